@@ -0,0 +1,46 @@
+// Command flvcut clips a time range out of an FLV file.
+//
+//	flvcut -start 60000 -end 90000 [-forward] [-preroll 100] in.flv out.flv
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"os"
+)
+
+func main() {
+	start := flag.Uint("start", 0, "start of the range, ms")
+	end := flag.Uint("end", 0, "end of the range, ms (0 means end of file)")
+	forward := flag.Bool("forward", false, "snap the start to the following keyframe")
+	preroll := flag.Uint("preroll", 0, "audio preroll kept before the start keyframe, ms")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] in.flv out.flv\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	inFile, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer inFile.Close()
+
+	outFile, err := os.Create(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer outFile.Close()
+
+	opts := flv.CutOptions{SnapForward: *forward, AudioPreroll: uint32(*preroll)}
+	err = flv.CutWithOptions(flv.NewReader(inFile), flv.NewWriter(outFile), uint32(*start), uint32(*end), opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,64 @@
+// Command flvdemux extracts the audio and video tracks of an FLV file into
+// elementary stream files named after the output base and the codec, e.g.
+// out.h264 and out.aac.
+//
+//	flvdemux [-video=false] [-audio=false] in.flv [outbase]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	video := flag.Bool("video", true, "extract the video track")
+	audio := flag.Bool("audio", true, "extract the audio track")
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] in.flv [outbase]\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	inName := flag.Arg(0)
+	base := strings.TrimSuffix(inName, filepath.Ext(inName))
+	if flag.NArg() == 2 {
+		base = flag.Arg(1)
+	}
+
+	inFile, err := os.Open(inName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer inFile.Close()
+
+	reader := flv.NewReader(inFile)
+	if _, err = reader.ReadHeader(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	create := func(ext string) (io.WriteCloser, error) {
+		fmt.Printf("writing %s\n", base+ext)
+		return os.Create(base + ext)
+	}
+	d := &flv.Demuxer{Unsupported: func(err error) {
+		fmt.Fprintf(os.Stderr, "skipping track: %s\n", err)
+	}}
+	if *video {
+		d.CreateVideo = create
+	}
+	if *audio {
+		d.CreateAudio = create
+	}
+	if err = d.Demux(reader); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
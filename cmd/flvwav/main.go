@@ -0,0 +1,91 @@
+// Command flvwav decodes the PCM, G.711 or ADPCM audio of an FLV file into
+// a 16 bit WAV file, named after the input unless given.
+//
+//	flvwav in.flv [out.wav]
+package main
+
+import (
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) < 2 || len(os.Args) > 3 {
+		fmt.Fprintf(os.Stderr, "usage: %s in.flv [out.wav]\n", os.Args[0])
+		os.Exit(2)
+	}
+	inName := os.Args[1]
+	outName := strings.TrimSuffix(inName, filepath.Ext(inName)) + ".wav"
+	if len(os.Args) == 3 {
+		outName = os.Args[2]
+	}
+	if err := convert(inName, outName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func convert(inName, outName string) error {
+	inFile, err := os.Open(inName)
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	reader := flv.NewReader(inFile)
+	if _, err = reader.ReadHeader(); err != nil {
+		return err
+	}
+
+	var (
+		outFile *os.File
+		wav     *flv.WavWriter
+		first   flv.AudioFrame
+	)
+	for {
+		fr, rerr := reader.ReadFrame()
+		if rerr != nil {
+			return rerr
+		}
+		if fr == nil {
+			break
+		}
+		f, ok := fr.(flv.AudioFrame)
+		if !ok || len(f.Body) < 2 {
+			continue
+		}
+		if wav == nil {
+			if !flv.CanDecodeAudio(f.CodecId) {
+				return fmt.Errorf("%s audio can not be decoded", f.CodecId)
+			}
+			if outFile, err = os.Create(outName); err != nil {
+				return err
+			}
+			defer outFile.Close()
+			channels := uint16(1)
+			if f.Channels == flv.AUDIO_TYPE_STEREO {
+				channels = 2
+			}
+			wav = flv.NewWavWriter(outFile, flv.DecodedSampleRate(f), channels, 16)
+			first = f
+			fmt.Printf("writing %s: %s %d Hz %s\n", outName, f.CodecId, wav.SampleRate, f.Channels)
+		}
+		if f.CodecId != first.CodecId || f.Rate != first.Rate || f.Channels != first.Channels {
+			return fmt.Errorf("audio format changes at %d ms", f.Dts)
+		}
+		samples, err := flv.DecodeAudio(f)
+		if err != nil {
+			return fmt.Errorf("audio at %d ms: %s", f.Dts, err)
+		}
+		if err = wav.WriteSamples(samples); err != nil {
+			return err
+		}
+	}
+	if wav == nil {
+		return fmt.Errorf("no audio in %s", inName)
+	}
+	return wav.Close()
+}
@@ -0,0 +1,279 @@
+// Package dash packages FLV into MPEG-DASH fMP4 representations described by
+// an MPD.
+package dash
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/mp4"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultSegmentDuration = 4000
+
+type Options struct {
+	// Name is the base name of the MPD and segment files.
+	Name string
+	// SegmentDuration is the shortest segment in ms; video segments are
+	// cut at the first keyframe after it.
+	SegmentDuration uint32
+	// Dynamic writes a live MPD, rewritten after every segment. It turns
+	// static once the packager is closed.
+	Dynamic bool
+	// Window is the number of segments a dynamic MPD lists per
+	// representation; 0 lists all of them.
+	Window int
+}
+
+type Segment struct {
+	Number   int
+	Start    uint32 // ms
+	Duration uint32 // ms
+	Size     int
+}
+
+// Representation is a single track packaged as its own fMP4 stream.
+type Representation struct {
+	ID       string // "video" or "audio"
+	Track    *mp4.Track
+	Segments []Segment
+
+	fragmenter *mp4.Fragmenter
+}
+
+func (r *Representation) bandwidth() int {
+	var size, duration int
+	for _, s := range r.Segments {
+		size += s.Size
+		duration += int(s.Duration)
+	}
+	if duration == 0 {
+		return 0
+	}
+	return size * 8 * 1000 / duration
+}
+
+// Packager writes the representations and the MPD through Create.
+type Packager struct {
+	Options
+	Create func(name string) (io.WriteCloser, error)
+
+	// AvailabilityStartTime of a dynamic MPD; the time of the first
+	// segment if not set.
+	AvailabilityStartTime time.Time
+
+	Video *Representation
+	Audio *Representation
+
+	closed bool
+}
+
+func (p *Packager) name() string {
+	if p.Name == "" {
+		return "stream"
+	}
+	return p.Name
+}
+
+func (p *Packager) segmentDuration() uint32 {
+	if p.SegmentDuration == 0 {
+		return defaultSegmentDuration
+	}
+	return p.SegmentDuration
+}
+
+func (p *Packager) representations() (reps []*Representation) {
+	for _, r := range []*Representation{p.Video, p.Audio} {
+		if r != nil && r.Track != nil {
+			reps = append(reps, r)
+		}
+	}
+	return
+}
+
+func (p *Packager) newRepresentation(id string) *Representation {
+	r := &Representation{ID: id}
+	r.fragmenter = &mp4.Fragmenter{
+		SkipVideo:   id == "audio",
+		SkipAudio:   id == "video",
+		MinDuration: p.segmentDuration(),
+		WriteInit: func(init []byte, tracks []*mp4.Track) error {
+			if r.Track != nil {
+				return fmt.Errorf("dash: %s codec configuration changes mid-stream", id)
+			}
+			r.Track = tracks[0]
+			return p.writeFile(fmt.Sprintf("%s-%s-init.mp4", p.name(), id), init)
+		},
+		WriteFragment: func(frag *mp4.Fragment) error {
+			s := Segment{Number: len(r.Segments) + 1, Start: frag.Start, Duration: frag.Duration, Size: len(frag.Data)}
+			if p.Dynamic && p.AvailabilityStartTime.IsZero() {
+				p.AvailabilityStartTime = time.Now().UTC()
+			}
+			if err := p.writeFile(fmt.Sprintf("%s-%s-%d.m4s", p.name(), id, s.Number), frag.Data); err != nil {
+				return err
+			}
+			r.Segments = append(r.Segments, s)
+			if p.Dynamic {
+				return p.writeMPD()
+			}
+			return nil
+		},
+	}
+	return r
+}
+
+func (p *Packager) writeFile(name string, data []byte) error {
+	w, err := p.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// WriteFrame adds a frame; script data is ignored.
+func (p *Packager) WriteFrame(fr flv.Frame) error {
+	switch fr.GetType() {
+	case flv.TAG_TYPE_VIDEO:
+		if p.Video == nil {
+			p.Video = p.newRepresentation("video")
+		}
+		return p.Video.fragmenter.WriteFrame(fr)
+	case flv.TAG_TYPE_AUDIO:
+		if p.Audio == nil {
+			p.Audio = p.newRepresentation("audio")
+		}
+		return p.Audio.fragmenter.WriteFrame(fr)
+	}
+	return nil
+}
+
+// Close writes the last segments and the final, static MPD.
+func (p *Packager) Close() error {
+	for _, r := range []*Representation{p.Video, p.Audio} {
+		if r != nil {
+			if err := r.fragmenter.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	p.closed = true
+	return p.writeMPD()
+}
+
+func (p *Packager) writeMPD() error {
+	return p.writeFile(p.name()+".mpd", p.MPD())
+}
+
+func duration(ms uint32) string {
+	return fmt.Sprintf("PT%.3fS", float64(ms)/1000)
+}
+
+// MPD renders the manifest: static once closed, dynamic before if
+// Options.Dynamic is set.
+func (p *Packager) MPD() []byte {
+	dynamic := p.Dynamic && !p.closed
+	var end uint32
+	for _, r := range p.representations() {
+		if n := len(r.Segments); n > 0 {
+			if e := r.Segments[n-1].Start + r.Segments[n-1].Duration; e > end {
+				end = e
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	b.WriteString("<MPD xmlns=\"urn:mpeg:dash:schema:mpd:2011\" profiles=\"urn:mpeg:dash:profile:isoff-live:2011\"")
+	if dynamic {
+		fmt.Fprintf(&b, " type=\"dynamic\" availabilityStartTime=\"%s\" publishTime=\"%s\" minimumUpdatePeriod=\"%s\"",
+			p.AvailabilityStartTime.Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339), duration(p.segmentDuration()))
+		if p.Window > 0 {
+			fmt.Fprintf(&b, " timeShiftBufferDepth=\"%s\"", duration(uint32(p.Window)*p.segmentDuration()))
+		}
+	} else {
+		fmt.Fprintf(&b, " type=\"static\" mediaPresentationDuration=\"%s\"", duration(end))
+	}
+	fmt.Fprintf(&b, " minBufferTime=\"%s\">\n", duration(p.segmentDuration()))
+	b.WriteString("  <Period id=\"0\" start=\"PT0S\">\n")
+
+	for _, r := range p.representations() {
+		segments := r.Segments
+		if dynamic && p.Window > 0 && len(segments) > p.Window {
+			segments = segments[len(segments)-p.Window:]
+		}
+		t := r.Track
+		if t.IsVideo() {
+			b.WriteString("    <AdaptationSet contentType=\"video\" mimeType=\"video/mp4\" segmentAlignment=\"true\" startWithSAP=\"1\">\n")
+		} else {
+			b.WriteString("    <AdaptationSet contentType=\"audio\" mimeType=\"audio/mp4\" segmentAlignment=\"true\" startWithSAP=\"1\">\n")
+		}
+		startNumber := 1
+		if len(segments) > 0 {
+			startNumber = segments[0].Number
+		}
+		fmt.Fprintf(&b, "      <SegmentTemplate timescale=\"1000\" initialization=\"%s-%s-init.mp4\" media=\"%s-%s-$Number$.m4s\" startNumber=\"%d\">\n",
+			p.name(), r.ID, p.name(), r.ID, startNumber)
+		b.WriteString("        <SegmentTimeline>\n")
+		for i := 0; i < len(segments); {
+			s, repeat := segments[i], 0
+			for i+repeat+1 < len(segments) && segments[i+repeat+1].Duration == s.Duration &&
+				segments[i+repeat+1].Start == segments[i+repeat].Start+s.Duration {
+				repeat++
+			}
+			if repeat > 0 {
+				fmt.Fprintf(&b, "          <S t=\"%d\" d=\"%d\" r=\"%d\"/>\n", s.Start, s.Duration, repeat)
+			} else {
+				fmt.Fprintf(&b, "          <S t=\"%d\" d=\"%d\"/>\n", s.Start, s.Duration)
+			}
+			i += repeat + 1
+		}
+		b.WriteString("        </SegmentTimeline>\n")
+		b.WriteString("      </SegmentTemplate>\n")
+		if t.IsVideo() {
+			fmt.Fprintf(&b, "      <Representation id=\"%s\" codecs=\"%s\" bandwidth=\"%d\" width=\"%d\" height=\"%d\"/>\n",
+				r.ID, t.Codec(), r.bandwidth(), t.Width, t.Height)
+		} else {
+			fmt.Fprintf(&b, "      <Representation id=\"%s\" codecs=\"%s\" bandwidth=\"%d\" audioSamplingRate=\"%d\">\n",
+				r.ID, t.Codec(), r.bandwidth(), t.SampleRate)
+			fmt.Fprintf(&b, "        <AudioChannelConfiguration schemeIdUri=\"urn:mpeg:dash:23003:3:audio_channel_configuration:2011\" value=\"%d\"/>\n", t.Channels)
+			b.WriteString("      </Representation>\n")
+		}
+		b.WriteString("    </AdaptationSet>\n")
+	}
+	b.WriteString("  </Period>\n</MPD>\n")
+	return b.Bytes()
+}
+
+// PackageFile packages an FLV file into dir.
+func PackageFile(in *flv.FlvReader, dir string, opts Options) error {
+	p := &Packager{
+		Options: opts,
+		Create: func(name string) (io.WriteCloser, error) {
+			return os.Create(filepath.Join(dir, name))
+		},
+	}
+	if _, err := in.ReadHeader(); err != nil {
+		return err
+	}
+	for {
+		fr, rerr := in.ReadFrame()
+		if rerr != nil {
+			return rerr
+		}
+		if fr == nil {
+			break
+		}
+		if err := p.WriteFrame(fr); err != nil {
+			return err
+		}
+	}
+	return p.Close()
+}
@@ -0,0 +1,105 @@
+package dash
+
+import (
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/internal/flvtest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFrames is 10 seconds of flvtest.Frames with High profile video and
+// HE-AAC audio.
+func testFrames() []flv.Frame {
+	frames := flvtest.Frames(10000)
+	frames[0] = flvtest.Video(0, true, flv.VIDEO_AVC_SEQUENCE_HEADER, 0, flvtest.HighAVCConf)
+	frames[1] = flvtest.Audio(0, flv.AUDIO_AAC_SEQUENCE_HEADER, []byte{0x2B, 0x90})
+	return frames
+}
+
+// testPackager returns a packager writing to the files it returns.
+func testPackager(opts Options) (*Packager, flvtest.Files) {
+	files := flvtest.Files{}
+	return &Packager{Options: opts, Create: files.Create}, files
+}
+
+func TestPackagerStatic(t *testing.T) {
+	p, files := testPackager(Options{SegmentDuration: 2000})
+	for _, fr := range testFrames() {
+		if err := p.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"stream-video-init.mp4", "stream-audio-init.mp4", "stream-video-5.m4s", "stream-audio-5.m4s"} {
+		if files[name] == nil || files[name].Len() == 0 {
+			t.Errorf("expect %s", name)
+		}
+	}
+	mpd := files["stream.mpd"].String()
+	for _, want := range []string{
+		`type="static" mediaPresentationDuration="PT10.000S"`,
+		`media="stream-video-$Number$.m4s" startNumber="1"`,
+		`<S t="0" d="2000" r="4"/>`,
+		`codecs="avc1.64001f"`,
+		`width="640" height="360"`,
+		`codecs="mp4a.40.5"`,
+		`value="2"`,
+	} {
+		if !strings.Contains(mpd, want) {
+			t.Errorf("expect %s in MPD\n%s", want, mpd)
+		}
+	}
+}
+
+func TestPackagerDynamic(t *testing.T) {
+	p, files := testPackager(Options{SegmentDuration: 2000, Dynamic: true, Window: 2})
+	p.AvailabilityStartTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, fr := range testFrames()[:600] {
+		if err := p.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mpd := files["stream.mpd"].String()
+	for _, want := range []string{
+		`type="dynamic" availabilityStartTime="2020-01-02T03:04:05Z"`,
+		`timeShiftBufferDepth="PT4.000S"`,
+		`media="stream-video-$Number$.m4s" startNumber="2"`,
+		`<S t="2000" d="2000" r="1"/>`,
+	} {
+		if !strings.Contains(mpd, want) {
+			t.Errorf("expect %s in MPD\n%s", want, mpd)
+		}
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if mpd = files["stream.mpd"].String(); !strings.Contains(mpd, `type="static"`) || !strings.Contains(mpd, `<S t="0" d="2000" r="2"/>`) {
+		t.Errorf("expect a static MPD listing all segments\n%s", mpd)
+	}
+}
+
+func TestPackagerAvailabilityStartTime(t *testing.T) {
+	p, files := testPackager(Options{SegmentDuration: 2000, Dynamic: true})
+	p.MPD()
+	if !p.AvailabilityStartTime.IsZero() {
+		t.Errorf("expect MPD to leave AvailabilityStartTime alone got %s", p.AvailabilityStartTime)
+	}
+	before := time.Now().UTC().Truncate(time.Second)
+	for _, fr := range testFrames()[:200] {
+		if err := p.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := p.AvailabilityStartTime
+	if start.Before(before) || start.After(time.Now()) {
+		t.Fatalf("expect AvailabilityStartTime set by the first segment got %s", start)
+	}
+	if mpd := files["stream.mpd"].String(); !strings.Contains(mpd, `availabilityStartTime="`+start.Format(time.RFC3339)+`"`) {
+		t.Errorf("expect availabilityStartTime %s in MPD\n%s", start.Format(time.RFC3339), mpd)
+	}
+}
@@ -0,0 +1,157 @@
+package flv
+
+import (
+	"fmt"
+)
+
+type AACObjectType byte
+
+const (
+	AAC_OBJECT_MAIN AACObjectType = 1
+	AAC_OBJECT_LC   AACObjectType = 2
+	AAC_OBJECT_SSR  AACObjectType = 3
+	AAC_OBJECT_LTP  AACObjectType = 4
+	AAC_OBJECT_SBR  AACObjectType = 5
+	AAC_OBJECT_PS   AACObjectType = 29
+)
+
+var (
+	aacSampleRates = []uint32{
+		96000, 88200, 64000, 48000, 44100, 32000,
+		24000, 22050, 16000, 12000, 11025, 8000, 7350,
+	}
+)
+
+// AudioSpecificConfig is the AAC decoder configuration carried by the AAC
+// sequence header (ISO/IEC 14496-3 1.6.2.1).
+type AudioSpecificConfig struct {
+	ObjectType             AACObjectType
+	SamplingFrequencyIndex byte
+	SampleRate             uint32
+	ChannelConfiguration   byte
+	Raw                    []byte
+}
+
+func (c *AudioSpecificConfig) String() string {
+	return fmt.Sprintf("AudioSpecificConfig(object type: %d, rate: %d, channels: %d)",
+		c.ObjectType, c.SampleRate, c.ChannelConfiguration)
+}
+
+func ParseAudioSpecificConfig(data []byte) (cfg *AudioSpecificConfig, err error) {
+	r := NewBitReader(data)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = rec.(error)
+		}
+	}()
+
+	objectType := r.U(5)
+	if objectType == 31 {
+		objectType = 32 + r.U(6)
+	}
+
+	freqIndex := r.U(4)
+	var rate uint32
+	if freqIndex == 15 {
+		rate = r.U(24)
+		freqIndex = uint32(aacSampleRateIndex(rate))
+	} else if int(freqIndex) < len(aacSampleRates) {
+		rate = aacSampleRates[freqIndex]
+	} else {
+		return nil, fmt.Errorf("invalid AAC sampling frequency index %d", freqIndex)
+	}
+
+	channels := r.U(4)
+
+	cfg = &AudioSpecificConfig{
+		ObjectType:             AACObjectType(objectType),
+		SamplingFrequencyIndex: byte(freqIndex),
+		SampleRate:             rate,
+		ChannelConfiguration:   byte(channels),
+		Raw:                    data,
+	}
+	return
+}
+
+// Bytes serializes the config as carried in the AAC sequence header.
+func (c *AudioSpecificConfig) Bytes() []byte {
+	if len(c.Raw) > 0 {
+		return c.Raw
+	}
+	v := uint16(c.ObjectType)<<11 | uint16(c.SamplingFrequencyIndex)<<7 | uint16(c.ChannelConfiguration)<<3
+	return []byte{byte(v >> 8), byte(v)}
+}
+
+// Codec returns the RFC 6381 codecs parameter, e.g. "mp4a.40.2".
+func (c *AudioSpecificConfig) Codec() string {
+	return fmt.Sprintf("mp4a.40.%d", c.ObjectType)
+}
+
+// ParseADTSHeader parses the ADTS header at the start of data and returns the
+// equivalent AudioSpecificConfig, the header length (7, or 9 with CRC) and
+// the length of the whole frame including the header.
+func ParseADTSHeader(data []byte) (cfg *AudioSpecificConfig, headerLength, frameLength int, err error) {
+	if len(data) < 7 {
+		return nil, 0, 0, fmt.Errorf("ADTS header too short: %d bytes", len(data))
+	}
+	if data[0] != 0xFF || data[1]&0xF0 != 0xF0 {
+		return nil, 0, 0, fmt.Errorf("bad ADTS syncword %02x%02x", data[0], data[1])
+	}
+	headerLength = 7
+	if data[1]&0x01 == 0 {
+		headerLength = 9
+	}
+	freqIndex := (data[2] >> 2) & 0x0F
+	if int(freqIndex) >= len(aacSampleRates) {
+		return nil, 0, 0, fmt.Errorf("invalid AAC sampling frequency index %d", freqIndex)
+	}
+	frameLength = int(data[3]&0x03)<<11 | int(data[4])<<3 | int(data[5]>>5)
+	if frameLength < headerLength {
+		return nil, 0, 0, fmt.Errorf("bad ADTS frame length %d", frameLength)
+	}
+	cfg = &AudioSpecificConfig{
+		ObjectType:             AACObjectType(data[2]>>6) + 1,
+		SamplingFrequencyIndex: freqIndex,
+		SampleRate:             aacSampleRates[freqIndex],
+		ChannelConfiguration:   (data[2]&0x01)<<2 | data[3]>>6,
+	}
+	return cfg, headerLength, frameLength, nil
+}
+
+// aacSampleRateIndex returns the index of the closest standard sample rate.
+func aacSampleRateIndex(rate uint32) byte {
+	best := 0
+	for i, r := range aacSampleRates {
+		if absDiff(r, rate) < absDiff(aacSampleRates[best], rate) {
+			best = i
+		}
+	}
+	return byte(best)
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// ADTSHeader builds the 7 byte ADTS header (without CRC) for a raw AAC
+// frame of payloadLength bytes.
+func (c *AudioSpecificConfig) ADTSHeader(payloadLength int) []byte {
+	frameLength := payloadLength + 7
+	profile := byte(c.ObjectType) - 1
+	if c.ObjectType == 0 || c.ObjectType > 4 {
+		profile = byte(AAC_OBJECT_LC) - 1
+	}
+	return []byte{
+		0xFF,
+		0xF1, // MPEG-4, layer 0, no CRC
+		profile<<6 | (c.SamplingFrequencyIndex&0x0F)<<2 | (c.ChannelConfiguration>>2)&0x01,
+		(c.ChannelConfiguration&0x03)<<6 | byte(frameLength>>11)&0x03,
+		byte(frameLength >> 3),
+		byte(frameLength&0x07)<<5 | 0x1F, // buffer fullness 0x7FF
+		0xFC,
+	}
+}
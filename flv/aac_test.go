@@ -0,0 +1,25 @@
+package flv
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseAudioSpecificConfig(t *testing.T) {
+	cfg, err := ParseAudioSpecificConfig([]byte{0x12, 0x10})
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if cfg.ObjectType != AAC_OBJECT_LC || cfg.SampleRate != 44100 || cfg.ChannelConfiguration != 2 {
+		t.Errorf("unexpected %s", cfg)
+	}
+
+	expect := []byte{0xFF, 0xF1, 0x50, 0x80, 0x0D, 0x7F, 0xFC}
+	if got := cfg.ADTSHeader(100); !bytes.Equal(expect, got) {
+		t.Errorf("expect %x got %x", expect, got)
+	}
+
+	if _, err := ParseAudioSpecificConfig([]byte{0x12}); err == nil {
+		t.Errorf("expect error on truncated config")
+	}
+}
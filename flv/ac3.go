@@ -0,0 +1,99 @@
+package flv
+
+import (
+	"fmt"
+)
+
+var (
+	ac3SampleRates = []uint32{48000, 44100, 32000}
+	ac3Channels    = []byte{2, 1, 2, 3, 3, 4, 4, 5} // by acmod
+)
+
+// AC3SyncInfo describes the stream of an AC-3 or E-AC-3 syncframe.
+type AC3SyncInfo struct {
+	EAC3       bool
+	Bsid       byte
+	SampleRate uint32
+	Acmod      byte
+	LFE        bool
+	Channels   byte // including the LFE channel
+}
+
+func (si *AC3SyncInfo) String() string {
+	codec := "AC-3"
+	if si.EAC3 {
+		codec = "E-AC-3"
+	}
+	return fmt.Sprintf("%s(bsid: %d, rate: %d, channels: %d)", codec, si.Bsid, si.SampleRate, si.Channels)
+}
+
+// ParseAC3SyncInfo parses the syncinfo and the leading bit stream
+// information of the AC-3 (ETSI TS 102 366 4.3) or E-AC-3 (annex E)
+// syncframe data starts with.
+func ParseAC3SyncInfo(data []byte) (ret *AC3SyncInfo, err error) {
+	if len(data) < 6 {
+		return nil, fmt.Errorf("AC-3 syncframe of %d bytes", len(data))
+	}
+	r := NewBitReader(data)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = rec.(error)
+		}
+	}()
+
+	syncword := r.U(16)
+	if syncword != 0x0B77 {
+		err = fmt.Errorf("Not AC-3 syncframe, syncword = %04x", syncword)
+		return
+	}
+	// bsid is 40 bits into both headers, after the syncword and 24 bits of
+	// syncinfo or E-AC-3 fields
+	bsid := byte(data[5] >> 3)
+	si := &AC3SyncInfo{Bsid: bsid, EAC3: bsid > 10}
+	if !si.EAC3 {
+		r.U(16) /* crc1 */
+		fscod := r.U(2)
+		if fscod == 3 {
+			err = fmt.Errorf("reserved AC-3 fscod")
+			return
+		}
+		si.SampleRate = ac3SampleRates[fscod]
+		r.U(6) /* frmsizecod */
+		r.U(5) /* bsid */
+		r.U(3) /* bsmod */
+		si.Acmod = byte(r.U(3))
+		if si.Acmod&1 != 0 && si.Acmod != 1 {
+			r.U(2) /* cmixlev */
+		}
+		if si.Acmod&4 != 0 {
+			r.U(2) /* surmixlev */
+		}
+		if si.Acmod == 2 {
+			r.U(2) /* dsurmod */
+		}
+	} else {
+		r.U(2)  /* strmtyp */
+		r.U(3)  /* substreamid */
+		r.U(11) /* frmsiz */
+		fscod := r.U(2)
+		if fscod == 3 {
+			fscod2 := r.U(2)
+			if fscod2 == 3 {
+				err = fmt.Errorf("reserved E-AC-3 fscod2")
+				return
+			}
+			si.SampleRate = ac3SampleRates[fscod2] / 2
+		} else {
+			si.SampleRate = ac3SampleRates[fscod]
+			r.U(2) /* numblkscod */
+		}
+		si.Acmod = byte(r.U(3))
+	}
+	si.LFE = r.U(1) != 0
+	si.Channels = ac3Channels[si.Acmod]
+	if si.LFE {
+		si.Channels++
+	}
+	return si, nil
+}
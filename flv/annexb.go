@@ -0,0 +1,105 @@
+package flv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+type NALUType byte
+
+const (
+	NALU_TYPE_SLICE NALUType = 1
+	NALU_TYPE_IDR   NALUType = 5
+	NALU_TYPE_SEI   NALUType = 6
+	NALU_TYPE_SPS   NALUType = 7
+	NALU_TYPE_PPS   NALUType = 8
+	NALU_TYPE_AUD   NALUType = 9
+)
+
+var (
+	annexBStartCode = []byte{0, 0, 0, 1}
+)
+
+// NALUTypeOf returns the type of an H.264 NAL unit.
+func NALUTypeOf(nalu []byte) NALUType {
+	if len(nalu) == 0 {
+		return 0
+	}
+	return NALUType(nalu[0] & 0x1F)
+}
+
+// SplitAVCC splits length-prefixed NAL units as carried in FLV and MP4.
+func SplitAVCC(data []byte, lengthSize int) (nalus [][]byte, err error) {
+	for len(data) > 0 {
+		if len(data) < lengthSize {
+			return nil, fmt.Errorf("truncated NALU length: %d bytes left", len(data))
+		}
+		n := 0
+		for _, b := range data[:lengthSize] {
+			n = n<<8 | int(b)
+		}
+		data = data[lengthSize:]
+		if n > len(data) {
+			return nil, fmt.Errorf("NALU length %d exceeds %d bytes left", n, len(data))
+		}
+		nalus = append(nalus, data[:n])
+		data = data[n:]
+	}
+	return nalus, nil
+}
+
+// WriteAnnexB writes the NAL units each prefixed with a start code.
+func WriteAnnexB(w io.Writer, nalus [][]byte) error {
+	for _, nalu := range nalus {
+		if _, err := w.Write(annexBStartCode); err != nil {
+			return err
+		}
+		if _, err := w.Write(nalu); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SplitAnnexB splits a byte stream into NAL units separated by 3 or 4 byte
+// start codes.
+func SplitAnnexB(data []byte) (nalus [][]byte) {
+	for len(data) > 0 {
+		advance, nalu, _ := ScanAnnexB(data, true)
+		if advance == 0 {
+			break
+		}
+		if nalu != nil {
+			nalus = append(nalus, nalu)
+		}
+		data = data[advance:]
+	}
+	return nalus
+}
+
+// ScanAnnexB is a bufio.SplitFunc returning the NAL units of an Annex B
+// byte stream without their start codes.
+func ScanAnnexB(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := bytes.Index(data, annexBStartCode[1:])
+	if start == -1 {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		if len(data) > 3 {
+			// drop leading garbage, keeping a possible partial start code
+			return len(data) - 3, nil, nil
+		}
+		return 0, nil, nil
+	}
+	begin := start + 3
+	next := bytes.Index(data[begin:], annexBStartCode[1:])
+	if next == -1 {
+		if !atEOF {
+			return start, nil, nil
+		}
+		return len(data), bytes.TrimRight(data[begin:], "\x00"), nil
+	}
+	next += begin
+	return next, bytes.TrimRight(data[begin:next], "\x00"), nil
+}
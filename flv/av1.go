@@ -0,0 +1,378 @@
+package flv
+
+import (
+	"fmt"
+)
+
+const (
+	AV1_OBU_SEQUENCE_HEADER        = 1
+	AV1_OBU_TEMPORAL_DELIMITER     = 2
+	AV1_OBU_FRAME_HEADER           = 3
+	AV1_OBU_TILE_GROUP             = 4
+	AV1_OBU_METADATA               = 5
+	AV1_OBU_FRAME                  = 6
+	AV1_OBU_REDUNDANT_FRAME_HEADER = 7
+	AV1_OBU_TILE_LIST              = 8
+	AV1_OBU_PADDING                = 15
+)
+
+// AV1ConfRecord is the AV1CodecConfigurationRecord carried by av01
+// sequence starts.
+type AV1ConfRecord struct {
+	Version                          byte
+	SeqProfile                       byte
+	SeqLevelIdx0                     byte
+	SeqTier0                         byte
+	HighBitdepth                     bool
+	TwelveBit                        bool
+	Monochrome                       bool
+	ChromaSubsamplingX               byte
+	ChromaSubsamplingY               byte
+	ChromaSamplePosition             byte
+	InitialPresentationDelayPresent  bool
+	InitialPresentationDelayMinusOne byte
+	ConfigOBUs                       []byte
+}
+
+func (r *AV1ConfRecord) String() string {
+	return fmt.Sprintf("AV1CodecConfigurationRecord(ver. %d, profile: %d, level: %d, %d bit, %d bytes of OBUs)",
+		r.Version, r.SeqProfile, r.SeqLevelIdx0, r.BitDepth(), len(r.ConfigOBUs))
+}
+
+func ParseAV1ConfRecord(data []byte) (rec *AV1ConfRecord, err error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("AV1CodecConfigurationRecord of %d bytes", len(data))
+	}
+	if data[0]&0x80 == 0 {
+		return nil, fmt.Errorf("AV1CodecConfigurationRecord marker not set")
+	}
+	rec = &AV1ConfRecord{
+		Version:                         data[0] & 0x7F,
+		SeqProfile:                      data[1] >> 5,
+		SeqLevelIdx0:                    data[1] & 0x1F,
+		SeqTier0:                        data[2] >> 7,
+		HighBitdepth:                    data[2]&0x40 != 0,
+		TwelveBit:                       data[2]&0x20 != 0,
+		Monochrome:                      data[2]&0x10 != 0,
+		ChromaSubsamplingX:              data[2] >> 3 & 1,
+		ChromaSubsamplingY:              data[2] >> 2 & 1,
+		ChromaSamplePosition:            data[2] & 3,
+		InitialPresentationDelayPresent: data[3]&0x10 != 0,
+		ConfigOBUs:                      data[4:],
+	}
+	if rec.InitialPresentationDelayPresent {
+		rec.InitialPresentationDelayMinusOne = data[3] & 0x0F
+	}
+	return rec, nil
+}
+
+// Bytes serializes the record as an AV1CodecConfigurationRecord.
+func (r *AV1ConfRecord) Bytes() []byte {
+	flags := r.SeqTier0<<7 | r.ChromaSubsamplingX<<3 | r.ChromaSubsamplingY<<2 | r.ChromaSamplePosition
+	for i, f := range []bool{r.HighBitdepth, r.TwelveBit, r.Monochrome} {
+		if f {
+			flags |= 0x40 >> uint(i)
+		}
+	}
+	delay := byte(0)
+	if r.InitialPresentationDelayPresent {
+		delay = 0x10 | r.InitialPresentationDelayMinusOne&0x0F
+	}
+	return append([]byte{0x80 | r.Version, r.SeqProfile<<5 | r.SeqLevelIdx0&0x1F, flags, delay}, r.ConfigOBUs...)
+}
+
+func (r *AV1ConfRecord) BitDepth() int {
+	switch {
+	case r.TwelveBit:
+		return 12
+	case r.HighBitdepth:
+		return 10
+	}
+	return 8
+}
+
+// Codec returns the RFC 6381 codecs parameter, e.g. "av01.0.04M.08".
+func (r *AV1ConfRecord) Codec() string {
+	tier := "M"
+	if r.SeqTier0 != 0 {
+		tier = "H"
+	}
+	return fmt.Sprintf("av01.%d.%02d%s.%02d", r.SeqProfile, r.SeqLevelIdx0, tier, r.BitDepth())
+}
+
+// SequenceHeader parses the sequence header OBU of the configuration OBUs.
+func (r *AV1ConfRecord) SequenceHeader() (*AV1SequenceHeader, error) {
+	for data := r.ConfigOBUs; len(data) > 0; {
+		obuType, payload, rest, err := SplitOBU(data)
+		if err != nil {
+			return nil, err
+		}
+		if obuType == AV1_OBU_SEQUENCE_HEADER {
+			return ParseAV1SequenceHeader(payload)
+		}
+		data = rest
+	}
+	return nil, fmt.Errorf("no AV1 sequence header OBU")
+}
+
+func readLeb128(data []byte) (v uint64, n int, err error) {
+	for n < len(data) && n < 8 {
+		b := data[n]
+		v |= uint64(b&0x7F) << (7 * uint(n))
+		n++
+		if b&0x80 == 0 {
+			return v, n, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("truncated leb128")
+}
+
+// SplitOBU returns the type and payload of the first OBU of data and the
+// data following it; an OBU without a size field takes up all of data.
+func SplitOBU(data []byte) (obuType byte, payload, rest []byte, err error) {
+	if len(data) < 1 {
+		return 0, nil, nil, fmt.Errorf("empty OBU")
+	}
+	obuType = data[0] >> 3 & 0x0F
+	header := 1
+	if data[0]&0x04 != 0 { // obu_extension_flag
+		header++
+	}
+	if header > len(data) {
+		return 0, nil, nil, fmt.Errorf("truncated OBU header")
+	}
+	if data[0]&0x02 == 0 { // obu_has_size_field
+		return obuType, data[header:], nil, nil
+	}
+	size, n, err := readLeb128(data[header:])
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	start := header + n
+	if uint64(len(data)-start) < size {
+		return 0, nil, nil, fmt.Errorf("OBU of %d bytes in %d", size, len(data)-start)
+	}
+	return obuType, data[start : start+int(size)], data[start+int(size):], nil
+}
+
+// AV1SequenceHeader holds the fields of a sequence_header_obu needed to
+// describe the stream.
+type AV1SequenceHeader struct {
+	SeqProfile                byte
+	StillPicture              bool
+	ReducedStillPictureHeader bool
+	SeqLevelIdx               byte // of the first operating point
+	SeqTier                   byte
+	MaxFrameWidth             uint32
+	MaxFrameHeight            uint32
+
+	BitDepth                byte
+	Monochrome              bool
+	SubsamplingX            byte
+	SubsamplingY            byte
+	ColorPrimaries          byte
+	TransferCharacteristics byte
+	MatrixCoefficients      byte
+	ColorRange              bool // full range
+	FilmGrainParamsPresent  bool
+
+	// timing info, 0 if absent
+	NumUnitsInDisplayTick uint32
+	TimeScale             uint32
+}
+
+func (sh *AV1SequenceHeader) Width() uint32 {
+	return sh.MaxFrameWidth
+}
+
+func (sh *AV1SequenceHeader) Height() uint32 {
+	return sh.MaxFrameHeight
+}
+
+// HDR reports whether the transfer characteristics are PQ or HLG.
+func (sh *AV1SequenceHeader) HDR() bool {
+	return sh.TransferCharacteristics == 16 || sh.TransferCharacteristics == 18
+}
+
+func (sh *AV1SequenceHeader) String() string {
+	return fmt.Sprintf("sequence_header_obu(profile: %d, level: %d, %dx%d, %d bit)",
+		sh.SeqProfile, sh.SeqLevelIdx, sh.MaxFrameWidth, sh.MaxFrameHeight, sh.BitDepth)
+}
+
+func av1Uvlc(r *BitReader) uint32 {
+	leadingZeros := uint32(0)
+	for r.U(1) == 0 {
+		leadingZeros++
+		if leadingZeros >= 32 {
+			return 0xFFFFFFFF
+		}
+	}
+	if leadingZeros == 0 {
+		return 0
+	}
+	return 1<<leadingZeros - 1 + r.U(leadingZeros)
+}
+
+// ParseAV1SequenceHeader parses the payload of a sequence header OBU.
+func ParseAV1SequenceHeader(payload []byte) (ret *AV1SequenceHeader, err error) {
+	r := NewBitReader(payload)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = rec.(error)
+		}
+	}()
+
+	sh := &AV1SequenceHeader{ColorPrimaries: 2, TransferCharacteristics: 2, MatrixCoefficients: 2}
+	sh.SeqProfile = byte(r.U(3))
+	sh.StillPicture = r.U(1) != 0
+	sh.ReducedStillPictureHeader = r.U(1) != 0
+	if sh.ReducedStillPictureHeader {
+		sh.SeqLevelIdx = byte(r.U(5))
+	} else {
+		decoder_model_info_present_flag := uint32(0)
+		buffer_delay_length := uint32(0)
+		timing_info_present_flag := r.U(1)
+		if timing_info_present_flag != 0 {
+			sh.NumUnitsInDisplayTick = r.U(16)<<16 | r.U(16)
+			sh.TimeScale = r.U(16)<<16 | r.U(16)
+			equal_picture_interval := r.U(1)
+			if equal_picture_interval != 0 {
+				av1Uvlc(r) /* num_ticks_per_picture_minus_1 */
+			}
+			decoder_model_info_present_flag = r.U(1)
+			if decoder_model_info_present_flag != 0 {
+				buffer_delay_length = r.U(5) + 1
+				r.U(16) /* num_units_in_decoding_tick */
+				r.U(16)
+				r.U(5) /* buffer_removal_time_length_minus_1 */
+				r.U(5) /* frame_presentation_time_length_minus_1 */
+			}
+		}
+		initial_display_delay_present_flag := r.U(1)
+		operating_points_cnt := r.U(5) + 1
+		for i := uint32(0); i < operating_points_cnt; i++ {
+			r.U(12) /* operating_point_idc */
+			seq_level_idx := byte(r.U(5))
+			seq_tier := byte(0)
+			if seq_level_idx > 7 {
+				seq_tier = byte(r.U(1))
+			}
+			if i == 0 {
+				sh.SeqLevelIdx, sh.SeqTier = seq_level_idx, seq_tier
+			}
+			if decoder_model_info_present_flag != 0 {
+				decoder_model_present_for_this_op := r.U(1)
+				if decoder_model_present_for_this_op != 0 {
+					r.U(buffer_delay_length) /* decoder_buffer_delay */
+					r.U(buffer_delay_length) /* encoder_buffer_delay */
+					r.U(1)                   /* low_delay_mode_flag */
+				}
+			}
+			if initial_display_delay_present_flag != 0 {
+				initial_display_delay_present_for_this_op := r.U(1)
+				if initial_display_delay_present_for_this_op != 0 {
+					r.U(4) /* initial_display_delay_minus_1 */
+				}
+			}
+		}
+	}
+
+	frame_width_bits := r.U(4) + 1
+	frame_height_bits := r.U(4) + 1
+	sh.MaxFrameWidth = r.U(frame_width_bits) + 1
+	sh.MaxFrameHeight = r.U(frame_height_bits) + 1
+	frame_id_numbers_present_flag := uint32(0)
+	if !sh.ReducedStillPictureHeader {
+		frame_id_numbers_present_flag = r.U(1)
+	}
+	if frame_id_numbers_present_flag != 0 {
+		r.U(4) /* delta_frame_id_length_minus_2 */
+		r.U(3) /* additional_frame_id_length_minus_1 */
+	}
+	r.U(1) /* use_128x128_superblock */
+	r.U(1) /* enable_filter_intra */
+	r.U(1) /* enable_intra_edge_filter */
+	if !sh.ReducedStillPictureHeader {
+		r.U(1) /* enable_interintra_compound */
+		r.U(1) /* enable_masked_compound */
+		r.U(1) /* enable_warped_motion */
+		r.U(1) /* enable_dual_filter */
+		enable_order_hint := r.U(1)
+		if enable_order_hint != 0 {
+			r.U(1) /* enable_jnt_comp */
+			r.U(1) /* enable_ref_frame_mvs */
+		}
+		seq_force_screen_content_tools := uint32(2) // SELECT_SCREEN_CONTENT_TOOLS
+		seq_choose_screen_content_tools := r.U(1)
+		if seq_choose_screen_content_tools == 0 {
+			seq_force_screen_content_tools = r.U(1)
+		}
+		if seq_force_screen_content_tools > 0 {
+			seq_choose_integer_mv := r.U(1)
+			if seq_choose_integer_mv == 0 {
+				r.U(1) /* seq_force_integer_mv */
+			}
+		}
+		if enable_order_hint != 0 {
+			r.U(3) /* order_hint_bits_minus_1 */
+		}
+	}
+	r.U(1) /* enable_superres */
+	r.U(1) /* enable_cdef */
+	r.U(1) /* enable_restoration */
+
+	parseAV1ColorConfig(r, sh)
+	sh.FilmGrainParamsPresent = r.U(1) != 0
+	return sh, nil
+}
+
+func parseAV1ColorConfig(r *BitReader, sh *AV1SequenceHeader) {
+	sh.BitDepth = 8
+	high_bitdepth := r.U(1)
+	if high_bitdepth != 0 {
+		sh.BitDepth = 10
+		if sh.SeqProfile == 2 {
+			twelve_bit := r.U(1)
+			if twelve_bit != 0 {
+				sh.BitDepth = 12
+			}
+		}
+	}
+	if sh.SeqProfile != 1 {
+		sh.Monochrome = r.U(1) != 0
+	}
+	color_description_present_flag := r.U(1)
+	if color_description_present_flag != 0 {
+		sh.ColorPrimaries = r.U8()
+		sh.TransferCharacteristics = r.U8()
+		sh.MatrixCoefficients = r.U8()
+	}
+	switch {
+	case sh.Monochrome:
+		sh.ColorRange = r.U(1) != 0
+		sh.SubsamplingX, sh.SubsamplingY = 1, 1
+		return
+	case sh.ColorPrimaries == 1 && sh.TransferCharacteristics == 13 && sh.MatrixCoefficients == 0:
+		// sRGB
+		sh.ColorRange = true
+	default:
+		sh.ColorRange = r.U(1) != 0
+		switch {
+		case sh.SeqProfile == 0:
+			sh.SubsamplingX, sh.SubsamplingY = 1, 1
+		case sh.SeqProfile == 1:
+		case sh.BitDepth == 12:
+			sh.SubsamplingX = byte(r.U(1))
+			if sh.SubsamplingX != 0 {
+				sh.SubsamplingY = byte(r.U(1))
+			}
+		default:
+			sh.SubsamplingX = 1
+		}
+		if sh.SubsamplingX != 0 && sh.SubsamplingY != 0 {
+			r.U(2) /* chroma_sample_position */
+		}
+	}
+	r.U(1) /* separate_uv_delta_q */
+}
@@ -0,0 +1,97 @@
+package flv
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testAV1SequenceHeader() []byte {
+	b := &testBits{}
+	b.u(0, 3).u(0, 1).u(0, 1)          // main profile, not still
+	b.u(1, 1).u(1001, 32).u(60000, 32) // 59.94fps
+	b.u(0, 1).u(0, 1)                  // no equal_picture_interval, no decoder model
+	b.u(0, 1).u(0, 5).u(0, 12).u(8, 5) // one operating point, level 4.0
+	b.u(0, 1)                          // main tier
+	b.u(10, 4).u(10, 4).u(1919, 11).u(1079, 11)
+	b.u(0, 1).u(0, 1).u(1, 1).u(1, 1) // frame ids, superblock, intra tools
+	b.u(0, 4).u(1, 1).u(0, 1).u(1, 1) // order hint
+	b.u(1, 1).u(1, 1).u(6, 3)         // screen content, integer mv, order hint bits
+	b.u(0, 1).u(1, 1).u(1, 1)         // superres, cdef, restoration
+	b.u(1, 1).u(0, 1).u(1, 1)         // 10 bit, not monochrome, color description
+	b.u(9, 8).u(16, 8).u(9, 8)        // BT.2020 PQ
+	b.u(0, 1).u(0, 2).u(0, 1).u(0, 1) // limited range, chroma position
+	b.u(1, 1)                         // trailing bits
+	return append([]byte{0x0A, byte(len(b.buf))}, b.buf...)
+}
+
+func TestParseAV1SequenceHeader(t *testing.T) {
+	obuType, payload, rest, err := SplitOBU(testAV1SequenceHeader())
+	if err != nil || obuType != AV1_OBU_SEQUENCE_HEADER || len(rest) != 0 {
+		t.Fatalf("expect one sequence header OBU got %d, %d bytes left, %v", obuType, len(rest), err)
+	}
+	sh, err := ParseAV1SequenceHeader(payload)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if sh.Width() != 1920 || sh.Height() != 1080 || sh.BitDepth != 10 || sh.SeqLevelIdx != 8 {
+		t.Errorf("expect 1920x1080 10 bit level 8 got %s", sh)
+	}
+	if sh.SubsamplingX != 1 || sh.SubsamplingY != 1 || sh.ColorRange || !sh.HDR() {
+		t.Errorf("expect 4:2:0 limited range PQ got %d/%d/%v/%d", sh.SubsamplingX, sh.SubsamplingY, sh.ColorRange, sh.TransferCharacteristics)
+	}
+	if sh.NumUnitsInDisplayTick != 1001 || sh.TimeScale != 60000 {
+		t.Errorf("expect 1001/60000 got %d/%d", sh.NumUnitsInDisplayTick, sh.TimeScale)
+	}
+}
+
+func TestAV1ConfRecord(t *testing.T) {
+	conf := &AV1ConfRecord{
+		Version:            1,
+		SeqLevelIdx0:       8,
+		HighBitdepth:       true,
+		ChromaSubsamplingX: 1,
+		ChromaSubsamplingY: 1,
+		ConfigOBUs:         testAV1SequenceHeader(),
+	}
+	data := conf.Bytes()
+	rec, err := ParseAV1ConfRecord(data)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if !bytes.Equal(rec.Bytes(), data) {
+		t.Errorf("expect % x got % x", data, rec.Bytes())
+	}
+	if codec := rec.Codec(); codec != "av01.0.08M.10" {
+		t.Errorf("expect av01.0.08M.10 got %s", codec)
+	}
+
+	frames := []*CFrame{
+		NewExVideoFrame(0, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_SEQUENCE_START, FOURCC_AV1, 0, data).CFrame,
+		NewExVideoFrame(0, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_AV1, 0, []byte{0x12, 0x00}).CFrame,
+	}
+	got := readTestFile(t, writeTestFile(t, "av1.flv", frames))
+	if f := got[1].(ExVideoFrame); f.Width != 1920 || f.Height != 1080 {
+		t.Errorf("expect frames of 1920x1080 got %dx%d", f.Width, f.Height)
+	}
+}
+
+func TestSplitOBUTruncated(t *testing.T) {
+	// a lone OBU header with the extension flag but no extension byte
+	if _, _, _, err := SplitOBU([]byte{0x04}); err == nil {
+		t.Errorf("expect truncated OBU header to fail")
+	}
+	rec, err := ParseAV1ConfRecord([]byte{0x81, 0, 0, 0, 0x04})
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if _, err := rec.SequenceHeader(); err == nil {
+		t.Errorf("expect truncated config OBUs to fail")
+	}
+
+	frames := []*CFrame{
+		NewExVideoFrame(0, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_SEQUENCE_START, FOURCC_AV1, 0, []byte{0x81, 0, 0, 0, 0x04}).CFrame,
+	}
+	if got := readTestFile(t, writeTestFile(t, "av1.flv", frames)); len(got) != 1 {
+		t.Errorf("expect 1 frame got %d", len(got))
+	}
+}
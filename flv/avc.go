@@ -40,6 +40,7 @@ type AVCConfRecord struct {
     AVCProfileIndication AVCProfile
     ProfileCompatibility byte
     AVCLevelIndication  byte
+    LengthSizeMinusOne byte
     RawSPSData [][]byte
     RawPPSData [][]byte
 }
@@ -71,7 +72,7 @@ func ParseAVCConfRecord(data []byte) (rec *AVCConfRecord, err error) {
         panic("wrong reserved 1")
     } */
 
-    r.U(2) /* lengthSizeMinusOne */
+    lengthSizeMinusOne := r.U(2)
     r.U(3)
     /* same here
     if r.U(3) != 07 {
@@ -99,12 +100,63 @@ func ParseAVCConfRecord(data []byte) (rec *AVCConfRecord, err error) {
             AVCProfileIndication: AVCProfile(AVCProfileIndication),
             ProfileCompatibility: profile_compatibility,
             AVCLevelIndication: AVCLevelIndication,
+            LengthSizeMinusOne: byte(lengthSizeMinusOne),
             RawSPSData: spss,
             RawPPSData: ppss,
         }
     return
 }
 
+// NewAVCConfRecord builds a configuration record with 4 byte NAL unit
+// lengths from raw SPS and PPS NAL units.
+func NewAVCConfRecord(spss, ppss [][]byte) *AVCConfRecord {
+    rec := &AVCConfRecord{
+        ConfigurationVersion: 1,
+        LengthSizeMinusOne: 3,
+        RawSPSData: spss,
+        RawPPSData: ppss,
+    }
+    if len(spss) > 0 && len(spss[0]) >= 4 {
+        rec.AVCProfileIndication = AVCProfile(spss[0][1])
+        rec.ProfileCompatibility = spss[0][2]
+        rec.AVCLevelIndication = spss[0][3]
+    }
+    return rec
+}
+
+// Bytes serializes the record as an AVCDecoderConfigurationRecord.
+func (r *AVCConfRecord) Bytes() []byte {
+    buf := []byte{
+        r.ConfigurationVersion,
+        byte(r.AVCProfileIndication),
+        r.ProfileCompatibility,
+        r.AVCLevelIndication,
+        0xFC | r.LengthSizeMinusOne,
+        0xE0 | byte(len(r.RawSPSData)),
+    }
+    for _, sps := range r.RawSPSData {
+        buf = append(buf, byte(len(sps) >> 8), byte(len(sps)))
+        buf = append(buf, sps...)
+    }
+    buf = append(buf, byte(len(r.RawPPSData)))
+    for _, pps := range r.RawPPSData {
+        buf = append(buf, byte(len(pps) >> 8), byte(len(pps)))
+        buf = append(buf, pps...)
+    }
+    return buf
+}
+
+// NALULengthSize is the size in bytes of the length prefix of every NAL unit
+// in AVC video frames.
+func (r *AVCConfRecord) NALULengthSize() int {
+    return int(r.LengthSizeMinusOne) + 1
+}
+
+// Codec returns the RFC 6381 codecs parameter, e.g. "avc1.64001f".
+func (r *AVCConfRecord) Codec() string {
+    return fmt.Sprintf("avc1.%02x%02x%02x", byte(r.AVCProfileIndication), r.ProfileCompatibility, r.AVCLevelIndication)
+}
+
 
 type SPS struct {
     Profile_idc AVCProfile
@@ -112,10 +164,19 @@ type SPS struct {
     Level_idc byte
     SPS_id uint32
 
+    Num_units_in_tick uint32
+    Time_scale uint32
+    Fixed_frame_rate_flag uint32
+
     pic_width_in_mbs uint32
     pic_height_in_map_units uint32
     frame_mbs_only_flag uint32
     crops FrameCropOffsets
+
+    separate_colour_plane_flag uint32
+    log2_max_frame_num uint32
+    pic_order_cnt_type uint32
+    log2_max_pic_order_cnt_lsb uint32
 }
 
 type FrameCropOffsets struct {
@@ -136,12 +197,21 @@ func (sps *SPS) Height() uint32 {
     return c*h
 }
 
+// FrameRate returns the frame rate signalled by the VUI timing_info, or 0 if
+// it is absent.
+func (sps *SPS) FrameRate() float64 {
+    if sps.Num_units_in_tick == 0 {
+        return 0
+    }
+    return float64(sps.Time_scale) / float64(2*sps.Num_units_in_tick)
+}
+
 func (sps *SPS) String() string {
     return fmt.Sprintf("seq_parameter_set(profile: %d, level: %d, id: %d)", sps.Profile_idc, sps.Level_idc, sps.SPS_id)
 }
 
 func ParseSPS(rawSPSNALU []byte) (ret *SPS, err error) {
-    r := NewBitReader(rawSPSNALU)
+    r := NewBitReader(UnescapeRBSP(rawSPSNALU))
 
     defer func () {
         if rec := recover(); rec != nil {
@@ -171,12 +241,13 @@ func ParseSPS(rawSPSNALU []byte) (ret *SPS, err error) {
 
     seq_parameter_set_id := r.Ue()
 
+    separate_colour_plane_flag := uint32(0)
     extended_profiles := []byte{100, 110, 122, 244, 44, 83, 86, 118, 128}
     if bytes.IndexByte(extended_profiles, profile_idc) != -1 {
 
         chroma_format_idc := r.Ue()
         if chroma_format_idc == 3 {
-            r.U(1) // separate_colour_plane_flag
+            separate_colour_plane_flag = r.U(1)
         }
         r.Ue() // bit_depth_luma_minus8
         r.Ue() // bit_depth_chroma_minus8
@@ -201,10 +272,11 @@ func ParseSPS(rawSPSNALU []byte) (ret *SPS, err error) {
         }
     }
 
-    r.Ue() /* log2_max_frame_num_minus4 */
+    log2_max_frame_num_minus4 := r.Ue()
     pic_order_cnt_type := r.Ue()
+    log2_max_pic_order_cnt_lsb_minus4 := uint32(0)
     if pic_order_cnt_type == 0 {
-        r.Ue() /* log2_max_pic_order_cnt_lsb_minus4 */
+        log2_max_pic_order_cnt_lsb_minus4 = r.Ue()
     } else if pic_order_cnt_type == 1 {
         r.U(1) /* delta_pic_order_always_zero_flag */
         r.Se() /* offset_for_non_ref_pic */
@@ -254,10 +326,147 @@ func ParseSPS(rawSPSNALU []byte) (ret *SPS, err error) {
                 pic_height_in_map_units : pic_height_in_map_units_minus1 + 1,
                 frame_mbs_only_flag : frame_mbs_only_flag,
                 crops: crops,
+
+                separate_colour_plane_flag: separate_colour_plane_flag,
+                log2_max_frame_num: log2_max_frame_num_minus4 + 4,
+                pic_order_cnt_type: pic_order_cnt_type,
+                log2_max_pic_order_cnt_lsb: log2_max_pic_order_cnt_lsb_minus4 + 4,
             }
+
+    vui_parameters_present_flag := r.U(1)
+    if vui_parameters_present_flag != 0 {
+        parseVUI(r, ret)
+    }
     return
 }
 
+// parseVUI reads the timing_info of vui_parameters. Truncated or unusual VUI
+// is not an error: the SPS is still usable without it.
+func parseVUI(r *BitReader, sps *SPS) {
+    defer func () {
+        recover()
+    }()
+
+    aspect_ratio_info_present_flag := r.U(1)
+    if aspect_ratio_info_present_flag != 0 {
+        aspect_ratio_idc := r.U8()
+        if aspect_ratio_idc == 255 /* Extended_SAR */ {
+            r.U(16) /* sar_width */
+            r.U(16) /* sar_height */
+        }
+    }
+
+    overscan_info_present_flag := r.U(1)
+    if overscan_info_present_flag != 0 {
+        r.U(1) /* overscan_appropriate_flag */
+    }
+
+    video_signal_type_present_flag := r.U(1)
+    if video_signal_type_present_flag != 0 {
+        r.U(3) /* video_format */
+        r.U(1) /* video_full_range_flag */
+        colour_description_present_flag := r.U(1)
+        if colour_description_present_flag != 0 {
+            r.U8() /* colour_primaries */
+            r.U8() /* transfer_characteristics */
+            r.U8() /* matrix_coefficients */
+        }
+    }
+
+    chroma_loc_info_present_flag := r.U(1)
+    if chroma_loc_info_present_flag != 0 {
+        r.Ue() /* chroma_sample_loc_type_top_field */
+        r.Ue() /* chroma_sample_loc_type_bottom_field */
+    }
+
+    timing_info_present_flag := r.U(1)
+    if timing_info_present_flag != 0 {
+        num_units_in_tick := r.U(32)
+        time_scale := r.U(32)
+        sps.Fixed_frame_rate_flag = r.U(1)
+        sps.Num_units_in_tick = num_units_in_tick
+        sps.Time_scale = time_scale
+    }
+}
+
+// SliceHeader holds the leading fields of a slice header up to
+// pic_order_cnt_lsb.
+type SliceHeader struct {
+    First_mb_in_slice uint32
+    Slice_type uint32
+    PPS_id uint32
+    Frame_num uint32
+    Field_pic_flag uint32
+    Bottom_field_flag uint32
+    Idr_pic_id uint32
+    Pic_order_cnt_lsb uint32
+}
+
+// ParseSliceHeader parses the start of the header of a coded slice NAL unit
+// (types 1 and 5) using the active SPS.
+func ParseSliceHeader(nalu []byte, sps *SPS) (ret *SliceHeader, err error) {
+    r := NewBitReader(UnescapeRBSP(nalu))
+
+    defer func () {
+        if rec := recover(); rec != nil {
+            err = rec.(error)
+        }
+    }()
+
+    r.U(1) /* forbidden_zero_bit */
+    r.U(2) /* nal_ref_idc */
+    nal_unit_type := r.U(5)
+    if nal_unit_type != 1 && nal_unit_type != 5 {
+        err = fmt.Errorf("Not slice NALU, nal_unit_type = %d", nal_unit_type)
+        return
+    }
+
+    ret = &SliceHeader{}
+    ret.First_mb_in_slice = r.Ue()
+    ret.Slice_type = r.Ue()
+    ret.PPS_id = r.Ue()
+    if sps.separate_colour_plane_flag != 0 {
+        r.U(2) /* colour_plane_id */
+    }
+    ret.Frame_num = r.U(sps.log2_max_frame_num)
+    if sps.frame_mbs_only_flag == 0 {
+        ret.Field_pic_flag = r.U(1)
+        if ret.Field_pic_flag != 0 {
+            ret.Bottom_field_flag = r.U(1)
+        }
+    }
+    if nal_unit_type == 5 {
+        ret.Idr_pic_id = r.Ue()
+    }
+    if sps.pic_order_cnt_type == 0 {
+        ret.Pic_order_cnt_lsb = r.U(sps.log2_max_pic_order_cnt_lsb)
+    }
+    return
+}
+
+// UnescapeRBSP removes the emulation prevention bytes (00 00 03) of a NAL
+// unit.
+func UnescapeRBSP(nalu []byte) []byte {
+    if bytes.Index(nalu, []byte{0, 0, 3}) == -1 {
+        return nalu
+    }
+    rbsp := make([]byte, 0, len(nalu))
+    zeros := 0
+    for _, b := range nalu {
+        if zeros >= 2 && b == 3 {
+            zeros = 0
+            continue
+        }
+        if b == 0 {
+            zeros++
+        } else {
+            zeros = 0
+        }
+        rbsp = append(rbsp, b)
+    }
+    return rbsp
+}
+
 func scaling_list(r *BitReader, scalingListSize uint32) {
     lastScale := int32(8)
     nextScale := int32(8)
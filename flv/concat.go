@@ -0,0 +1,245 @@
+package flv
+
+import (
+	"bytes"
+	"os"
+)
+
+// GapMode selects which track of the previous input the next input
+// continues from when concatenating.
+type GapMode byte
+
+const (
+	// GAP_LONGEST starts the next input after the longer of both tracks.
+	GAP_LONGEST GapMode = iota
+	// GAP_VIDEO continues the video timeline; audio may overlap or leave a gap.
+	GAP_VIDEO
+	// GAP_AUDIO continues the audio timeline; video may overlap or leave a gap.
+	GAP_AUDIO
+)
+
+// ConcatOptions tunes how Concat joins the inputs.
+type ConcatOptions struct {
+	GapMode GapMode
+	// Gap is an extra pause in milliseconds inserted between inputs.
+	Gap uint32
+}
+
+// properties describing a single input that are stale after concatenation
+var concatDroppedProperties = map[string]bool{
+	"filesize":              true,
+	"datasize":              true,
+	"videosize":             true,
+	"audiosize":             true,
+	"lasttimestamp":         true,
+	"lastkeyframetimestamp": true,
+	"lastkeyframelocation":  true,
+	"framerate":             true,
+}
+
+type trackSpan struct {
+	present bool
+	first   uint32
+	last    uint32
+	delta   uint32
+	frames  int
+}
+
+func (s *trackSpan) add(dts uint32) {
+	if !s.present {
+		s.present = true
+		s.first = dts
+	} else if dts > s.last {
+		s.delta = dts - s.last
+	}
+	if dts > s.last {
+		s.last = dts
+	}
+	s.frames++
+}
+
+// end is the time right after the last frame of the track.
+func (s *trackSpan) end() uint32 {
+	return s.last + s.delta
+}
+
+type concatInput struct {
+	md    MetaData
+	props map[string]interface{}
+	video trackSpan
+	audio trackSpan
+}
+
+func (ci *concatInput) start() uint32 {
+	switch {
+	case ci.video.present && ci.audio.present && ci.audio.first < ci.video.first:
+		return ci.audio.first
+	case ci.video.present:
+		return ci.video.first
+	default:
+		return ci.audio.first
+	}
+}
+
+func summarizeInput(in *FlvReader) (ci *concatInput, err error) {
+	if _, err = in.InFile.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	if _, err = in.ReadHeader(); err != nil {
+		return nil, err
+	}
+	ci = &concatInput{}
+	for {
+		fr, rerr := in.ReadFrame()
+		if rerr != nil {
+			return nil, rerr
+		}
+		if fr == nil {
+			break
+		}
+		if mf, ok := fr.(MetaFrame); ok {
+			if ci.props == nil && mf.Name() == "onMetaData" {
+				ci.props = mf.Properties()
+			}
+			continue
+		}
+		if !ci.video.present && fr.GetType() == TAG_TYPE_VIDEO || !ci.audio.present && fr.GetType() == TAG_TYPE_AUDIO {
+			ci.md.fillFrom(fr)
+		}
+		if IsSequenceHeader(fr) {
+			continue
+		}
+		switch fr.GetType() {
+		case TAG_TYPE_VIDEO:
+			ci.video.add(fr.GetDts())
+		case TAG_TYPE_AUDIO:
+			ci.audio.add(fr.GetDts())
+		}
+	}
+	return ci, nil
+}
+
+// mergeProperties keeps the onMetaData properties every input agrees on.
+func mergeProperties(inputs []*concatInput) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for k, v := range inputs[0].props {
+		if !concatDroppedProperties[k] {
+			merged[k] = v
+		}
+	}
+	for _, ci := range inputs[1:] {
+		for k, v := range merged {
+			if ci.props[k] != v {
+				delete(merged, k)
+			}
+		}
+	}
+	return merged
+}
+
+// Concat joins the inputs into out with continuous timestamps: the DTS of
+// each input is rebased to continue where the previous one ended.
+//
+// Sequence headers are written again only when the codec configuration
+// changes between inputs, and the onMetaData of all inputs is merged into a
+// single tag at the start of the output.
+func Concat(inputs []*FlvReader, out *FlvWriter, opts ConcatOptions) error {
+	if len(inputs) == 0 {
+		return nil
+	}
+	summaries := make([]*concatInput, len(inputs))
+	for i, in := range inputs {
+		ci, err := summarizeInput(in)
+		if err != nil {
+			return err
+		}
+		summaries[i] = ci
+	}
+
+	offsets := make([]uint32, len(inputs))
+	var end uint32
+	md := &MetaData{Extra: mergeProperties(summaries)}
+	videoFrames := 0
+	for i, ci := range summaries {
+		if i > 0 {
+			offsets[i] = end + opts.Gap
+		}
+		start := ci.start()
+		videoEnd := offsets[i] + ci.video.end() - start
+		audioEnd := offsets[i] + ci.audio.end() - start
+		switch {
+		case !ci.audio.present || opts.GapMode == GAP_VIDEO && ci.video.present:
+			end = videoEnd
+		case !ci.video.present || opts.GapMode == GAP_AUDIO:
+			end = audioEnd
+		case videoEnd > audioEnd:
+			end = videoEnd
+		default:
+			end = audioEnd
+		}
+
+		if !md.HasVideo && ci.md.HasVideo {
+			md.HasVideo = true
+			md.VideoCodecId, md.Width, md.Height = ci.md.VideoCodecId, ci.md.Width, ci.md.Height
+		}
+		if !md.HasAudio && ci.md.HasAudio {
+			md.HasAudio = true
+			md.AudioCodecId, md.AudioSampleRate = ci.md.AudioCodecId, ci.md.AudioSampleRate
+			md.AudioSampleSize, md.Stereo = ci.md.AudioSampleSize, ci.md.Stereo
+		}
+		videoFrames += ci.video.frames
+	}
+	md.Duration = float64(end) / 1000
+	if md.Duration > 0 {
+		md.FrameRate = float64(videoFrames) / md.Duration
+	}
+
+	if err := out.WriteHeader(NewHeader(md.HasAudio, md.HasVideo)); err != nil {
+		return err
+	}
+	if err := out.WriteFrame(md.Frame()); err != nil {
+		return err
+	}
+
+	var videoHeader, audioHeader []byte
+	for i, in := range inputs {
+		if _, err := in.InFile.Seek(0, os.SEEK_SET); err != nil {
+			return err
+		}
+		if _, err := in.ReadHeader(); err != nil {
+			return err
+		}
+		start := summaries[i].start()
+		for {
+			fr, rerr := in.ReadFrame()
+			if rerr != nil {
+				return rerr
+			}
+			if fr == nil {
+				break
+			}
+			if mf, ok := fr.(MetaFrame); ok && mf.Name() == "onMetaData" {
+				continue
+			}
+			if IsSequenceHeader(fr) {
+				active := &videoHeader
+				if fr.GetType() == TAG_TYPE_AUDIO {
+					active = &audioHeader
+				}
+				if bytes.Equal(*active, *fr.GetBody()) {
+					continue
+				}
+				*active = *fr.GetBody()
+			}
+			dts := offsets[i]
+			if fr.GetDts() > start {
+				dts += fr.GetDts() - start
+			}
+			fr.SetDts(dts)
+			if err := out.WriteFrame(fr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package flv_test
+
+import (
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/internal/flvtest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConcat(t *testing.T) {
+	second := flvtest.Frames(5000)
+	second[0] = flvtest.Video(0, true, flv.VIDEO_AVC_SEQUENCE_HEADER, 0, append(append([]byte{}, flvtest.AVCConf...), 0xBB))
+	inputs := []*flv.FlvReader{
+		flvtest.WriteFLV(t, flvtest.Frames(5000)),
+		flvtest.WriteFLV(t, flvtest.Frames(5000)),
+		flvtest.WriteFLV(t, second),
+	}
+	outPath := filepath.Join(t.TempDir(), "out.flv")
+	out, err := os.Create(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = flv.Concat(inputs, flv.NewWriter(out), flv.ConcatOptions{})
+	out.Close()
+	if err != nil {
+		t.Fatalf("concat error: %s", err)
+	}
+
+	frames := flvtest.ReadFLV(t, outPath)
+	if d := frames[0].(flv.MetaFrame).Properties()["duration"]; d != 15.0 {
+		t.Errorf("expect duration 15 got %v", d)
+	}
+	var headers []uint32
+	var prev uint32
+	for _, fr := range frames[1:] {
+		if flv.IsSequenceHeader(fr) {
+			headers = append(headers, fr.GetDts())
+			continue
+		}
+		if fr.GetDts() < prev {
+			t.Fatalf("timestamp jumps back from %d to %d", prev, fr.GetDts())
+		}
+		prev = fr.GetDts()
+	}
+	if len(headers) != 3 || headers[2] != 10000 {
+		t.Errorf("expect AVC, AAC and changed AVC header at 10000, got %v", headers)
+	}
+	if prev != 14980 {
+		t.Errorf("expect last frame at 14980 got %d", prev)
+	}
+}
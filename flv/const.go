@@ -52,6 +52,54 @@ const (
 	VIDEO_AVC_SEQUENCE_END    AvcPacketType = 2
 )
 
+// VideoPacketType is the packet type of an Enhanced RTMP ExVideoTagHeader.
+type VideoPacketType byte
+
+const (
+	VIDEO_PACKET_TYPE_SEQUENCE_START         VideoPacketType = 0
+	VIDEO_PACKET_TYPE_CODED_FRAMES           VideoPacketType = 1
+	VIDEO_PACKET_TYPE_SEQUENCE_END           VideoPacketType = 2
+	VIDEO_PACKET_TYPE_CODED_FRAMES_X         VideoPacketType = 3
+	VIDEO_PACKET_TYPE_METADATA               VideoPacketType = 4
+	VIDEO_PACKET_TYPE_MPEG2TS_SEQUENCE_START VideoPacketType = 5
+	VIDEO_PACKET_TYPE_MULTITRACK             VideoPacketType = 6
+	VIDEO_PACKET_TYPE_MODEX                  VideoPacketType = 7
+)
+
+// ModExType is the type of an Enhanced RTMP ModEx packet extension.
+type ModExType byte
+
+const (
+	MODEX_TYPE_TIMESTAMP_OFFSET_NANO ModExType = 0
+)
+
+// AvMultitrackType tells how the tracks of an Enhanced RTMP multitrack tag
+// are laid out.
+type AvMultitrackType byte
+
+const (
+	AV_MULTITRACK_TYPE_ONE_TRACK               AvMultitrackType = 0
+	AV_MULTITRACK_TYPE_MANY_TRACKS             AvMultitrackType = 1
+	AV_MULTITRACK_TYPE_MANY_TRACKS_MANY_CODECS AvMultitrackType = 2
+)
+
+// FourCC identifies the codec of Enhanced RTMP tags.
+type FourCC string
+
+const (
+	FOURCC_AVC  FourCC = "avc1"
+	FOURCC_HEVC FourCC = "hvc1"
+	FOURCC_AV1  FourCC = "av01"
+	FOURCC_VP9  FourCC = "vp09"
+
+	FOURCC_OPUS FourCC = "Opus"
+	FOURCC_FLAC FourCC = "fLaC"
+	FOURCC_AC3  FourCC = "ac-3"
+	FOURCC_EAC3 FourCC = "ec-3"
+	FOURCC_AAC  FourCC = "mp4a"
+	FOURCC_MP3  FourCC = ".mp3"
+)
+
 type AudioType byte
 
 const (
@@ -89,12 +137,15 @@ const (
 	AUDIO_CODEC_NELLYMOSER  AudioCodec = 6
 	AUDIO_CODEC_A_G711      AudioCodec = 7
 	AUDIO_CODEC_MU_G711     AudioCodec = 8
-	AUDIO_CODEC_RESERVED    AudioCodec = 9
+	AUDIO_CODEC_EX_HEADER   AudioCodec = 9
 	AUDIO_CODEC_AAC         AudioCodec = 10
 	AUDIO_CODEC_SPEEX       AudioCodec = 11
 	AUDIO_CODEC_MP3_8KHZ    AudioCodec = 14
 	AUDIO_CODEC_DEVICE      AudioCodec = 15
 	AUDIO_CODEC_UNDEFINED   AudioCodec = 255
+
+	// Deprecated: SoundFormat 9 is the Enhanced RTMP ExAudioTagHeader.
+	AUDIO_CODEC_RESERVED = AUDIO_CODEC_EX_HEADER
 )
 
 type AudioAac byte
@@ -104,6 +155,59 @@ const (
 	AUDIO_AAC_RAW             AudioAac = 1
 )
 
+// AudioPacketType is the packet type of an Enhanced RTMP ExAudioTagHeader.
+type AudioPacketType byte
+
+const (
+	AUDIO_PACKET_TYPE_SEQUENCE_START      AudioPacketType = 0
+	AUDIO_PACKET_TYPE_CODED_FRAMES        AudioPacketType = 1
+	AUDIO_PACKET_TYPE_SEQUENCE_END        AudioPacketType = 2
+	AUDIO_PACKET_TYPE_MULTICHANNEL_CONFIG AudioPacketType = 4
+	AUDIO_PACKET_TYPE_MULTITRACK          AudioPacketType = 5
+	AUDIO_PACKET_TYPE_MODEX               AudioPacketType = 7
+)
+
+type AudioChannelOrder byte
+
+const (
+	AUDIO_CHANNEL_ORDER_UNSPECIFIED AudioChannelOrder = 0
+	AUDIO_CHANNEL_ORDER_NATIVE      AudioChannelOrder = 1
+	AUDIO_CHANNEL_ORDER_CUSTOM      AudioChannelOrder = 2
+)
+
+// AudioChannel is a speaker position of a multichannel configuration; in
+// the native order channel c is present if bit 1 << c of the flags is set.
+type AudioChannel byte
+
+const (
+	AUDIO_CHANNEL_FRONT_LEFT          AudioChannel = 0
+	AUDIO_CHANNEL_FRONT_RIGHT         AudioChannel = 1
+	AUDIO_CHANNEL_FRONT_CENTER        AudioChannel = 2
+	AUDIO_CHANNEL_LOW_FREQUENCY1      AudioChannel = 3
+	AUDIO_CHANNEL_BACK_LEFT           AudioChannel = 4
+	AUDIO_CHANNEL_BACK_RIGHT          AudioChannel = 5
+	AUDIO_CHANNEL_FRONT_LEFT_CENTER   AudioChannel = 6
+	AUDIO_CHANNEL_FRONT_RIGHT_CENTER  AudioChannel = 7
+	AUDIO_CHANNEL_BACK_CENTER         AudioChannel = 8
+	AUDIO_CHANNEL_SIDE_LEFT           AudioChannel = 9
+	AUDIO_CHANNEL_SIDE_RIGHT          AudioChannel = 10
+	AUDIO_CHANNEL_TOP_CENTER          AudioChannel = 11
+	AUDIO_CHANNEL_TOP_FRONT_LEFT      AudioChannel = 12
+	AUDIO_CHANNEL_TOP_FRONT_CENTER    AudioChannel = 13
+	AUDIO_CHANNEL_TOP_FRONT_RIGHT     AudioChannel = 14
+	AUDIO_CHANNEL_TOP_BACK_LEFT       AudioChannel = 15
+	AUDIO_CHANNEL_TOP_BACK_CENTER     AudioChannel = 16
+	AUDIO_CHANNEL_TOP_BACK_RIGHT      AudioChannel = 17
+	AUDIO_CHANNEL_LOW_FREQUENCY2      AudioChannel = 18
+	AUDIO_CHANNEL_TOP_SIDE_LEFT       AudioChannel = 19
+	AUDIO_CHANNEL_TOP_SIDE_RIGHT      AudioChannel = 20
+	AUDIO_CHANNEL_BOTTOM_FRONT_CENTER AudioChannel = 21
+	AUDIO_CHANNEL_BOTTOM_FRONT_LEFT   AudioChannel = 22
+	AUDIO_CHANNEL_BOTTOM_FRONT_RIGHT  AudioChannel = 23
+	AUDIO_CHANNEL_UNUSED              AudioChannel = 0xFE
+	AUDIO_CHANNEL_UNKNOWN             AudioChannel = 0xFF
+)
+
 type Flavor byte
 
 const (
@@ -163,7 +267,7 @@ var (
 		AUDIO_CODEC_NELLYMOSER:  "nellymoser",
 		AUDIO_CODEC_A_G711:      "g711a",
 		AUDIO_CODEC_MU_G711:     "g711u",
-		AUDIO_CODEC_RESERVED:    "RESERVED",
+		AUDIO_CODEC_EX_HEADER:   "ex",
 		AUDIO_CODEC_AAC:         "aac",
 		AUDIO_CODEC_SPEEX:       "speex",
 		AUDIO_CODEC_MP3_8KHZ:    "mp3_8khz",
@@ -175,6 +279,67 @@ var (
 		VIDEO_AVC_NALU:				"NALU",
 		VIDEO_AVC_SEQUENCE_END:		"sequence end",
 	}
+
+	vptToStr = map[VideoPacketType]string{
+		VIDEO_PACKET_TYPE_SEQUENCE_START:         "sequence start",
+		VIDEO_PACKET_TYPE_CODED_FRAMES:           "coded frames",
+		VIDEO_PACKET_TYPE_SEQUENCE_END:           "sequence end",
+		VIDEO_PACKET_TYPE_CODED_FRAMES_X:         "coded frames x",
+		VIDEO_PACKET_TYPE_METADATA:               "metadata",
+		VIDEO_PACKET_TYPE_MPEG2TS_SEQUENCE_START: "mpeg2ts sequence start",
+		VIDEO_PACKET_TYPE_MULTITRACK:             "multitrack",
+		VIDEO_PACKET_TYPE_MODEX:                  "modex",
+	}
+
+	amtToStr = map[AvMultitrackType]string{
+		AV_MULTITRACK_TYPE_ONE_TRACK:               "one track",
+		AV_MULTITRACK_TYPE_MANY_TRACKS:             "many tracks",
+		AV_MULTITRACK_TYPE_MANY_TRACKS_MANY_CODECS: "many tracks many codecs",
+	}
+
+	aptToStr = map[AudioPacketType]string{
+		AUDIO_PACKET_TYPE_SEQUENCE_START:      "sequence start",
+		AUDIO_PACKET_TYPE_CODED_FRAMES:        "coded frames",
+		AUDIO_PACKET_TYPE_SEQUENCE_END:        "sequence end",
+		AUDIO_PACKET_TYPE_MULTICHANNEL_CONFIG: "multichannel config",
+		AUDIO_PACKET_TYPE_MULTITRACK:          "multitrack",
+		AUDIO_PACKET_TYPE_MODEX:               "modex",
+	}
+
+	acoToStr = map[AudioChannelOrder]string{
+		AUDIO_CHANNEL_ORDER_UNSPECIFIED: "unspecified",
+		AUDIO_CHANNEL_ORDER_NATIVE:      "native",
+		AUDIO_CHANNEL_ORDER_CUSTOM:      "custom",
+	}
+
+	achToStr = map[AudioChannel]string{
+		AUDIO_CHANNEL_FRONT_LEFT:          "FL",
+		AUDIO_CHANNEL_FRONT_RIGHT:         "FR",
+		AUDIO_CHANNEL_FRONT_CENTER:        "FC",
+		AUDIO_CHANNEL_LOW_FREQUENCY1:      "LFE",
+		AUDIO_CHANNEL_BACK_LEFT:           "BL",
+		AUDIO_CHANNEL_BACK_RIGHT:          "BR",
+		AUDIO_CHANNEL_FRONT_LEFT_CENTER:   "FLC",
+		AUDIO_CHANNEL_FRONT_RIGHT_CENTER:  "FRC",
+		AUDIO_CHANNEL_BACK_CENTER:         "BC",
+		AUDIO_CHANNEL_SIDE_LEFT:           "SL",
+		AUDIO_CHANNEL_SIDE_RIGHT:          "SR",
+		AUDIO_CHANNEL_TOP_CENTER:          "TC",
+		AUDIO_CHANNEL_TOP_FRONT_LEFT:      "TFL",
+		AUDIO_CHANNEL_TOP_FRONT_CENTER:    "TFC",
+		AUDIO_CHANNEL_TOP_FRONT_RIGHT:     "TFR",
+		AUDIO_CHANNEL_TOP_BACK_LEFT:       "TBL",
+		AUDIO_CHANNEL_TOP_BACK_CENTER:     "TBC",
+		AUDIO_CHANNEL_TOP_BACK_RIGHT:      "TBR",
+		AUDIO_CHANNEL_LOW_FREQUENCY2:      "LFE2",
+		AUDIO_CHANNEL_TOP_SIDE_LEFT:       "TSL",
+		AUDIO_CHANNEL_TOP_SIDE_RIGHT:      "TSR",
+		AUDIO_CHANNEL_BOTTOM_FRONT_CENTER: "BFC",
+		AUDIO_CHANNEL_BOTTOM_FRONT_LEFT:   "BFL",
+		AUDIO_CHANNEL_BOTTOM_FRONT_RIGHT:  "BFR",
+		AUDIO_CHANNEL_UNUSED:              "unused",
+		AUDIO_CHANNEL_UNKNOWN:             "unknown",
+	}
 )
 
 func (vc VideoCodec) String() (s string) {
@@ -193,6 +358,26 @@ func (apt AvcPacketType) String() (s string) {
 	return avcptToStr[apt]
 }
 
+func (vpt VideoPacketType) String() (s string) {
+	return vptToStr[vpt]
+}
+
+func (amt AvMultitrackType) String() (s string) {
+	return amtToStr[amt]
+}
+
+func (apt AudioPacketType) String() (s string) {
+	return aptToStr[apt]
+}
+
+func (aco AudioChannelOrder) String() (s string) {
+	return acoToStr[aco]
+}
+
+func (ach AudioChannel) String() (s string) {
+	return achToStr[ach]
+}
+
 func (at AudioType) String() (s string) {
 	return atToStr[at]
 }
@@ -0,0 +1,268 @@
+package flv
+
+import (
+	"fmt"
+	"os"
+)
+
+// CutOptions tunes how Cut selects the frames of the output.
+type CutOptions struct {
+	// SnapForward moves the start to the first keyframe at or after the
+	// requested start instead of the last keyframe at or before it.
+	SnapForward bool
+	// AudioPreroll keeps audio up to this many milliseconds ahead of the
+	// start keyframe so the audio decoder is primed; such frames get DTS 0.
+	AudioPreroll uint32
+}
+
+type indexEntry struct {
+	position   int64
+	track      byte // in a multitrack tag
+	size       int64
+	dts        uint32
+	tagType    TagType
+	keyframe   bool
+	seqHeader  bool
+	onMetaData bool
+}
+
+// scanIndex reads every frame of the file and remembers where it starts.
+func scanIndex(in *FlvReader) (entries []indexEntry, err error) {
+	if _, err = in.InFile.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	if _, err = in.ReadHeader(); err != nil {
+		return nil, err
+	}
+	for {
+		fr, rerr := in.ReadFrame()
+		if rerr != nil {
+			return nil, rerr
+		}
+		if fr == nil {
+			break
+		}
+		e := indexEntry{
+			position:  PositionOf(fr),
+			track:     TrackId(fr),
+			size:      int64(len(*fr.GetBody())) + int64(TAG_HEADER_LENGTH+PREV_TAG_SIZE_LENGTH),
+			dts:       fr.GetDts(),
+			tagType:   fr.GetType(),
+			keyframe:  IsKeyframe(fr),
+			seqHeader: IsSequenceHeader(fr),
+		}
+		if mf, ok := fr.(MetaFrame); ok {
+			e.onMetaData = mf.Name() == "onMetaData"
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// readIndexed reads the frames of the given entries; indices of -1 are
+// skipped.
+func readIndexed(in *FlvReader, entries []indexEntry, indices ...int) (frames []Frame, err error) {
+	for _, i := range indices {
+		if i == -1 {
+			continue
+		}
+		fr, rerr := in.ReadTrackAt(entries[i].position, entries[i].track)
+		if rerr != nil {
+			return nil, rerr
+		}
+		frames = append(frames, fr)
+	}
+	return frames, nil
+}
+
+// Cut copies the [startMs, endMs] range of in to out, starting at the
+// keyframe preceding startMs. An endMs of 0 copies up to the end of file.
+func Cut(in *FlvReader, out *FlvWriter, startMs, endMs uint32) error {
+	return CutWithOptions(in, out, startMs, endMs, CutOptions{})
+}
+
+// CutWithOptions is Cut with explicit keyframe snapping and audio preroll.
+//
+// The output starts with a fresh onMetaData tag followed by the last
+// sequence headers of every track seen before the start, and all timestamps
+// are rebased so that the start keyframe has DTS 0.
+func CutWithOptions(in *FlvReader, out *FlvWriter, startMs, endMs uint32, opts CutOptions) error {
+	entries, err := scanIndex(in)
+	if err != nil {
+		return err
+	}
+
+	hasVideo := false
+	for _, e := range entries {
+		if e.keyframe {
+			hasVideo = true
+			break
+		}
+	}
+
+	start := -1
+	for i, e := range entries {
+		if e.seqHeader || e.tagType == TAG_TYPE_META {
+			continue
+		}
+		if hasVideo && !e.keyframe {
+			continue
+		}
+		if opts.SnapForward {
+			if e.dts >= startMs {
+				start = i
+				break
+			}
+			continue
+		}
+		if e.dts <= startMs {
+			start = i
+			continue
+		}
+		if start == -1 {
+			start = i
+		}
+		break
+	}
+	if start == -1 {
+		return fmt.Errorf("no frame to start from at %dms", startMs)
+	}
+	base := entries[start].dts
+	if endMs != 0 && endMs < base {
+		return fmt.Errorf("cut range [%d-%d] is empty after snapping to %dms", startMs, endMs, base)
+	}
+	prerollFrom := uint32(0)
+	if base > opts.AudioPreroll {
+		prerollFrom = base - opts.AudioPreroll
+	}
+
+	headers := lastSequenceHeaders(entries, start)
+	hasAudioHeader := false
+	for _, i := range headers {
+		hasAudioHeader = hasAudioHeader || entries[i].tagType == TAG_TYPE_AUDIO
+	}
+
+	var selected []int
+	var lastDts uint32
+	videoFrames := 0
+	firstVideo, firstAudio := -1, -1
+	for i, e := range entries {
+		if endMs != 0 && e.dts > endMs {
+			continue
+		}
+		switch e.tagType {
+		case TAG_TYPE_VIDEO:
+			if i < start {
+				continue
+			}
+			if !e.seqHeader {
+				videoFrames++
+			}
+			if firstVideo == -1 {
+				firstVideo = i
+			}
+		case TAG_TYPE_AUDIO:
+			if i < start && (e.seqHeader || e.dts < prerollFrom) {
+				continue
+			}
+			if firstAudio == -1 {
+				firstAudio = i
+			}
+		case TAG_TYPE_META:
+			if i < start || e.onMetaData {
+				continue
+			}
+		}
+		if e.dts > lastDts {
+			lastDts = e.dts
+		}
+		selected = append(selected, i)
+	}
+
+	md := &MetaData{HasVideo: firstVideo != -1, HasAudio: firstAudio != -1 || hasAudioHeader}
+	if lastDts > base {
+		md.Duration = float64(lastDts-base) / 1000
+		md.FrameRate = float64(videoFrames) / md.Duration
+	}
+
+	headerFrames, err := readIndexed(in, entries, headers...)
+	if err != nil {
+		return err
+	}
+	firstFrames, err := readIndexed(in, entries, firstVideo, firstAudio)
+	if err != nil {
+		return err
+	}
+	for _, fr := range append(firstFrames, headerFrames...) {
+		md.fillFrom(fr)
+	}
+
+	if err = out.WriteHeader(NewHeader(md.HasAudio, md.HasVideo)); err != nil {
+		return err
+	}
+	if err = out.WriteFrame(md.Frame()); err != nil {
+		return err
+	}
+	for _, fr := range headerFrames {
+		fr.SetDts(0)
+		if err = out.WriteFrame(fr); err != nil {
+			return err
+		}
+	}
+	for _, i := range selected {
+		fr, rerr := in.ReadTrackAt(entries[i].position, entries[i].track)
+		if rerr != nil {
+			return rerr
+		}
+		if dts := fr.GetDts(); dts > base {
+			fr.SetDts(dts - base)
+		} else {
+			fr.SetDts(0)
+		}
+		if err = out.WriteFrame(fr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lastSequenceHeaders finds the last video and audio sequence headers of
+// every track before entries[end], in file order.
+func lastSequenceHeaders(entries []indexEntry, end int) (headers []int) {
+	type key struct {
+		tagType TagType
+		track   byte
+	}
+	last := map[key]int{}
+	for i := 0; i < end; i++ {
+		if e := entries[i]; e.seqHeader {
+			last[key{e.tagType, e.track}] = i
+		}
+	}
+	for i := 0; i < end; i++ {
+		e := entries[i]
+		if j, ok := last[key{e.tagType, e.track}]; ok && j == i {
+			headers = append(headers, i)
+		}
+	}
+	return
+}
+
+// fillFrom copies codec parameters from a parsed frame.
+func (md *MetaData) fillFrom(fr Frame) {
+	switch f := fr.(type) {
+	case AVCVideoFrame:
+		md.fillFrom(*f.VideoFrame)
+	case VideoFrame:
+		md.HasVideo = true
+		md.VideoCodecId = f.CodecId
+		md.Width = f.Width
+		md.Height = f.Height
+	case AudioFrame:
+		md.HasAudio = true
+		md.AudioCodecId = f.CodecId
+		md.AudioSampleRate = f.Rate
+		md.AudioSampleSize = f.BitSize
+		md.Stereo = f.Channels == AUDIO_TYPE_STEREO
+	}
+}
@@ -0,0 +1,72 @@
+package flv_test
+
+import (
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/internal/flvtest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func cutTestFile(t *testing.T, startMs, endMs uint32, opts flv.CutOptions) []flv.Frame {
+	outPath := filepath.Join(t.TempDir(), "out.flv")
+	out, err := os.Create(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = flv.CutWithOptions(flvtest.WriteFLV(t, flvtest.Frames(5000)), flv.NewWriter(out), startMs, endMs, opts)
+	out.Close()
+	if err != nil {
+		t.Fatalf("cut error: %s", err)
+	}
+	return flvtest.ReadFLV(t, outPath)
+}
+
+func TestCut(t *testing.T) {
+	frames := cutTestFile(t, 2500, 3500, flv.CutOptions{})
+
+	md, ok := frames[0].(flv.MetaFrame)
+	if !ok || md.Name() != "onMetaData" {
+		t.Fatalf("expect onMetaData first, got %v", frames[0])
+	}
+	if d := md.Properties()["duration"]; d != 1.5 {
+		t.Errorf("expect duration 1.5 got %v", d)
+	}
+	if !flv.IsSequenceHeader(frames[1]) || frames[1].GetType() != flv.TAG_TYPE_VIDEO {
+		t.Errorf("expect AVC sequence header, got %v", frames[1])
+	}
+	if !flv.IsSequenceHeader(frames[2]) || frames[2].GetType() != flv.TAG_TYPE_AUDIO {
+		t.Errorf("expect AAC sequence header, got %v", frames[2])
+	}
+	if !flv.IsKeyframe(frames[3]) || frames[3].GetDts() != 0 {
+		t.Errorf("expect keyframe at 0, got %v", frames[3])
+	}
+	last := frames[len(frames)-1]
+	if last.GetDts() != 1500 {
+		t.Errorf("expect last frame at 1500 got %d", last.GetDts())
+	}
+}
+
+func TestCutSnapForwardWithPreroll(t *testing.T) {
+	frames := cutTestFile(t, 2500, 0, flv.CutOptions{SnapForward: true, AudioPreroll: 60})
+
+	var firstKey flv.Frame
+	preroll := 0
+	for _, fr := range frames[3:] {
+		if fr.GetType() == flv.TAG_TYPE_VIDEO && firstKey == nil {
+			firstKey = fr
+		}
+		if fr.GetType() == flv.TAG_TYPE_AUDIO && firstKey == nil {
+			preroll++
+		}
+	}
+	if firstKey == nil || !flv.IsKeyframe(firstKey) || firstKey.GetDts() != 0 {
+		t.Fatalf("expect keyframe at 0 got %v", firstKey)
+	}
+	if preroll != 3 {
+		t.Errorf("expect 3 preroll audio frames got %d", preroll)
+	}
+	if last := frames[len(frames)-1]; last.GetDts() != 1980 {
+		t.Errorf("expect last frame at 1980 got %d", last.GetDts())
+	}
+}
@@ -0,0 +1,257 @@
+package flv
+
+import (
+	"fmt"
+	"io"
+)
+
+// Demuxer extracts the tracks of an FLV stream into elementary stream
+// files: AVC as Annex B, AAC as ADTS, MP3 and Speex raw and PCM as WAV.
+// G.711 and ADPCM are decoded into 16 bit WAV. Tracks of other codecs are
+// skipped.
+type Demuxer struct {
+	// CreateVideo and CreateAudio open the output of a track once its codec
+	// is known; ext is the file extension to use, e.g. ".h264". A nil
+	// function skips the track.
+	CreateVideo func(ext string) (io.WriteCloser, error)
+	CreateAudio func(ext string) (io.WriteCloser, error)
+	// Unsupported is called once for a track whose codec can not be
+	// extracted, the track is skipped while the other one is extracted.
+	Unsupported func(err error)
+
+	video     io.WriteCloser
+	audio     io.WriteCloser
+	wav       *WavWriter
+	avcConf   *AVCConfRecord
+	aacConf   *AudioSpecificConfig
+	audioErr  error
+	videoErr  error
+	skipVideo bool
+	skipAudio bool
+}
+
+// DemuxExtension returns the elementary stream file extension for the codec
+// of fr, or an error if the codec can not be extracted.
+func DemuxExtension(fr Frame) (string, error) {
+	switch f := fr.(type) {
+	case AVCVideoFrame:
+		return ".h264", nil
+	case VideoFrame:
+		return "", fmt.Errorf("demux: %s video can not be extracted", f.CodecId)
+	case ExVideoFrame:
+		return "", fmt.Errorf("demux: %s video can not be extracted", f.FourCC)
+	case ExAudioFrame:
+		return "", fmt.Errorf("demux: %s audio can not be extracted", f.FourCC)
+	case AudioFrame:
+		switch f.CodecId {
+		case AUDIO_CODEC_AAC:
+			return ".aac", nil
+		case AUDIO_CODEC_MP3, AUDIO_CODEC_MP3_8KHZ:
+			return ".mp3", nil
+		case AUDIO_CODEC_SPEEX:
+			return ".spx", nil
+		case AUDIO_CODEC_PCM, AUDIO_CODEC_PCM_LE, AUDIO_CODEC_A_G711, AUDIO_CODEC_MU_G711, AUDIO_CODEC_ADPCM:
+			return ".wav", nil
+		}
+		return "", fmt.Errorf("demux: %s audio can not be extracted", f.CodecId)
+	}
+	return "", fmt.Errorf("demux: %s tags can not be extracted", fr.GetType())
+}
+
+// Demux extracts all frames of in and closes the outputs.
+func (d *Demuxer) Demux(in *FlvReader) error {
+	for {
+		fr, rerr := in.ReadFrame()
+		if rerr != nil {
+			d.Close()
+			return rerr
+		}
+		if fr == nil {
+			break
+		}
+		if err := d.WriteFrame(fr); err != nil {
+			d.Close()
+			return err
+		}
+	}
+	return d.Close()
+}
+
+// WriteFrame writes the payload of a single frame to its track output.
+// Frames of codecs that can not be extracted are skipped.
+func (d *Demuxer) WriteFrame(fr Frame) error {
+	switch f := fr.(type) {
+	case AVCVideoFrame:
+		return d.writeVideo(f)
+	case VideoFrame, ExVideoFrame:
+		if d.CreateVideo == nil {
+			return nil
+		}
+		return d.openVideo(f)
+	case ExAudioFrame:
+		if d.CreateAudio == nil {
+			return nil
+		}
+		return d.openAudio(f)
+	case AudioFrame:
+		return d.writeAudio(f)
+	}
+	return nil
+}
+
+// skip marks a track whose codec can not be extracted as skipped, the
+// first time reporting err.
+func (d *Demuxer) skip(skipped *bool, err error) {
+	if !*skipped && d.Unsupported != nil {
+		d.Unsupported(err)
+	}
+	*skipped = true
+}
+
+func (d *Demuxer) openVideo(fr Frame) error {
+	if d.video != nil || d.videoErr != nil || d.skipVideo {
+		return d.videoErr
+	}
+	ext, err := DemuxExtension(fr)
+	if err != nil {
+		d.skip(&d.skipVideo, err)
+		return nil
+	}
+	d.video, d.videoErr = d.CreateVideo(ext)
+	return d.videoErr
+}
+
+func (d *Demuxer) writeVideo(f AVCVideoFrame) error {
+	if d.CreateVideo == nil {
+		return nil
+	}
+	if err := d.openVideo(f); err != nil || d.video == nil {
+		return err
+	}
+
+	switch f.PacketType {
+	case VIDEO_AVC_SEQUENCE_HEADER:
+		conf, err := ParseAVCConfRecord(f.Data())
+		if err != nil {
+			return err
+		}
+		d.avcConf = conf
+		return nil
+	case VIDEO_AVC_NALU:
+		if d.avcConf == nil {
+			return fmt.Errorf("demux: AVC frame @%d before sequence header", f.Position)
+		}
+		nalus, err := SplitAVCC(f.Data(), d.avcConf.NALULengthSize())
+		if err != nil {
+			return err
+		}
+		hasIDR, hasSPS := false, false
+		for _, nalu := range nalus {
+			switch NALUTypeOf(nalu) {
+			case NALU_TYPE_IDR:
+				hasIDR = true
+			case NALU_TYPE_SPS:
+				hasSPS = true
+			}
+		}
+		if hasIDR && !hasSPS {
+			params := append(append([][]byte{}, d.avcConf.RawSPSData...), d.avcConf.RawPPSData...)
+			nalus = append(params, nalus...)
+		}
+		return WriteAnnexB(d.video, nalus)
+	}
+	return nil
+}
+
+func (d *Demuxer) openAudio(fr Frame) error {
+	if d.audio != nil || d.audioErr != nil || d.skipAudio {
+		return d.audioErr
+	}
+	ext, err := DemuxExtension(fr)
+	if err != nil {
+		d.skip(&d.skipAudio, err)
+		return nil
+	}
+	d.audio, err = d.CreateAudio(ext)
+	if f, ok := fr.(AudioFrame); ok && err == nil && ext == ".wav" {
+		// PCM is copied as is, the others are decoded to 16 bit
+		bits := uint16(16)
+		if f.BitSize == AUDIO_SIZE_8BIT && (f.CodecId == AUDIO_CODEC_PCM || f.CodecId == AUDIO_CODEC_PCM_LE) {
+			bits = 8
+		}
+		channels := uint16(1)
+		if f.Channels == AUDIO_TYPE_STEREO {
+			channels = 2
+		}
+		d.wav = NewWavWriter(d.audio, DecodedSampleRate(f), channels, bits)
+	}
+	d.audioErr = err
+	return err
+}
+
+func (d *Demuxer) writeAudio(f AudioFrame) error {
+	if d.CreateAudio == nil || len(f.Body) < 2 {
+		return nil
+	}
+	if err := d.openAudio(f); err != nil || d.audio == nil {
+		return err
+	}
+
+	var err error
+	switch f.CodecId {
+	case AUDIO_CODEC_AAC:
+		if AudioAac(f.Body[1]) == AUDIO_AAC_SEQUENCE_HEADER {
+			d.aacConf, err = ParseAudioSpecificConfig(f.Body[2:])
+			return err
+		}
+		if d.aacConf == nil {
+			return fmt.Errorf("demux: AAC frame @%d before sequence header", f.Position)
+		}
+		if _, err = d.audio.Write(d.aacConf.ADTSHeader(len(f.Body) - 2)); err == nil {
+			_, err = d.audio.Write(f.Body[2:])
+		}
+	case AUDIO_CODEC_PCM, AUDIO_CODEC_PCM_LE:
+		_, err = d.wav.Write(f.Body[1:])
+	case AUDIO_CODEC_A_G711, AUDIO_CODEC_MU_G711, AUDIO_CODEC_ADPCM:
+		var samples []int16
+		if samples, err = DecodeAudio(f); err == nil {
+			err = d.wav.WriteSamples(samples)
+		}
+	default:
+		_, err = d.audio.Write(f.Body[1:])
+	}
+	return err
+}
+
+// Close finishes and closes the outputs that were opened.
+func (d *Demuxer) Close() (err error) {
+	if d.wav != nil {
+		err = d.wav.Close()
+		d.wav = nil
+	}
+	for _, w := range []*io.WriteCloser{&d.video, &d.audio} {
+		if *w == nil {
+			continue
+		}
+		if cerr := (*w).Close(); err == nil {
+			err = cerr
+		}
+		*w = nil
+	}
+	return
+}
+
+// pcmSampleRate converts the nominal FLV sound rate to the real one.
+func pcmSampleRate(rate uint32) uint32 {
+	switch rate {
+	case 5500:
+		return 5512
+	case 11000:
+		return 11025
+	case 22000:
+		return 22050
+	case 44000:
+		return 44100
+	}
+	return rate
+}
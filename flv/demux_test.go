@@ -0,0 +1,100 @@
+package flv
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func TestDemuxAnnexB(t *testing.T) {
+	conf := []byte{
+		0x17, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x42, 0x00, 0x1E, 0xFF,
+		0xE1, 0x00, 0x02, 0x67, 0x42,
+		0x01, 0x00, 0x02, 0x68, 0xCE,
+	}
+	idr := []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x65, 0x88}
+	inter := []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x41, 0x9A}
+
+	out := nopCloser{new(bytes.Buffer)}
+	d := &Demuxer{CreateVideo: func(ext string) (w io.WriteCloser, err error) {
+		if ext != ".h264" {
+			t.Errorf("expect .h264 got %s", ext)
+		}
+		return out, nil
+	}}
+	r := &FlvReader{}
+	for _, body := range [][]byte{conf, idr, inter} {
+		fr := r.parseFrame(&CFrame{Type: TAG_TYPE_VIDEO, Body: body})
+		if err := d.WriteFrame(fr); err != nil {
+			t.Fatalf("demux error: %s", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []byte{
+		0, 0, 0, 1, 0x67, 0x42,
+		0, 0, 0, 1, 0x68, 0xCE,
+		0, 0, 0, 1, 0x65, 0x88,
+		0, 0, 0, 1, 0x41, 0x9A,
+	}
+	if !bytes.Equal(expect, out.Bytes()) {
+		t.Errorf("expect %x got %x", expect, out.Bytes())
+	}
+}
+
+func TestDemuxUnsupported(t *testing.T) {
+	frames := []Frame{
+		VideoFrame{CFrame: &CFrame{Type: TAG_TYPE_VIDEO, Flavor: KEYFRAME, Body: []byte{0x12, 0x00}}, CodecId: VIDEO_CODEC_SORENSON},
+		AudioFrame{CFrame: &CFrame{Type: TAG_TYPE_AUDIO, Body: []byte{0x2E, 0xFF, 0xFB}}, CodecId: AUDIO_CODEC_MP3},
+		NewExVideoFrame(0, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_CODED_FRAMES_X, FOURCC_HEVC, 0, []byte{0x26}),
+		VideoFrame{CFrame: &CFrame{Type: TAG_TYPE_VIDEO, Body: []byte{0x22, 0x00}}, CodecId: VIDEO_CODEC_SORENSON},
+		AudioFrame{CFrame: &CFrame{Type: TAG_TYPE_AUDIO, Body: []byte{0x2E, 0x90, 0x64}}, CodecId: AUDIO_CODEC_MP3},
+	}
+	out := nopCloser{new(bytes.Buffer)}
+	var skipped []error
+	d := &Demuxer{
+		CreateVideo: func(ext string) (io.WriteCloser, error) {
+			t.Errorf("unexpected %s video output", ext)
+			return out, nil
+		},
+		CreateAudio: func(ext string) (io.WriteCloser, error) {
+			return out, nil
+		},
+		Unsupported: func(err error) { skipped = append(skipped, err) },
+	}
+	for _, fr := range frames {
+		if err := d.WriteFrame(fr); err != nil {
+			t.Fatalf("demux error: %s", err)
+		}
+	}
+	if !bytes.Equal(out.Bytes(), []byte{0xFF, 0xFB, 0x90, 0x64}) {
+		t.Errorf("expect the MP3 track got % x", out.Bytes())
+	}
+	if len(skipped) != 1 {
+		t.Errorf("expect the video track reported once got %v", skipped)
+	}
+
+	// Enhanced RTMP tracks are skipped the same way
+	skipped = nil
+	d = &Demuxer{CreateAudio: d.CreateAudio, Unsupported: d.Unsupported}
+	opus := NewExAudioFrame(0, AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, []byte{0xFC})
+	for _, fr := range []Frame{opus, opus} {
+		if err := d.WriteFrame(fr); err != nil {
+			t.Fatalf("demux error: %s", err)
+		}
+	}
+	if len(skipped) != 1 {
+		t.Errorf("expect the Opus track reported once got %v", skipped)
+	}
+}
@@ -0,0 +1,260 @@
+package flv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// ExAudioFrame is an audio tag with the Enhanced RTMP ExAudioTagHeader:
+// SoundFormat AUDIO_CODEC_EX_HEADER followed by the packet type and the
+// FourCC of the codec. Rate, BitSize and Channels come from the last
+// sequence start or multichannel configuration and are undefined before.
+type ExAudioFrame struct {
+	AudioFrame
+	PacketType   AudioPacketType
+	FourCC       FourCC
+	ChannelCount byte
+	TrackId      byte // of multitrack tags
+}
+
+// NewExAudioFrame builds an Enhanced RTMP audio tag.
+func NewExAudioFrame(dts uint32, packetType AudioPacketType, fourCC FourCC, data []byte) ExAudioFrame {
+	body := append([]byte{byte(AUDIO_CODEC_EX_HEADER)<<4 | byte(packetType)}, fourCC...)
+	return ExAudioFrame{
+		AudioFrame: AudioFrame{
+			CFrame:   &CFrame{Type: TAG_TYPE_AUDIO, Dts: dts, Flavor: FRAME, Body: append(body, data...)},
+			CodecId:  AUDIO_CODEC_EX_HEADER,
+			BitSize:  AUDIO_SIZE_UNDEFINED,
+			Channels: AUDIO_TYPE_UNDEFINED,
+		},
+		PacketType: packetType,
+		FourCC:     fourCC,
+	}
+}
+
+type audioConfig struct {
+	rate     uint32
+	bitSize  AudioSize
+	channels byte
+}
+
+func (frReader *FlvReader) parseExAudioFrame(pFrame *CFrame) Frame {
+	if m, err := parseModEx(pFrame.Body); err == nil && AudioPacketType(m.packetType) == AUDIO_PACKET_TYPE_MULTITRACK {
+		return frReader.expandMultitrack(pFrame, frReader.parseExAudioTrack)
+	}
+	return frReader.parseExAudioTrack(pFrame)
+}
+
+// exAudioHeader decodes the ExAudioTagHeader of pFrame.
+func exAudioHeader(pFrame *CFrame) ExAudioFrame {
+	body := pFrame.Body
+	f := ExAudioFrame{
+		AudioFrame: AudioFrame{CFrame: pFrame, CodecId: AUDIO_CODEC_EX_HEADER},
+		PacketType: AudioPacketType(body[0] & 0x0F),
+	}
+	// skip the ModEx wrappers, leaving the packet type they wrap in the
+	// low bits of body[0]
+	if m, err := parseModEx(body); err == nil {
+		f.PacketType = AudioPacketType(m.packetType)
+		body = body[m.length:]
+	}
+	switch {
+	case f.PacketType == AUDIO_PACKET_TYPE_MULTITRACK:
+		// tracks are split into one track tags, others are left as is
+		if len(body) >= 7 && AvMultitrackType(body[1]>>4) == AV_MULTITRACK_TYPE_ONE_TRACK {
+			f.PacketType = AudioPacketType(body[1] & 0x0F)
+			f.FourCC, f.TrackId = FourCC(body[2:6]), body[6]
+		}
+	case len(body) >= 5:
+		f.FourCC = FourCC(body[1:5])
+	}
+	return f
+}
+
+func (frReader *FlvReader) parseExAudioTrack(pFrame *CFrame) Frame {
+	f := exAudioHeader(pFrame)
+	conf := frReader.trackAudio(f.TrackId)
+	switch {
+	case pFrame.Filter:
+		// the payload is encrypted
+	case f.PacketType == AUDIO_PACKET_TYPE_SEQUENCE_START:
+		*conf = audioConfig{bitSize: AUDIO_SIZE_UNDEFINED}
+		conf.update(f.FourCC, f.Data())
+	case f.PacketType == AUDIO_PACKET_TYPE_CODED_FRAMES:
+		// AC-3, E-AC-3 and MP3 have no sequence start, the frames tell
+		if f.FourCC == FOURCC_AC3 || f.FourCC == FOURCC_EAC3 || f.FourCC == FOURCC_MP3 {
+			conf.update(f.FourCC, f.Data())
+		}
+	case f.PacketType == AUDIO_PACKET_TYPE_MULTICHANNEL_CONFIG:
+		if mc, err := ParseMultichannelConfig(f.Data()); err == nil {
+			conf.channels = mc.ChannelCount
+		}
+	}
+	f.Rate, f.BitSize, f.ChannelCount = conf.rate, conf.bitSize, conf.channels
+	switch conf.channels {
+	case 0:
+		f.Channels = AUDIO_TYPE_UNDEFINED
+	case 1:
+		f.Channels = AUDIO_TYPE_MONO
+	default:
+		f.Channels = AUDIO_TYPE_STEREO
+	}
+	return f
+}
+
+// trackAudio returns the audio configuration of track id.
+func (frReader *FlvReader) trackAudio(id byte) *audioConfig {
+	if id == 0 {
+		return &frReader.audio
+	}
+	if frReader.audioTracks == nil {
+		frReader.audioTracks = map[byte]*audioConfig{}
+	}
+	conf, ok := frReader.audioTracks[id]
+	if !ok {
+		conf = &audioConfig{bitSize: AUDIO_SIZE_UNDEFINED}
+		frReader.audioTracks[id] = conf
+	}
+	return conf
+}
+
+// update takes the sample rate, sample size and channel count from the
+// decoder configuration or frames of fourCC, leaving unknown ones as is.
+func (conf *audioConfig) update(fourCC FourCC, data []byte) {
+	switch fourCC {
+	case FOURCC_OPUS:
+		if head, err := ParseOpusHead(data); err == nil {
+			conf.rate, conf.channels = 48000, head.ChannelCount
+		}
+	case FOURCC_FLAC:
+		if si, err := ParseFLACStreamInfo(data); err == nil {
+			conf.rate, conf.channels = si.SampleRate, si.Channels
+			switch si.BitsPerSample {
+			case 8:
+				conf.bitSize = AUDIO_SIZE_8BIT
+			case 16:
+				conf.bitSize = AUDIO_SIZE_16BIT
+			}
+		}
+	case FOURCC_AAC:
+		if asc, err := ParseAudioSpecificConfig(data); err == nil {
+			conf.rate, conf.channels = asc.SampleRate, asc.ChannelConfiguration
+		}
+	case FOURCC_AC3, FOURCC_EAC3:
+		if si, err := ParseAC3SyncInfo(data); err == nil {
+			conf.rate, conf.channels = si.SampleRate, si.Channels
+		}
+	case FOURCC_MP3:
+		if h, err := ParseMP3FrameHeader(data); err == nil {
+			conf.rate, conf.channels = h.SampleRate, byte(h.Channels())
+		}
+	}
+}
+
+// Data returns the payload following the ExAudioTagHeader: the decoder
+// configuration of sequence starts, the coded frames or the multichannel
+// configuration. For multitrack or ModEx tags that could not be parsed it
+// is all of the tag but the first byte.
+func (f ExAudioFrame) Data() []byte {
+	return f.trackData()
+}
+
+func (f ExAudioFrame) headerLength() int {
+	n := modExLength(f.Body)
+	switch {
+	case f.PacketType == AUDIO_PACKET_TYPE_MULTITRACK || f.PacketType == AUDIO_PACKET_TYPE_MODEX:
+		return n + 1
+	case len(f.Body) > n && AudioPacketType(f.Body[n]&0x0F) == AUDIO_PACKET_TYPE_MULTITRACK:
+		return n + 7
+	}
+	return n + 5
+}
+
+// trackData returns the payload of the track in a multitrack tag.
+func (f ExAudioFrame) trackData() []byte {
+	if n := f.headerLength(); len(f.Body) >= n {
+		return f.Body[n:]
+	}
+	return nil
+}
+
+func (f ExAudioFrame) String() string {
+	s := fmt.Sprintf("%10d\t%d\t%d\t%s\t%s\t{%s,%d,%d channels,%d bytes}", f.CFrame.Stream, f.CFrame.Dts, f.CFrame.Position, f.CFrame.Type, f.FourCC, f.PacketType, f.Rate, f.ChannelCount, len(f.CFrame.Body))
+	if f.TrackId != 0 {
+		s += fmt.Sprintf(" track %d", f.TrackId)
+	}
+	return s
+}
+
+// MultichannelConfig is the channel layout of a multichannel configuration
+// packet: the native order lists the channels present in Flags, the custom
+// order maps every channel to a speaker position.
+type MultichannelConfig struct {
+	Order        AudioChannelOrder
+	ChannelCount byte
+	Mapping      []AudioChannel // custom order
+	Flags        uint32         // native order
+}
+
+func ParseMultichannelConfig(data []byte) (*MultichannelConfig, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("multichannel config of %d bytes", len(data))
+	}
+	mc := &MultichannelConfig{Order: AudioChannelOrder(data[0]), ChannelCount: data[1]}
+	switch mc.Order {
+	case AUDIO_CHANNEL_ORDER_CUSTOM:
+		if len(data) < 2+int(mc.ChannelCount) {
+			return nil, fmt.Errorf("custom channel mapping of %d channels in %d bytes", mc.ChannelCount, len(data)-2)
+		}
+		for _, c := range data[2 : 2+int(mc.ChannelCount)] {
+			mc.Mapping = append(mc.Mapping, AudioChannel(c))
+		}
+	case AUDIO_CHANNEL_ORDER_NATIVE:
+		if len(data) < 6 {
+			return nil, fmt.Errorf("native channel flags of %d bytes", len(data)-2)
+		}
+		mc.Flags = binary.BigEndian.Uint32(data[2:])
+	}
+	return mc, nil
+}
+
+// Bytes serializes the config as carried in multichannel config packets.
+func (mc *MultichannelConfig) Bytes() []byte {
+	buf := []byte{byte(mc.Order), mc.ChannelCount}
+	switch mc.Order {
+	case AUDIO_CHANNEL_ORDER_CUSTOM:
+		for _, c := range mc.Mapping {
+			buf = append(buf, byte(c))
+		}
+	case AUDIO_CHANNEL_ORDER_NATIVE:
+		buf = append(buf, byte(mc.Flags>>24), byte(mc.Flags>>16), byte(mc.Flags>>8), byte(mc.Flags))
+	}
+	return buf
+}
+
+// Channels returns the speaker positions in channel order, nil when the
+// order is unspecified.
+func (mc *MultichannelConfig) Channels() []AudioChannel {
+	switch mc.Order {
+	case AUDIO_CHANNEL_ORDER_CUSTOM:
+		return mc.Mapping
+	case AUDIO_CHANNEL_ORDER_NATIVE:
+		var channels []AudioChannel
+		for c := uint(0); c < 32; c++ {
+			if mc.Flags&(1<<c) != 0 {
+				channels = append(channels, AudioChannel(c))
+			}
+		}
+		return channels
+	}
+	return nil
+}
+
+func (mc *MultichannelConfig) String() string {
+	names := []string{}
+	for _, c := range mc.Channels() {
+		names = append(names, c.String())
+	}
+	return fmt.Sprintf("MultichannelConfig(%s, %d channels: %s)", mc.Order, mc.ChannelCount, strings.Join(names, " "))
+}
@@ -0,0 +1,146 @@
+package flv
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var (
+	testAC3Frame  = []byte{0x0B, 0x77, 0x00, 0x00, 0x1C, 0x40, 0xE1, 0x00}
+	testEAC3Frame = []byte{0x0B, 0x77, 0x01, 0x7F, 0x74, 0x80, 0x00, 0x00}
+)
+
+func TestOpusHead(t *testing.T) {
+	head := &OpusHead{Version: 1, ChannelCount: 6, PreSkip: 312, InputSampleRate: 44100, OutputGain: -256,
+		MappingFamily: 1, StreamCount: 4, CoupledCount: 2, ChannelMapping: []byte{0, 4, 1, 2, 3, 5}}
+	data := head.Bytes()
+	got, err := ParseOpusHead(data)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if !reflect.DeepEqual(got, head) {
+		t.Errorf("expect %s got %s", head, got)
+	}
+	if _, err := ParseOpusHead(data[:20]); err == nil {
+		t.Errorf("expect error on truncated channel mapping")
+	}
+}
+
+func TestFLACStreamInfo(t *testing.T) {
+	si := &FLACStreamInfo{MinBlockSize: 4096, MaxBlockSize: 4096, MinFrameSize: 14, MaxFrameSize: 12000,
+		SampleRate: 96000, Channels: 2, BitsPerSample: 24, TotalSamples: 0x123456789, MD5: [16]byte{1, 2, 3}}
+	data := si.Bytes()
+	for _, b := range [][]byte{data, data[8:], append([]byte{0x04, 0, 0, 2, 'x', 'y'}, data[4:]...)} {
+		got, err := ParseFLACStreamInfo(b)
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		if *got != *si {
+			t.Errorf("expect %s got %s", si, got)
+		}
+	}
+	if _, err := ParseFLACStreamInfo([]byte{0x84, 0, 0, 0}); err == nil {
+		t.Errorf("expect error without STREAMINFO")
+	}
+}
+
+func TestMultichannelConfig(t *testing.T) {
+	native := &MultichannelConfig{Order: AUDIO_CHANNEL_ORDER_NATIVE, ChannelCount: 6, Flags: 0x3F}
+	custom := &MultichannelConfig{Order: AUDIO_CHANNEL_ORDER_CUSTOM, ChannelCount: 3,
+		Mapping: []AudioChannel{AUDIO_CHANNEL_FRONT_CENTER, AUDIO_CHANNEL_FRONT_LEFT, AUDIO_CHANNEL_UNUSED}}
+	for _, mc := range []*MultichannelConfig{native, custom, {Order: AUDIO_CHANNEL_ORDER_UNSPECIFIED, ChannelCount: 4}} {
+		got, err := ParseMultichannelConfig(mc.Bytes())
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		if !reflect.DeepEqual(got, mc) {
+			t.Errorf("expect %s got %s", mc, got)
+		}
+	}
+	if s := native.String(); s != "MultichannelConfig(native, 6 channels: FL FR FC LFE BL BR)" {
+		t.Errorf("unexpected %s", s)
+	}
+	if _, err := ParseMultichannelConfig([]byte{2, 3, 0}); err == nil {
+		t.Errorf("expect error on truncated mapping")
+	}
+}
+
+func TestParseAC3SyncInfo(t *testing.T) {
+	for _, c := range []struct {
+		data     []byte
+		eac3     bool
+		rate     uint32
+		channels byte
+	}{
+		{testAC3Frame, false, 48000, 6},
+		{testEAC3Frame, true, 44100, 2},
+	} {
+		si, err := ParseAC3SyncInfo(c.data)
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		if si.EAC3 != c.eac3 || si.SampleRate != c.rate || si.Channels != c.channels {
+			t.Errorf("expect %v %d %d got %s", c.eac3, c.rate, c.channels, si)
+		}
+	}
+	if _, err := ParseAC3SyncInfo([]byte{0x0B, 0x78, 0, 0, 0, 0}); err == nil {
+		t.Errorf("expect syncword error")
+	}
+}
+
+func TestExAudioFrame(t *testing.T) {
+	head := (&OpusHead{Version: 1, ChannelCount: 2, PreSkip: 312, InputSampleRate: 44100}).Bytes()
+	mc := (&MultichannelConfig{Order: AUDIO_CHANNEL_ORDER_NATIVE, ChannelCount: 6, Flags: 0x3F}).Bytes()
+	si := (&FLACStreamInfo{SampleRate: 44100, Channels: 1, BitsPerSample: 16}).Bytes()
+	frames := []*CFrame{
+		NewExAudioFrame(0, AUDIO_PACKET_TYPE_SEQUENCE_START, FOURCC_OPUS, head).CFrame,
+		NewExAudioFrame(0, AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, []byte{0xFC}).CFrame,
+		NewExAudioFrame(20, AUDIO_PACKET_TYPE_MULTICHANNEL_CONFIG, FOURCC_OPUS, mc).CFrame,
+		NewExAudioFrame(20, AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, []byte{0xFC}).CFrame,
+		NewExAudioFrame(40, AUDIO_PACKET_TYPE_SEQUENCE_START, FOURCC_FLAC, si).CFrame,
+		NewExAudioFrame(40, AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_AC3, testAC3Frame).CFrame,
+		{Type: TAG_TYPE_AUDIO, Dts: 60, Body: []byte{0xAF, 0x01, 0x21}},
+	}
+	if !bytes.Equal(frames[0].Body[:5], []byte{0x90, 'O', 'p', 'u', 's'}) {
+		t.Errorf("unexpected header % x", frames[0].Body[:5])
+	}
+	got := readTestFile(t, writeTestFile(t, "exaudio.flv", frames))
+	if len(got) != len(frames) {
+		t.Fatalf("expect %d frames got %d", len(frames), len(got))
+	}
+
+	for i, c := range []struct {
+		packetType AudioPacketType
+		fourCC     FourCC
+		rate       uint32
+		channels   byte
+		bitSize    AudioSize
+		data       []byte
+	}{
+		{AUDIO_PACKET_TYPE_SEQUENCE_START, FOURCC_OPUS, 48000, 2, AUDIO_SIZE_UNDEFINED, head},
+		{AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, 48000, 2, AUDIO_SIZE_UNDEFINED, []byte{0xFC}},
+		{AUDIO_PACKET_TYPE_MULTICHANNEL_CONFIG, FOURCC_OPUS, 48000, 6, AUDIO_SIZE_UNDEFINED, mc},
+		{AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, 48000, 6, AUDIO_SIZE_UNDEFINED, []byte{0xFC}},
+		{AUDIO_PACKET_TYPE_SEQUENCE_START, FOURCC_FLAC, 44100, 1, AUDIO_SIZE_16BIT, si},
+		{AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_AC3, 48000, 6, AUDIO_SIZE_16BIT, testAC3Frame},
+	} {
+		f, ok := got[i].(ExAudioFrame)
+		if !ok {
+			t.Fatalf("frame %d: expect an ExAudioFrame got %T", i, got[i])
+		}
+		if f.PacketType != c.packetType || f.FourCC != c.fourCC || f.Rate != c.rate || f.ChannelCount != c.channels ||
+			f.BitSize != c.bitSize || f.CodecId != AUDIO_CODEC_EX_HEADER || !bytes.Equal(f.Data(), c.data) {
+			t.Errorf("frame %d: unexpected %s, %s, data % x", i, f, f.BitSize, f.Data())
+		}
+	}
+	if f := got[3].(ExAudioFrame); f.Channels != AUDIO_TYPE_STEREO {
+		t.Errorf("expect multichannel frames to be stereo got %s", f.Channels)
+	}
+	if !IsSequenceHeader(got[0]) || IsSequenceHeader(got[1]) || IsSequenceHeader(got[2]) {
+		t.Errorf("expect only sequence starts to be sequence headers")
+	}
+	if f, ok := got[6].(AudioFrame); !ok || f.CodecId != AUDIO_CODEC_AAC {
+		t.Errorf("expect a legacy AAC frame got %s", got[6])
+	}
+}
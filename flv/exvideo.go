@@ -0,0 +1,212 @@
+package flv
+
+import (
+	"fmt"
+)
+
+// ExVideoFrame is a video tag with the Enhanced RTMP ExVideoTagHeader: the
+// codec is identified by a FourCC instead of the 4 bit codec id, which is
+// left VIDEO_CODEC_UNDEFINED.
+type ExVideoFrame struct {
+	*VideoFrame
+	FrameType  VideoFrameType
+	PacketType VideoPacketType
+	FourCC     FourCC // empty for command frames
+	TrackId    byte   // of multitrack tags
+}
+
+// NewExVideoFrame builds an Enhanced RTMP video tag. The composition time is
+// only written in AVC and HEVC coded frames.
+func NewExVideoFrame(dts uint32, frameType VideoFrameType, packetType VideoPacketType, fourCC FourCC, cts int32, data []byte) ExVideoFrame {
+	body := append([]byte{0x80 | byte(frameType)<<4 | byte(packetType)}, fourCC...)
+	f := ExVideoFrame{FrameType: frameType, PacketType: packetType, FourCC: fourCC}
+	if f.hasCompositionTime() {
+		body = append(body, byte(cts>>16), byte(cts>>8), byte(cts))
+	}
+	flavor := FRAME
+	if frameType == VIDEO_FRAME_TYPE_KEYFRAME {
+		flavor = KEYFRAME
+	}
+	f.VideoFrame = &VideoFrame{
+		CFrame:  &CFrame{Type: TAG_TYPE_VIDEO, Dts: dts, Flavor: flavor, Body: append(body, data...)},
+		CodecId: VIDEO_CODEC_UNDEFINED,
+	}
+	return f
+}
+
+func (frReader *FlvReader) parseExVideoFrame(pFrame *CFrame) Frame {
+	if m, err := parseModEx(pFrame.Body); err == nil && VideoPacketType(m.packetType) == VIDEO_PACKET_TYPE_MULTITRACK {
+		return frReader.expandMultitrack(pFrame, frReader.parseExVideoTrack)
+	}
+	return frReader.parseExVideoTrack(pFrame)
+}
+
+// exVideoHeader decodes the ExVideoTagHeader of pFrame.
+func exVideoHeader(pFrame *CFrame) ExVideoFrame {
+	body := pFrame.Body
+	f := ExVideoFrame{
+		VideoFrame: &VideoFrame{CFrame: pFrame, CodecId: VIDEO_CODEC_UNDEFINED},
+		FrameType:  VideoFrameType(body[0] >> 4 & 0x07),
+		PacketType: VideoPacketType(body[0] & 0x0F),
+	}
+	// skip the ModEx wrappers, leaving the packet type they wrap in the
+	// low bits of body[0]
+	if m, err := parseModEx(body); err == nil {
+		f.PacketType = VideoPacketType(m.packetType)
+		body = body[m.length:]
+	}
+	switch {
+	case f.PacketType == VIDEO_PACKET_TYPE_MULTITRACK:
+		// tracks are split into one track tags, others are left as is
+		if len(body) >= 7 && AvMultitrackType(body[1]>>4) == AV_MULTITRACK_TYPE_ONE_TRACK {
+			f.PacketType = VideoPacketType(body[1] & 0x0F)
+			f.FourCC, f.TrackId = FourCC(body[2:6]), body[6]
+		}
+	case !f.isCommand() && len(body) >= 5:
+		// command frames carry a command byte instead of the FourCC
+		f.FourCC = FourCC(body[1:5])
+	}
+	return f
+}
+
+func (frReader *FlvReader) parseExVideoTrack(pFrame *CFrame) Frame {
+	f := exVideoHeader(pFrame)
+	pFrame.Flavor = FRAME
+	if f.FrameType == VIDEO_FRAME_TYPE_KEYFRAME {
+		pFrame.Flavor = KEYFRAME
+	}
+	width, height := frReader.trackSize(f.TrackId)
+	if pFrame.Filter {
+		// the payload is encrypted
+		f.Width, f.Height = *width, *height
+		return f
+	}
+	if f.PacketType == VIDEO_PACKET_TYPE_SEQUENCE_START {
+		if w, h := sequenceStartSize(f.FourCC, f.Data()); w > 0 {
+			*width, *height = w, h
+		}
+	}
+	// VP9 keeps the frame size in the uncompressed header of keyframes
+	if f.FourCC == FOURCC_VP9 && (f.PacketType == VIDEO_PACKET_TYPE_CODED_FRAMES || f.PacketType == VIDEO_PACKET_TYPE_CODED_FRAMES_X) {
+		if h, err := ParseVP9FrameHeader(f.Data()); err == nil && h.KeyFrame {
+			pFrame.Flavor = KEYFRAME
+			*width, *height = uint16(h.Width), uint16(h.Height)
+		}
+	}
+	f.Width, f.Height = *width, *height
+	return f
+}
+
+// trackSize returns where the dimensions of video track id are kept.
+func (frReader *FlvReader) trackSize(id byte) (width, height *uint16) {
+	if id == 0 {
+		return &frReader.width, &frReader.height
+	}
+	if frReader.videoTracks == nil {
+		frReader.videoTracks = map[byte]*[2]uint16{}
+	}
+	size, ok := frReader.videoTracks[id]
+	if !ok {
+		size = &[2]uint16{}
+		frReader.videoTracks[id] = size
+	}
+	return &size[0], &size[1]
+}
+
+// sequenceStartSize returns the dimensions in the decoder configuration
+// record of a sequence start, or 0 if they are unknown.
+func sequenceStartSize(fourCC FourCC, conf []byte) (width, height uint16) {
+	switch fourCC {
+	case FOURCC_HEVC:
+		rec, err := ParseHEVCConfRecord(conf)
+		if err != nil {
+			return
+		}
+		if spss := rec.NALUs(HEVC_NALU_TYPE_SPS); len(spss) > 0 {
+			if sps, err := ParseHEVCSPS(spss[0]); err == nil {
+				return uint16(sps.Width()), uint16(sps.Height())
+			}
+		}
+	case FOURCC_AV1:
+		rec, err := ParseAV1ConfRecord(conf)
+		if err != nil {
+			return
+		}
+		if sh, err := rec.SequenceHeader(); err == nil {
+			return uint16(sh.Width()), uint16(sh.Height())
+		}
+	}
+	return
+}
+
+func (f ExVideoFrame) isCommand() bool {
+	return f.FrameType == VIDEO_FRAME_TYPE_COMMAND && f.PacketType != VIDEO_PACKET_TYPE_METADATA
+}
+
+func (f ExVideoFrame) hasCompositionTime() bool {
+	return f.PacketType == VIDEO_PACKET_TYPE_CODED_FRAMES && (f.FourCC == FOURCC_AVC || f.FourCC == FOURCC_HEVC)
+}
+
+// trackHeaderLength is the length of the header up to the composition
+// time.
+func (f ExVideoFrame) trackHeaderLength() int {
+	n := modExLength(f.Body)
+	switch {
+	case f.PacketType == VIDEO_PACKET_TYPE_MULTITRACK || f.PacketType == VIDEO_PACKET_TYPE_MODEX:
+		return n + 1
+	case len(f.Body) > n && VideoPacketType(f.Body[n]&0x0F) == VIDEO_PACKET_TYPE_MULTITRACK:
+		return n + 7
+	case f.isCommand():
+		return n + 1
+	}
+	return n + 5
+}
+
+func (f ExVideoFrame) headerLength() int {
+	if f.hasCompositionTime() {
+		return f.trackHeaderLength() + 3
+	}
+	return f.trackHeaderLength()
+}
+
+// trackData returns the payload of the track in a multitrack tag.
+func (f ExVideoFrame) trackData() []byte {
+	if n := f.trackHeaderLength(); len(f.Body) >= n {
+		return f.Body[n:]
+	}
+	return nil
+}
+
+// CompositionTime returns the composition time offset (PTS - DTS) in ms;
+// it is 0 but for AVC and HEVC coded frames.
+func (f ExVideoFrame) CompositionTime() int32 {
+	n := f.trackHeaderLength()
+	if !f.hasCompositionTime() || len(f.Body) < n+3 {
+		return 0
+	}
+	ct := uint32(f.Body[n])<<16 | uint32(f.Body[n+1])<<8 | uint32(f.Body[n+2])
+	return int32(ct<<8) >> 8
+}
+
+// Data returns the payload following the ExVideoTagHeader: the decoder
+// configuration record of sequence starts, the coded frames, the AMF
+// encoded metadata or the command byte of command frames. For multitrack
+// or ModEx tags that could not be parsed it is all of the tag but the first
+// byte.
+func (f ExVideoFrame) Data() []byte {
+	if n := f.headerLength(); len(f.Body) >= n {
+		return f.Body[n:]
+	}
+	return nil
+}
+
+func (f ExVideoFrame) String() string {
+	s := fmt.Sprintf("%10d\t%d\t%d\t%s\t%s\t{%s,%dx%d,%d bytes}", f.CFrame.Stream, f.CFrame.Dts, f.CFrame.Position, f.CFrame.Type, f.FourCC, f.PacketType, f.Width, f.Height, len(f.CFrame.Body))
+	if f.TrackId != 0 {
+		s += fmt.Sprintf(" track %d", f.TrackId)
+	}
+	if f.Flavor == KEYFRAME {
+		s += " seekable"
+	}
+	return s
+}
@@ -0,0 +1,53 @@
+package flv
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExVideoFrame(t *testing.T) {
+	hvcc := []byte{0x01, 0x01, 0x60, 0x00}
+	frames := []*CFrame{
+		NewExVideoFrame(0, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_SEQUENCE_START, FOURCC_HEVC, 0, hvcc).CFrame,
+		NewExVideoFrame(0, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_HEVC, -40, []byte{0, 0, 0, 1, 0x26}).CFrame,
+		NewExVideoFrame(40, VIDEO_FRAME_TYPE_INTER_FRAME, VIDEO_PACKET_TYPE_CODED_FRAMES_X, FOURCC_HEVC, 0, []byte{0, 0, 0, 1, 0x02}).CFrame,
+		NewExVideoFrame(80, VIDEO_FRAME_TYPE_INTER_FRAME, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_AV1, 0, []byte{0x32, 0x00}).CFrame,
+		{Type: TAG_TYPE_VIDEO, Dts: 120, Body: []byte{0xD1, 0x01}},
+	}
+	if !bytes.Equal(frames[1].Body[:8], []byte{0x91, 'h', 'v', 'c', '1', 0xFF, 0xFF, 0xD8}) {
+		t.Errorf("unexpected header % x", frames[1].Body[:8])
+	}
+	got := readTestFile(t, writeTestFile(t, "ex.flv", frames))
+	if len(got) != len(frames) {
+		t.Fatalf("expect %d frames got %d", len(frames), len(got))
+	}
+
+	for i, c := range []struct {
+		packetType VideoPacketType
+		fourCC     FourCC
+		key        bool
+		cts        int32
+		data       []byte
+	}{
+		{VIDEO_PACKET_TYPE_SEQUENCE_START, FOURCC_HEVC, true, 0, hvcc},
+		{VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_HEVC, true, -40, []byte{0, 0, 0, 1, 0x26}},
+		{VIDEO_PACKET_TYPE_CODED_FRAMES_X, FOURCC_HEVC, false, 0, []byte{0, 0, 0, 1, 0x02}},
+		{VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_AV1, false, 0, []byte{0x32, 0x00}},
+		{VIDEO_PACKET_TYPE_CODED_FRAMES, "", false, 0, []byte{0x01}},
+	} {
+		f, ok := got[i].(ExVideoFrame)
+		if !ok {
+			t.Fatalf("frame %d: expect an ExVideoFrame got %T", i, got[i])
+		}
+		if f.PacketType != c.packetType || f.FourCC != c.fourCC || (f.Flavor == KEYFRAME) != c.key ||
+			f.CompositionTime() != c.cts || !bytes.Equal(f.Data(), c.data) {
+			t.Errorf("frame %d: unexpected %s, cts %d, data % x", i, f, f.CompositionTime(), f.Data())
+		}
+	}
+	if !IsSequenceHeader(got[0]) || IsSequenceHeader(got[1]) {
+		t.Errorf("expect only the sequence start to be a sequence header")
+	}
+	if got[4].(ExVideoFrame).FrameType != VIDEO_FRAME_TYPE_COMMAND {
+		t.Errorf("expect a command frame")
+	}
+}
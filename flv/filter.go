@@ -0,0 +1,174 @@
+package flv
+
+import (
+	"fmt"
+)
+
+const (
+	FILTER_ENCRYPTION = "Encryption"
+	FILTER_SE         = "SE" // selective encryption
+
+	filterIVLength = 16
+)
+
+// FilterHeader is the EncryptionTagHeader and FilterParams in front of the
+// encrypted payload of filtered tags.
+type FilterHeader struct {
+	NumFilters  byte
+	Name        string
+	EncryptedAU bool   // always set by the Encryption filter
+	IV          []byte // if EncryptedAU
+	Data        []byte // payload following the FilterParams
+}
+
+func (h *FilterHeader) String() string {
+	return fmt.Sprintf("FilterHeader(%s, encrypted: %v, iv: % x, %d bytes)", h.Name, h.EncryptedAU, h.IV, len(h.Data))
+}
+
+// ParseFilterHeader parses the EncryptionTagHeader and FilterParams data
+// starts with.
+func ParseFilterHeader(data []byte) (*FilterHeader, error) {
+	if len(data) < 3 {
+		return nil, fmt.Errorf("EncryptionTagHeader of %d bytes", len(data))
+	}
+	h := &FilterHeader{NumFilters: data[0]}
+	if h.NumFilters != 1 {
+		return nil, fmt.Errorf("%d filters, only 1 is supported", h.NumFilters)
+	}
+	nameLen := int(data[1])<<8 | int(data[2])
+	if len(data) < 3+nameLen+3 {
+		return nil, fmt.Errorf("truncated EncryptionTagHeader")
+	}
+	h.Name = string(data[3 : 3+nameLen])
+	pos := 3 + nameLen
+	length := int(data[pos])<<16 | int(data[pos+1])<<8 | int(data[pos+2])
+	pos += 3
+	if len(data) < pos+length {
+		return nil, fmt.Errorf("FilterParams of %d bytes in %d", length, len(data)-pos)
+	}
+	params := data[pos : pos+length]
+	switch h.Name {
+	case FILTER_ENCRYPTION:
+		if len(params) < filterIVLength {
+			return nil, fmt.Errorf("EncryptionFilterParams of %d bytes", len(params))
+		}
+		h.EncryptedAU, h.IV = true, params[:filterIVLength]
+	case FILTER_SE:
+		if len(params) < 1 {
+			return nil, fmt.Errorf("empty SelectiveEncryptionFilterParams")
+		}
+		h.EncryptedAU = params[0]&0x80 != 0
+		if h.EncryptedAU {
+			if len(params) < 1+filterIVLength {
+				return nil, fmt.Errorf("SelectiveEncryptionFilterParams of %d bytes", len(params))
+			}
+			h.IV = params[1 : 1+filterIVLength]
+		}
+	default:
+		return nil, fmt.Errorf("unknown filter %q", h.Name)
+	}
+	h.Data = data[pos+length:]
+	return h, nil
+}
+
+// Bytes serializes the EncryptionTagHeader, FilterParams and payload.
+func (h *FilterHeader) Bytes() []byte {
+	var params []byte
+	if h.Name == FILTER_SE {
+		if h.EncryptedAU {
+			params = append([]byte{0x80}, h.IV...)
+		} else {
+			params = []byte{0}
+		}
+	} else {
+		params = h.IV
+	}
+	buf := []byte{1, byte(len(h.Name) >> 8), byte(len(h.Name))}
+	buf = append(buf, h.Name...)
+	buf = append(buf, byte(len(params)>>16), byte(len(params)>>8), byte(len(params)))
+	return append(append(buf, params...), h.Data...)
+}
+
+// Decrypter returns the decrypted payload of the filtered tag f.
+type Decrypter func(f *CFrame, h *FilterHeader) ([]byte, error)
+
+// filterOffset returns where the EncryptionTagHeader of a filtered tag
+// starts: the audio and video tag headers, legacy or Enhanced RTMP, stay in
+// the clear.
+func (f *CFrame) filterOffset() int {
+	if len(f.Body) == 0 {
+		return 0
+	}
+	switch f.Type {
+	case TAG_TYPE_AUDIO:
+		switch AudioCodec(f.Body[0] >> 4) {
+		case AUDIO_CODEC_EX_HEADER:
+			return exAudioHeader(f).headerLength()
+		case AUDIO_CODEC_AAC:
+			return 2
+		}
+		return 1
+	case TAG_TYPE_VIDEO:
+		switch {
+		case f.Body[0]&0x80 != 0:
+			return exVideoHeader(f).headerLength()
+		case VideoCodec(f.Body[0]&0x0F) == VIDEO_CODEC_AVC:
+			return 5
+		}
+		return 1
+	}
+	return 0
+}
+
+// FilterHeader parses the encryption header of a filtered tag.
+func (f *CFrame) FilterHeader() (*FilterHeader, error) {
+	if !f.Filter {
+		return nil, fmt.Errorf("tag is not filtered")
+	}
+	n := f.filterOffset()
+	if len(f.Body) < n {
+		return nil, fmt.Errorf("filtered tag of %d bytes", len(f.Body))
+	}
+	return ParseFilterHeader(f.Body[n:])
+}
+
+// SetFilter encrypts the tag: the payload following the tag header is
+// replaced with h, whose Data has to be the encrypted payload.
+func (f *CFrame) SetFilter(h *FilterHeader) {
+	n := f.filterOffset()
+	f.Body = append(f.Body[:n:n], h.Bytes()...)
+	f.Filter = true
+}
+
+// decrypt replaces the encrypted payload of a filtered tag with the one
+// returned by the decrypter, leaving the tag as is if that fails.
+func (f *CFrame) decrypt(decrypt Decrypter) error {
+	if !f.Filter || decrypt == nil {
+		return nil
+	}
+	h, err := f.FilterHeader()
+	if err != nil {
+		return err
+	}
+	data, err := decrypt(f, h)
+	if err != nil {
+		return err
+	}
+	n := f.filterOffset()
+	f.Body = append(f.Body[:n:n], data...)
+	f.Filter = false
+	return nil
+}
+
+// validTagStart tells if b may start a tag: the reserved bits are 0 unless
+// AllowReserved is set.
+func (frReader *FlvReader) validTagStart(b byte) bool {
+	if b&0xC0 != 0 && !frReader.AllowReserved {
+		return false
+	}
+	switch TagType(b & 0x1F) {
+	case TAG_TYPE_AUDIO, TAG_TYPE_VIDEO, TAG_TYPE_META:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package flv
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// xorFilter stands in for the cipher: every byte is xored with the IV's
+// first one.
+func xorFilter(iv []byte, data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = b ^ iv[0]
+	}
+	return out
+}
+
+func TestFilterHeader(t *testing.T) {
+	iv := bytes.Repeat([]byte{0x5A}, 16)
+	for _, h := range []*FilterHeader{
+		{NumFilters: 1, Name: FILTER_ENCRYPTION, EncryptedAU: true, IV: iv, Data: []byte{1, 2}},
+		{NumFilters: 1, Name: FILTER_SE, EncryptedAU: true, IV: iv, Data: []byte{3}},
+		{NumFilters: 1, Name: FILTER_SE, Data: []byte{4, 5, 6}},
+	} {
+		got, err := ParseFilterHeader(h.Bytes())
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		if got.Name != h.Name || got.EncryptedAU != h.EncryptedAU || !bytes.Equal(got.IV, h.IV) || !bytes.Equal(got.Data, h.Data) {
+			t.Errorf("expect %s got %s", h, got)
+		}
+	}
+	for _, data := range [][]byte{
+		{2, 0, 2, 'S', 'E', 0, 0, 1, 0},
+		{1, 0, 3, 'R', 'O', 'T', 0, 0, 0},
+		{1, 0, 2, 'S', 'E', 0, 0, 17, 0x80},
+	} {
+		if _, err := ParseFilterHeader(data); err == nil {
+			t.Errorf("expect error on % x", data)
+		}
+	}
+}
+
+func TestFilteredTags(t *testing.T) {
+	iv := bytes.Repeat([]byte{0x5A}, 16)
+	conf := NewAVCConfRecord([][]byte{testSPS()}, [][]byte{{0x68, 0xCE, 0x38, 0x80}}).Bytes()
+	frames := []*CFrame{
+		{Type: TAG_TYPE_META, Body: []byte{2, 0, 4, 't', 'e', 's', 't'}},
+		testVideoTag(0, true, VIDEO_AVC_SEQUENCE_HEADER),
+		testAudioTag(0, AUDIO_AAC_RAW),
+		testVideoTag(40, false, VIDEO_AVC_NALU),
+	}
+	frames[1].Body = append(frames[1].Body[:5], conf...)
+	clear := make([][]byte, len(frames))
+	for i, f := range frames[:3] {
+		clear[i] = append([]byte{}, f.Body...)
+		n := f.filterOffset()
+		name := FILTER_ENCRYPTION
+		if f.Type == TAG_TYPE_AUDIO {
+			name = FILTER_SE
+		}
+		f.SetFilter(&FilterHeader{Name: name, EncryptedAU: true, IV: iv, Data: xorFilter(iv, f.Body[n:])})
+	}
+	if frames[0].tagType() != 0x32 || frames[2].tagType() != 0x28 || frames[3].tagType() != 0x09 {
+		t.Errorf("unexpected tag types %02x %02x %02x", frames[0].tagType(), frames[2].tagType(), frames[3].tagType())
+	}
+	path := writeTestFile(t, "filtered.flv", frames)
+
+	// passed through encrypted, not taken for broken tags
+	got := readTestFile(t, path)
+	if len(got) != len(frames) {
+		t.Fatalf("expect %d frames got %d", len(frames), len(got))
+	}
+	for i, fr := range got {
+		if fr.GetType() != frames[i].Type || !bytes.Equal(*fr.GetBody(), frames[i].Body) {
+			t.Errorf("frame %d: unexpected %s", i, fr)
+		}
+	}
+	v := got[1].(AVCVideoFrame)
+	if !v.Filter || v.Width != 0 || v.Flavor != KEYFRAME {
+		t.Errorf("expect the encrypted sequence header left alone got %s", v)
+	}
+	h, err := v.FilterHeader()
+	if err != nil || h.Name != FILTER_ENCRYPTION || !bytes.Equal(h.IV, iv) || !bytes.Equal(xorFilter(iv, h.Data), conf) {
+		t.Errorf("unexpected filter header %v, %v", h, err)
+	}
+	if _, err := got[3].(AVCVideoFrame).FilterHeader(); err == nil {
+		t.Errorf("expect error on a clear tag")
+	}
+
+	// copied as is
+	out := new(bytes.Buffer)
+	out.Write(NewHeader(true, true).Body)
+	for _, fr := range got {
+		fr.WriteFrame(out)
+	}
+	if orig, _ := ioutil.ReadFile(path); !bytes.Equal(orig, out.Bytes()) {
+		t.Errorf("expect the filtered tags to be copied as is")
+	}
+
+	// decrypted through the hook
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := NewReader(f)
+	r.Decrypt = func(f *CFrame, h *FilterHeader) ([]byte, error) {
+		return xorFilter(h.IV, h.Data), nil
+	}
+	r.ReadHeader()
+	for i := range frames {
+		fr, rerr := r.ReadFrame()
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		if i < 3 && !bytes.Equal(*fr.GetBody(), clear[i]) {
+			t.Errorf("frame %d: expect % x got % x", i, clear[i], *fr.GetBody())
+		}
+		if v, ok := fr.(AVCVideoFrame); ok && (v.Filter || v.Width != 320) {
+			t.Errorf("frame %d: expect a decrypted 320x240 frame got %s", i, v)
+		}
+	}
+}
+
+func TestUndecryptable(t *testing.T) {
+	iv := bytes.Repeat([]byte{0x5A}, 16)
+	frames := []*CFrame{
+		testVideoTag(0, true, VIDEO_AVC_NALU),
+		testAudioTag(0, AUDIO_AAC_RAW),
+		testVideoTag(40, false, VIDEO_AVC_NALU),
+	}
+	frames[0].SetFilter(&FilterHeader{Name: FILTER_ENCRYPTION, EncryptedAU: true, IV: iv, Data: []byte{1}})
+	frames[1].SetFilter(&FilterHeader{Name: FILTER_ENCRYPTION, EncryptedAU: true, IV: iv, Data: []byte{2}})
+	frames[1].Body = frames[1].Body[:4] // cut in the EncryptionTagHeader
+	f, err := os.Open(writeTestFile(t, "filtered.flv", frames))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := NewReader(f)
+	r.Decrypt = func(f *CFrame, h *FilterHeader) ([]byte, error) {
+		return nil, fmt.Errorf("no key")
+	}
+	var failed []string
+	r.Undecryptable = func(f *CFrame, err error) {
+		failed = append(failed, fmt.Sprintf("%d %s", f.Type, err))
+	}
+	r.ReadHeader()
+	for i := range frames {
+		fr, rerr := r.ReadFrame()
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		if !bytes.Equal(*fr.GetBody(), frames[i].Body) {
+			t.Errorf("frame %d: expect the tag passed through got % x", i, *fr.GetBody())
+		}
+	}
+	if len(failed) != 2 || failed[0] != "9 no key" || failed[1] != "8 EncryptionTagHeader of 2 bytes" {
+		t.Errorf("unexpected failures %q", failed)
+	}
+}
+
+func TestFilterOffsetEnhanced(t *testing.T) {
+	iv := bytes.Repeat([]byte{0x5A}, 16)
+	hevc := NewExVideoFrame(40, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_HEVC, -40, []byte{0, 0, 0, 1, 0x26})
+	hevcX := NewExVideoFrame(40, VIDEO_FRAME_TYPE_INTER_FRAME, VIDEO_PACKET_TYPE_CODED_FRAMES_X, FOURCC_HEVC, 0, []byte{0, 0, 0, 1, 0x02})
+	modExVideo := NewExVideoFrame(40, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_HEVC, 0, []byte{0, 0, 0, 1, 0x26})
+	modExVideo.SetTimestampOffsetNano(123456)
+	opus := NewExAudioFrame(60, AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, []byte{0xFC, 1})
+	modExAudio := NewExAudioFrame(60, AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, []byte{0xFC, 2})
+	modExAudio.SetTimestampOffsetNano(500)
+	for _, fr := range []Frame{hevc, hevcX, modExVideo, opus, modExAudio} {
+		var f *CFrame
+		var data []byte
+		switch v := fr.(type) {
+		case ExVideoFrame:
+			f, data = v.CFrame, v.Data()
+		case ExAudioFrame:
+			f, data = v.CFrame, v.Data()
+		}
+		orig := append([]byte{}, f.Body...)
+		n := len(orig) - len(data)
+		if got := f.filterOffset(); got != n {
+			t.Errorf("%s: expect the clear header of %d bytes got %d", fr, n, got)
+			continue
+		}
+		f.SetFilter(&FilterHeader{NumFilters: 1, Name: FILTER_ENCRYPTION, EncryptedAU: true, IV: iv, Data: xorFilter(iv, data)})
+		h, err := f.FilterHeader()
+		if err != nil || !bytes.Equal(f.Body[:n], orig[:n]) || !bytes.Equal(xorFilter(iv, h.Data), data) {
+			t.Errorf("%s: unexpected filtered tag % x, %v", fr, f.Body, err)
+		}
+	}
+}
+
+func TestFilteredConfig(t *testing.T) {
+	iv := bytes.Repeat([]byte{0x5A}, 16)
+	opus := (&OpusHead{Version: 1, ChannelCount: 2}).Bytes()
+	frames := []*CFrame{
+		NewExAudioFrame(0, AUDIO_PACKET_TYPE_SEQUENCE_START, FOURCC_OPUS, opus).CFrame,
+		NewExAudioFrame(20, AUDIO_PACKET_TYPE_SEQUENCE_START, FOURCC_OPUS, opus).CFrame,
+		NewExAudioFrame(40, AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, []byte{0xFC}).CFrame,
+	}
+	frames[1].SetFilter(&FilterHeader{Name: FILTER_ENCRYPTION, EncryptedAU: true, IV: iv, Data: xorFilter(iv, opus)})
+	got := readTestFile(t, writeTestFile(t, "filtered.flv", frames))
+	if len(got) != len(frames) {
+		t.Fatalf("expect %d frames got %d", len(frames), len(got))
+	}
+	for i, fr := range got {
+		if a := fr.(ExAudioFrame); a.Rate != 48000 || a.ChannelCount != 2 {
+			t.Errorf("frame %d: expect the configuration kept over the encrypted one got %s", i, a)
+		}
+	}
+}
+
+func TestReservedBits(t *testing.T) {
+	frames := []*CFrame{testVideoTag(0, true, VIDEO_AVC_NALU)}
+	frames[0].Reserved = 2
+	path := writeTestFile(t, "reserved.flv", frames)
+	for _, allow := range []bool{false, true} {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewReader(f)
+		r.AllowReserved = allow
+		r.ReadHeader()
+		fr, rerr := r.ReadFrame()
+		f.Close()
+		switch {
+		case !allow && rerr == nil:
+			t.Errorf("expect the reserved bits rejected got %s", fr)
+		case allow && (rerr != nil || fr.(AVCVideoFrame).Reserved != 2):
+			t.Errorf("expect the reserved bits kept got %v, %v", fr, rerr)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package flv
+
+import (
+	"fmt"
+)
+
+const (
+	flacStreamInfoLength = 34
+)
+
+// FLACStreamInfo is the STREAMINFO metadata block carried by FLAC sequence
+// starts.
+type FLACStreamInfo struct {
+	MinBlockSize  uint16
+	MaxBlockSize  uint16
+	MinFrameSize  uint32
+	MaxFrameSize  uint32
+	SampleRate    uint32
+	Channels      byte
+	BitsPerSample byte
+	TotalSamples  uint64
+	MD5           [16]byte
+}
+
+func (si *FLACStreamInfo) String() string {
+	return fmt.Sprintf("FLACStreamInfo(rate: %d, channels: %d, %d bit, %d samples)",
+		si.SampleRate, si.Channels, si.BitsPerSample, si.TotalSamples)
+}
+
+// ParseFLACStreamInfo finds the STREAMINFO block in the metadata blocks of
+// data, which may start with the "fLaC" marker, or takes data as the bare
+// block.
+func ParseFLACStreamInfo(data []byte) (*FLACStreamInfo, error) {
+	if len(data) >= 4 && string(data[:4]) == "fLaC" {
+		data = data[4:]
+	}
+	if len(data) != flacStreamInfoLength {
+		for {
+			if len(data) < 4 {
+				return nil, fmt.Errorf("no FLAC STREAMINFO block")
+			}
+			blockType := data[0] & 0x7F
+			length := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+			if len(data) < 4+length {
+				return nil, fmt.Errorf("FLAC metadata block of %d bytes in %d", length, len(data)-4)
+			}
+			if blockType == 0 {
+				data = data[4 : 4+length]
+				break
+			}
+			if data[0]&0x80 != 0 {
+				return nil, fmt.Errorf("no FLAC STREAMINFO block")
+			}
+			data = data[4+length:]
+		}
+	}
+	if len(data) < flacStreamInfoLength {
+		return nil, fmt.Errorf("FLAC STREAMINFO of %d bytes", len(data))
+	}
+	si := &FLACStreamInfo{
+		MinBlockSize:  uint16(data[0])<<8 | uint16(data[1]),
+		MaxBlockSize:  uint16(data[2])<<8 | uint16(data[3]),
+		MinFrameSize:  uint32(data[4])<<16 | uint32(data[5])<<8 | uint32(data[6]),
+		MaxFrameSize:  uint32(data[7])<<16 | uint32(data[8])<<8 | uint32(data[9]),
+		SampleRate:    uint32(data[10])<<12 | uint32(data[11])<<4 | uint32(data[12])>>4,
+		Channels:      data[12]>>1&0x07 + 1,
+		BitsPerSample: (data[12]&1)<<4 | data[13]>>4 + 1,
+		TotalSamples:  uint64(data[13]&0x0F)<<32 | uint64(data[14])<<24 | uint64(data[15])<<16 | uint64(data[16])<<8 | uint64(data[17]),
+	}
+	copy(si.MD5[:], data[18:34])
+	return si, nil
+}
+
+// Bytes serializes the block as carried in FLAC sequence starts: the
+// "fLaC" marker and STREAMINFO as the last metadata block.
+func (si *FLACStreamInfo) Bytes() []byte {
+	buf := []byte{'f', 'L', 'a', 'C', 0x80, 0, 0, flacStreamInfoLength,
+		byte(si.MinBlockSize >> 8), byte(si.MinBlockSize),
+		byte(si.MaxBlockSize >> 8), byte(si.MaxBlockSize),
+		byte(si.MinFrameSize >> 16), byte(si.MinFrameSize >> 8), byte(si.MinFrameSize),
+		byte(si.MaxFrameSize >> 16), byte(si.MaxFrameSize >> 8), byte(si.MaxFrameSize),
+		byte(si.SampleRate >> 12), byte(si.SampleRate >> 4),
+		byte(si.SampleRate<<4) | (si.Channels-1)<<1 | (si.BitsPerSample-1)>>4,
+		(si.BitsPerSample-1)<<4 | byte(si.TotalSamples>>32)&0x0F,
+		byte(si.TotalSamples >> 24), byte(si.TotalSamples >> 16), byte(si.TotalSamples >> 8), byte(si.TotalSamples),
+	}
+	return append(buf, si.MD5[:]...)
+}
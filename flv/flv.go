@@ -28,6 +28,8 @@ type CFrame struct {
 	Stream      uint32
 	Dts         uint32
 	Type        TagType
+	Reserved    byte // the 2 bits above Filter
+	Filter      bool // encrypted, see FilterHeader
 	Flavor      Flavor
 	Position    int64
 	Body        []byte
@@ -61,7 +63,7 @@ type MetaFrame struct {
 func (f *CFrame) WriteFrame(w io.Writer) error {
 	bl := uint32(len(f.Body))
 	var err error
-	err = writeType(w, f.Type)
+	err = writeType(w, f.tagType())
 	if err != nil {
 		return err
 	}
@@ -89,12 +91,66 @@ func (f *CFrame) SetDts(dts uint32) {
 func (f *CFrame) GetType() TagType {
 	return f.Type
 }
+func (f *CFrame) GetFlavor() Flavor {
+	return f.Flavor
+}
+func (f *CFrame) GetPosition() int64 {
+	return f.Position
+}
 func (f *CFrame) GetPrevTagSize() uint32 {
 	return f.PrevTagSize
 }
 
-func writeType(w io.Writer, t TagType) error {
-	_, err := w.Write([]byte{byte(t)})
+// IsSequenceHeader reports whether fr carries decoder configuration: an AVC
+// or Enhanced RTMP sequence header or an AAC AudioSpecificConfig.
+func IsSequenceHeader(fr Frame) bool {
+	switch f := fr.(type) {
+	case AVCVideoFrame:
+		return f.PacketType == VIDEO_AVC_SEQUENCE_HEADER
+	case ExVideoFrame:
+		return f.PacketType == VIDEO_PACKET_TYPE_SEQUENCE_START || f.PacketType == VIDEO_PACKET_TYPE_MPEG2TS_SEQUENCE_START
+	case ExAudioFrame:
+		return f.PacketType == AUDIO_PACKET_TYPE_SEQUENCE_START
+	case AudioFrame:
+		return f.CodecId == AUDIO_CODEC_AAC && len(f.Body) > 1 && AudioAac(f.Body[1]) == AUDIO_AAC_SEQUENCE_HEADER
+	}
+	return false
+}
+
+// IsKeyframe reports whether fr is a video frame playback can start from.
+func IsKeyframe(fr Frame) bool {
+	return fr.GetType() == TAG_TYPE_VIDEO && FlavorOf(fr) == KEYFRAME && !IsSequenceHeader(fr)
+}
+
+// FlavorOf returns the Flavor of frames built on CFrame, FRAME for others.
+func FlavorOf(fr Frame) Flavor {
+	if f, ok := fr.(interface{ GetFlavor() Flavor }); ok {
+		return f.GetFlavor()
+	}
+	return FRAME
+}
+
+// PositionOf returns the file position frames built on CFrame were read
+// from, -1 for others.
+func PositionOf(fr Frame) int64 {
+	if f, ok := fr.(interface{ GetPosition() int64 }); ok {
+		return f.GetPosition()
+	}
+	return -1
+}
+
+// tagType returns the first tag header byte: reserved bits, Filter and
+// TagType.
+func (f *CFrame) tagType() byte {
+	b := f.Reserved<<6 | byte(f.Type)&0x1F
+	if f.Filter {
+		b |= 0x20
+	}
+	return b
+}
+
+func writeType(w io.Writer, t byte) error {
+	_, err := w.Write([]byte{t})
 	return err
 }
 
@@ -147,6 +203,24 @@ func (f AVCVideoFrame) String() string {
 	return s
 }
 
+// CompositionTime returns the composition time offset (PTS - DTS) in ms.
+func (f AVCVideoFrame) CompositionTime() int32 {
+	if len(f.Body) < 5 {
+		return 0
+	}
+	ct := (uint32(f.Body[2]) << 16) | (uint32(f.Body[3]) << 8) | (uint32(f.Body[4]) << 0)
+	return int32(ct<<8) >> 8
+}
+
+// Data returns the AVC payload following the 5 byte video tag header: the
+// decoder configuration record or length-prefixed NAL units.
+func (f AVCVideoFrame) Data() []byte {
+	if len(f.Body) < 5 {
+		return nil
+	}
+	return f.Body[5:]
+}
+
 func (f AudioFrame) String() string {
 	return fmt.Sprintf("%10d\t%d\t%d\t%s\t%s\t{%d,%s,%s,%d bytes}", f.CFrame.Stream, f.CFrame.Dts, f.CFrame.Position, f.CFrame.Type, f.CodecId, f.Rate, f.BitSize, f.Channels, len(f.CFrame.Body))
 }
@@ -181,9 +255,28 @@ func (f MetaFrame) String() string {
 
 type FlvReader struct {
 	InFile *os.File
+	// Decrypt decrypts filtered tags, which are passed through encrypted
+	// if it is nil
+	Decrypt Decrypter
+	// Undecryptable is told about the filtered tags Decrypt failed on,
+	// which are passed through encrypted
+	Undecryptable func(f *CFrame, err error)
+	// AllowReserved accepts tags with the reserved bits set, which are
+	// taken for garbage otherwise
+	AllowReserved bool
 	width  uint16
 	height uint16
+	audio  audioConfig
 	size   int64
+	// first MP3 frame and its Xing, Info or VBRI header
+	mp3    *MP3FrameHeader
+	mp3VBR *MP3VBRHeader
+
+	// state of the other tracks of multitrack tags
+	videoTracks map[byte]*[2]uint16
+	audioTracks map[byte]*audioConfig
+	// track frames of the last multitrack tag not returned yet
+	pending []Frame
 }
 
 func NewReader(inFile *os.File) *FlvReader {
@@ -192,10 +285,24 @@ func NewReader(inFile *os.File) *FlvReader {
 		InFile: inFile,
 		width:  0,
 		height: 0,
+		audio:  audioConfig{bitSize: AUDIO_SIZE_UNDEFINED},
 		size:   fi.Size(),
 	}
 }
 
+// NewHeader creates a version 1 file header announcing the given tracks.
+func NewHeader(hasAudio, hasVideo bool) *Header {
+	flags := byte(0)
+	if hasAudio {
+		flags |= 0x04
+	}
+	if hasVideo {
+		flags |= 0x01
+	}
+	body := []byte{'F', 'L', 'V', 1, flags, 0, 0, 0, byte(HEADER_LENGTH), 0, 0, 0, 0}
+	return &Header{Version: (uint16(1) << 8) | uint16(flags), Body: body}
+}
+
 type FlvWriter struct {
 	OutFile *os.File
 }
@@ -240,6 +347,7 @@ func (fr *FlvReader) Recover(e Error, scanLength int) (broken Frame, err error,
 	}
 	// fmt.Printf("\n%v %d\n", re, scanLength)
 
+	fr.pending = nil
 	scanStart := re.position
 	readStart := re.position
 	scanBuf := []byte{}
@@ -260,10 +368,9 @@ func (fr *FlvReader) Recover(e Error, scanLength int) (broken Frame, err error,
 
 	scanBuf = append(scanBuf, b...)
 	// fmt.Printf("%v\n", scanBuf)
-	validTagStart := []byte{8, 9, 18}
 	seekLength = 0
 	for {
-		for ;(seekLength<scanLength) && (bytes.IndexByte(validTagStart, scanBuf[seekLength]) == -1);seekLength++ {
+		for ;(seekLength<scanLength) && !fr.validTagStart(scanBuf[seekLength]);seekLength++ {
 		}
 		if seekLength == scanLength {
 			return nil, fmt.Errorf("no valid frames @[%d-%d]", scanStart, int(scanStart)+seekLength), seekLength
@@ -309,11 +416,10 @@ func (frReader *FlvReader) readFrame() (*CFrame, Error) {
 		return nil, Unrecoverable(err.Error(), curPos)
 	}
 
-	validTagStart := []byte{8, 9, 18}
-	if bytes.IndexByte(validTagStart, tagHeaderB[0]) == -1 {
+	if !frReader.validTagStart(tagHeaderB[0]) {
 		return nil, InvalidTagStart(curPos)
 	}
-	tagType := TagType(tagHeaderB[0])
+	tagType := TagType(tagHeaderB[0] & 0x1F)
 
 	bodyLen := (uint32(tagHeaderB[1]) << 16) | (uint32(tagHeaderB[2]) << 8) | (uint32(tagHeaderB[3]) << 0)
 	ts := (uint32(tagHeaderB[4]) << 16) | (uint32(tagHeaderB[5]) << 8) | (uint32(tagHeaderB[6]) << 0)
@@ -340,6 +446,8 @@ func (frReader *FlvReader) readFrame() (*CFrame, Error) {
 		Stream:      stream,
 		Dts:         dts,
 		Type:        tagType,
+		Reserved:    tagHeaderB[0] >> 6,
+		Filter:      tagHeaderB[0]&0x20 != 0,
 		Position:    curPos,
 		Body:        bodyBuf,
 		PrevTagSize: prevTagSize,
@@ -361,6 +469,10 @@ func (frReader *FlvReader) parseFrame(pFrame *CFrame) (resFrame Frame) {
 		resFrame = MetaFrame{CFrame: pFrame}
 	case TAG_TYPE_VIDEO:
 		if len(bodyBuf) > 0 {
+			if bodyBuf[0]&0x80 != 0 {
+				resFrame = frReader.parseExVideoFrame(pFrame)
+				break
+			}
 			vft := VideoFrameType(uint8(bodyBuf[0]) >> 4)
 			codecId := VideoCodec(uint8(bodyBuf[0]) & 0x0F)
 			switch vft {
@@ -371,14 +483,18 @@ func (frReader *FlvReader) parseFrame(pFrame *CFrame) (resFrame Frame) {
 			}
 
 			switch {
-			case codecId == VIDEO_CODEC_ON2VP6 && vft == VIDEO_FRAME_TYPE_KEYFRAME:
-				hHelper := (uint16(bodyBuf[1]) >> 4) & 0x0F
-				wHelper := uint16(bodyBuf[1]) & 0x0F
-				w := uint16(bodyBuf[5])
-				h := uint16(bodyBuf[6])
-
-				frReader.width = w*16 - wHelper
-				frReader.height = h*16 - hHelper
+			case pFrame.Filter:
+				// the payload is encrypted
+			case codecId == VIDEO_CODEC_SORENSON:
+				// every picture header has the dimensions
+				if h, err := ParseH263PictureHeader(bodyBuf[1:]); err == nil {
+					frReader.width, frReader.height = h.Width, h.Height
+				}
+			case codecId == VIDEO_CODEC_ON2VP6 || codecId == VIDEO_CODEC_ON2VP6_ALPHA:
+				p, err := ParseVP6Packet(bodyBuf[1:], codecId == VIDEO_CODEC_ON2VP6_ALPHA)
+				if err == nil && p.Header.KeyFrame {
+					frReader.width, frReader.height = p.Width(), p.Height()
+				}
 			case codecId == VIDEO_CODEC_AVC && AvcPacketType(bodyBuf[1]) == VIDEO_AVC_SEQUENCE_HEADER:
 				confRecord, err := ParseAVCConfRecord(bodyBuf[5:])
 				if err == nil {
@@ -409,10 +525,20 @@ func (frReader *FlvReader) parseFrame(pFrame *CFrame) (resFrame Frame) {
 	case TAG_TYPE_AUDIO:
 		pFrame.Flavor = FRAME
 		if len(bodyBuf) > 0 {
+			if AudioCodec(bodyBuf[0]>>4) == AUDIO_CODEC_EX_HEADER {
+				resFrame = frReader.parseExAudioFrame(pFrame)
+				break
+			}
 			codecId := AudioCodec(uint8(bodyBuf[0]) >> 4)
 			rate := audioRate(AudioRate((uint8(bodyBuf[0]) >> 2) & 0x03))
 			bitSize := AudioSize((uint8(bodyBuf[0]) >> 1) & 0x01)
 			channels := AudioType(uint8(bodyBuf[0]) & 0x01)
+			if (codecId == AUDIO_CODEC_MP3 || codecId == AUDIO_CODEC_MP3_8KHZ) && !pFrame.Filter && frReader.mp3 == nil {
+				if h, err := ParseMP3FrameHeader(bodyBuf[1:]); err == nil {
+					frReader.mp3 = h
+					frReader.mp3VBR, _ = ParseMP3VBRHeader(bodyBuf[1:])
+				}
+			}
 			resFrame = AudioFrame{CFrame: pFrame, CodecId: codecId, Rate: rate, BitSize: bitSize, Channels: channels}
 		} else {
 			resFrame = AudioFrame{CFrame: pFrame, CodecId: AUDIO_CODEC_UNDEFINED, Rate: audioRate(AUDIO_RATE_UNDEFINED), BitSize: AUDIO_SIZE_UNDEFINED, Channels: AUDIO_TYPE_UNDEFINED}
@@ -422,17 +548,71 @@ func (frReader *FlvReader) parseFrame(pFrame *CFrame) (resFrame Frame) {
 	return resFrame
 }
 
+// MP3Header returns the header of the first MP3 frame read, which has the
+// real sample rate and channels of the stream where the tag only has the
+// nominal ones, and its Xing, Info or VBRI header, nil if there is none.
+func (frReader *FlvReader) MP3Header() (*MP3FrameHeader, *MP3VBRHeader) {
+	return frReader.mp3, frReader.mp3VBR
+}
+
 func (frReader *FlvReader) ReadFrame() (resFrame Frame, err Error) {
+	if len(frReader.pending) > 0 {
+		resFrame, frReader.pending = frReader.pending[0], frReader.pending[1:]
+		return
+	}
 	pFrame, err := frReader.readFrame()
 	if err != nil {
 		return
 	}
 	if pFrame != nil {
+		if derr := pFrame.decrypt(frReader.Decrypt); derr != nil && frReader.Undecryptable != nil {
+			frReader.Undecryptable(pFrame, derr)
+		}
 		resFrame = frReader.parseFrame(pFrame)
 	}
 	return
 }
 
+// ReadFrameAt reads the frame whose tag starts at position, the first track
+// of a multitrack tag; ReadTrackAt reads the others.
+func (frReader *FlvReader) ReadFrameAt(position int64) (resFrame Frame, err Error) {
+	frReader.pending = nil
+	if _, serr := frReader.InFile.Seek(position, os.SEEK_SET); serr != nil {
+		return nil, Unrecoverable(serr.Error(), position)
+	}
+	return frReader.ReadFrame()
+}
+
+// ReadTrackAt reads the frame of track id in the tag that starts at
+// position. Every track of a multitrack tag shares the position of the tag,
+// so tools that index frames by position keep the track id too; other tags
+// are track 0.
+func (frReader *FlvReader) ReadTrackAt(position int64, id byte) (resFrame Frame, err Error) {
+	resFrame, err = frReader.ReadFrameAt(position)
+	if err != nil || resFrame == nil {
+		return
+	}
+	tracks := append([]Frame{resFrame}, frReader.pending...)
+	frReader.pending = nil
+	for _, fr := range tracks {
+		if TrackId(fr) == id {
+			return fr, nil
+		}
+	}
+	return nil, Unrecoverable(fmt.Sprintf("no track %d in tag", id), position)
+}
+
+// TrackId returns the track of fr in a multitrack tag, 0 for other frames.
+func TrackId(fr Frame) byte {
+	switch f := fr.(type) {
+	case ExVideoFrame:
+		return f.TrackId
+	case ExAudioFrame:
+		return f.TrackId
+	}
+	return 0
+}
+
 func audioRate(ar AudioRate) uint32 {
 	var ret uint32
 	switch ar {
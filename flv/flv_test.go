@@ -2,9 +2,68 @@ package flv
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
+// The tests in package flv can not use internal/flvtest, which imports flv;
+// these build the tags and files they need.
+
+func testVideoTag(dts uint32, key bool, packetType AvcPacketType) *CFrame {
+	flags := byte(VIDEO_FRAME_TYPE_INTER_FRAME)<<4 | byte(VIDEO_CODEC_AVC)
+	if key {
+		flags = byte(VIDEO_FRAME_TYPE_KEYFRAME)<<4 | byte(VIDEO_CODEC_AVC)
+	}
+	return &CFrame{Type: TAG_TYPE_VIDEO, Dts: dts, Body: []byte{flags, byte(packetType), 0, 0, 0, 0xAA}}
+}
+
+func testAudioTag(dts uint32, packetType AudioAac) *CFrame {
+	flags := byte(AUDIO_CODEC_AAC)<<4 | byte(AUDIO_RATE_44)<<2 | 1<<1 | 1
+	return &CFrame{Type: TAG_TYPE_AUDIO, Dts: dts, Body: []byte{flags, byte(packetType), 0x12, 0x10}}
+}
+
+func writeTestFile(t *testing.T, name string, frames []*CFrame) string {
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := NewWriter(f)
+	if err := w.WriteHeader(NewHeader(true, true)); err != nil {
+		t.Fatal(err)
+	}
+	for _, fr := range frames {
+		if err := fr.WriteFrame(w.OutFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func readTestFile(t *testing.T, path string) (frames []Frame) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := NewReader(f)
+	if _, err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		fr, rerr := r.ReadFrame()
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		if fr == nil {
+			return
+		}
+		frames = append(frames, fr)
+	}
+}
+
 func TestWriteFrame(t *testing.T) {
 	got := new(bytes.Buffer)
 	cFrame := CFrame{
@@ -27,3 +86,21 @@ func TestWriteFrame(t *testing.T) {
 		}
 	}
 }
+
+// plainFrame has only the methods of Frame, like frames implemented
+// outside the package.
+type plainFrame struct {
+	Frame
+}
+
+func TestFlavorPosition(t *testing.T) {
+	cFrame := &CFrame{Type: TAG_TYPE_VIDEO, Flavor: KEYFRAME, Position: 13}
+	fr := VideoFrame{CFrame: cFrame, CodecId: VIDEO_CODEC_SORENSON}
+	if FlavorOf(fr) != KEYFRAME || PositionOf(fr) != 13 || !IsKeyframe(fr) {
+		t.Errorf("unexpected flavor %d position %d", FlavorOf(fr), PositionOf(fr))
+	}
+	plain := plainFrame{fr}
+	if FlavorOf(plain) != FRAME || PositionOf(plain) != -1 || IsKeyframe(plain) {
+		t.Errorf("unexpected flavor %d position %d", FlavorOf(plain), PositionOf(plain))
+	}
+}
@@ -0,0 +1,93 @@
+package flv
+
+import (
+	"fmt"
+)
+
+type H263PictureType byte
+
+const (
+	H263_PICTURE_TYPE_INTRA            H263PictureType = 0
+	H263_PICTURE_TYPE_INTER            H263PictureType = 1
+	H263_PICTURE_TYPE_DISPOSABLE_INTER H263PictureType = 2
+)
+
+var (
+	// by PictureSize, 0 and 1 are custom
+	h263PictureSizes = [][2]uint16{
+		2: {352, 288},
+		3: {176, 144},
+		4: {128, 96},
+		5: {320, 240},
+		6: {160, 120},
+	}
+)
+
+// H263PictureHeader is the picture header of Sorenson H.263 video tags.
+type H263PictureHeader struct {
+	Version           byte
+	TemporalReference byte
+	PictureSize       byte
+	Width             uint16
+	Height            uint16
+	PictureType       H263PictureType
+	Deblocking        bool
+	Quantizer         byte
+}
+
+func (h *H263PictureHeader) String() string {
+	return fmt.Sprintf("H263PictureHeader(ver. %d, %dx%d, picture type: %d, deblocking: %v, quantizer: %d)",
+		h.Version, h.Width, h.Height, h.PictureType, h.Deblocking, h.Quantizer)
+}
+
+// IsKeyframe reports whether the picture is intra coded.
+func (h *H263PictureHeader) IsKeyframe() bool {
+	return h.PictureType == H263_PICTURE_TYPE_INTRA
+}
+
+// ParseH263PictureHeader parses the picture header data, the video tag
+// body past its first byte, starts with.
+func ParseH263PictureHeader(data []byte) (ret *H263PictureHeader, err error) {
+	r := NewBitReader(data)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = rec.(error)
+		}
+	}()
+
+	picture_start_code := r.U(17)
+	if picture_start_code != 1 {
+		err = fmt.Errorf("Not H.263 picture, picture_start_code = %05x", picture_start_code)
+		return
+	}
+	h := &H263PictureHeader{}
+	h.Version = byte(r.U(5))
+	if h.Version > 1 {
+		err = fmt.Errorf("unknown Sorenson H.263 version %d", h.Version)
+		return
+	}
+	h.TemporalReference = r.U8()
+	h.PictureSize = byte(r.U(3))
+	switch h.PictureSize {
+	case 0:
+		h.Width = uint16(r.U(8))
+		h.Height = uint16(r.U(8))
+	case 1:
+		h.Width = uint16(r.U(16))
+		h.Height = uint16(r.U(16))
+	case 7:
+		err = fmt.Errorf("reserved H.263 picture size")
+		return
+	default:
+		h.Width, h.Height = h263PictureSizes[h.PictureSize][0], h263PictureSizes[h.PictureSize][1]
+	}
+	h.PictureType = H263PictureType(r.U(2))
+	if h.PictureType > H263_PICTURE_TYPE_DISPOSABLE_INTER {
+		err = fmt.Errorf("reserved H.263 picture type")
+		return
+	}
+	h.Deblocking = r.U(1) != 0
+	h.Quantizer = byte(r.U(5))
+	return h, nil
+}
@@ -0,0 +1,60 @@
+package flv
+
+import (
+	"testing"
+)
+
+func testH263Picture(size uint64, w, h uint64, pictureType uint64) []byte {
+	b := &testBits{}
+	b.u(1, 17).u(0, 5).u(3, 8).u(size, 3)
+	switch size {
+	case 0:
+		b.u(w, 8).u(h, 8)
+	case 1:
+		b.u(w, 16).u(h, 16)
+	}
+	b.u(pictureType, 2).u(1, 1).u(10, 5).u(0, 1)
+	return b.buf
+}
+
+func TestParseH263PictureHeader(t *testing.T) {
+	for _, c := range []struct {
+		data          []byte
+		width, height uint16
+		pictureType   H263PictureType
+	}{
+		{testH263Picture(0, 100, 80, 0), 100, 80, H263_PICTURE_TYPE_INTRA},
+		{testH263Picture(1, 1024, 768, 2), 1024, 768, H263_PICTURE_TYPE_DISPOSABLE_INTER},
+		{testH263Picture(5, 0, 0, 1), 320, 240, H263_PICTURE_TYPE_INTER},
+		{testH263Picture(4, 0, 0, 1), 128, 96, H263_PICTURE_TYPE_INTER},
+	} {
+		h, err := ParseH263PictureHeader(c.data)
+		if err != nil {
+			t.Fatalf("parse error: %s", err)
+		}
+		if h.Width != c.width || h.Height != c.height || h.PictureType != c.pictureType || !h.Deblocking || h.Quantizer != 10 || h.TemporalReference != 3 {
+			t.Errorf("expect %dx%d type %d got %s", c.width, c.height, c.pictureType, h)
+		}
+	}
+	for _, data := range [][]byte{{0, 0, 0xC0}, testH263Picture(7, 0, 0, 0), testH263Picture(2, 0, 0, 3), {0, 0, 0x80}} {
+		if _, err := ParseH263PictureHeader(data); err == nil {
+			t.Errorf("expect error on % x", data)
+		}
+	}
+}
+
+func TestSorensonDimensions(t *testing.T) {
+	frames := []*CFrame{
+		{Type: TAG_TYPE_VIDEO, Dts: 0, Body: append([]byte{0x12}, testH263Picture(0, 176, 144, 0)...)},
+		{Type: TAG_TYPE_VIDEO, Dts: 40, Body: append([]byte{0x22}, testH263Picture(0, 176, 144, 1)...)},
+		{Type: TAG_TYPE_VIDEO, Dts: 80, Body: append([]byte{0x12}, testH263Picture(5, 0, 0, 0)...)},
+	}
+	got := readTestFile(t, writeTestFile(t, "sorenson.flv", frames))
+	for i, size := range [][2]uint16{{176, 144}, {176, 144}, {320, 240}} {
+		f := got[i].(VideoFrame)
+		h, err := ParseH263PictureHeader(f.Body[1:])
+		if err != nil || f.Width != size[0] || f.Height != size[1] || h.IsKeyframe() != (f.Flavor == KEYFRAME) {
+			t.Errorf("frame %d: expect %dx%d got %s, %v", i, size[0], size[1], f, err)
+		}
+	}
+}
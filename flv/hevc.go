@@ -0,0 +1,506 @@
+package flv
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	HEVC_NALU_TYPE_VPS        = 32
+	HEVC_NALU_TYPE_SPS        = 33
+	HEVC_NALU_TYPE_PPS        = 34
+	HEVC_NALU_TYPE_PREFIX_SEI = 39
+	HEVC_NALU_TYPE_SUFFIX_SEI = 40
+)
+
+// HEVCNALUArray is one of the arrays of parameter sets and SEI of an
+// HEVCDecoderConfigurationRecord.
+type HEVCNALUArray struct {
+	Completeness bool
+	NALUType     byte
+	NALUs        [][]byte
+}
+
+// HEVCConfRecord is the HEVCDecoderConfigurationRecord of ISO/IEC 14496-15
+// carried by hvc1 sequence starts.
+type HEVCConfRecord struct {
+	ConfigurationVersion      byte
+	ProfileSpace              byte
+	TierFlag                  byte
+	ProfileIdc                byte
+	ProfileCompatibilityFlags uint32
+	ConstraintIndicatorFlags  uint64 // 48 bits
+	LevelIdc                  byte
+	MinSpatialSegmentationIdc uint16
+	ParallelismType           byte
+	ChromaFormat              byte
+	BitDepthLuma              byte
+	BitDepthChroma            byte
+	AvgFrameRate              uint16 // frames per 256 seconds
+	ConstantFrameRate         byte
+	NumTemporalLayers         byte
+	TemporalIdNested          byte
+	LengthSizeMinusOne        byte
+	Arrays                    []HEVCNALUArray
+}
+
+func (r *HEVCConfRecord) String() string {
+	return fmt.Sprintf("HEVCDecoderConfigurationRecord(ver. %d, profile: %d, level: %d, %d VPS, %d SPS, %d PPS)",
+		r.ConfigurationVersion, r.ProfileIdc, r.LevelIdc,
+		len(r.NALUs(HEVC_NALU_TYPE_VPS)), len(r.NALUs(HEVC_NALU_TYPE_SPS)), len(r.NALUs(HEVC_NALU_TYPE_PPS)))
+}
+
+func ParseHEVCConfRecord(data []byte) (rec *HEVCConfRecord, err error) {
+	r := NewBitReader(data)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = rec.(error)
+		}
+	}()
+
+	c := &HEVCConfRecord{}
+	c.ConfigurationVersion = r.U8()
+	c.ProfileSpace = byte(r.U(2))
+	c.TierFlag = byte(r.U(1))
+	c.ProfileIdc = byte(r.U(5))
+	c.ProfileCompatibilityFlags = r.U(16)<<16 | r.U(16)
+	c.ConstraintIndicatorFlags = uint64(r.U(16))<<32 | uint64(r.U(16))<<16 | uint64(r.U(16))
+	c.LevelIdc = r.U8()
+	r.U(4) // reserved
+	c.MinSpatialSegmentationIdc = uint16(r.U(12))
+	r.U(6)
+	c.ParallelismType = byte(r.U(2))
+	r.U(6)
+	c.ChromaFormat = byte(r.U(2))
+	r.U(5)
+	c.BitDepthLuma = byte(r.U(3)) + 8
+	r.U(5)
+	c.BitDepthChroma = byte(r.U(3)) + 8
+	c.AvgFrameRate = uint16(r.U(16))
+	c.ConstantFrameRate = byte(r.U(2))
+	c.NumTemporalLayers = byte(r.U(3))
+	c.TemporalIdNested = byte(r.U(1))
+	c.LengthSizeMinusOne = byte(r.U(2))
+
+	numOfArrays := r.U8()
+	for i := byte(0); i < numOfArrays; i++ {
+		a := HEVCNALUArray{Completeness: r.U(1) != 0}
+		r.U(1)
+		a.NALUType = byte(r.U(6))
+		numNalus := r.U(16)
+		for j := uint32(0); j < numNalus; j++ {
+			nalu := make([]byte, r.U(16))
+			if len(nalu) > 0 {
+				r.Read(nalu)
+			}
+			a.NALUs = append(a.NALUs, nalu)
+		}
+		c.Arrays = append(c.Arrays, a)
+	}
+	return c, nil
+}
+
+// NALUs returns the NAL units of the arrays of type naluType.
+func (r *HEVCConfRecord) NALUs(naluType byte) (nalus [][]byte) {
+	for _, a := range r.Arrays {
+		if a.NALUType == naluType {
+			nalus = append(nalus, a.NALUs...)
+		}
+	}
+	return
+}
+
+// Bytes serializes the record as an HEVCDecoderConfigurationRecord.
+func (r *HEVCConfRecord) Bytes() []byte {
+	cif := r.ConstraintIndicatorFlags
+	buf := []byte{
+		r.ConfigurationVersion,
+		r.ProfileSpace<<6 | r.TierFlag<<5 | r.ProfileIdc&0x1F,
+		byte(r.ProfileCompatibilityFlags >> 24), byte(r.ProfileCompatibilityFlags >> 16),
+		byte(r.ProfileCompatibilityFlags >> 8), byte(r.ProfileCompatibilityFlags),
+		byte(cif >> 40), byte(cif >> 32), byte(cif >> 24), byte(cif >> 16), byte(cif >> 8), byte(cif),
+		r.LevelIdc,
+		0xF0 | byte(r.MinSpatialSegmentationIdc>>8&0x0F), byte(r.MinSpatialSegmentationIdc),
+		0xFC | r.ParallelismType,
+		0xFC | r.ChromaFormat,
+		0xF8 | (r.BitDepthLuma - 8),
+		0xF8 | (r.BitDepthChroma - 8),
+		byte(r.AvgFrameRate >> 8), byte(r.AvgFrameRate),
+		r.ConstantFrameRate<<6 | r.NumTemporalLayers<<3 | r.TemporalIdNested<<2 | r.LengthSizeMinusOne,
+		byte(len(r.Arrays)),
+	}
+	for _, a := range r.Arrays {
+		b := a.NALUType & 0x3F
+		if a.Completeness {
+			b |= 0x80
+		}
+		buf = append(buf, b, byte(len(a.NALUs)>>8), byte(len(a.NALUs)))
+		for _, nalu := range a.NALUs {
+			buf = append(buf, byte(len(nalu)>>8), byte(len(nalu)))
+			buf = append(buf, nalu...)
+		}
+	}
+	return buf
+}
+
+// NALULengthSize is the size in bytes of the length prefix of every NAL unit
+// in HEVC coded frames.
+func (r *HEVCConfRecord) NALULengthSize() int {
+	return int(r.LengthSizeMinusOne) + 1
+}
+
+// Codec returns the RFC 6381 codecs parameter, e.g. "hvc1.1.6.L93.B0".
+func (r *HEVCConfRecord) Codec() string {
+	// the compatibility flags are written in reverse bit order
+	var compat uint32
+	for i := uint(0); i < 32; i++ {
+		compat |= (r.ProfileCompatibilityFlags >> i & 1) << (31 - i)
+	}
+	tier := "L"
+	if r.TierFlag != 0 {
+		tier = "H"
+	}
+	s := fmt.Sprintf("hvc1.%s%d.%X.%s%d", []string{"", "A", "B", "C"}[r.ProfileSpace&3], r.ProfileIdc, compat, tier, r.LevelIdc)
+	constraints := []string{}
+	for i := 5; i >= 0; i-- {
+		constraints = append(constraints, fmt.Sprintf("%02X", byte(r.ConstraintIndicatorFlags>>(8*uint(i)))))
+	}
+	for len(constraints) > 0 && constraints[len(constraints)-1] == "00" {
+		constraints = constraints[:len(constraints)-1]
+	}
+	if len(constraints) > 0 {
+		s += "." + strings.Join(constraints, ".")
+	}
+	return s
+}
+
+// HEVCSPS holds the fields of an H.265 seq_parameter_set_rbsp needed to
+// describe the stream.
+type HEVCSPS struct {
+	VPSId                     byte
+	MaxSubLayers              byte
+	ProfileSpace              byte
+	TierFlag                  byte
+	ProfileIdc                byte
+	ProfileCompatibilityFlags uint32
+	LevelIdc                  byte
+	SPSId                     uint32
+
+	ChromaFormatIdc     uint32
+	SeparateColourPlane bool
+	PicWidth            uint32 // luma samples
+	PicHeight           uint32
+	ConfWinLeft         uint32 // in chroma samples
+	ConfWinRight        uint32
+	ConfWinTop          uint32
+	ConfWinBottom       uint32
+	BitDepthLuma        uint32
+	BitDepthChroma      uint32
+
+	// VUI video signal type, 2 (unspecified) if absent
+	VideoFullRange          bool
+	ColourPrimaries         byte
+	TransferCharacteristics byte
+	MatrixCoeffs            byte
+
+	// VUI timing info, 0 if absent
+	NumUnitsInTick uint32
+	TimeScale      uint32
+
+	log2MaxPicOrderCntLsb uint32
+}
+
+func (sps *HEVCSPS) subWidthHeight() (uint32, uint32) {
+	if sps.SeparateColourPlane {
+		return 1, 1
+	}
+	switch sps.ChromaFormatIdc {
+	case 1:
+		return 2, 2
+	case 2:
+		return 2, 1
+	}
+	return 1, 1
+}
+
+// Width returns the width of the conformance window.
+func (sps *HEVCSPS) Width() uint32 {
+	sub, _ := sps.subWidthHeight()
+	return sps.PicWidth - sub*(sps.ConfWinLeft+sps.ConfWinRight)
+}
+
+// Height returns the height of the conformance window.
+func (sps *HEVCSPS) Height() uint32 {
+	_, sub := sps.subWidthHeight()
+	return sps.PicHeight - sub*(sps.ConfWinTop+sps.ConfWinBottom)
+}
+
+// FrameRate returns the frame rate signalled by the VUI timing info, or 0 if
+// it is absent.
+func (sps *HEVCSPS) FrameRate() float64 {
+	if sps.NumUnitsInTick == 0 {
+		return 0
+	}
+	return float64(sps.TimeScale) / float64(sps.NumUnitsInTick)
+}
+
+// HDR reports whether the transfer characteristics are PQ (SMPTE ST 2084)
+// or HLG (ARIB STD-B67).
+func (sps *HEVCSPS) HDR() bool {
+	return sps.TransferCharacteristics == 16 || sps.TransferCharacteristics == 18
+}
+
+func (sps *HEVCSPS) String() string {
+	return fmt.Sprintf("hevc_seq_parameter_set(profile: %d, level: %d, id: %d, %dx%d, %d bit)",
+		sps.ProfileIdc, sps.LevelIdc, sps.SPSId, sps.Width(), sps.Height(), sps.BitDepthLuma)
+}
+
+// ParseHEVCSPS parses an SPS NAL unit. The dimensions, chroma format and bit
+// depth are always known on success; the VUI is read on a best effort basis.
+func ParseHEVCSPS(nalu []byte) (ret *HEVCSPS, err error) {
+	r := NewBitReader(UnescapeRBSP(nalu))
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = rec.(error)
+		}
+	}()
+
+	r.U(1) /* forbidden_zero_bit */
+	nal_unit_type := r.U(6)
+	if nal_unit_type != HEVC_NALU_TYPE_SPS {
+		err = fmt.Errorf("Not HEVC SPS NALU, nal_unit_type = %d", nal_unit_type)
+		return
+	}
+	r.U(6) /* nuh_layer_id */
+	r.U(3) /* nuh_temporal_id_plus1 */
+
+	sps := &HEVCSPS{ColourPrimaries: 2, TransferCharacteristics: 2, MatrixCoeffs: 2}
+	sps.VPSId = byte(r.U(4))
+	sps.MaxSubLayers = byte(r.U(3)) + 1
+	r.U(1) /* sps_temporal_id_nesting_flag */
+	parseProfileTierLevel(r, sps)
+
+	sps.SPSId = r.Ue()
+	sps.ChromaFormatIdc = r.Ue()
+	if sps.ChromaFormatIdc == 3 {
+		sps.SeparateColourPlane = r.U(1) != 0
+	}
+	sps.PicWidth = r.Ue()
+	sps.PicHeight = r.Ue()
+	conformance_window_flag := r.U(1)
+	if conformance_window_flag != 0 {
+		sps.ConfWinLeft = r.Ue()
+		sps.ConfWinRight = r.Ue()
+		sps.ConfWinTop = r.Ue()
+		sps.ConfWinBottom = r.Ue()
+	}
+	sps.BitDepthLuma = r.Ue() + 8
+	sps.BitDepthChroma = r.Ue() + 8
+	sps.log2MaxPicOrderCntLsb = r.Ue() + 4
+
+	parseHEVCSPSTail(r, sps)
+	return sps, nil
+}
+
+func parseProfileTierLevel(r *BitReader, sps *HEVCSPS) {
+	sps.ProfileSpace = byte(r.U(2))
+	sps.TierFlag = byte(r.U(1))
+	sps.ProfileIdc = byte(r.U(5))
+	sps.ProfileCompatibilityFlags = r.U(16)<<16 | r.U(16)
+	r.U(4)  /* progressive, interlaced, non packed and frame only flags */
+	r.U(22) /* general_reserved_zero_43bits */
+	r.U(22) /* and general_inbld_flag */
+	sps.LevelIdc = r.U8()
+
+	subLayers := int(sps.MaxSubLayers) - 1
+	profilePresent := make([]bool, subLayers)
+	levelPresent := make([]bool, subLayers)
+	for i := 0; i < subLayers; i++ {
+		profilePresent[i] = r.U(1) != 0
+		levelPresent[i] = r.U(1) != 0
+	}
+	if subLayers > 0 {
+		for i := subLayers; i < 8; i++ {
+			r.U(2) /* reserved_zero_2bits */
+		}
+	}
+	for i := 0; i < subLayers; i++ {
+		if profilePresent[i] {
+			r.U(24) /* sub_layer profile space, tier, idc and compatibility flags */
+			r.U(16)
+			r.U(24) /* sub_layer flags */
+			r.U(24)
+		}
+		if levelPresent[i] {
+			r.U8() /* sub_layer_level_idc */
+		}
+	}
+}
+
+// parseHEVCSPSTail skips to the VUI and reads it. Truncated or unusual
+// syntax is not an error: the SPS is still usable without it.
+func parseHEVCSPSTail(r *BitReader, sps *HEVCSPS) {
+	defer func() {
+		recover()
+	}()
+
+	sub_layer_ordering_info_present_flag := r.U(1)
+	first := uint32(sps.MaxSubLayers) - 1
+	if sub_layer_ordering_info_present_flag != 0 {
+		first = 0
+	}
+	for i := first; i < uint32(sps.MaxSubLayers); i++ {
+		r.Ue() /* sps_max_dec_pic_buffering_minus1 */
+		r.Ue() /* sps_max_num_reorder_pics */
+		r.Ue() /* sps_max_latency_increase_plus1 */
+	}
+	r.Ue() /* log2_min_luma_coding_block_size_minus3 */
+	r.Ue() /* log2_diff_max_min_luma_coding_block_size */
+	r.Ue() /* log2_min_luma_transform_block_size_minus2 */
+	r.Ue() /* log2_diff_max_min_luma_transform_block_size */
+	r.Ue() /* max_transform_hierarchy_depth_inter */
+	r.Ue() /* max_transform_hierarchy_depth_intra */
+	scaling_list_enabled_flag := r.U(1)
+	if scaling_list_enabled_flag != 0 {
+		sps_scaling_list_data_present_flag := r.U(1)
+		if sps_scaling_list_data_present_flag != 0 {
+			hevcScalingListData(r)
+		}
+	}
+	r.U(1) /* amp_enabled_flag */
+	r.U(1) /* sample_adaptive_offset_enabled_flag */
+	pcm_enabled_flag := r.U(1)
+	if pcm_enabled_flag != 0 {
+		r.U(4) /* pcm_sample_bit_depth_luma_minus1 */
+		r.U(4) /* pcm_sample_bit_depth_chroma_minus1 */
+		r.Ue() /* log2_min_pcm_luma_coding_block_size_minus3 */
+		r.Ue() /* log2_diff_max_min_pcm_luma_coding_block_size */
+		r.U(1) /* pcm_loop_filter_disabled_flag */
+	}
+
+	num_short_term_ref_pic_sets := r.Ue()
+	if num_short_term_ref_pic_sets > 64 {
+		return
+	}
+	numDeltaPocs := make([]uint32, num_short_term_ref_pic_sets)
+	for i := uint32(0); i < num_short_term_ref_pic_sets; i++ {
+		inter_ref_pic_set_prediction_flag := uint32(0)
+		if i != 0 {
+			inter_ref_pic_set_prediction_flag = r.U(1)
+		}
+		if inter_ref_pic_set_prediction_flag != 0 {
+			r.U(1) /* delta_rps_sign */
+			r.Ue() /* abs_delta_rps_minus1 */
+			for j := uint32(0); j <= numDeltaPocs[i-1]; j++ {
+				used_by_curr_pic_flag := r.U(1)
+				use_delta_flag := uint32(1)
+				if used_by_curr_pic_flag == 0 {
+					use_delta_flag = r.U(1)
+				}
+				if used_by_curr_pic_flag != 0 || use_delta_flag != 0 {
+					numDeltaPocs[i]++
+				}
+			}
+			continue
+		}
+		num_negative_pics := r.Ue()
+		num_positive_pics := r.Ue()
+		// both are below sps_max_dec_pic_buffering_minus1, at most 15
+		if num_negative_pics > 16 || num_positive_pics > 16 {
+			return
+		}
+		for j := uint32(0); j < num_negative_pics+num_positive_pics; j++ {
+			r.Ue() /* delta_poc_minus1 */
+			r.U(1) /* used_by_curr_pic_flag */
+		}
+		numDeltaPocs[i] = num_negative_pics + num_positive_pics
+	}
+
+	long_term_ref_pics_present_flag := r.U(1)
+	if long_term_ref_pics_present_flag != 0 {
+		num_long_term_ref_pics_sps := r.Ue()
+		for i := uint32(0); i < num_long_term_ref_pics_sps; i++ {
+			r.U(sps.log2MaxPicOrderCntLsb) /* lt_ref_pic_poc_lsb_sps */
+			r.U(1)                         /* used_by_curr_pic_lt_sps_flag */
+		}
+	}
+	r.U(1) /* sps_temporal_mvp_enabled_flag */
+	r.U(1) /* strong_intra_smoothing_enabled_flag */
+	vui_parameters_present_flag := r.U(1)
+	if vui_parameters_present_flag == 0 {
+		return
+	}
+
+	aspect_ratio_info_present_flag := r.U(1)
+	if aspect_ratio_info_present_flag != 0 {
+		aspect_ratio_idc := r.U8()
+		if aspect_ratio_idc == 255 /* Extended_SAR */ {
+			r.U(16) /* sar_width */
+			r.U(16) /* sar_height */
+		}
+	}
+	overscan_info_present_flag := r.U(1)
+	if overscan_info_present_flag != 0 {
+		r.U(1) /* overscan_appropriate_flag */
+	}
+	video_signal_type_present_flag := r.U(1)
+	if video_signal_type_present_flag != 0 {
+		r.U(3) /* video_format */
+		sps.VideoFullRange = r.U(1) != 0
+		colour_description_present_flag := r.U(1)
+		if colour_description_present_flag != 0 {
+			sps.ColourPrimaries = r.U8()
+			sps.TransferCharacteristics = r.U8()
+			sps.MatrixCoeffs = r.U8()
+		}
+	}
+	chroma_loc_info_present_flag := r.U(1)
+	if chroma_loc_info_present_flag != 0 {
+		r.Ue() /* chroma_sample_loc_type_top_field */
+		r.Ue() /* chroma_sample_loc_type_bottom_field */
+	}
+	r.U(1) /* neutral_chroma_indication_flag */
+	r.U(1) /* field_seq_flag */
+	r.U(1) /* frame_field_info_present_flag */
+	default_display_window_flag := r.U(1)
+	if default_display_window_flag != 0 {
+		r.Ue()
+		r.Ue()
+		r.Ue()
+		r.Ue()
+	}
+	vui_timing_info_present_flag := r.U(1)
+	if vui_timing_info_present_flag != 0 {
+		num_units_in_tick := r.U(16)<<16 | r.U(16)
+		time_scale := r.U(16)<<16 | r.U(16)
+		sps.NumUnitsInTick, sps.TimeScale = num_units_in_tick, time_scale
+	}
+}
+
+func hevcScalingListData(r *BitReader) {
+	for sizeId := uint32(0); sizeId < 4; sizeId++ {
+		step := 1
+		if sizeId == 3 {
+			step = 3
+		}
+		for matrixId := 0; matrixId < 6; matrixId += step {
+			scaling_list_pred_mode_flag := r.U(1)
+			if scaling_list_pred_mode_flag == 0 {
+				r.Ue() /* scaling_list_pred_matrix_id_delta */
+				continue
+			}
+			coefNum := 1 << (4 + sizeId<<1)
+			if coefNum > 64 {
+				coefNum = 64
+			}
+			if sizeId > 1 {
+				r.Se() /* scaling_list_dc_coef_minus8 */
+			}
+			for i := 0; i < coefNum; i++ {
+				r.Se() /* scaling_list_delta_coef */
+			}
+		}
+	}
+}
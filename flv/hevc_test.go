@@ -0,0 +1,115 @@
+package flv
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testHEVCSPS() []byte {
+	b := &testBits{}
+	b.u(0, 4).u(0, 3).u(1, 1)                   // vps id, max_sub_layers_minus1, nesting
+	b.u(0, 2).u(0, 1).u(1, 5).u(0x60000000, 32) // Main profile
+	b.u(0x9, 4).u(0, 44).u(93, 8)               // progressive, frame only, level 3.1
+	b.ue(0).ue(1).ue(1920).ue(1088)             // id, 4:2:0
+	b.u(1, 1).ue(0).ue(0).ue(0).ue(4)           // conformance window cropping 8 lines
+	b.ue(2).ue(2).ue(4)                         // 10 bit, log2_max_poc_lsb
+	b.u(1, 1).ue(4).ue(2).ue(0)                 // sub layer ordering info
+	b.ue(0).ue(3).ue(0).ue(3).ue(0).ue(0)       // block sizes
+	b.u(0, 1).u(1, 1).u(1, 1).u(0, 1)           // no scaling list, amp, sao, no pcm
+	b.ue(2)                                     // short term ref pic sets
+	b.ue(1).ue(0).ue(0).u(1, 1)                 // one negative picture
+	b.u(1, 1).u(0, 1).ue(0).u(1, 1).u(1, 1)     // predicted from the first
+	b.u(0, 1).u(1, 1).u(1, 1)                   // no long term, tmvp, strong intra
+	b.u(1, 1).u(0, 2)                           // vui, no aspect ratio or overscan
+	b.u(1, 1).u(5, 3).u(0, 1).u(1, 1)           // video signal type
+	b.u(9, 8).u(16, 8).u(9, 8)                  // BT.2020 PQ
+	b.u(0, 5).u(1, 1).u(1001, 32).u(60000, 32)  // 59.94fps
+	b.u(0, 2)
+	nalu := b.nalu(0x42)
+	return append([]byte{nalu[0], 0x01}, nalu[1:]...)
+}
+
+func testHEVCConf() *HEVCConfRecord {
+	return &HEVCConfRecord{
+		ConfigurationVersion:      1,
+		ProfileIdc:                1,
+		ProfileCompatibilityFlags: 0x60000000,
+		ConstraintIndicatorFlags:  0x900000000000,
+		LevelIdc:                  93,
+		ChromaFormat:              1,
+		BitDepthLuma:              10,
+		BitDepthChroma:            10,
+		NumTemporalLayers:         1,
+		TemporalIdNested:          1,
+		LengthSizeMinusOne:        3,
+		Arrays: []HEVCNALUArray{
+			{Completeness: true, NALUType: HEVC_NALU_TYPE_VPS, NALUs: [][]byte{{0x40, 0x01, 0x0C}}},
+			{Completeness: true, NALUType: HEVC_NALU_TYPE_SPS, NALUs: [][]byte{testHEVCSPS()}},
+			{Completeness: true, NALUType: HEVC_NALU_TYPE_PPS, NALUs: [][]byte{{0x44, 0x01, 0xC1}}},
+		},
+	}
+}
+
+func TestParseHEVCSPS(t *testing.T) {
+	sps, err := ParseHEVCSPS(testHEVCSPS())
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if sps.Width() != 1920 || sps.Height() != 1080 || sps.BitDepthLuma != 10 || sps.ChromaFormatIdc != 1 {
+		t.Errorf("expect 1920x1080 10 bit 4:2:0 got %s", sps)
+	}
+	if sps.ColourPrimaries != 9 || sps.MatrixCoeffs != 9 || !sps.HDR() {
+		t.Errorf("expect BT.2020 PQ got %d/%d/%d", sps.ColourPrimaries, sps.TransferCharacteristics, sps.MatrixCoeffs)
+	}
+	if rate := sps.FrameRate(); rate < 59.94 || rate > 59.95 {
+		t.Errorf("expect 59.94fps got %v", rate)
+	}
+}
+
+func TestParseHEVCSPSBadRefPicSets(t *testing.T) {
+	b := &testBits{}
+	b.u(0, 4).u(0, 3).u(1, 1)
+	b.u(0, 2).u(0, 1).u(1, 5).u(0x60000000, 32)
+	b.u(0x9, 4).u(0, 44).u(93, 8)
+	b.ue(0).ue(1).ue(1920).ue(1080).u(0, 1)
+	b.ue(0).ue(0).ue(4)
+	b.u(1, 1).ue(4).ue(2).ue(0)
+	b.ue(0).ue(3).ue(0).ue(3).ue(0).ue(0)
+	b.u(0, 1).u(1, 1).u(1, 1).u(0, 1)
+	b.ue(1 << 31) // num_short_term_ref_pic_sets way past 64
+	b.u(0, 8)
+	nalu := b.nalu(0x42)
+	sps, err := ParseHEVCSPS(append([]byte{nalu[0], 0x01}, nalu[1:]...))
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if sps.Width() != 1920 || sps.Height() != 1080 || sps.ColourPrimaries != 2 {
+		t.Errorf("expect 1920x1080 without VUI got %s", sps)
+	}
+}
+
+func TestHEVCConfRecord(t *testing.T) {
+	data := testHEVCConf().Bytes()
+	rec, err := ParseHEVCConfRecord(data)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if !bytes.Equal(rec.Bytes(), data) {
+		t.Errorf("expect % x got % x", data, rec.Bytes())
+	}
+	if len(rec.NALUs(HEVC_NALU_TYPE_SPS)) != 1 || rec.BitDepthLuma != 10 || rec.NALULengthSize() != 4 {
+		t.Errorf("unexpected %s", rec)
+	}
+	if codec := rec.Codec(); codec != "hvc1.1.6.L93.90" {
+		t.Errorf("expect hvc1.1.6.L93.90 got %s", codec)
+	}
+
+	frames := []*CFrame{
+		NewExVideoFrame(0, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_SEQUENCE_START, FOURCC_HEVC, 0, data).CFrame,
+		NewExVideoFrame(0, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_CODED_FRAMES_X, FOURCC_HEVC, 0, []byte{0, 0, 0, 1, 0x26}).CFrame,
+	}
+	got := readTestFile(t, writeTestFile(t, "hevc.flv", frames))
+	if f := got[1].(ExVideoFrame); f.Width != 1920 || f.Height != 1080 {
+		t.Errorf("expect frames of 1920x1080 got %dx%d", f.Width, f.Height)
+	}
+}
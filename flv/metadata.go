@@ -0,0 +1,219 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/metachord/amf.go/amf0"
+	"math"
+	"sort"
+)
+
+const (
+	amfNumber    = 0x00
+	amfBoolean   = 0x01
+	amfString    = 0x02
+	amfEcmaArray = 0x08
+	amfObjectEnd = 0x09
+)
+
+// MetaData describes the stream properties written into a fresh
+// onMetaData tag by Cut and the other stream rewriting tools.
+type MetaData struct {
+	HasVideo bool
+	HasAudio bool
+
+	Duration  float64 // seconds
+	Width     uint16
+	Height    uint16
+	FrameRate float64
+
+	VideoCodecId    VideoCodec
+	AudioCodecId    AudioCodec
+	AudioSampleRate uint32
+	AudioSampleSize AudioSize
+	Stereo          bool
+
+	// Extra holds additional properties copied verbatim; only number,
+	// bool and string values are written, numbers as float64.
+	Extra map[string]interface{}
+}
+
+type amfProperty struct {
+	name  string
+	value interface{}
+}
+
+func (md *MetaData) properties() []amfProperty {
+	props := []amfProperty{{"duration", md.Duration}}
+	if md.HasVideo {
+		props = append(props,
+			amfProperty{"width", float64(md.Width)},
+			amfProperty{"height", float64(md.Height)},
+			amfProperty{"videocodecid", float64(md.VideoCodecId)},
+		)
+		if md.FrameRate > 0 {
+			props = append(props, amfProperty{"framerate", md.FrameRate})
+		}
+	}
+	if md.HasAudio {
+		sampleSize := 8.0
+		if md.AudioSampleSize == AUDIO_SIZE_16BIT {
+			sampleSize = 16
+		}
+		props = append(props,
+			amfProperty{"audiocodecid", float64(md.AudioCodecId)},
+			amfProperty{"audiosamplerate", float64(md.AudioSampleRate)},
+			amfProperty{"audiosamplesize", sampleSize},
+			amfProperty{"stereo", md.Stereo},
+		)
+	}
+	known := map[string]bool{}
+	for _, p := range props {
+		known[p.name] = true
+	}
+	for _, k := range sortedKeys(md.Extra) {
+		if v, ok := amfValue(md.Extra[k]); ok && !known[k] {
+			props = append(props, amfProperty{k, v})
+		}
+	}
+	return props
+}
+
+// amfValue converts v to a value Frame can write, numbers to float64.
+func amfValue(v interface{}) (interface{}, bool) {
+	switch n := v.(type) {
+	case float64, bool, string:
+		return v, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return nil, false
+}
+
+// Frame builds an onMetaData script tag with DTS 0.
+func (md *MetaData) Frame() MetaFrame {
+	buf := new(bytes.Buffer)
+	writeAmfString(buf, "onMetaData")
+
+	props := md.properties()
+	buf.WriteByte(amfEcmaArray)
+	binary.Write(buf, binary.BigEndian, uint32(len(props)))
+	for _, p := range props {
+		writeAmfKey(buf, p.name)
+		switch v := p.value.(type) {
+		case float64:
+			writeAmfNumber(buf, v)
+		case bool:
+			writeAmfBoolean(buf, v)
+		case string:
+			writeAmfString(buf, v)
+		}
+	}
+	writeAmfKey(buf, "")
+	buf.WriteByte(amfObjectEnd)
+
+	return MetaFrame{CFrame: &CFrame{
+		Type:   TAG_TYPE_META,
+		Flavor: METADATA,
+		Body:   buf.Bytes(),
+	}}
+}
+
+// Name returns the name of the script data event, e.g. "onMetaData"
+// or "onCuePoint", or an empty string if the body is not decodable.
+func (f MetaFrame) Name() string {
+	dec := amf0.NewDecoder(bytes.NewReader(f.CFrame.Body))
+	v, err := dec.Decode()
+	if err != nil {
+		return ""
+	}
+	if s, ok := v.(amf0.StringType); ok {
+		return string(s)
+	}
+	return ""
+}
+
+// Properties returns the scalar (number, boolean and string) properties of
+// an onMetaData tag keyed by name.
+func (f MetaFrame) Properties() map[string]interface{} {
+	props := map[string]interface{}{}
+	dec := amf0.NewDecoder(bytes.NewReader(f.CFrame.Body))
+	if _, err := dec.Decode(); err != nil {
+		return props
+	}
+	v, err := dec.Decode()
+	if err != nil {
+		return props
+	}
+	var ea map[amf0.StringType]interface{}
+	switch v := v.(type) {
+	case *amf0.EcmaArrayType:
+		ea = *v
+	case *amf0.ObjectType:
+		ea = *v
+	}
+	for k, v := range ea {
+		switch v := v.(type) {
+		case amf0.NumberType:
+			props[string(k)] = float64(v)
+		case amf0.BooleanType:
+			props[string(k)] = bool(v)
+		case amf0.StringType:
+			props[string(k)] = string(v)
+		}
+	}
+	return props
+}
+
+func writeAmfKey(buf *bytes.Buffer, key string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(key)))
+	buf.WriteString(key)
+}
+
+func writeAmfString(buf *bytes.Buffer, s string) {
+	buf.WriteByte(amfString)
+	writeAmfKey(buf, s)
+}
+
+func writeAmfNumber(buf *bytes.Buffer, n float64) {
+	buf.WriteByte(amfNumber)
+	binary.Write(buf, binary.BigEndian, math.Float64bits(n))
+}
+
+func writeAmfBoolean(buf *bytes.Buffer, b bool) {
+	buf.WriteByte(amfBoolean)
+	if b {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,31 @@
+package flv
+
+import (
+	"testing"
+)
+
+func TestMetaDataExtra(t *testing.T) {
+	md := &MetaData{HasVideo: true, Width: 320, Extra: map[string]interface{}{
+		"width":    640, // known
+		"bitrate":  int64(800),
+		"level":    uint8(3),
+		"encoder":  "flv.go",
+		"live":     true,
+		"tags":     []string{"a"},
+		"metadata": map[string]interface{}{},
+	}}
+	props := md.Frame().Properties()
+	if len(props) == 0 {
+		t.Fatalf("onMetaData is not decodable")
+	}
+	for k, v := range map[string]interface{}{"width": 320.0, "bitrate": 800.0, "level": 3.0, "encoder": "flv.go", "live": true} {
+		if props[k] != v {
+			t.Errorf("expect %s %v got %v", k, v, props[k])
+		}
+	}
+	for _, k := range []string{"tags", "metadata"} {
+		if _, ok := props[k]; ok {
+			t.Errorf("expect %s to be left out", k)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package flv
+
+import (
+	"fmt"
+)
+
+const (
+	// the ModEx packet type of both audio and video tags
+	modExPacketType = 7
+
+	maxTimestampOffsetNano = 999999
+)
+
+type modExWrapper struct {
+	typ  ModExType
+	data []byte
+}
+
+// modEx describes the ModEx wrappers following the first byte of an
+// Enhanced RTMP tag body.
+type modEx struct {
+	wrappers   []modExWrapper
+	packetType byte // wrapped by them
+	length     int
+}
+
+func parseModEx(body []byte) (m modEx, err error) {
+	if len(body) < 1 {
+		return m, fmt.Errorf("empty tag")
+	}
+	m.packetType = body[0] & 0x0F
+	pos := 1
+	for m.packetType == modExPacketType {
+		if pos >= len(body) {
+			return m, fmt.Errorf("truncated ModEx data size")
+		}
+		size := int(body[pos]) + 1
+		pos++
+		if size == 256 {
+			if pos+2 > len(body) {
+				return m, fmt.Errorf("truncated ModEx data size")
+			}
+			size = (int(body[pos])<<8 | int(body[pos+1])) + 1
+			pos += 2
+		}
+		if pos+size+1 > len(body) {
+			return m, fmt.Errorf("ModEx data of %d bytes in %d", size, len(body)-pos)
+		}
+		w := modExWrapper{data: body[pos : pos+size]}
+		pos += size
+		w.typ, m.packetType = ModExType(body[pos]>>4), body[pos]&0x0F
+		pos++
+		m.wrappers = append(m.wrappers, w)
+	}
+	m.length = pos - 1
+	return m, nil
+}
+
+func (m modEx) timestampOffsetNano() uint32 {
+	for _, w := range m.wrappers {
+		if w.typ == MODEX_TYPE_TIMESTAMP_OFFSET_NANO && len(w.data) >= 3 {
+			return uint32(w.data[0])<<16 | uint32(w.data[1])<<8 | uint32(w.data[2])
+		}
+	}
+	return 0
+}
+
+// bytes serializes the first byte of the tag body and the wrappers.
+func (m modEx) bytes(header byte) []byte {
+	if len(m.wrappers) == 0 {
+		return []byte{header&0xF0 | m.packetType}
+	}
+	buf := []byte{header&0xF0 | modExPacketType}
+	for i, w := range m.wrappers {
+		if n := len(w.data) - 1; n < 255 {
+			buf = append(buf, byte(n))
+		} else {
+			buf = append(buf, 255, byte(n>>8), byte(n))
+		}
+		next := byte(modExPacketType)
+		if i == len(m.wrappers)-1 {
+			next = m.packetType
+		}
+		buf = append(append(buf, w.data...), byte(w.typ)<<4|next)
+	}
+	return buf
+}
+
+// timestampOffsetNano returns the nanosecond offset of an Enhanced RTMP tag
+// body, 0 if it has none.
+func timestampOffsetNano(body []byte) uint32 {
+	m, err := parseModEx(body)
+	if err != nil {
+		return 0
+	}
+	return m.timestampOffsetNano()
+}
+
+// setTimestampOffsetNano returns body with its TimestampOffsetNano ModEx
+// wrapper replaced by one carrying nano, or removed if nano is 0.
+func setTimestampOffsetNano(body []byte, nano uint32) ([]byte, error) {
+	if nano > maxTimestampOffsetNano {
+		return nil, fmt.Errorf("timestamp offset of %dns exceeds a millisecond", nano)
+	}
+	m, err := parseModEx(body)
+	if err != nil {
+		return nil, err
+	}
+	rest := body[1+m.length:]
+	wrappers := m.wrappers[:0:0]
+	if nano != 0 {
+		wrappers = append(wrappers, modExWrapper{MODEX_TYPE_TIMESTAMP_OFFSET_NANO, []byte{byte(nano >> 16), byte(nano >> 8), byte(nano)}})
+	}
+	for _, w := range m.wrappers {
+		if w.typ != MODEX_TYPE_TIMESTAMP_OFFSET_NANO {
+			wrappers = append(wrappers, w)
+		}
+	}
+	m.wrappers = wrappers
+	return append(m.bytes(body[0]), rest...), nil
+}
+
+// DtsNano returns the decoding timestamp of fr in nanoseconds, refined by
+// the TimestampOffsetNano ModEx of Enhanced RTMP frames.
+func DtsNano(fr Frame) uint64 {
+	dts := uint64(fr.GetDts()) * 1000000
+	switch f := fr.(type) {
+	case ExVideoFrame:
+		dts += uint64(f.TimestampOffsetNano())
+	case ExAudioFrame:
+		dts += uint64(f.TimestampOffsetNano())
+	}
+	return dts
+}
+
+// TimestampOffsetNano returns the nanosecond offset refining the
+// millisecond Dts, 0 if the frame has none.
+func (f ExVideoFrame) TimestampOffsetNano() uint32 {
+	return timestampOffsetNano(f.Body)
+}
+
+// SetTimestampOffsetNano wraps the frame into a ModEx packet carrying the
+// nanosecond offset, below a millisecond, or unwraps it for 0.
+func (f ExVideoFrame) SetTimestampOffsetNano(nano uint32) error {
+	body, err := setTimestampOffsetNano(f.Body, nano)
+	if err != nil {
+		return err
+	}
+	f.Body = body
+	return nil
+}
+
+// TimestampOffsetNano returns the nanosecond offset refining the
+// millisecond Dts, 0 if the frame has none.
+func (f ExAudioFrame) TimestampOffsetNano() uint32 {
+	return timestampOffsetNano(f.Body)
+}
+
+// SetTimestampOffsetNano wraps the frame into a ModEx packet carrying the
+// nanosecond offset, below a millisecond, or unwraps it for 0.
+func (f ExAudioFrame) SetTimestampOffsetNano(nano uint32) error {
+	body, err := setTimestampOffsetNano(f.Body, nano)
+	if err != nil {
+		return err
+	}
+	f.Body = body
+	return nil
+}
+
+// modExLength is the length of the ModEx wrappers following the first
+// byte of body, 0 if there are none or they are broken.
+func modExLength(body []byte) int {
+	m, err := parseModEx(body)
+	if err != nil {
+		return 0
+	}
+	return m.length
+}
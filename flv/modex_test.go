@@ -0,0 +1,90 @@
+package flv
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestModEx(t *testing.T) {
+	nalu := []byte{0, 0, 0, 1, 0x26}
+	v := NewExVideoFrame(40, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_HEVC, -40, nalu)
+	plain := append([]byte{}, v.Body...)
+	if err := v.SetTimestampOffsetNano(123456); err != nil {
+		t.Fatalf("set error: %s", err)
+	}
+	if !bytes.Equal(v.Body[:10], []byte{0x97, 0x02, 0x01, 0xE2, 0x40, 0x01, 'h', 'v', 'c', '1'}) {
+		t.Errorf("unexpected ModEx header % x", v.Body[:10])
+	}
+	opus := (&OpusHead{Version: 1, ChannelCount: 2}).Bytes()
+	a := NewExAudioFrame(40, AUDIO_PACKET_TYPE_SEQUENCE_START, FOURCC_OPUS, opus)
+	a.SetTimestampOffsetNano(500)
+	tracks := []Frame{
+		NewExAudioFrame(60, AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, []byte{0xFC}),
+		NewExAudioFrame(60, AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, []byte{0xFD}),
+	}
+	for i, f := range tracks {
+		f := f.(ExAudioFrame)
+		f.TrackId = byte(i + 1)
+		f.SetTimestampOffsetNano(250000)
+		tracks[i] = f
+	}
+	multi, err := NewMultitrackFrame(tracks)
+	if err != nil {
+		t.Fatalf("pack error: %s", err)
+	}
+
+	got := readTestFile(t, writeTestFile(t, "modex.flv", []*CFrame{v.CFrame, a.CFrame, multi}))
+	if len(got) != 4 {
+		t.Fatalf("expect 4 frames got %d", len(got))
+	}
+	fv := got[0].(ExVideoFrame)
+	if fv.PacketType != VIDEO_PACKET_TYPE_CODED_FRAMES || fv.FourCC != FOURCC_HEVC || fv.CompositionTime() != -40 ||
+		!bytes.Equal(fv.Data(), nalu) || fv.TimestampOffsetNano() != 123456 || DtsNano(fv) != 40123456 {
+		t.Errorf("unexpected %s, cts %d, data % x, offset %d", fv, fv.CompositionTime(), fv.Data(), fv.TimestampOffsetNano())
+	}
+	if fa := got[1].(ExAudioFrame); !IsSequenceHeader(fa) || fa.Rate != 48000 || fa.TimestampOffsetNano() != 500 {
+		t.Errorf("unexpected %s, offset %d", fa, fa.TimestampOffsetNano())
+	}
+	for i, f := range got[2:] {
+		f := f.(ExAudioFrame)
+		if f.TrackId != byte(i+1) || f.PacketType != AUDIO_PACKET_TYPE_CODED_FRAMES || DtsNano(f) != 60250000 || len(f.Data()) != 1 {
+			t.Errorf("track %d: unexpected %s, offset %d", i+1, f, f.TimestampOffsetNano())
+		}
+	}
+	if DtsNano(AudioFrame{CFrame: &CFrame{Dts: 7}}) != 7000000 {
+		t.Errorf("expect legacy frames at whole milliseconds")
+	}
+
+	if err := v.SetTimestampOffsetNano(0); err != nil || !bytes.Equal(v.Body, plain) {
+		t.Errorf("expect the ModEx wrapper removed got % x, %v", v.Body, err)
+	}
+	if err := v.SetTimestampOffsetNano(1000000); err == nil {
+		t.Errorf("expect error on an offset of a millisecond")
+	}
+}
+
+func TestModExWrappers(t *testing.T) {
+	// an unknown extension with a 16 bit data size is kept
+	m := modEx{wrappers: []modExWrapper{{5, bytes.Repeat([]byte{0xAA}, 300)}}, packetType: 1}
+	body := append(m.bytes(0x90), 'O', 'p', 'u', 's', 0xFC)
+	if !bytes.Equal(body[:4], []byte{0x97, 0xFF, 0x01, 0x2B}) || body[304] != 0x51 {
+		t.Errorf("unexpected ModEx header % x", body[:4])
+	}
+	body, err := setTimestampOffsetNano(body, 999999)
+	if err != nil {
+		t.Fatalf("set error: %s", err)
+	}
+	got, err := parseModEx(body)
+	if err != nil || len(got.wrappers) != 2 || got.wrappers[1].typ != 5 || got.packetType != 1 || got.timestampOffsetNano() != 999999 {
+		t.Errorf("unexpected %+v, %v", got, err)
+	}
+	if !bytes.Equal(body[1+got.length:], []byte{'O', 'p', 'u', 's', 0xFC}) {
+		t.Errorf("unexpected payload % x", body[1+got.length:])
+	}
+
+	frames := []*CFrame{{Type: TAG_TYPE_AUDIO, Body: []byte{0x97, 0x05, 1}}}
+	f := readTestFile(t, writeTestFile(t, "broken.flv", frames))[0].(ExAudioFrame)
+	if f.PacketType != AUDIO_PACKET_TYPE_MODEX || !bytes.Equal(f.Data(), []byte{0x05, 1}) {
+		t.Errorf("expect the broken ModEx tag as is got %s", f)
+	}
+}
@@ -0,0 +1,233 @@
+package flv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+type MPEGAudioVersion byte
+
+const (
+	MPEG_AUDIO_VERSION_2_5 MPEGAudioVersion = 0
+	MPEG_AUDIO_VERSION_2   MPEGAudioVersion = 2
+	MPEG_AUDIO_VERSION_1   MPEGAudioVersion = 3
+)
+
+type MP3ChannelMode byte
+
+const (
+	MP3_CHANNEL_MODE_STEREO       MP3ChannelMode = 0
+	MP3_CHANNEL_MODE_JOINT_STEREO MP3ChannelMode = 1
+	MP3_CHANNEL_MODE_DUAL_CHANNEL MP3ChannelMode = 2
+	MP3_CHANNEL_MODE_MONO         MP3ChannelMode = 3
+)
+
+var (
+	mpegAudioVersionToStr = map[MPEGAudioVersion]string{
+		MPEG_AUDIO_VERSION_2_5: "MPEG-2.5",
+		MPEG_AUDIO_VERSION_2:   "MPEG-2",
+		MPEG_AUDIO_VERSION_1:   "MPEG-1",
+	}
+
+	// kbit/s by bitrate_index: MPEG-1 layer I, II, III, then MPEG-2 and
+	// 2.5 layer I, II and III
+	mp3Bitrates = [5][15]uint32{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mp3SampleRates = [3]uint32{44100, 48000, 32000} // MPEG-1
+)
+
+func (v MPEGAudioVersion) String() string {
+	return mpegAudioVersionToStr[v]
+}
+
+// MP3FrameHeader is the header of an MPEG audio frame, as found in the
+// bodies of MP3 audio tags past their first byte.
+type MP3FrameHeader struct {
+	Version     MPEGAudioVersion
+	Layer       byte // 1, 2 or 3
+	Protected   bool // followed by a CRC
+	Bitrate     uint32
+	SampleRate  uint32
+	Padding     bool
+	ChannelMode MP3ChannelMode
+}
+
+func (h *MP3FrameHeader) String() string {
+	return fmt.Sprintf("MP3FrameHeader(%s layer %d, %d bit/s, %d Hz, %d channels)", h.Version, h.Layer, h.Bitrate, h.SampleRate, h.Channels())
+}
+
+// ParseMP3FrameHeader parses the 4 byte frame header data starts with.
+// Free format frames are rejected, their length is unknown.
+func ParseMP3FrameHeader(data []byte) (*MP3FrameHeader, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("MPEG audio frame header of %d bytes", len(data))
+	}
+	if data[0] != 0xFF || data[1]&0xE0 != 0xE0 {
+		return nil, fmt.Errorf("Not MPEG audio frame, sync = %03x", uint16(data[0])<<3|uint16(data[1]>>5))
+	}
+	h := &MP3FrameHeader{
+		Version:     MPEGAudioVersion(data[1] >> 3 & 0x03),
+		Layer:       4 - data[1]>>1&0x03,
+		Protected:   data[1]&0x01 == 0,
+		Padding:     data[2]>>1&0x01 != 0,
+		ChannelMode: MP3ChannelMode(data[3] >> 6),
+	}
+	if h.Version == 1 {
+		return nil, fmt.Errorf("reserved MPEG audio version")
+	}
+	if h.Layer == 4 {
+		return nil, fmt.Errorf("reserved MPEG audio layer")
+	}
+	bitrate_index := data[2] >> 4
+	switch bitrate_index {
+	case 0:
+		return nil, fmt.Errorf("free format MPEG audio is not supported")
+	case 15:
+		return nil, fmt.Errorf("bad MPEG audio bitrate_index")
+	}
+	table := h.Layer - 1
+	if h.Version != MPEG_AUDIO_VERSION_1 {
+		table = 3
+		if h.Layer > 1 {
+			table = 4
+		}
+	}
+	h.Bitrate = mp3Bitrates[table][bitrate_index] * 1000
+
+	sampling_frequency := data[2] >> 2 & 0x03
+	if sampling_frequency == 3 {
+		return nil, fmt.Errorf("reserved MPEG audio sampling_frequency")
+	}
+	h.SampleRate = mp3SampleRates[sampling_frequency]
+	switch h.Version {
+	case MPEG_AUDIO_VERSION_2:
+		h.SampleRate /= 2
+	case MPEG_AUDIO_VERSION_2_5:
+		h.SampleRate /= 4
+	}
+	return h, nil
+}
+
+func (h *MP3FrameHeader) Channels() int {
+	if h.ChannelMode == MP3_CHANNEL_MODE_MONO {
+		return 1
+	}
+	return 2
+}
+
+// SamplesPerFrame returns the number of samples per channel in a frame.
+func (h *MP3FrameHeader) SamplesPerFrame() int {
+	switch {
+	case h.Layer == 1:
+		return 384
+	case h.Layer == 3 && h.Version != MPEG_AUDIO_VERSION_1:
+		return 576
+	}
+	return 1152
+}
+
+// FrameLength returns the length of the frame in bytes, header included.
+func (h *MP3FrameHeader) FrameLength() int {
+	padding := 0
+	if h.Padding {
+		padding = 1
+	}
+	if h.Layer == 1 {
+		return (12*int(h.Bitrate)/int(h.SampleRate) + padding) * 4
+	}
+	return h.SamplesPerFrame()/8*int(h.Bitrate)/int(h.SampleRate) + padding
+}
+
+// sideInfoLength is the length of the layer III side information
+// following the header.
+func (h *MP3FrameHeader) sideInfoLength() int {
+	mono := h.ChannelMode == MP3_CHANNEL_MODE_MONO
+	switch {
+	case h.Version == MPEG_AUDIO_VERSION_1 && mono:
+		return 17
+	case h.Version == MPEG_AUDIO_VERSION_1:
+		return 32
+	case mono:
+		return 9
+	}
+	return 17
+}
+
+// MP3VBRHeader is the Xing (or Info for CBR streams) or VBRI header LAME
+// and the Fraunhofer encoders put in place of the first frame's audio.
+type MP3VBRHeader struct {
+	Tag    string // "Xing", "Info" or "VBRI"
+	Frames uint32 // 0 if unknown
+	Bytes  uint32 // 0 if unknown
+	Frame  *MP3FrameHeader
+}
+
+func (v *MP3VBRHeader) String() string {
+	return fmt.Sprintf("MP3VBRHeader(%s, %d frames, %d bytes)", v.Tag, v.Frames, v.Bytes)
+}
+
+// ParseMP3VBRHeader parses the Xing, Info or VBRI header of the MP3 frame
+// data starts with; it fails on frames without one.
+func ParseMP3VBRHeader(data []byte) (*MP3VBRHeader, error) {
+	h, err := ParseMP3FrameHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if h.Layer != 3 {
+		return nil, fmt.Errorf("no VBR header in layer %d", h.Layer)
+	}
+	v := &MP3VBRHeader{Frame: h}
+	if n := 4 + h.sideInfoLength(); len(data) >= n+8 {
+		switch tag := string(data[n : n+4]); tag {
+		case "Xing", "Info":
+			v.Tag = tag
+			flags := binary.BigEndian.Uint32(data[n+4:])
+			n += 8
+			if flags&0x01 != 0 {
+				if len(data) < n+4 {
+					return nil, fmt.Errorf("truncated %s header", tag)
+				}
+				v.Frames = binary.BigEndian.Uint32(data[n:])
+				n += 4
+			}
+			if flags&0x02 != 0 {
+				if len(data) < n+4 {
+					return nil, fmt.Errorf("truncated %s header", tag)
+				}
+				v.Bytes = binary.BigEndian.Uint32(data[n:])
+			}
+			return v, nil
+		}
+	}
+	// VBRI follows 32 bytes of side information whatever the mode
+	if n := 4 + 32; len(data) >= n+18 && string(data[n:n+4]) == "VBRI" {
+		v.Tag = "VBRI"
+		v.Bytes = binary.BigEndian.Uint32(data[n+10:])
+		v.Frames = binary.BigEndian.Uint32(data[n+14:])
+		return v, nil
+	}
+	return nil, fmt.Errorf("no VBR header")
+}
+
+// Duration returns the duration of the stream by the frame count, or 0 if
+// it is unknown.
+func (v *MP3VBRHeader) Duration() time.Duration {
+	samples := float64(v.Frames) * float64(v.Frame.SamplesPerFrame())
+	return time.Duration(samples / float64(v.Frame.SampleRate) * float64(time.Second))
+}
+
+// Bitrate returns the average bitrate in bit/s, or 0 if the frame count
+// or byte count is unknown.
+func (v *MP3VBRHeader) Bitrate() uint32 {
+	d := v.Duration()
+	if d == 0 || v.Bytes == 0 {
+		return 0
+	}
+	return uint32(float64(v.Bytes) * 8 / d.Seconds())
+}
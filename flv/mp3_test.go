@@ -0,0 +1,113 @@
+package flv
+
+import (
+	"testing"
+)
+
+func TestParseMP3FrameHeader(t *testing.T) {
+	tests := []struct {
+		header  []byte
+		version MPEGAudioVersion
+		layer   byte
+		bitrate uint32
+		rate    uint32
+		length  int
+		samples int
+		chans   int
+	}{
+		{[]byte{0xFF, 0xFB, 0x90, 0x64}, MPEG_AUDIO_VERSION_1, 3, 128000, 44100, 417, 1152, 2},
+		{[]byte{0xFF, 0xF3, 0x88, 0xC0}, MPEG_AUDIO_VERSION_2, 3, 64000, 16000, 288, 576, 1},
+		{[]byte{0xFF, 0xE3, 0x88, 0xC0}, MPEG_AUDIO_VERSION_2_5, 3, 64000, 8000, 576, 576, 1},
+		{[]byte{0xFF, 0xFF, 0x16, 0x00}, MPEG_AUDIO_VERSION_1, 1, 32000, 48000, 36, 384, 2},
+		{[]byte{0xFF, 0xFC, 0x90, 0x80}, MPEG_AUDIO_VERSION_1, 2, 160000, 44100, 522, 1152, 2},
+	}
+	for _, tt := range tests {
+		h, err := ParseMP3FrameHeader(tt.header)
+		if err != nil {
+			t.Errorf("% x: parse error: %s", tt.header, err)
+			continue
+		}
+		if h.Version != tt.version || h.Layer != tt.layer || h.Bitrate != tt.bitrate || h.SampleRate != tt.rate {
+			t.Errorf("% x: unexpected %s", tt.header, h)
+		}
+		if h.FrameLength() != tt.length || h.SamplesPerFrame() != tt.samples || h.Channels() != tt.chans {
+			t.Errorf("% x: expect %d bytes, %d samples, %d channels got %d, %d, %d", tt.header,
+				tt.length, tt.samples, tt.chans, h.FrameLength(), h.SamplesPerFrame(), h.Channels())
+		}
+	}
+
+	for _, header := range [][]byte{{0xFF, 0xFB, 0x00, 0x64}, {0xFF, 0xFB, 0xF0, 0x64}, {0xFF, 0xFB, 0x9C, 0x64}, {0xFF, 0xEB, 0x90, 0x64}, {0x49, 0x44, 0x33, 0x03}} {
+		if _, err := ParseMP3FrameHeader(header); err == nil {
+			t.Errorf("% x: expect an error", header)
+		}
+	}
+}
+
+func TestParseMP3VBRHeader(t *testing.T) {
+	xing := append([]byte{0xFF, 0xFB, 0x90, 0x64}, make([]byte, 32)...)
+	xing = append(xing, "Xing\x00\x00\x00\x03"...)
+	xing = appendUint32(xing, 1000)
+	xing = appendUint32(xing, 417000)
+	v, err := ParseMP3VBRHeader(xing)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if v.Tag != "Xing" || v.Frames != 1000 || v.Bytes != 417000 {
+		t.Errorf("unexpected %s", v)
+	}
+	if ms := v.Duration().Milliseconds(); ms != 26122 {
+		t.Errorf("expect 26122 ms got %d", ms)
+	}
+	if rate := v.Bitrate(); rate < 127000 || rate > 128000 {
+		t.Errorf("expect about 128000 bit/s got %d", rate)
+	}
+
+	// mono MPEG-2 has 9 bytes of side information
+	info := append([]byte{0xFF, 0xF3, 0x88, 0xC0}, make([]byte, 9)...)
+	info = append(info, "Info\x00\x00\x00\x01"...)
+	info = appendUint32(info, 500)
+	if v, err = ParseMP3VBRHeader(info); err != nil || v.Tag != "Info" || v.Frames != 500 || v.Bytes != 0 {
+		t.Errorf("unexpected %v, %v", v, err)
+	}
+
+	vbri := append([]byte{0xFF, 0xFB, 0x90, 0x64}, make([]byte, 32)...)
+	vbri = append(vbri, "VBRI\x00\x01\x00\x00\x00\x4B"...)
+	vbri = appendUint32(vbri, 834000)
+	vbri = appendUint32(vbri, 2000)
+	if v, err = ParseMP3VBRHeader(vbri); err != nil || v.Tag != "VBRI" || v.Frames != 2000 || v.Bytes != 834000 {
+		t.Errorf("unexpected %v, %v", v, err)
+	}
+
+	if _, err = ParseMP3VBRHeader(append([]byte{0xFF, 0xFB, 0x90, 0x64}, make([]byte, 413)...)); err == nil {
+		t.Errorf("expect frames without VBR header to fail")
+	}
+}
+
+func TestParseMP3Frame(t *testing.T) {
+	r := &FlvReader{}
+	if h, v := r.MP3Header(); h != nil || v != nil {
+		t.Fatalf("unexpected %s %s before any frame", h, v)
+	}
+	// the tag claims 44 kHz mono, the frame is 48 kHz stereo with a Xing
+	// header
+	xing := append([]byte{0x2E, 0xFF, 0xFB, 0x94, 0x64}, make([]byte, 32)...)
+	xing = append(xing, "Xing\x00\x00\x00\x01"...)
+	xing = appendUint32(xing, 1000)
+	fr := r.parseFrame(&CFrame{Type: TAG_TYPE_AUDIO, Body: xing})
+	r.parseFrame(&CFrame{Type: TAG_TYPE_AUDIO, Body: []byte{0x2E, 0xFF, 0xFB, 0x90, 0x64}})
+	f := fr.(AudioFrame)
+	if f.Rate != 44000 || f.Channels != AUDIO_TYPE_MONO {
+		t.Errorf("expect the tag's 44000 Hz mono got %d %s", f.Rate, f.Channels)
+	}
+	h, v := r.MP3Header()
+	if h == nil || h.SampleRate != 48000 || h.Channels() != 2 {
+		t.Errorf("expect the first frame of 48000 Hz stereo got %s", h)
+	}
+	if v == nil || v.Tag != "Xing" || v.Frames != 1000 {
+		t.Errorf("unexpected %s", v)
+	}
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
@@ -0,0 +1,176 @@
+package flv
+
+import (
+	"fmt"
+)
+
+// multitrackEntry is one track of a multitrack tag; data is what follows
+// the track id, composition time included.
+type multitrackEntry struct {
+	trackId byte
+	fourCC  FourCC
+	data    []byte
+}
+
+// splitMultitrack splits the tracks of a multitrack tag body, whose first
+// byte is the tag header and second the multitrack and packet types.
+func splitMultitrack(body []byte) (entries []multitrackEntry, err error) {
+	if len(body) < 2 {
+		return nil, fmt.Errorf("multitrack tag of %d bytes", len(body))
+	}
+	mtType := AvMultitrackType(body[1] >> 4)
+	if mtType > AV_MULTITRACK_TYPE_MANY_TRACKS_MANY_CODECS {
+		return nil, fmt.Errorf("unknown multitrack type %d", mtType)
+	}
+	data := body[2:]
+	var fourCC FourCC
+	if mtType != AV_MULTITRACK_TYPE_MANY_TRACKS_MANY_CODECS {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("truncated multitrack FourCC")
+		}
+		fourCC, data = FourCC(data[:4]), data[4:]
+	}
+	for len(data) > 0 {
+		if mtType == AV_MULTITRACK_TYPE_MANY_TRACKS_MANY_CODECS {
+			if len(data) < 4 {
+				return nil, fmt.Errorf("truncated multitrack FourCC")
+			}
+			fourCC, data = FourCC(data[:4]), data[4:]
+		}
+		if len(data) < 1 {
+			return nil, fmt.Errorf("truncated multitrack track id")
+		}
+		e := multitrackEntry{trackId: data[0], fourCC: fourCC}
+		data = data[1:]
+		if mtType == AV_MULTITRACK_TYPE_ONE_TRACK {
+			e.data, data = data, nil
+		} else {
+			if len(data) < 3 {
+				return nil, fmt.Errorf("truncated multitrack track size")
+			}
+			size := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+			if len(data) < 3+size {
+				return nil, fmt.Errorf("multitrack track of %d bytes in %d", size, len(data)-3)
+			}
+			e.data, data = data[3:3+size], data[3+size:]
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("multitrack tag without tracks")
+	}
+	return entries, nil
+}
+
+// packMultitrack builds a multitrack tag body, choosing the most compact
+// multitrack type for entries.
+func packMultitrack(header, packetType byte, entries []multitrackEntry) []byte {
+	mtType := AV_MULTITRACK_TYPE_ONE_TRACK
+	if len(entries) > 1 {
+		mtType = AV_MULTITRACK_TYPE_MANY_TRACKS
+		for _, e := range entries[1:] {
+			if e.fourCC != entries[0].fourCC {
+				mtType = AV_MULTITRACK_TYPE_MANY_TRACKS_MANY_CODECS
+			}
+		}
+	}
+	body := []byte{header, byte(mtType)<<4 | packetType&0x0F}
+	if mtType != AV_MULTITRACK_TYPE_MANY_TRACKS_MANY_CODECS {
+		body = append(body, entries[0].fourCC...)
+	}
+	for _, e := range entries {
+		if mtType == AV_MULTITRACK_TYPE_MANY_TRACKS_MANY_CODECS {
+			body = append(body, e.fourCC...)
+		}
+		body = append(body, e.trackId)
+		if mtType != AV_MULTITRACK_TYPE_ONE_TRACK {
+			n := len(e.data)
+			body = append(body, byte(n>>16), byte(n>>8), byte(n))
+		}
+		body = append(body, e.data...)
+	}
+	return body
+}
+
+// expandMultitrack parses the first track of a multitrack tag and queues
+// the others for the following ReadFrame calls. Every track frame gets a
+// one track body of its own, so it can be written as is; they all share
+// the position of the tag and are read back with ReadTrackAt.
+func (frReader *FlvReader) expandMultitrack(pFrame *CFrame, parse func(*CFrame) Frame) Frame {
+	// ModEx wrappers go in front of every track
+	n := modExLength(pFrame.Body)
+	entries, err := splitMultitrack(pFrame.Body[n:])
+	if err != nil {
+		return parse(pFrame)
+	}
+	frames := make([]Frame, len(entries))
+	for i := range entries {
+		track := *pFrame
+		packed := packMultitrack(pFrame.Body[0], pFrame.Body[n+1], entries[i:i+1])
+		track.Body = append(pFrame.Body[:n+1:n+1], packed[1:]...)
+		frames[i] = parse(&track)
+	}
+	frReader.pending = append(frReader.pending, frames[1:]...)
+	return frames[0]
+}
+
+// NewMultitrackFrame packs frames of several tracks into one multitrack
+// tag, the track of each frame given by its TrackId. The frames must all be
+// ExVideoFrame or all ExAudioFrame with the same timestamp, nanosecond
+// offset included, and packet type, video frames also of the same frame
+// type.
+func NewMultitrackFrame(frames []Frame) (*CFrame, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frames for a multitrack tag")
+	}
+	var header, packetType byte
+	entries := make([]multitrackEntry, len(frames))
+	for i, fr := range frames {
+		var h, pt byte
+		switch f := fr.(type) {
+		case ExVideoFrame:
+			if f.PacketType == VIDEO_PACKET_TYPE_MULTITRACK || f.isCommand() {
+				return nil, fmt.Errorf("can not pack %s video frame into a multitrack tag", f.PacketType)
+			}
+			h, pt = 0x80|byte(f.FrameType)<<4|byte(VIDEO_PACKET_TYPE_MULTITRACK), byte(f.PacketType)
+			entries[i] = multitrackEntry{trackId: f.TrackId, fourCC: f.FourCC, data: f.trackData()}
+		case ExAudioFrame:
+			if f.PacketType == AUDIO_PACKET_TYPE_MULTITRACK {
+				return nil, fmt.Errorf("can not pack %s audio frame into a multitrack tag", f.PacketType)
+			}
+			h, pt = byte(AUDIO_CODEC_EX_HEADER)<<4|byte(AUDIO_PACKET_TYPE_MULTITRACK), byte(f.PacketType)
+			entries[i] = multitrackEntry{trackId: f.TrackId, fourCC: f.FourCC, data: f.trackData()}
+		default:
+			return nil, fmt.Errorf("can not pack %T into a multitrack tag", fr)
+		}
+		if i == 0 {
+			header, packetType = h, pt
+		} else if h != header || pt != packetType || DtsNano(fr) != DtsNano(frames[0]) {
+			return nil, fmt.Errorf("frames of a multitrack tag differ in type, packet type or timestamp")
+		}
+	}
+	body := packMultitrack(header, packetType, entries)
+	if nano := DtsNano(frames[0]) % 1000000; nano != 0 {
+		body, _ = setTimestampOffsetNano(body, uint32(nano))
+	}
+	flavor := FRAME
+	if frames[0].GetType() == TAG_TYPE_VIDEO && VideoFrameType(header>>4&0x07) == VIDEO_FRAME_TYPE_KEYFRAME {
+		flavor = KEYFRAME
+	}
+	return &CFrame{
+		Stream: frames[0].GetStream(),
+		Dts:    frames[0].GetDts(),
+		Type:   frames[0].GetType(),
+		Flavor: flavor,
+		Body:   body,
+	}, nil
+}
+
+// WriteMultitrack writes frames of several tracks as one multitrack tag.
+func (frWriter *FlvWriter) WriteMultitrack(frames ...Frame) error {
+	f, err := NewMultitrackFrame(frames)
+	if err != nil {
+		return err
+	}
+	return f.WriteFrame(frWriter.OutFile)
+}
@@ -0,0 +1,193 @@
+package flv
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMultitrack(t *testing.T) {
+	video := func(id byte, packetType VideoPacketType, fourCC FourCC, cts int32, data []byte) Frame {
+		f := NewExVideoFrame(0, VIDEO_FRAME_TYPE_KEYFRAME, packetType, fourCC, cts, data)
+		f.TrackId = id
+		return f
+	}
+	audio := func(id byte, fourCC FourCC, data []byte) Frame {
+		f := NewExAudioFrame(0, AUDIO_PACKET_TYPE_SEQUENCE_START, fourCC, data)
+		f.TrackId = id
+		return f
+	}
+	av1 := (&AV1ConfRecord{Version: 1, ConfigOBUs: testAV1SequenceHeader()}).Bytes()
+	opus := (&OpusHead{Version: 1, ChannelCount: 2}).Bytes()
+	flac := (&FLACStreamInfo{SampleRate: 44100, Channels: 1, BitsPerSample: 16}).Bytes()
+	tags := [][]Frame{
+		{video(0, VIDEO_PACKET_TYPE_SEQUENCE_START, FOURCC_HEVC, 0, testHEVCConf().Bytes()), video(1, VIDEO_PACKET_TYPE_SEQUENCE_START, FOURCC_AV1, 0, av1)},
+		{audio(1, FOURCC_OPUS, opus), audio(2, FOURCC_FLAC, flac)},
+		{video(0, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_HEVC, -40, []byte{0, 0, 0, 1, 0x26}), video(2, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_HEVC, 80, []byte{0, 0, 0, 1, 0x28})},
+		{video(3, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_VP9, 0, testVP9KeyFrame())},
+	}
+	var frames []*CFrame
+	for _, tag := range tags {
+		f, err := NewMultitrackFrame(tag)
+		if err != nil {
+			t.Fatalf("pack error: %s", err)
+		}
+		frames = append(frames, f)
+	}
+	if !bytes.Equal(frames[2].Body[:9], []byte{0x96, 0x11, 'h', 'v', 'c', '1', 0, 0, 0}) {
+		t.Errorf("expect many tracks header got % x", frames[2].Body[:9])
+	}
+	if !bytes.Equal(frames[1].Body[:7], []byte{0x95, 0x20, 'O', 'p', 'u', 's', 1}) {
+		t.Errorf("expect many tracks many codecs header got % x", frames[1].Body[:7])
+	}
+	if frames[3].Body[1] != 0x01 {
+		t.Errorf("expect one track header got % x", frames[3].Body[:2])
+	}
+
+	got := readTestFile(t, writeTestFile(t, "multitrack.flv", frames))
+	if len(got) != 7 {
+		t.Fatalf("expect 7 track frames got %d", len(got))
+	}
+	for i, c := range []struct {
+		id     byte
+		fourCC FourCC
+		width  uint16
+		cts    int32
+		tag    int
+	}{
+		{0, FOURCC_HEVC, 1920, 0, 0},
+		{1, FOURCC_AV1, 1920, 0, 0},
+		{1, FOURCC_OPUS, 0, 0, 1},
+		{2, FOURCC_FLAC, 0, 0, 1},
+		{0, FOURCC_HEVC, 1920, -40, 2},
+		{2, FOURCC_HEVC, 0, 80, 2},
+		{3, FOURCC_VP9, 640, 0, 3},
+	} {
+		if PositionOf(got[i]) != PositionOf(got[[]int{0, 2, 4, 6}[c.tag]]) {
+			t.Errorf("frame %d: expect the position of tag %d", i, c.tag)
+		}
+		switch f := got[i].(type) {
+		case ExVideoFrame:
+			want := tags[c.tag][i-[]int{0, 2, 4, 6}[c.tag]].(ExVideoFrame)
+			if f.TrackId != c.id || f.FourCC != c.fourCC || f.Width != c.width || f.CompositionTime() != c.cts ||
+				f.PacketType != want.PacketType || !bytes.Equal(f.Data(), want.Data()) || f.Flavor != KEYFRAME {
+				t.Errorf("frame %d: unexpected %s", i, f)
+			}
+		case ExAudioFrame:
+			want := tags[c.tag][i-[]int{0, 2, 4, 6}[c.tag]].(ExAudioFrame)
+			if f.TrackId != c.id || f.FourCC != c.fourCC || !bytes.Equal(f.Data(), want.Data()) {
+				t.Errorf("frame %d: unexpected %s", i, f)
+			}
+		}
+	}
+	if f := got[3].(ExAudioFrame); f.Rate != 44100 || f.ChannelCount != 1 {
+		t.Errorf("expect the FLAC track at 44100 mono got %s", f)
+	}
+	if f := got[2].(ExAudioFrame); f.Rate != 48000 || f.ChannelCount != 2 {
+		t.Errorf("expect the Opus track at 48000 stereo got %s", f)
+	}
+
+	// track frames are written as one track tags and pack back into the tag
+	var single []*CFrame
+	for _, f := range got {
+		switch f := f.(type) {
+		case ExVideoFrame:
+			single = append(single, f.CFrame)
+		case ExAudioFrame:
+			single = append(single, f.CFrame)
+		}
+	}
+	again := readTestFile(t, writeTestFile(t, "single.flv", single))
+	if len(again) != len(got) || again[5].(ExVideoFrame).TrackId != 2 || again[5].(ExVideoFrame).CompositionTime() != 80 {
+		t.Errorf("expect one track tags to keep their track")
+	}
+	if f, err := NewMultitrackFrame(got[4:6]); err != nil || !bytes.Equal(f.Body, frames[2].Body) {
+		t.Errorf("expect track frames to pack into % x got %v, %v", frames[2].Body, f, err)
+	}
+}
+
+func TestMultitrackErrors(t *testing.T) {
+	v := NewExVideoFrame(0, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_AV1, 0, []byte{1})
+	a := NewExAudioFrame(0, AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, []byte{1})
+	later := NewExAudioFrame(20, AUDIO_PACKET_TYPE_CODED_FRAMES, FOURCC_OPUS, []byte{1})
+	legacy := AudioFrame{CFrame: &CFrame{Type: TAG_TYPE_AUDIO, Body: []byte{0xAF, 1}}}
+	for i, frames := range [][]Frame{nil, {v, a}, {a, later}, {legacy}} {
+		if _, err := NewMultitrackFrame(frames); err == nil {
+			t.Errorf("case %d: expect error", i)
+		}
+	}
+
+	// a truncated tag is left as is
+	frames := []*CFrame{{Type: TAG_TYPE_VIDEO, Body: []byte{0x96, 0x11, 'a', 'v', '0', '1', 0, 0, 0, 9, 1}}}
+	got := readTestFile(t, writeTestFile(t, "broken.flv", frames))
+	if f := got[0].(ExVideoFrame); len(got) != 1 || f.PacketType != VIDEO_PACKET_TYPE_MULTITRACK || len(f.Data()) != 10 {
+		t.Errorf("expect the multitrack tag as is got %s", f)
+	}
+}
+
+func TestCutMultitrack(t *testing.T) {
+	opus := func(dts uint32, packetType AudioPacketType, data func(id byte) []byte) *CFrame {
+		var tracks []Frame
+		for id := byte(1); id <= 2; id++ {
+			f := NewExAudioFrame(dts, packetType, FOURCC_OPUS, data(id))
+			f.TrackId = id
+			tracks = append(tracks, f)
+		}
+		f, err := NewMultitrackFrame(tracks)
+		if err != nil {
+			t.Fatalf("pack error: %s", err)
+		}
+		return f
+	}
+	frames := []*CFrame{
+		testVideoTag(0, true, VIDEO_AVC_SEQUENCE_HEADER),
+		opus(0, AUDIO_PACKET_TYPE_SEQUENCE_START, func(id byte) []byte {
+			return (&OpusHead{Version: 1, ChannelCount: id}).Bytes()
+		}),
+	}
+	for ms := uint32(0); ms < 2000; ms += 40 {
+		frames = append(frames, testVideoTag(ms, ms%1000 == 0, VIDEO_AVC_NALU))
+		frames = append(frames, opus(ms, AUDIO_PACKET_TYPE_CODED_FRAMES, func(id byte) []byte {
+			return []byte{id, byte(ms / 40)}
+		}))
+	}
+	in, err := os.Open(writeTestFile(t, "in.flv", frames))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	outPath := filepath.Join(t.TempDir(), "out.flv")
+	out, err := os.Create(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Cut(NewReader(in), NewWriter(out), 1000, 0)
+	out.Close()
+	if err != nil {
+		t.Fatalf("cut error: %s", err)
+	}
+
+	var heads, coded []ExAudioFrame
+	for _, fr := range readTestFile(t, outPath) {
+		if f, ok := fr.(ExAudioFrame); ok {
+			if f.PacketType == AUDIO_PACKET_TYPE_SEQUENCE_START {
+				heads = append(heads, f)
+			} else {
+				coded = append(coded, f)
+			}
+		}
+	}
+	if len(heads) != 2 || heads[0].TrackId != 1 || heads[1].TrackId != 2 || heads[1].ChannelCount != 2 {
+		t.Errorf("expect the sequence starts of tracks 1 and 2 got %v", heads)
+	}
+	if len(coded) != 50 {
+		t.Fatalf("expect 50 coded frames got %d", len(coded))
+	}
+	for i, f := range coded {
+		want := []byte{byte(i%2 + 1), byte(25 + i/2)}
+		if f.TrackId != want[0] || !bytes.Equal(f.Data(), want) {
+			t.Errorf("frame %d: expect track %d data % x got track %d data % x", i, want[0], want, f.TrackId, f.Data())
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package flv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// MuxOptions configure Mux.
+type MuxOptions struct {
+	// FrameRate of the video stream; when zero the SPS timing_info is used.
+	FrameRate float64
+}
+
+type accessUnit struct {
+	nalus [][]byte
+	idr   bool
+	poc   int
+	conf  *AVCConfRecord
+}
+
+// h264Source turns an Annex B byte stream into AVC video frames with DTS and
+// composition times.
+type h264Source struct {
+	scanner   *bufio.Scanner
+	pending   []byte
+	frameRate float64
+
+	sps    *SPS
+	rawSPS []byte
+	rawPPS []byte
+	conf   *AVCConfRecord
+
+	prevPocMsb int
+	prevPocLsb int
+
+	gop     []*accessUnit
+	queue   []Frame
+	decoded int
+	reorder int
+	eof     bool
+}
+
+func newH264Source(r io.Reader, frameRate float64) *h264Source {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1<<20), 64<<20)
+	scanner.Split(ScanAnnexB)
+	return &h264Source{scanner: scanner, frameRate: frameRate}
+}
+
+func (s *h264Source) nextNALU() ([]byte, error) {
+	if s.pending != nil {
+		nalu := s.pending
+		s.pending = nil
+		return nalu, nil
+	}
+	for s.scanner.Scan() {
+		if len(s.scanner.Bytes()) > 0 {
+			return append([]byte{}, s.scanner.Bytes()...), nil
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// readAccessUnit collects the NAL units of the next picture.
+func (s *h264Source) readAccessUnit() (au *accessUnit, err error) {
+	au = &accessUnit{}
+	hasSlice := false
+	for {
+		nalu, err := s.nextNALU()
+		if err == io.EOF && hasSlice {
+			return au, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		t := NALUTypeOf(nalu)
+		isSlice := t == NALU_TYPE_SLICE || t == NALU_TYPE_IDR
+		if hasSlice {
+			firstSlice := isSlice && len(nalu) > 1 && nalu[1]&0x80 != 0 // first_mb_in_slice == 0
+			if firstSlice || t == NALU_TYPE_AUD || t == NALU_TYPE_SPS || t == NALU_TYPE_PPS || t == NALU_TYPE_SEI {
+				s.pending = nalu
+				return au, nil
+			}
+		}
+
+		switch t {
+		case NALU_TYPE_AUD:
+		case NALU_TYPE_SPS:
+			sps, err := ParseSPS(nalu)
+			if err != nil {
+				return nil, err
+			}
+			s.sps, s.rawSPS = sps, nalu
+		case NALU_TYPE_PPS:
+			s.rawPPS = nalu
+		case NALU_TYPE_SLICE, NALU_TYPE_IDR:
+			if !hasSlice {
+				if err = s.startPicture(au, nalu); err != nil {
+					return nil, err
+				}
+			}
+			hasSlice = true
+			au.nalus = append(au.nalus, nalu)
+		default:
+			au.nalus = append(au.nalus, nalu)
+		}
+	}
+}
+
+// startPicture computes the picture order count from the first slice and
+// notes parameter set changes.
+func (s *h264Source) startPicture(au *accessUnit, slice []byte) error {
+	if s.sps == nil || s.rawPPS == nil {
+		return fmt.Errorf("mux: H.264 slice before SPS and PPS")
+	}
+	if s.conf == nil || !bytes.Equal(s.conf.RawSPSData[0], s.rawSPS) || !bytes.Equal(s.conf.RawPPSData[0], s.rawPPS) {
+		s.conf = NewAVCConfRecord([][]byte{s.rawSPS}, [][]byte{s.rawPPS})
+		au.conf = s.conf
+	}
+	if s.frameRate == 0 {
+		s.frameRate = s.sps.FrameRate()
+		if s.frameRate == 0 {
+			return fmt.Errorf("mux: frame rate is not set and the SPS has no timing info")
+		}
+	}
+
+	au.idr = NALUTypeOf(slice) == NALU_TYPE_IDR
+	if s.sps.pic_order_cnt_type != 0 {
+		au.poc = s.decoded + len(s.gop)
+		return nil
+	}
+	sh, err := ParseSliceHeader(slice, s.sps)
+	if err != nil {
+		return err
+	}
+	if au.idr {
+		s.prevPocMsb, s.prevPocLsb = 0, 0
+	}
+	maxLsb := 1 << s.sps.log2_max_pic_order_cnt_lsb
+	lsb := int(sh.Pic_order_cnt_lsb)
+	msb := s.prevPocMsb
+	switch {
+	case lsb < s.prevPocLsb && s.prevPocLsb-lsb >= maxLsb/2:
+		msb += maxLsb
+	case lsb > s.prevPocLsb && lsb-s.prevPocLsb > maxLsb/2:
+		msb -= maxLsb
+	}
+	au.poc = msb + lsb
+	if slice[0]&0x60 != 0 { // reference picture
+		s.prevPocMsb, s.prevPocLsb = msb, lsb
+	}
+	return nil
+}
+
+func (s *h264Source) ms(frames int) uint32 {
+	return uint32(math.Floor(float64(frames)*1000/s.frameRate + 0.5))
+}
+
+// flushGop assigns timestamps to the buffered group of pictures: DTS in
+// decoding order and composition times from the picture order counts.
+func (s *h264Source) flushGop() {
+	n := len(s.gop)
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return s.gop[order[a]].poc < s.gop[order[b]].poc })
+	rank := make([]int, n)
+	for r, i := range order {
+		rank[i] = r
+		if i-r > s.reorder {
+			s.reorder = i - r
+		}
+	}
+
+	for i, au := range s.gop {
+		dts := s.ms(s.decoded + i)
+		cts := int32(s.ms(s.decoded+rank[i]+s.reorder)) - int32(dts)
+		if au.conf != nil {
+			s.queue = append(s.queue, s.frame(dts, 0, true, VIDEO_AVC_SEQUENCE_HEADER, au.conf.Bytes()))
+		}
+		body := new(bytes.Buffer)
+		for _, nalu := range au.nalus {
+			binary.Write(body, binary.BigEndian, uint32(len(nalu)))
+			body.Write(nalu)
+		}
+		s.queue = append(s.queue, s.frame(dts, cts, au.idr, VIDEO_AVC_NALU, body.Bytes()))
+	}
+	s.decoded += n
+	s.gop = nil
+}
+
+func (s *h264Source) frame(dts uint32, cts int32, key bool, packetType AvcPacketType, data []byte) Frame {
+	frameType, flavor := VIDEO_FRAME_TYPE_INTER_FRAME, FRAME
+	if key {
+		frameType, flavor = VIDEO_FRAME_TYPE_KEYFRAME, KEYFRAME
+	}
+	body := append([]byte{
+		byte(frameType)<<4 | byte(VIDEO_CODEC_AVC), byte(packetType),
+		byte(cts >> 16), byte(cts >> 8), byte(cts),
+	}, data...)
+	vFrame := &VideoFrame{
+		CFrame:  &CFrame{Type: TAG_TYPE_VIDEO, Dts: dts, Flavor: flavor, Body: body},
+		CodecId: VIDEO_CODEC_AVC,
+		Width:   uint16(s.sps.Width()),
+		Height:  uint16(s.sps.Height()),
+	}
+	return AVCVideoFrame{VideoFrame: vFrame, PacketType: packetType}
+}
+
+// next returns the next video frame in decoding order, or nil at the end.
+func (s *h264Source) next() (Frame, error) {
+	for len(s.queue) == 0 && !s.eof {
+		au, err := s.readAccessUnit()
+		if err == io.EOF {
+			s.eof = true
+			if len(s.gop) > 0 {
+				s.flushGop()
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if au.idr && len(s.gop) > 0 {
+			s.flushGop()
+		}
+		s.gop = append(s.gop, au)
+	}
+	if len(s.queue) == 0 {
+		return nil, nil
+	}
+	fr := s.queue[0]
+	s.queue = s.queue[1:]
+	return fr, nil
+}
+
+// duration is the time right after the last frame read.
+func (s *h264Source) duration() uint32 {
+	if s.frameRate == 0 {
+		return 0
+	}
+	return s.ms(s.decoded)
+}
+
+// adtsSource turns an ADTS byte stream into AAC audio frames.
+type adtsSource struct {
+	reader *bufio.Reader
+	conf   *AudioSpecificConfig
+	frames int
+	queue  []Frame
+}
+
+func newADTSSource(r io.Reader) *adtsSource {
+	return &adtsSource{reader: bufio.NewReader(r)}
+}
+
+func (s *adtsSource) dts(frames int) uint32 {
+	return uint32(math.Floor(float64(frames)*1024*1000/float64(s.conf.SampleRate) + 0.5))
+}
+
+func (s *adtsSource) frame(dts uint32, packetType AudioAac, data []byte) Frame {
+	body := append([]byte{byte(AUDIO_CODEC_AAC)<<4 | byte(AUDIO_RATE_44)<<2 | 1<<1 | 1, byte(packetType)}, data...)
+	return AudioFrame{
+		CFrame:   &CFrame{Type: TAG_TYPE_AUDIO, Dts: dts, Flavor: FRAME, Body: body},
+		CodecId:  AUDIO_CODEC_AAC,
+		Rate:     audioRate(AUDIO_RATE_44),
+		BitSize:  AUDIO_SIZE_16BIT,
+		Channels: AUDIO_TYPE_STEREO,
+	}
+}
+
+// next returns the next audio frame, or nil at the end.
+func (s *adtsSource) next() (Frame, error) {
+	if len(s.queue) > 0 {
+		fr := s.queue[0]
+		s.queue = s.queue[1:]
+		return fr, nil
+	}
+	header, err := s.reader.Peek(9)
+	if len(header) < 7 {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	conf, headerLength, frameLength, err := ParseADTSHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, frameLength)
+	if _, err = io.ReadFull(s.reader, data); err != nil {
+		return nil, err
+	}
+	if s.conf == nil || !bytes.Equal(s.conf.Bytes(), conf.Bytes()) {
+		s.conf = conf
+		s.queue = append(s.queue, s.frame(s.dts(s.frames), AUDIO_AAC_SEQUENCE_HEADER, conf.Bytes()))
+	}
+	s.queue = append(s.queue, s.frame(s.dts(s.frames), AUDIO_AAC_RAW, data[headerLength:]))
+	s.frames++
+	return s.next()
+}
+
+func (s *adtsSource) duration() uint32 {
+	if s.conf == nil {
+		return 0
+	}
+	return s.dts(s.frames)
+}
+
+// Mux writes an H.264 Annex B stream and an ADTS AAC stream interleaved by
+// DTS into out; either input may be nil.
+//
+// The AVC and AAC sequence headers are generated from the in-band SPS/PPS
+// and ADTS headers. The onMetaData tag is rewritten with the final duration
+// once all frames are written.
+func Mux(video, audio io.Reader, out *FlvWriter, opts MuxOptions) error {
+	var vs *h264Source
+	var as *adtsSource
+	var v, a Frame
+	var err error
+	md := &MetaData{}
+	if video != nil {
+		vs = newH264Source(video, opts.FrameRate)
+		if v, err = vs.next(); err != nil {
+			return err
+		}
+		if v != nil {
+			md.fillFrom(v)
+			md.FrameRate = vs.frameRate
+		}
+	}
+	if audio != nil {
+		as = newADTSSource(audio)
+		if a, err = as.next(); err != nil {
+			return err
+		}
+		if a != nil {
+			md.fillFrom(a)
+			md.AudioSampleRate = as.conf.SampleRate
+			md.Stereo = as.conf.ChannelConfiguration != 1
+		}
+	}
+
+	if err = out.WriteHeader(NewHeader(md.HasAudio, md.HasVideo)); err != nil {
+		return err
+	}
+	metaPos, err := out.OutFile.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return err
+	}
+	if err = out.WriteFrame(md.Frame()); err != nil {
+		return err
+	}
+
+	for v != nil || a != nil {
+		if a == nil || v != nil && v.GetDts() <= a.GetDts() {
+			if err = out.WriteFrame(v); err != nil {
+				return err
+			}
+			v, err = vs.next()
+		} else {
+			if err = out.WriteFrame(a); err != nil {
+				return err
+			}
+			a, err = as.next()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var end uint32
+	if vs != nil {
+		end = vs.duration()
+	}
+	if as != nil && as.duration() > end {
+		end = as.duration()
+	}
+	md.Duration = float64(end) / 1000
+
+	endPos, err := out.OutFile.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return err
+	}
+	if _, err = out.OutFile.Seek(metaPos, os.SEEK_SET); err != nil {
+		return err
+	}
+	if err = out.WriteFrame(md.Frame()); err != nil {
+		return err
+	}
+	_, err = out.OutFile.Seek(endPos, os.SEEK_SET)
+	return err
+}
@@ -0,0 +1,145 @@
+package flv
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testBits struct {
+	buf  []byte
+	bits uint
+}
+
+func (b *testBits) u(v uint64, n uint) *testBits {
+	for i := n; i > 0; i-- {
+		if b.bits%8 == 0 {
+			b.buf = append(b.buf, 0)
+		}
+		if v>>(i-1)&1 != 0 {
+			b.buf[len(b.buf)-1] |= 0x80 >> (b.bits % 8)
+		}
+		b.bits++
+	}
+	return b
+}
+
+func (b *testBits) ue(v uint32) *testBits {
+	n := uint(0)
+	for x := v + 1; x > 1; x >>= 1 {
+		n++
+	}
+	return b.u(0, n).u(uint64(v+1), n+1)
+}
+
+// nalu adds the rbsp stop bit and emulation prevention bytes.
+func (b *testBits) nalu(header byte) []byte {
+	b.u(1, 1)
+	out := []byte{header}
+	zeros := 0
+	for _, c := range b.buf {
+		if zeros >= 2 && c <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func testSPS() []byte {
+	b := &testBits{}
+	b.u(66, 8).u(0, 8).u(30, 8).ue(0) // profile, constraints, level, id
+	b.ue(0).ue(0).ue(0)               // log2_max_frame_num, poc type 0, log2_max_poc_lsb
+	b.ue(1).u(0, 1)                   // max_num_ref_frames, gaps
+	b.ue(19).ue(14)                   // 320x240
+	b.u(1, 1).u(1, 1).u(0, 1)         // frame_mbs_only, direct_8x8, cropping
+	b.u(1, 1).u(0, 4).u(1, 1)         // vui, no aspect/overscan/signal/chroma loc, timing
+	b.u(1, 32).u(50, 32).u(1, 1)      // 25fps
+	b.u(0, 5)
+	return b.nalu(0x67)
+}
+
+func testSlice(header byte, sliceType uint32, poc uint64) []byte {
+	b := &testBits{}
+	b.ue(0).ue(sliceType).ue(0).u(0, 4)
+	if header&0x1F == 5 {
+		b.ue(0)
+	}
+	b.u(poc, 4).u(0x5A5A, 16)
+	return b.nalu(header)
+}
+
+func TestParseSPSTiming(t *testing.T) {
+	sps, err := ParseSPS(testSPS())
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if sps.Width() != 320 || sps.Height() != 240 || sps.FrameRate() != 25 {
+		t.Errorf("expect 320x240@25 got %dx%d@%v", sps.Width(), sps.Height(), sps.FrameRate())
+	}
+}
+
+func TestMux(t *testing.T) {
+	video := new(bytes.Buffer)
+	for _, nalu := range [][]byte{
+		{0x09, 0xF0}, testSPS(), {0x68, 0xCE, 0x38, 0x80},
+		testSlice(0x65, 7, 0), testSlice(0x41, 5, 4), testSlice(0x01, 6, 2),
+		testSlice(0x41, 5, 8), testSlice(0x01, 6, 6),
+	} {
+		video.Write(annexBStartCode)
+		video.Write(nalu)
+	}
+	audio := new(bytes.Buffer)
+	conf := &AudioSpecificConfig{ObjectType: AAC_OBJECT_LC, SamplingFrequencyIndex: 4, ChannelConfiguration: 2}
+	for i := 0; i < 10; i++ {
+		audio.Write(conf.ADTSHeader(3))
+		audio.Write([]byte{0x21, 0x00, 0x49})
+	}
+
+	outPath := filepath.Join(t.TempDir(), "out.flv")
+	out, err := os.Create(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Mux(video, audio, NewWriter(out), MuxOptions{})
+	out.Close()
+	if err != nil {
+		t.Fatalf("mux error: %s", err)
+	}
+
+	frames := readTestFile(t, outPath)
+	props := frames[0].(MetaFrame).Properties()
+	if props["duration"] != 0.232 || props["width"] != 320.0 || props["framerate"] != 25.0 {
+		t.Errorf("unexpected metadata %v", props)
+	}
+	var dts []uint32
+	var cts []int32
+	var prev uint32
+	for _, fr := range frames[1:] {
+		if fr.GetDts() < prev {
+			t.Errorf("frames not interleaved: %d after %d", fr.GetDts(), prev)
+		}
+		prev = fr.GetDts()
+		if f, ok := fr.(AVCVideoFrame); ok && !IsSequenceHeader(f) {
+			dts = append(dts, f.Dts)
+			cts = append(cts, f.CompositionTime())
+		}
+	}
+	expectDts := []uint32{0, 40, 80, 120, 160}
+	expectCts := []int32{40, 80, 0, 80, 0}
+	for i := range expectDts {
+		if i >= len(dts) || dts[i] != expectDts[i] || cts[i] != expectCts[i] {
+			t.Fatalf("expect dts %v cts %v got %v %v", expectDts, expectCts, dts, cts)
+		}
+	}
+	if !IsSequenceHeader(frames[1]) || !IsKeyframe(frames[3]) && !IsKeyframe(frames[2]) {
+		t.Errorf("expect sequence headers before the first keyframe")
+	}
+}
@@ -0,0 +1,65 @@
+package flv
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// OpusHead is the Opus identification header (RFC 7845 5.1) carried by
+// Opus sequence starts.
+type OpusHead struct {
+	Version         byte
+	ChannelCount    byte
+	PreSkip         uint16
+	InputSampleRate uint32
+	OutputGain      int16
+	MappingFamily   byte
+	StreamCount     byte   // mapping family other than 0
+	CoupledCount    byte   // mapping family other than 0
+	ChannelMapping  []byte // mapping family other than 0
+}
+
+func (h *OpusHead) String() string {
+	return fmt.Sprintf("OpusHead(ver. %d, channels: %d, pre-skip: %d, input rate: %d, mapping family: %d)",
+		h.Version, h.ChannelCount, h.PreSkip, h.InputSampleRate, h.MappingFamily)
+}
+
+func ParseOpusHead(data []byte) (*OpusHead, error) {
+	if len(data) < 19 || string(data[:8]) != "OpusHead" {
+		return nil, fmt.Errorf("not an OpusHead")
+	}
+	le := binary.LittleEndian
+	h := &OpusHead{
+		Version:         data[8],
+		ChannelCount:    data[9],
+		PreSkip:         le.Uint16(data[10:]),
+		InputSampleRate: le.Uint32(data[12:]),
+		OutputGain:      int16(le.Uint16(data[16:])),
+		MappingFamily:   data[18],
+	}
+	if h.MappingFamily != 0 {
+		if len(data) < 21+int(h.ChannelCount) {
+			return nil, fmt.Errorf("OpusHead channel mapping of %d channels in %d bytes", h.ChannelCount, len(data)-19)
+		}
+		h.StreamCount, h.CoupledCount = data[19], data[20]
+		h.ChannelMapping = data[21 : 21+int(h.ChannelCount)]
+	}
+	return h, nil
+}
+
+// Bytes serializes the header as carried in Opus sequence starts.
+func (h *OpusHead) Bytes() []byte {
+	buf := make([]byte, 19, 21+len(h.ChannelMapping))
+	le := binary.LittleEndian
+	copy(buf, "OpusHead")
+	buf[8], buf[9] = h.Version, h.ChannelCount
+	le.PutUint16(buf[10:], h.PreSkip)
+	le.PutUint32(buf[12:], h.InputSampleRate)
+	le.PutUint16(buf[16:], uint16(h.OutputGain))
+	buf[18] = h.MappingFamily
+	if h.MappingFamily != 0 {
+		buf = append(buf, h.StreamCount, h.CoupledCount)
+		buf = append(buf, h.ChannelMapping...)
+	}
+	return buf
+}
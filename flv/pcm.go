@@ -0,0 +1,199 @@
+package flv
+
+import (
+	"fmt"
+)
+
+// adpcmStepTable is the IMA ADPCM step size table.
+var adpcmStepTable = [89]int32{
+	7, 8, 9, 10, 11, 12, 13, 14, 16, 17,
+	19, 21, 23, 25, 28, 31, 34, 37, 41, 45,
+	50, 55, 60, 66, 73, 80, 88, 97, 107, 118,
+	130, 143, 157, 173, 190, 209, 230, 253, 279, 307,
+	337, 371, 408, 449, 494, 544, 598, 658, 724, 796,
+	876, 963, 1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066,
+	2272, 2499, 2749, 3024, 3327, 3660, 4026, 4428, 4871, 5358,
+	5894, 6484, 7132, 7845, 8630, 9493, 10442, 11487, 12635, 13899,
+	15289, 16818, 18500, 20350, 22385, 24623, 27086, 29794, 32767,
+}
+
+// adpcmIndexTables adjust the step index by the magnitude of a 2 to 5 bit
+// Flash ADPCM code.
+var adpcmIndexTables = [4][]int32{
+	{-1, 2},
+	{-1, -1, 2, 4},
+	{-1, -1, -1, -1, 2, 4, 6, 8},
+	{-1, -1, -1, -1, -1, -1, -1, -1, 1, 2, 4, 6, 8, 10, 13, 16},
+}
+
+const (
+	adpcmPacketSamples = 4096
+)
+
+// CanDecodeAudio reports whether DecodeAudio supports the codec.
+func CanDecodeAudio(codec AudioCodec) bool {
+	switch codec {
+	case AUDIO_CODEC_PCM, AUDIO_CODEC_PCM_LE, AUDIO_CODEC_A_G711, AUDIO_CODEC_MU_G711, AUDIO_CODEC_ADPCM:
+		return true
+	}
+	return false
+}
+
+// DecodeAudio decodes a PCM, G.711 or ADPCM audio frame into interleaved
+// 16 bit samples. PCM is taken as little endian, as written by all known
+// encoders.
+func DecodeAudio(f AudioFrame) ([]int16, error) {
+	if len(f.Body) < 1 {
+		return nil, fmt.Errorf("empty audio tag")
+	}
+	data := f.Body[1:]
+	switch f.CodecId {
+	case AUDIO_CODEC_PCM, AUDIO_CODEC_PCM_LE:
+		return DecodePCM(data, f.BitSize), nil
+	case AUDIO_CODEC_A_G711:
+		return DecodeALaw(data), nil
+	case AUDIO_CODEC_MU_G711:
+		return DecodeMuLaw(data), nil
+	case AUDIO_CODEC_ADPCM:
+		channels := 1
+		if f.Channels == AUDIO_TYPE_STEREO {
+			channels = 2
+		}
+		return DecodeADPCM(data, channels)
+	}
+	return nil, fmt.Errorf("%s audio can not be decoded", f.CodecId)
+}
+
+// DecodedSampleRate returns the real sample rate of a frame decoded by
+// DecodeAudio: G.711 is always 8 kHz, whatever the sound rate bits say.
+func DecodedSampleRate(f AudioFrame) uint32 {
+	if f.CodecId == AUDIO_CODEC_A_G711 || f.CodecId == AUDIO_CODEC_MU_G711 {
+		return 8000
+	}
+	return pcmSampleRate(f.Rate)
+}
+
+// DecodePCM converts unsigned 8 bit or signed little endian 16 bit PCM to
+// 16 bit samples; a trailing odd byte of 16 bit PCM is dropped.
+func DecodePCM(data []byte, bitSize AudioSize) []int16 {
+	if bitSize != AUDIO_SIZE_16BIT {
+		samples := make([]int16, len(data))
+		for i, b := range data {
+			samples[i] = (int16(b) - 0x80) << 8
+		}
+		return samples
+	}
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(uint16(data[2*i]) | uint16(data[2*i+1])<<8)
+	}
+	return samples
+}
+
+// DecodeALaw expands G.711 A-law samples.
+func DecodeALaw(data []byte) []int16 {
+	samples := make([]int16, len(data))
+	for i, a := range data {
+		a ^= 0x55
+		t := int16(a&0x0F) << 4
+		switch seg := (a & 0x70) >> 4; seg {
+		case 0:
+			t += 8
+		case 1:
+			t += 0x108
+		default:
+			t = (t + 0x108) << (seg - 1)
+		}
+		if a&0x80 == 0 {
+			t = -t
+		}
+		samples[i] = t
+	}
+	return samples
+}
+
+// DecodeMuLaw expands G.711 mu-law samples.
+func DecodeMuLaw(data []byte) []int16 {
+	samples := make([]int16, len(data))
+	for i, u := range data {
+		u = ^u
+		t := (int16(u&0x0F)<<3 + 0x84) << ((u & 0x70) >> 4)
+		if u&0x80 != 0 {
+			samples[i] = 0x84 - t
+		} else {
+			samples[i] = t - 0x84
+		}
+	}
+	return samples
+}
+
+// DecodeADPCM decodes Flash ADPCM: a 2 bit code size, then packets of 4096
+// samples per channel, each starting with a raw 16 bit sample and a 6 bit
+// step index per channel followed by the interleaved codes.
+func DecodeADPCM(data []byte, channels int) (samples []int16, err error) {
+	r := NewBitReader(data)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = rec.(error)
+		}
+	}()
+
+	if channels != 1 && channels != 2 {
+		return nil, fmt.Errorf("ADPCM of %d channels", channels)
+	}
+	size := len(data) * 8
+	if size < 2 {
+		return nil, fmt.Errorf("ADPCM of %d bytes", len(data))
+	}
+	code_size := int(r.U(2)) + 2
+	pos := 2
+	indexTable := adpcmIndexTables[code_size-2]
+	signMask := int32(1) << uint(code_size-1)
+
+	predictor := make([]int32, channels)
+	stepIndex := make([]int32, channels)
+	for pos+22*channels <= size {
+		for c := 0; c < channels; c++ {
+			predictor[c] = int32(int16(r.U(16)))
+			stepIndex[c] = int32(r.U(6))
+			pos += 22
+			samples = append(samples, int16(predictor[c]))
+		}
+		for n := 1; n < adpcmPacketSamples && pos+code_size*channels <= size; n++ {
+			for c := 0; c < channels; c++ {
+				delta := int32(r.U(uint32(code_size)))
+				pos += code_size
+				// diff = (delta + 0.5) * step / 4 for 4 bit codes
+				step := adpcmStepTable[stepIndex[c]]
+				diff := int32(0)
+				for k := signMask >> 1; k != 0; k >>= 1 {
+					if delta&k != 0 {
+						diff += step
+					}
+					step >>= 1
+				}
+				diff += step
+				if delta&signMask != 0 {
+					predictor[c] -= diff
+				} else {
+					predictor[c] += diff
+				}
+				predictor[c] = clamp(predictor[c], -32768, 32767)
+				stepIndex[c] = clamp(stepIndex[c]+indexTable[delta&^signMask], 0, 88)
+				samples = append(samples, int16(predictor[c]))
+			}
+		}
+	}
+	return samples, nil
+}
+
+func clamp(v, lo, hi int32) int32 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
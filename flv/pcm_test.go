@@ -0,0 +1,82 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeG711(t *testing.T) {
+	if got := DecodeMuLaw([]byte{0xFF, 0x7F, 0x00, 0x80}); !reflect.DeepEqual(got, []int16{0, 0, -32124, 32124}) {
+		t.Errorf("unexpected mu-law %v", got)
+	}
+	if got := DecodeALaw([]byte{0xD5, 0x55, 0xAA, 0x2A}); !reflect.DeepEqual(got, []int16{8, -8, 32256, -32256}) {
+		t.Errorf("unexpected A-law %v", got)
+	}
+}
+
+func TestDecodePCM(t *testing.T) {
+	if got := DecodePCM([]byte{0x80, 0xFF, 0x00}, AUDIO_SIZE_8BIT); !reflect.DeepEqual(got, []int16{0, 0x7F00, -0x8000}) {
+		t.Errorf("unexpected 8 bit PCM %v", got)
+	}
+	if got := DecodePCM([]byte{0x34, 0x12, 0xFE, 0xFF, 0x01}, AUDIO_SIZE_16BIT); !reflect.DeepEqual(got, []int16{0x1234, -2}) {
+		t.Errorf("unexpected 16 bit PCM %v", got)
+	}
+}
+
+func TestDecodeADPCM(t *testing.T) {
+	// 4 bit codes: the largest step up and the smallest down
+	b := (&testBits{}).u(2, 2).u(1000, 16).u(0, 6).u(0x7, 4).u(0x8, 4)
+	got, err := DecodeADPCM(b.buf, 1)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	if !reflect.DeepEqual(got, []int16{1000, 1011, 1009}) {
+		t.Errorf("unexpected mono samples %v", got)
+	}
+
+	// 5 bit stereo codes
+	b = (&testBits{}).u(3, 2).u(100, 16).u(10, 6).u(0xFF9C, 16).u(0, 6).u(0x08, 5).u(0x10, 5)
+	f := AudioFrame{CFrame: &CFrame{Type: TAG_TYPE_AUDIO, Body: append([]byte{0x1F}, b.buf...)}, CodecId: AUDIO_CODEC_ADPCM, Channels: AUDIO_TYPE_STEREO}
+	if got, err = DecodeAudio(f); err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	if !reflect.DeepEqual(got, []int16{100, -100, 120, -100}) {
+		t.Errorf("unexpected stereo samples %v", got)
+	}
+
+	if _, err = DecodeADPCM(b.buf, 3); err == nil {
+		t.Errorf("expect 3 channels to be rejected")
+	}
+}
+
+func TestDemuxG711(t *testing.T) {
+	out := nopCloser{new(bytes.Buffer)}
+	d := &Demuxer{CreateAudio: func(ext string) (w io.WriteCloser, err error) {
+		if ext != ".wav" {
+			t.Errorf("expect .wav got %s", ext)
+		}
+		return out, nil
+	}}
+	r := &FlvReader{}
+	fr := r.parseFrame(&CFrame{Type: TAG_TYPE_AUDIO, Body: []byte{0x8E, 0xFF, 0x00}})
+	if err := d.WriteFrame(fr); err != nil {
+		t.Fatalf("demux error: %s", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	wav := out.Bytes()
+	if len(wav) != wavHeaderLength+4 {
+		t.Fatalf("expect %d bytes got %d", wavHeaderLength+4, len(wav))
+	}
+	if rate, bits := binary.LittleEndian.Uint32(wav[24:]), binary.LittleEndian.Uint16(wav[34:]); rate != 8000 || bits != 16 {
+		t.Errorf("expect 8000 Hz 16 bit got %d Hz %d bit", rate, bits)
+	}
+	if !bytes.Equal(wav[wavHeaderLength:], []byte{0x00, 0x00, 0x84, 0x82}) {
+		t.Errorf("unexpected samples % x", wav[wavHeaderLength:])
+	}
+}
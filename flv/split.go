@@ -0,0 +1,198 @@
+package flv
+
+import (
+	"fmt"
+	"os"
+)
+
+// SplitOptions sets the targets after which a new segment is started at the
+// next keyframe. Zero values disable the corresponding target.
+type SplitOptions struct {
+	Duration  uint32 // milliseconds
+	Size      int64  // bytes of tag data
+	Keyframes int
+	// KeepTimestamps disables rebasing the DTS of every segment to zero.
+	KeepTimestamps bool
+}
+
+type splitSegment struct {
+	start int
+	end   int
+}
+
+// planSegments groups the entries into segments starting at cut points:
+// keyframes, or any audio frame for audio-only files.
+func planSegments(entries []indexEntry, opts SplitOptions) (segments []splitSegment) {
+	hasVideo := false
+	for _, e := range entries {
+		if e.keyframe {
+			hasVideo = true
+			break
+		}
+	}
+
+	cur := splitSegment{start: 0}
+	segStart := -1
+	var size int64
+	keyframes := 0
+	for i, e := range entries {
+		cutPoint := !e.seqHeader && (e.keyframe || !hasVideo && e.tagType == TAG_TYPE_AUDIO)
+		if cutPoint {
+			if segStart == -1 {
+				segStart = i
+			} else {
+				full := opts.Duration != 0 && e.dts-entries[segStart].dts >= opts.Duration ||
+					opts.Size != 0 && size >= opts.Size ||
+					opts.Keyframes != 0 && keyframes >= opts.Keyframes
+				if full {
+					cur.end = i
+					segments = append(segments, cur)
+					cur = splitSegment{start: i}
+					segStart = i
+					size = 0
+					keyframes = 0
+				}
+			}
+			if e.keyframe {
+				keyframes++
+			}
+		}
+		size += e.size
+	}
+	cur.end = len(entries)
+	return append(segments, cur)
+}
+
+// Split cuts in into independently playable segments. next is called to get
+// the writer for every segment, numbered from 0, and Split closes the
+// writer's file once the segment is complete.
+//
+// Every segment starts with a header, an onMetaData tag and the AVC and AAC
+// sequence headers in effect at its first keyframe.
+func Split(in *FlvReader, next func(segment int) (*FlvWriter, error), opts SplitOptions) error {
+	entries, err := scanIndex(in)
+	if err != nil {
+		return err
+	}
+
+	hasVideo, hasAudio := false, false
+	for _, e := range entries {
+		hasVideo = hasVideo || e.tagType == TAG_TYPE_VIDEO
+		hasAudio = hasAudio || e.tagType == TAG_TYPE_AUDIO
+	}
+
+	for n, seg := range planSegments(entries, opts) {
+		if err = writeSegment(in, entries, seg, next, n, hasAudio, hasVideo, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSegment(in *FlvReader, entries []indexEntry, seg splitSegment, next func(segment int) (*FlvWriter, error), n int, hasAudio, hasVideo bool, opts SplitOptions) (err error) {
+	headers := lastSequenceHeaders(entries, seg.start)
+
+	first := entries[seg.start].dts
+	if seg.start == 0 {
+		// the leading segment may open with script data ahead of the media
+		found := false
+		for i := seg.start; i < seg.end; i++ {
+			if e := entries[i]; e.tagType != TAG_TYPE_META && (!found || e.dts < first) {
+				first = e.dts
+				found = true
+			}
+		}
+	}
+	base := first
+	if opts.KeepTimestamps {
+		base = 0
+	}
+	var lastDts uint32
+	firstVideo, firstAudio := -1, -1
+	videoFrames := 0
+	for i := seg.start; i < seg.end; i++ {
+		e := entries[i]
+		if e.dts > lastDts {
+			lastDts = e.dts
+		}
+		switch {
+		case e.tagType == TAG_TYPE_VIDEO && firstVideo == -1:
+			firstVideo = i
+		case e.tagType == TAG_TYPE_AUDIO && firstAudio == -1:
+			firstAudio = i
+		}
+		if e.tagType == TAG_TYPE_VIDEO && !e.seqHeader {
+			videoFrames++
+		}
+	}
+
+	md := &MetaData{HasVideo: hasVideo, HasAudio: hasAudio}
+	if lastDts > first {
+		md.Duration = float64(lastDts-first) / 1000
+		md.FrameRate = float64(videoFrames) / md.Duration
+	}
+	headerFrames, err := readIndexed(in, entries, headers...)
+	if err != nil {
+		return err
+	}
+	firstFrames, err := readIndexed(in, entries, firstVideo, firstAudio)
+	if err != nil {
+		return err
+	}
+	for _, fr := range append(firstFrames, headerFrames...) {
+		md.fillFrom(fr)
+	}
+
+	out, err := next(n)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.OutFile.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if err = out.WriteHeader(NewHeader(md.HasAudio, md.HasVideo)); err != nil {
+		return err
+	}
+	if err = out.WriteFrame(md.Frame()); err != nil {
+		return err
+	}
+	for _, fr := range headerFrames {
+		fr.SetDts(first - base)
+		if err = out.WriteFrame(fr); err != nil {
+			return err
+		}
+	}
+	for i := seg.start; i < seg.end; i++ {
+		if entries[i].onMetaData {
+			continue
+		}
+		fr, rerr := in.ReadTrackAt(entries[i].position, entries[i].track)
+		if rerr != nil {
+			return rerr
+		}
+		if dts := fr.GetDts(); dts > base {
+			fr.SetDts(dts - base)
+		} else {
+			fr.SetDts(0)
+		}
+		if err = out.WriteFrame(fr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SplitFiles is Split writing segments to files named by formatting pattern
+// with the segment number, e.g. "part-%03d.flv".
+func SplitFiles(in *FlvReader, pattern string, opts SplitOptions) error {
+	return Split(in, func(segment int) (*FlvWriter, error) {
+		f, err := os.Create(fmt.Sprintf(pattern, segment))
+		if err != nil {
+			return nil, err
+		}
+		return NewWriter(f), nil
+	}, opts)
+}
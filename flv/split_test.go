@@ -0,0 +1,34 @@
+package flv_test
+
+import (
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/internal/flvtest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	pattern := filepath.Join(t.TempDir(), "part-%d.flv")
+	err := flv.SplitFiles(flvtest.WriteFLV(t, flvtest.Frames(5000)), pattern, flv.SplitOptions{Duration: 2000})
+	if err != nil {
+		t.Fatalf("split error: %s", err)
+	}
+
+	for n, expect := range []float64{1.98, 1.98, 0.98} {
+		frames := flvtest.ReadFLV(t, fmt.Sprintf(pattern, n))
+		if d := frames[0].(flv.MetaFrame).Properties()["duration"]; d != expect {
+			t.Errorf("segment %d: expect duration %v got %v", n, expect, d)
+		}
+		if !flv.IsSequenceHeader(frames[1]) || !flv.IsSequenceHeader(frames[2]) {
+			t.Errorf("segment %d: expect sequence headers got %v, %v", n, frames[1], frames[2])
+		}
+		if !flv.IsKeyframe(frames[3]) || frames[3].GetDts() != 0 {
+			t.Errorf("segment %d: expect keyframe at 0 got %v", n, frames[3])
+		}
+	}
+	if _, err := os.Stat(fmt.Sprintf(pattern, 3)); err == nil {
+		t.Errorf("unexpected 4th segment")
+	}
+}
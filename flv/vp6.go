@@ -0,0 +1,170 @@
+package flv
+
+import (
+	"fmt"
+)
+
+// VP6FrameHeader is the header of a VP6 frame. Version, profile, the
+// macroblock counts and scaling are only known for keyframes.
+type VP6FrameHeader struct {
+	KeyFrame    bool
+	Quantizer   byte
+	Marker      bool // separated coefficient partitions
+	Version     byte
+	Profile     byte
+	Interlaced  bool
+	Buff2Offset uint16 // offset of the second partition, if present
+	Rows        byte   // of coded macroblocks
+	Cols        byte
+	DisplayRows byte
+	DisplayCols byte
+	Scaling     byte
+}
+
+func (h *VP6FrameHeader) String() string {
+	return fmt.Sprintf("VP6FrameHeader(key: %v, quantizer: %d, ver. %d, profile: %d, %dx%d macroblocks, scaling: %d)",
+		h.KeyFrame, h.Quantizer, h.Version, h.Profile, h.Cols, h.Rows, h.Scaling)
+}
+
+// ParseVP6FrameHeader parses the header of a VP6 frame. The offset of the
+// second partition is read for keyframes and for inter frames with the
+// Marker bit; inter frames of the simple profile have it too, but the
+// profile is only known from the last keyframe.
+func ParseVP6FrameHeader(data []byte) (*VP6FrameHeader, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("empty VP6 frame")
+	}
+	h := &VP6FrameHeader{
+		KeyFrame:  data[0]&0x80 == 0,
+		Quantizer: data[0] >> 1 & 0x3F,
+		Marker:    data[0]&1 != 0,
+	}
+	if !h.KeyFrame {
+		if h.Marker {
+			if len(data) < 3 {
+				return nil, fmt.Errorf("VP6 inter frame header of %d bytes", len(data))
+			}
+			h.Buff2Offset = uint16(data[1])<<8 | uint16(data[2])
+		}
+		return h, nil
+	}
+	if len(data) < 2 {
+		return nil, fmt.Errorf("VP6 keyframe header of %d bytes", len(data))
+	}
+	h.Version = data[1] >> 3
+	h.Profile = data[1] >> 1 & 0x03
+	h.Interlaced = data[1]&1 != 0
+	pos := 2
+	if h.Marker || h.Profile == 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("VP6 keyframe header of %d bytes", len(data))
+		}
+		h.Buff2Offset = uint16(data[2])<<8 | uint16(data[3])
+		pos += 2
+	}
+	if len(data) < pos+4 {
+		return nil, fmt.Errorf("VP6 keyframe header of %d bytes", len(data))
+	}
+	h.Rows, h.Cols, h.DisplayRows, h.DisplayCols = data[pos], data[pos+1], data[pos+2], data[pos+3]
+	if h.Rows == 0 || h.Cols == 0 {
+		return nil, fmt.Errorf("VP6 keyframe of %dx%d macroblocks", h.Cols, h.Rows)
+	}
+	d := newVP6BoolDecoder(data[pos+4:])
+	h.Scaling = byte(d.bit()<<1 | d.bit())
+	return h, nil
+}
+
+// vp6BoolDecoder reads equiprobable bits off the boolean coded partition,
+// past its end as zeros.
+type vp6BoolDecoder struct {
+	data     []byte
+	value    uint32
+	rng      uint32
+	bitCount uint
+}
+
+func newVP6BoolDecoder(data []byte) *vp6BoolDecoder {
+	d := &vp6BoolDecoder{data: data, rng: 255}
+	d.value = uint32(d.next())<<8 | uint32(d.next())
+	return d
+}
+
+func (d *vp6BoolDecoder) next() byte {
+	if len(d.data) == 0 {
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *vp6BoolDecoder) bit() uint32 {
+	split := 1 + (d.rng-1)*128>>8
+	bit := uint32(0)
+	if d.value >= split<<8 {
+		bit = 1
+		d.rng -= split
+		d.value -= split << 8
+	} else {
+		d.rng = split
+	}
+	for d.rng < 128 {
+		d.value <<= 1
+		d.rng <<= 1
+		if d.bitCount++; d.bitCount == 8 {
+			d.bitCount = 0
+			d.value |= uint32(d.next())
+		}
+	}
+	return bit
+}
+
+// VP6Packet is the payload of VP6 and VP6 alpha video tags: the size
+// adjustments, the alpha offset and the frame header.
+type VP6Packet struct {
+	HorizontalAdjustment byte
+	VerticalAdjustment   byte
+	AlphaOffset          uint32 // VP6 alpha only
+	Header               *VP6FrameHeader
+}
+
+// ParseVP6Packet parses the video tag body past its first byte.
+func ParseVP6Packet(data []byte, alpha bool) (*VP6Packet, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("empty VP6 packet")
+	}
+	p := &VP6Packet{HorizontalAdjustment: data[0] >> 4, VerticalAdjustment: data[0] & 0x0F}
+	data = data[1:]
+	if alpha {
+		if len(data) < 3 {
+			return nil, fmt.Errorf("VP6 alpha packet of %d bytes", len(data)+1)
+		}
+		p.AlphaOffset = uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2])
+		data = data[3:]
+		if int(p.AlphaOffset) <= len(data) {
+			data = data[:p.AlphaOffset]
+		}
+	}
+	h, err := ParseVP6FrameHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	p.Header = h
+	return p, nil
+}
+
+// Width returns the frame width of keyframes, 0 for inter frames.
+func (p *VP6Packet) Width() uint16 {
+	if !p.Header.KeyFrame {
+		return 0
+	}
+	return uint16(p.Header.Cols)*16 - uint16(p.HorizontalAdjustment)
+}
+
+// Height returns the frame height of keyframes, 0 for inter frames.
+func (p *VP6Packet) Height() uint16 {
+	if !p.Header.KeyFrame {
+		return 0
+	}
+	return uint16(p.Header.Rows)*16 - uint16(p.VerticalAdjustment)
+}
@@ -0,0 +1,62 @@
+package flv
+
+import (
+	"testing"
+)
+
+var (
+	// key, quantizer 20, version 6, simple profile, 20x15 macroblocks
+	testVP6KeyFrame = []byte{0x28, 0x30, 0x00, 0x10, 15, 20, 15, 20, 0xFF, 0xFF}
+	// advanced profile without the second partition offset
+	testVP6AdvancedKeyFrame = []byte{0x28, 0x36, 15, 20, 15, 20, 0x00, 0x00}
+	testVP6InterFrame       = []byte{0xA9, 0x01, 0x20}
+)
+
+func TestParseVP6FrameHeader(t *testing.T) {
+	h, err := ParseVP6FrameHeader(testVP6KeyFrame)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if !h.KeyFrame || h.Quantizer != 20 || h.Version != 6 || h.Profile != 0 || h.Buff2Offset != 16 ||
+		h.Rows != 15 || h.Cols != 20 || h.Scaling != 3 {
+		t.Errorf("unexpected %s", h)
+	}
+	h, err = ParseVP6FrameHeader(testVP6AdvancedKeyFrame)
+	if err != nil || h.Profile != 3 || h.Buff2Offset != 0 || h.Cols != 20 || h.Scaling != 0 {
+		t.Errorf("unexpected %s, %v", h, err)
+	}
+	h, err = ParseVP6FrameHeader(testVP6InterFrame)
+	if err != nil || h.KeyFrame || h.Quantizer != 20 || !h.Marker || h.Buff2Offset != 0x120 {
+		t.Errorf("unexpected %s, %v", h, err)
+	}
+}
+
+func TestVP6Packets(t *testing.T) {
+	alpha := append([]byte{0x15, 0x48, 0, 0, byte(len(testVP6KeyFrame))}, testVP6KeyFrame...)
+	alpha = append(alpha, 0x28, 0x30, 0x00, 0x10, 1, 1, 1, 1)
+	frames := []*CFrame{
+		{Type: TAG_TYPE_VIDEO, Dts: 0, Body: append([]byte{0x14, 0x48}, testVP6KeyFrame...)},
+		{Type: TAG_TYPE_VIDEO, Dts: 40, Body: append([]byte{0x24, 0x48}, testVP6InterFrame...)},
+		{Type: TAG_TYPE_VIDEO, Dts: 80, Body: append([]byte{0x15, 0x00}, []byte{0, 0, 8}...)},
+		{Type: TAG_TYPE_VIDEO, Dts: 120, Body: alpha},
+	}
+	frames[2].Body = append(frames[2].Body, testVP6AdvancedKeyFrame...)
+	got := readTestFile(t, writeTestFile(t, "vp6.flv", frames))
+	for i, size := range [][2]uint16{{316, 232}, {316, 232}, {320, 240}, {316, 232}} {
+		if f := got[i].(VideoFrame); f.Width != size[0] || f.Height != size[1] {
+			t.Errorf("frame %d: expect %dx%d got %s", i, size[0], size[1], f)
+		}
+	}
+	p, err := ParseVP6Packet(alpha[1:], true)
+	if err != nil || p.AlphaOffset != uint32(len(testVP6KeyFrame)) || p.Header.Cols != 20 {
+		t.Errorf("unexpected %+v, %v", p, err)
+	}
+
+	// short bodies are no frames to take the size from
+	r := &FlvReader{}
+	for _, body := range [][]byte{frames[0].Body, frames[1].Body, alpha} {
+		for n := 1; n < len(body); n++ {
+			r.parseFrame(&CFrame{Type: TAG_TYPE_VIDEO, Body: body[:n]})
+		}
+	}
+}
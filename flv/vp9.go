@@ -0,0 +1,153 @@
+package flv
+
+import (
+	"fmt"
+)
+
+// VPConfRecord is the VPCodecConfigurationRecord carried by vp09 sequence
+// starts.
+type VPConfRecord struct {
+	Profile                 byte
+	Level                   byte
+	BitDepth                byte
+	ChromaSubsampling       byte
+	VideoFullRange          bool
+	ColourPrimaries         byte
+	TransferCharacteristics byte
+	MatrixCoefficients      byte
+	CodecInitializationData []byte
+}
+
+func (r *VPConfRecord) String() string {
+	return fmt.Sprintf("VPCodecConfigurationRecord(profile: %d, level: %d, %d bit)", r.Profile, r.Level, r.BitDepth)
+}
+
+// ParseVPConfRecord parses a VPCodecConfigurationRecord. The version and
+// flags of the vpcC box some writers leave in front of it are skipped: a
+// record can not start with level 0.
+func ParseVPConfRecord(data []byte) (*VPConfRecord, error) {
+	if len(data) >= 12 && data[1] == 0 && data[2] == 0 && data[3] == 0 {
+		data = data[4:]
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("VPCodecConfigurationRecord of %d bytes", len(data))
+	}
+	rec := &VPConfRecord{
+		Profile:                 data[0],
+		Level:                   data[1],
+		BitDepth:                data[2] >> 4,
+		ChromaSubsampling:       data[2] >> 1 & 0x07,
+		VideoFullRange:          data[2]&1 != 0,
+		ColourPrimaries:         data[3],
+		TransferCharacteristics: data[4],
+		MatrixCoefficients:      data[5],
+	}
+	n := int(data[6])<<8 | int(data[7])
+	if 8+n > len(data) {
+		return nil, fmt.Errorf("VP codec initialization data of %d bytes in %d", n, len(data)-8)
+	}
+	rec.CodecInitializationData = data[8 : 8+n]
+	return rec, nil
+}
+
+// Bytes serializes the record as a VPCodecConfigurationRecord.
+func (r *VPConfRecord) Bytes() []byte {
+	flags := r.BitDepth<<4 | r.ChromaSubsampling<<1
+	if r.VideoFullRange {
+		flags |= 1
+	}
+	n := len(r.CodecInitializationData)
+	buf := []byte{r.Profile, r.Level, flags, r.ColourPrimaries, r.TransferCharacteristics, r.MatrixCoefficients, byte(n >> 8), byte(n)}
+	return append(buf, r.CodecInitializationData...)
+}
+
+// Codec returns the RFC 6381 codecs parameter, e.g. "vp09.00.10.08".
+func (r *VPConfRecord) Codec() string {
+	return fmt.Sprintf("vp09.%02d.%02d.%02d", r.Profile, r.Level, r.BitDepth)
+}
+
+// VP9FrameHeader holds the leading fields of a VP9 uncompressed header;
+// the size and color config are only known for keyframes.
+type VP9FrameHeader struct {
+	Profile           byte
+	ShowExistingFrame bool
+	KeyFrame          bool
+	ShowFrame         bool
+	ErrorResilient    bool
+
+	BitDepth     byte
+	ColorSpace   byte
+	ColorRange   bool // full range
+	SubsamplingX byte
+	SubsamplingY byte
+	Width        uint32
+	Height       uint32
+}
+
+// ParseVP9FrameHeader parses the uncompressed header of the first frame of
+// a VP9 frame or superframe.
+func ParseVP9FrameHeader(data []byte) (ret *VP9FrameHeader, err error) {
+	r := NewBitReader(data)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = rec.(error)
+		}
+	}()
+
+	frame_marker := r.U(2)
+	if frame_marker != 2 {
+		err = fmt.Errorf("Not VP9 frame, frame_marker = %d", frame_marker)
+		return
+	}
+	h := &VP9FrameHeader{}
+	profile_low_bit := r.U(1)
+	profile_high_bit := r.U(1)
+	h.Profile = byte(profile_high_bit<<1 | profile_low_bit)
+	if h.Profile == 3 {
+		r.U(1) /* reserved_zero */
+	}
+	h.ShowExistingFrame = r.U(1) != 0
+	if h.ShowExistingFrame {
+		return h, nil
+	}
+	frame_type := r.U(1)
+	h.KeyFrame = frame_type == 0
+	h.ShowFrame = r.U(1) != 0
+	h.ErrorResilient = r.U(1) != 0
+	if !h.KeyFrame {
+		return h, nil
+	}
+
+	frame_sync_code := r.U(24)
+	if frame_sync_code != 0x498342 {
+		err = fmt.Errorf("bad VP9 frame_sync_code %06x", frame_sync_code)
+		return
+	}
+	h.BitDepth = 8
+	if h.Profile >= 2 {
+		h.BitDepth = 10
+		ten_or_twelve_bit := r.U(1)
+		if ten_or_twelve_bit != 0 {
+			h.BitDepth = 12
+		}
+	}
+	h.ColorSpace = byte(r.U(3))
+	if h.ColorSpace != 7 /* CS_RGB */ {
+		h.ColorRange = r.U(1) != 0
+		h.SubsamplingX, h.SubsamplingY = 1, 1
+		if h.Profile == 1 || h.Profile == 3 {
+			h.SubsamplingX = byte(r.U(1))
+			h.SubsamplingY = byte(r.U(1))
+			r.U(1) /* reserved_zero */
+		}
+	} else {
+		h.ColorRange = true
+		if h.Profile == 1 || h.Profile == 3 {
+			r.U(1) /* reserved_zero */
+		}
+	}
+	h.Width = r.U(16) + 1
+	h.Height = r.U(16) + 1
+	return h, nil
+}
@@ -0,0 +1,66 @@
+package flv
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testVP9KeyFrame() []byte {
+	b := &testBits{}
+	b.u(2, 2).u(0, 2).u(0, 1)       // frame marker, profile 0
+	b.u(0, 1).u(1, 1).u(0, 1)       // keyframe, shown
+	b.u(0x498342, 24)               // sync code
+	b.u(1, 3).u(0, 1)               // BT.601, limited range
+	b.u(639, 16).u(359, 16).u(0, 1) // 640x360
+	return append(b.buf, 0, 0)
+}
+
+func TestParseVP9FrameHeader(t *testing.T) {
+	h, err := ParseVP9FrameHeader(testVP9KeyFrame())
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if !h.KeyFrame || h.Width != 640 || h.Height != 360 || h.BitDepth != 8 {
+		t.Errorf("expect 640x360 8 bit keyframe got %+v", h)
+	}
+	if h, err := ParseVP9FrameHeader([]byte{0x86, 0}); err != nil || h.KeyFrame {
+		t.Errorf("expect inter frame got %+v, %v", h, err)
+	}
+	if _, err := ParseVP9FrameHeader([]byte{0x00}); err == nil {
+		t.Errorf("expect frame_marker error")
+	}
+	if _, err := ParseVP9FrameHeader([]byte{0x82}); err == nil {
+		t.Errorf("expect error on truncated keyframe")
+	}
+}
+
+func TestVPConfRecord(t *testing.T) {
+	conf := &VPConfRecord{Level: 30, BitDepth: 8, ChromaSubsampling: 1, ColourPrimaries: 1, TransferCharacteristics: 1, MatrixCoefficients: 1}
+	data := conf.Bytes()
+	rec, err := ParseVPConfRecord(data)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if !bytes.Equal(rec.Bytes(), data) {
+		t.Errorf("expect % x got % x", data, rec.Bytes())
+	}
+	if codec := rec.Codec(); codec != "vp09.00.30.08" {
+		t.Errorf("expect vp09.00.30.08 got %s", codec)
+	}
+	if rec, err := ParseVPConfRecord(append([]byte{1, 0, 0, 0}, data...)); err != nil || rec.Level != 30 {
+		t.Errorf("expect vpcC box version and flags skipped got %v, %v", rec, err)
+	}
+
+	frames := []*CFrame{
+		NewExVideoFrame(0, VIDEO_FRAME_TYPE_KEYFRAME, VIDEO_PACKET_TYPE_SEQUENCE_START, FOURCC_VP9, 0, data).CFrame,
+		NewExVideoFrame(0, VIDEO_FRAME_TYPE_INTER_FRAME, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_VP9, 0, testVP9KeyFrame()).CFrame,
+		NewExVideoFrame(40, VIDEO_FRAME_TYPE_INTER_FRAME, VIDEO_PACKET_TYPE_CODED_FRAMES, FOURCC_VP9, 0, []byte{0x86, 0}).CFrame,
+	}
+	got := readTestFile(t, writeTestFile(t, "vp9.flv", frames))
+	if f := got[1].(ExVideoFrame); f.Width != 640 || f.Height != 360 || f.Flavor != KEYFRAME {
+		t.Errorf("expect 640x360 keyframe got %s", f)
+	}
+	if f := got[2].(ExVideoFrame); f.Width != 640 || f.Height != 360 || f.Flavor != FRAME {
+		t.Errorf("expect 640x360 frame got %s", f)
+	}
+}
@@ -0,0 +1,106 @@
+package flv
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+const (
+	wavHeaderLength = 44
+)
+
+// WavWriter writes interleaved little endian PCM samples into a RIFF WAVE
+// file. The chunk sizes are fixed up on Close when the underlying writer is
+// seekable.
+type WavWriter struct {
+	w             io.Writer
+	SampleRate    uint32
+	Channels      uint16
+	BitsPerSample uint16
+	dataSize      uint32
+	headerWritten bool
+}
+
+func NewWavWriter(w io.Writer, sampleRate uint32, channels, bitsPerSample uint16) *WavWriter {
+	return &WavWriter{
+		w:             w,
+		SampleRate:    sampleRate,
+		Channels:      channels,
+		BitsPerSample: bitsPerSample,
+	}
+}
+
+func (ww *WavWriter) header(dataSize uint32) []byte {
+	blockAlign := ww.Channels * ww.BitsPerSample / 8
+	h := make([]byte, wavHeaderLength)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], dataSize+wavHeaderLength-8)
+	copy(h[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(h[22:], ww.Channels)
+	binary.LittleEndian.PutUint32(h[24:], ww.SampleRate)
+	binary.LittleEndian.PutUint32(h[28:], ww.SampleRate*uint32(blockAlign))
+	binary.LittleEndian.PutUint16(h[32:], blockAlign)
+	binary.LittleEndian.PutUint16(h[34:], ww.BitsPerSample)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], dataSize)
+	return h
+}
+
+func (ww *WavWriter) writeHeader() error {
+	ww.headerWritten = true
+	size := uint32(0xFFFFFFFF - wavHeaderLength)
+	if _, ok := ww.w.(io.Seeker); ok {
+		size = 0
+	}
+	_, err := ww.w.Write(ww.header(size))
+	return err
+}
+
+func (ww *WavWriter) Write(samples []byte) (n int, err error) {
+	if !ww.headerWritten {
+		if err = ww.writeHeader(); err != nil {
+			return 0, err
+		}
+	}
+	n, err = ww.w.Write(samples)
+	ww.dataSize += uint32(n)
+	return
+}
+
+// WriteSamples writes 16 bit samples, interleaved by channel.
+func (ww *WavWriter) WriteSamples(samples []int16) error {
+	buf := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(buf[2*i:], uint16(s))
+	}
+	_, err := ww.Write(buf)
+	return err
+}
+
+// Close writes the final chunk sizes; it does not close the underlying writer.
+func (ww *WavWriter) Close() error {
+	if !ww.headerWritten {
+		if err := ww.writeHeader(); err != nil {
+			return err
+		}
+	}
+	s, ok := ww.w.(io.Seeker)
+	if !ok {
+		return nil
+	}
+	end, err := s.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return err
+	}
+	if _, err = s.Seek(end-int64(ww.dataSize)-wavHeaderLength, os.SEEK_SET); err != nil {
+		return err
+	}
+	if _, err = ww.w.Write(ww.header(ww.dataSize)); err != nil {
+		return err
+	}
+	_, err = s.Seek(end, os.SEEK_SET)
+	return err
+}
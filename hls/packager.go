@@ -0,0 +1,441 @@
+// Package hls packages FLV into HTTP Live Streaming segments and playlists.
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/mp4"
+	"github.com/metachord/flv.go/ts"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+type Format int
+
+const (
+	FORMAT_TS Format = iota
+	FORMAT_FMP4
+)
+
+const defaultTargetDuration = 6000
+
+type Options struct {
+	Format Format
+	// Name is the base name of the playlist and segment files.
+	Name string
+	// TargetDuration is the shortest segment in ms; segments are cut at
+	// the first keyframe after it.
+	TargetDuration uint32
+	// Window is the number of segments listed by a live playlist, which
+	// is rewritten after every segment. With 0 a VOD playlist listing
+	// all segments is written at the end.
+	Window int
+	// SingleFile writes all segments into one file addressed by byte
+	// ranges.
+	SingleFile bool
+}
+
+// Map is the fMP4 init segment of the following media segments.
+type Map struct {
+	URI    string
+	Offset int64
+	Length int64 // 0 when the map is a whole file
+}
+
+type Segment struct {
+	Sequence      int
+	URI           string
+	Start         uint32 // DTS of the first frame, ms
+	Duration      uint32 // ms
+	Offset        int64
+	Length        int64 // 0 when the segment is a whole file
+	Discontinuity bool
+	Map           *Map
+}
+
+// Packager cuts FLV frames into segments and writes them together with the
+// playlist through Create.
+type Packager struct {
+	Options
+	Create func(name string) (io.WriteCloser, error)
+
+	Segments []Segment
+
+	out           io.WriteCloser
+	written       int64
+	cur           Segment
+	started       bool
+	discontinuity bool
+	curMap        *Map
+	end           uint32
+
+	// TS
+	muxer    *ts.Muxer
+	hasVideo bool
+	keySeen  bool
+	headers  map[flv.TagType][]byte
+	lastDts  map[flv.TagType]uint32
+
+	// fMP4
+	fragmenter *mp4.Fragmenter
+	inits      int
+}
+
+func (p *Packager) name() string {
+	if p.Name == "" {
+		return "stream"
+	}
+	return p.Name
+}
+
+func (p *Packager) extension() string {
+	if p.Format == FORMAT_FMP4 {
+		return ".m4s"
+	}
+	return ".ts"
+}
+
+func (p *Packager) targetDuration() uint32 {
+	if p.TargetDuration == 0 {
+		return defaultTargetDuration
+	}
+	return p.TargetDuration
+}
+
+// Write appends to the current segment.
+func (p *Packager) Write(b []byte) (int, error) {
+	n, err := p.out.Write(b)
+	p.written += int64(n)
+	return n, err
+}
+
+// WriteFrame adds a frame; script data is ignored.
+func (p *Packager) WriteFrame(fr flv.Frame) error {
+	if fr.GetType() != flv.TAG_TYPE_VIDEO && fr.GetType() != flv.TAG_TYPE_AUDIO {
+		return nil
+	}
+	if p.Format == FORMAT_FMP4 {
+		if p.fragmenter == nil {
+			p.fragmenter = &mp4.Fragmenter{
+				MinDuration:   p.targetDuration(),
+				WriteInit:     p.writeInit,
+				WriteFragment: p.writeFragment,
+			}
+		}
+		return p.fragmenter.WriteFrame(fr)
+	}
+	return p.writeTS(fr)
+}
+
+func (p *Packager) writeTS(fr flv.Frame) error {
+	if p.muxer == nil {
+		p.muxer = ts.NewMuxer(p)
+		p.headers = map[flv.TagType][]byte{}
+		p.lastDts = map[flv.TagType]uint32{}
+	}
+	typ, dts := fr.GetType(), fr.GetDts()
+	if typ == flv.TAG_TYPE_VIDEO {
+		p.hasVideo = true
+	}
+
+	cut := false
+	if flv.IsSequenceHeader(fr) {
+		body := *fr.GetBody()
+		// the segment is cut at the next random access point
+		if prev, ok := p.headers[typ]; ok && !bytes.Equal(prev, body) {
+			p.discontinuity = true
+		}
+		p.headers[typ] = body
+	} else {
+		if typ == flv.TAG_TYPE_VIDEO && !p.keySeen {
+			if !flv.IsKeyframe(fr) {
+				return nil
+			}
+			p.keySeen = true
+		}
+		random := flv.IsKeyframe(fr) || !p.hasVideo
+		cut = random && (p.discontinuity || dts >= p.cur.Start+p.targetDuration())
+		if last, ok := p.lastDts[typ]; ok && dts > last && dts+(dts-last) > p.end {
+			p.end = dts + (dts - last)
+		}
+		p.lastDts[typ] = dts
+	}
+
+	if cut && p.started {
+		if err := p.closeSegment(dts); err != nil {
+			return err
+		}
+	}
+	if !p.started {
+		if err := p.openSegment(dts); err != nil {
+			return err
+		}
+		p.muxer.SetWriter(p)
+	}
+	if dts > p.end {
+		p.end = dts
+	}
+	return p.muxer.WriteFrame(fr)
+}
+
+func (p *Packager) writeInit(init []byte, tracks []*mp4.Track) error {
+	m := &Map{}
+	if p.SingleFile {
+		if err := p.openFile(); err != nil {
+			return err
+		}
+		m.URI, m.Offset, m.Length = p.singleFile(), p.written, int64(len(init))
+		if _, err := p.Write(init); err != nil {
+			return err
+		}
+	} else {
+		m.URI = fmt.Sprintf("%s-init%d.mp4", p.name(), p.inits)
+		w, err := p.Create(m.URI)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(init); err != nil {
+			w.Close()
+			return err
+		}
+		if err = w.Close(); err != nil {
+			return err
+		}
+	}
+	if p.inits > 0 {
+		p.discontinuity = true
+	}
+	p.inits++
+	p.curMap = m
+	return nil
+}
+
+func (p *Packager) writeFragment(frag *mp4.Fragment) error {
+	if err := p.openSegment(frag.Start); err != nil {
+		return err
+	}
+	if _, err := p.Write(frag.Data); err != nil {
+		return err
+	}
+	return p.closeSegment(frag.Start + frag.Duration)
+}
+
+// singleFile is the name of the file holding all segments in single file
+// mode.
+func (p *Packager) singleFile() string {
+	if p.Format == FORMAT_FMP4 {
+		return p.name() + ".mp4"
+	}
+	return p.name() + ".ts"
+}
+
+func (p *Packager) openFile() error {
+	if p.out != nil {
+		return nil
+	}
+	out, err := p.Create(p.singleFile())
+	p.out = out
+	return err
+}
+
+func (p *Packager) openSegment(start uint32) error {
+	p.cur = Segment{
+		Sequence:      len(p.Segments),
+		Start:         start,
+		Discontinuity: p.discontinuity,
+		Map:           p.curMap,
+	}
+	p.discontinuity = false
+	if p.SingleFile {
+		if err := p.openFile(); err != nil {
+			return err
+		}
+		p.cur.URI, p.cur.Offset = p.singleFile(), p.written
+	} else {
+		p.cur.URI = fmt.Sprintf("%s%d%s", p.name(), p.cur.Sequence, p.extension())
+		out, err := p.Create(p.cur.URI)
+		if err != nil {
+			return err
+		}
+		p.out, p.written = out, 0
+	}
+	p.started = true
+	return nil
+}
+
+func (p *Packager) closeSegment(end uint32) error {
+	p.started = false
+	if end > p.cur.Start {
+		p.cur.Duration = end - p.cur.Start
+	}
+	if p.SingleFile {
+		p.cur.Length = p.written - p.cur.Offset
+	} else {
+		err := p.out.Close()
+		p.out = nil
+		if err != nil {
+			return err
+		}
+	}
+	p.Segments = append(p.Segments, p.cur)
+	if p.Window > 0 {
+		return p.writePlaylist(false)
+	}
+	return nil
+}
+
+// Close finishes the last segment and writes the final playlist.
+func (p *Packager) Close() error {
+	if p.fragmenter != nil {
+		if err := p.fragmenter.Flush(); err != nil {
+			return err
+		}
+	}
+	if p.started {
+		if err := p.closeSegment(p.end); err != nil {
+			return err
+		}
+	}
+	if p.out != nil {
+		if err := p.out.Close(); err != nil {
+			return err
+		}
+		p.out = nil
+	}
+	return p.writePlaylist(true)
+}
+
+// Playlist renders the media playlist; final adds EXT-X-ENDLIST.
+func (p *Packager) Playlist(final bool) []byte {
+	segments := p.Segments
+	if p.Window > 0 && len(segments) > p.Window {
+		segments = segments[len(segments)-p.Window:]
+	}
+	discontinuities := 0
+	for _, s := range p.Segments[:len(p.Segments)-len(segments)] {
+		if s.Discontinuity {
+			discontinuities++
+		}
+	}
+
+	version := 3
+	if p.SingleFile {
+		version = 4
+	}
+	if p.Format == FORMAT_FMP4 {
+		version = 7
+	}
+	target := int(math.Ceil(float64(p.targetDuration()) / 1000))
+	for _, s := range segments {
+		if d := int(math.Ceil(float64(s.Duration) / 1000)); d > target {
+			target = d
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:%d\n#EXT-X-TARGETDURATION:%d\n", version, target)
+	if len(segments) > 0 {
+		fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", segments[0].Sequence)
+	}
+	if discontinuities > 0 {
+		fmt.Fprintf(&b, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", discontinuities)
+	}
+	if p.Window == 0 {
+		b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	}
+	var m *Map
+	for _, s := range segments {
+		if s.Discontinuity {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		if s.Map != nil && s.Map != m {
+			if s.Map.Length > 0 {
+				fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\",BYTERANGE=\"%d@%d\"\n", s.Map.URI, s.Map.Length, s.Map.Offset)
+			} else {
+				fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\"\n", s.Map.URI)
+			}
+			m = s.Map
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n", float64(s.Duration)/1000)
+		if s.Length > 0 {
+			fmt.Fprintf(&b, "#EXT-X-BYTERANGE:%d@%d\n", s.Length, s.Offset)
+		}
+		b.WriteString(s.URI + "\n")
+	}
+	if final {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return b.Bytes()
+}
+
+func (p *Packager) writePlaylist(final bool) error {
+	w, err := p.Create(p.name() + ".m3u8")
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(p.Playlist(final)); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Run packages the frames received until the channel is closed. On error
+// the rest of the channel is drained.
+func (p *Packager) Run(frames <-chan flv.Frame) error {
+	for fr := range frames {
+		if err := p.WriteFrame(fr); err != nil {
+			for range frames {
+			}
+			return err
+		}
+	}
+	return p.Close()
+}
+
+// Feed sends the frames of in to frames and closes the channel.
+func Feed(in *flv.FlvReader, frames chan<- flv.Frame) error {
+	defer close(frames)
+	if _, err := in.ReadHeader(); err != nil {
+		return err
+	}
+	for {
+		fr, rerr := in.ReadFrame()
+		if rerr != nil {
+			return rerr
+		}
+		if fr == nil {
+			return nil
+		}
+		frames <- fr
+	}
+}
+
+// PackageFile packages an FLV file into dir.
+func PackageFile(in *flv.FlvReader, dir string, opts Options) error {
+	p := &Packager{
+		Options: opts,
+		Create: func(name string) (io.WriteCloser, error) {
+			return os.Create(filepath.Join(dir, name))
+		},
+	}
+	if _, err := in.ReadHeader(); err != nil {
+		return err
+	}
+	for {
+		fr, rerr := in.ReadFrame()
+		if rerr != nil {
+			return rerr
+		}
+		if fr == nil {
+			break
+		}
+		if err := p.WriteFrame(fr); err != nil {
+			return err
+		}
+	}
+	return p.Close()
+}
@@ -0,0 +1,207 @@
+package hls
+
+import (
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/internal/flvtest"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testFrames is 10 seconds of flvtest.Frames where at 5 seconds the AAC
+// configuration changes.
+func testFrames() []flv.Frame {
+	return flvtest.Insert(flvtest.Frames(10000), flvtest.Audio(5000, flv.AUDIO_AAC_SEQUENCE_HEADER, []byte{0x11, 0x90}))
+}
+
+// testPackager returns a packager writing to the files it returns.
+func testPackager(opts Options) (*Packager, flvtest.Files) {
+	files := flvtest.Files{}
+	return &Packager{Options: opts, Create: files.Create}, files
+}
+
+func TestPackagerTS(t *testing.T) {
+	p, files := testPackager(Options{Name: "live", TargetDuration: 3000})
+	frames := make(chan flv.Frame)
+	go func() {
+		for _, fr := range testFrames() {
+			frames <- fr
+		}
+		close(frames)
+	}()
+	if err := p.Run(frames); err != nil {
+		t.Fatal(err)
+	}
+
+	// cut at 3s, at the configuration change at 5s, then at 8s
+	starts := []uint32{0, 3000, 5000, 8000}
+	if len(p.Segments) != len(starts) {
+		t.Fatalf("expect %d segments got %v", len(starts), p.Segments)
+	}
+	for i, s := range p.Segments {
+		f := files[s.URI]
+		if s.Start != starts[i] || f == nil || !f.Closed || f.Len() == 0 || f.Len()%188 != 0 {
+			t.Errorf("segment %d: unexpected %+v", i, s)
+		}
+		if s.Discontinuity != (i == 2) {
+			t.Errorf("segment %d: discontinuity %v", i, s.Discontinuity)
+		}
+	}
+	if p.Segments[3].Duration != 2000 {
+		t.Errorf("expect last segment of 2000ms got %d", p.Segments[3].Duration)
+	}
+
+	playlist := files["live.m3u8"].String()
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:3\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n" +
+		"#EXTINF:3.000,\nlive0.ts\n#EXTINF:2.000,\nlive1.ts\n#EXT-X-DISCONTINUITY\n#EXTINF:3.000,\nlive2.ts\n" +
+		"#EXTINF:2.000,\nlive3.ts\n#EXT-X-ENDLIST\n"
+	if playlist != want {
+		t.Errorf("unexpected playlist\n%s", playlist)
+	}
+}
+
+func TestPackagerTSChangeMidGOP(t *testing.T) {
+	p, _ := testPackager(Options{Name: "live", TargetDuration: 3000})
+	for _, fr := range testFrames() {
+		if flv.IsSequenceHeader(fr) && fr.GetDts() == 5000 {
+			continue
+		}
+		if fr.GetType() == flv.TAG_TYPE_AUDIO && fr.GetDts() == 5500 {
+			if err := p.WriteFrame(flvtest.Audio(5500, flv.AUDIO_AAC_SEQUENCE_HEADER, []byte{0x11, 0x90})); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := p.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the change at 5.5s waits for the keyframe at 6s
+	starts := []uint32{0, 3000, 6000, 9000}
+	if len(p.Segments) != len(starts) {
+		t.Fatalf("expect %d segments got %v", len(starts), p.Segments)
+	}
+	for i, s := range p.Segments {
+		if s.Start != starts[i] || s.Discontinuity != (i == 2) {
+			t.Errorf("segment %d: unexpected %+v", i, s)
+		}
+	}
+}
+
+func TestPackagerTSPCRAcrossSegments(t *testing.T) {
+	// audio runs 100ms ahead of video, so each keyframe starting a segment
+	// comes after audio with a later DTS
+	frames := flvtest.Frames(4000)
+	for _, fr := range frames[2:] {
+		if fr.GetType() == flv.TAG_TYPE_AUDIO {
+			fr.SetDts(fr.GetDts() + 100)
+		}
+	}
+	for _, single := range []bool{false, true} {
+		p, files := testPackager(Options{Name: "live", TargetDuration: 1000, SingleFile: single})
+		for _, fr := range frames {
+			if err := p.WriteFrame(fr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Segments) != 4 {
+			t.Fatalf("expect 4 segments got %v", p.Segments)
+		}
+		var data []byte
+		if single {
+			data = files["live.ts"].Bytes()
+		} else {
+			for _, s := range p.Segments {
+				data = append(data, files[s.URI].Bytes()...)
+			}
+		}
+		last := uint64(0)
+		for ; len(data) >= 188; data = data[188:] {
+			if data[3]&0x20 == 0 || data[4] == 0 || data[5]&0x10 == 0 {
+				continue
+			}
+			pcr := uint64(data[6])<<25 | uint64(data[7])<<17 | uint64(data[8])<<9 | uint64(data[9])<<1 | uint64(data[10]>>7)
+			if pcr < last {
+				t.Errorf("PCR goes back from %d to %d, single file %v", last, pcr, single)
+			}
+			last = pcr
+		}
+	}
+}
+
+func TestPackagerLiveFMP4(t *testing.T) {
+	p, files := testPackager(Options{Format: FORMAT_FMP4, TargetDuration: 2000, Window: 3})
+	var playlists []string
+	create := p.Create
+	p.Create = func(name string) (io.WriteCloser, error) {
+		if name == "stream.m3u8" && files[name] != nil {
+			playlists = append(playlists, files[name].String())
+		}
+		return create(name)
+	}
+	for _, fr := range testFrames() {
+		if err := p.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files["stream-init0.mp4"] == nil || files["stream-init1.mp4"] == nil {
+		t.Fatalf("expect two init segments")
+	}
+
+	// the fourth playlist slides past segment 0 and switches to the new init
+	// segment
+	if len(playlists) < 4 || !strings.Contains(playlists[3], "#EXT-X-MEDIA-SEQUENCE:1\n") ||
+		!strings.Contains(playlists[3], "#EXT-X-MAP:URI=\"stream-init1.mp4\"\n") ||
+		!strings.Contains(playlists[3], "#EXT-X-DISCONTINUITY\n") {
+		t.Errorf("unexpected live playlist\n%v", playlists)
+	}
+	final := files["stream.m3u8"].String()
+	if strings.Contains(final, "PLAYLIST-TYPE") || !strings.HasSuffix(final, "#EXT-X-ENDLIST\n") ||
+		!strings.Contains(final, "#EXT-X-MEDIA-SEQUENCE:3\n") {
+		t.Errorf("unexpected final playlist\n%s", final)
+	}
+}
+
+func TestPackagerSingleFile(t *testing.T) {
+	p, files := testPackager(Options{Format: FORMAT_FMP4, TargetDuration: 4000, SingleFile: true})
+	for _, fr := range testFrames()[:200] {
+		if err := p.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f := files["stream.mp4"]
+	if f == nil || len(files) != 2 {
+		t.Fatalf("expect a single media file got %v", files)
+	}
+	offset := p.Segments[0].Map.Length
+	for _, s := range p.Segments {
+		if s.URI != "stream.mp4" || s.Offset != offset || s.Length == 0 {
+			t.Errorf("unexpected segment %+v", s)
+		}
+		if string(f.Bytes()[s.Offset+4:s.Offset+8]) != "moof" {
+			t.Errorf("segment at %d does not start with moof", s.Offset)
+		}
+		offset += s.Length
+	}
+	if offset != int64(f.Len()) {
+		t.Errorf("segments cover %d of %d bytes", offset, f.Len())
+	}
+	playlist := files["stream.m3u8"].String()
+	if !strings.Contains(playlist, "#EXT-X-VERSION:7\n") ||
+		!strings.Contains(playlist, "BYTERANGE=\""+strconv.FormatInt(p.Segments[0].Map.Length, 10)+"@0\"") {
+		t.Errorf("unexpected playlist\n%s", playlist)
+	}
+}
@@ -0,0 +1,149 @@
+// Package flvtest builds the FLV frames and files shared by the tests of
+// the remuxing packages.
+package flvtest
+
+import (
+	"bytes"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// AVCConf is an AVCDecoderConfigurationRecord of the Baseline profile,
+// HighAVCConf one of the High profile.
+var (
+	AVCConf     = []byte{0x01, 0x42, 0x00, 0x1E, 0xFF, 0xE1, 0x00, 0x02, 0x67, 0x42, 0x01, 0x00, 0x02, 0x68, 0xCE}
+	HighAVCConf = []byte{0x01, 0x64, 0x00, 0x1F, 0xFF, 0xE1, 0x00, 0x02, 0x67, 0x64, 0x01, 0x00, 0x02, 0x68, 0xCE}
+)
+
+// AACConf is the AudioSpecificConfig of AAC LC at 44.1kHz stereo.
+var AACConf = []byte{0x12, 0x10}
+
+// Video builds a 640x360 AVC frame.
+func Video(dts uint32, key bool, packetType flv.AvcPacketType, cts int32, data []byte) flv.Frame {
+	frameType, flavor := flv.VIDEO_FRAME_TYPE_INTER_FRAME, flv.FRAME
+	if key {
+		frameType, flavor = flv.VIDEO_FRAME_TYPE_KEYFRAME, flv.KEYFRAME
+	}
+	body := append([]byte{byte(frameType)<<4 | byte(flv.VIDEO_CODEC_AVC), byte(packetType), byte(cts >> 16), byte(cts >> 8), byte(cts)}, data...)
+	return flv.AVCVideoFrame{
+		VideoFrame: &flv.VideoFrame{
+			CFrame:  &flv.CFrame{Type: flv.TAG_TYPE_VIDEO, Dts: dts, Flavor: flavor, Body: body},
+			CodecId: flv.VIDEO_CODEC_AVC, Width: 640, Height: 360,
+		},
+		PacketType: packetType,
+	}
+}
+
+// Audio builds a 44kHz stereo AAC frame.
+func Audio(dts uint32, packetType flv.AudioAac, data []byte) flv.Frame {
+	return flv.AudioFrame{
+		CFrame:   &flv.CFrame{Type: flv.TAG_TYPE_AUDIO, Dts: dts, Flavor: flv.FRAME, Body: append([]byte{0xAF, byte(packetType)}, data...)},
+		CodecId:  flv.AUDIO_CODEC_AAC,
+		Rate:     44000,
+		BitSize:  flv.AUDIO_SIZE_16BIT,
+		Channels: flv.AUDIO_TYPE_STEREO,
+	}
+}
+
+// Frames is duration ms of 25fps video with a keyframe every second and
+// AAC audio every 20ms, after the AVCConf and AACConf sequence headers.
+func Frames(duration uint32) []flv.Frame {
+	frames := []flv.Frame{
+		Video(0, true, flv.VIDEO_AVC_SEQUENCE_HEADER, 0, AVCConf),
+		Audio(0, flv.AUDIO_AAC_SEQUENCE_HEADER, AACConf),
+	}
+	for ms := uint32(0); ms < duration; ms += 20 {
+		if ms%40 == 0 {
+			nalu := byte(0x41)
+			if ms%1000 == 0 {
+				nalu = 0x65
+			}
+			frames = append(frames, Video(ms, ms%1000 == 0, flv.VIDEO_AVC_NALU, 40, []byte{0, 0, 0, 2, nalu, byte(ms / 40)}))
+		}
+		frames = append(frames, Audio(ms, flv.AUDIO_AAC_RAW, []byte{0x21, byte(ms / 20)}))
+	}
+	return frames
+}
+
+// Insert returns frames with fr placed ahead of the first frame at or after
+// its DTS.
+func Insert(frames []flv.Frame, fr flv.Frame) []flv.Frame {
+	i := 0
+	for i < len(frames) && frames[i].GetDts() < fr.GetDts() {
+		i++
+	}
+	return append(frames[:i:i], append([]flv.Frame{fr}, frames[i:]...)...)
+}
+
+// WriteFLV writes frames to a temporary file and returns a reader of it
+// positioned at the header.
+func WriteFLV(t *testing.T, frames []flv.Frame) *flv.FlvReader {
+	path := filepath.Join(t.TempDir(), "in.flv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := flv.NewWriter(f)
+	if err := w.WriteHeader(flv.NewHeader(true, true)); err != nil {
+		t.Fatal(err)
+	}
+	for _, fr := range frames {
+		if err := w.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	in, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { in.Close() })
+	return flv.NewReader(in)
+}
+
+// File is an in-memory output file.
+type File struct {
+	bytes.Buffer
+	Closed bool
+}
+
+func (f *File) Close() error {
+	f.Closed = true
+	return nil
+}
+
+// Files keeps the files of a packager by name.
+type Files map[string]*File
+
+// Create creates or truncates the file name.
+func (files Files) Create(name string) (io.WriteCloser, error) {
+	files[name] = &File{}
+	return files[name], nil
+}
+
+// ReadFLV reads the frames of the FLV file at path.
+func ReadFLV(t *testing.T, path string) (frames []flv.Frame) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := flv.NewReader(f)
+	if _, err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		fr, rerr := r.ReadFrame()
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		if fr == nil {
+			return
+		}
+		frames = append(frames, fr)
+	}
+}
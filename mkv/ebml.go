@@ -0,0 +1,181 @@
+// Package mkv converts FLV into Matroska files.
+package mkv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Element IDs, with their length marker bits as they are written.
+const (
+	idEBML               = 0x1A45DFA3
+	idEBMLVersion        = 0x4286
+	idEBMLReadVersion    = 0x42F7
+	idEBMLMaxIDLength    = 0x42F2
+	idEBMLMaxSizeLength  = 0x42F3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+
+	idSegment      = 0x18538067
+	idSeekHead     = 0x114D9B74
+	idSeek         = 0x4DBB
+	idSeekID       = 0x53AB
+	idSeekPosition = 0x53AC
+
+	idInfo          = 0x1549A966
+	idTimecodeScale = 0x2AD7B1
+	idDuration      = 0x4489
+	idMuxingApp     = 0x4D80
+	idWritingApp    = 0x5741
+
+	idTracks            = 0x1654AE6B
+	idTrackEntry        = 0xAE
+	idTrackNumber       = 0xD7
+	idTrackUID          = 0x73C5
+	idTrackType         = 0x83
+	idFlagLacing        = 0x9C
+	idName              = 0x536E
+	idLanguage          = 0x22B59C
+	idCodecID           = 0x86
+	idCodecPrivate      = 0x63A2
+	idVideo             = 0xE0
+	idPixelWidth        = 0xB0
+	idPixelHeight       = 0xBA
+	idAudio             = 0xE1
+	idSamplingFrequency = 0xB5
+	idChannels          = 0x9F
+	idBitDepth          = 0x6264
+
+	idChapters         = 0x1043A770
+	idEditionEntry     = 0x45B9
+	idChapterAtom      = 0xB6
+	idChapterUID       = 0x73C4
+	idChapterTimeStart = 0x91
+	idChapterDisplay   = 0x80
+	idChapString       = 0x85
+	idChapLanguage     = 0x437C
+
+	idCluster       = 0x1F43B675
+	idTimecode      = 0xE7
+	idSimpleBlock   = 0xA3
+	idBlockGroup    = 0xA0
+	idBlock         = 0xA1
+	idBlockDuration = 0x9B
+
+	idCues               = 0x1C53BB6B
+	idCuePoint           = 0xBB
+	idCueTime            = 0xB3
+	idCueTrackPositions  = 0xB7
+	idCueTrack           = 0xF7
+	idCueClusterPosition = 0xF1
+)
+
+// masterSizeLength is the fixed length of the size of master elements, so
+// that it can be patched once the content is written.
+const masterSizeLength = 8
+
+func idLength(id uint32) int {
+	switch {
+	case id > 0xFFFFFF:
+		return 4
+	case id > 0xFFFF:
+		return 3
+	case id > 0xFF:
+		return 2
+	}
+	return 1
+}
+
+// sizeLength is the length of the shortest vint holding n; the all ones
+// value of each length is reserved for unknown sizes.
+func sizeLength(n uint64) int {
+	l := 1
+	for n >= 1<<uint(7*l)-1 {
+		l++
+	}
+	return l
+}
+
+func uintLength(v uint64) int {
+	l := 1
+	for v >= 1<<uint(8*l) && l < 8 {
+		l++
+	}
+	return l
+}
+
+// elementLength is the full length of an element with a payload of n bytes
+// and a minimal size.
+func elementLength(id uint32, n int) int {
+	return idLength(id) + sizeLength(uint64(n)) + n
+}
+
+// ebmlWriter serializes nested elements, patching each master size on end.
+type ebmlWriter struct {
+	bytes.Buffer
+	open []int
+}
+
+func (w *ebmlWriter) id(id uint32) {
+	for i := idLength(id) - 1; i >= 0; i-- {
+		w.WriteByte(byte(id >> uint(8*i)))
+	}
+}
+
+func (w *ebmlWriter) size(n uint64) {
+	l := sizeLength(n)
+	n |= 1 << uint(7*l)
+	for i := l - 1; i >= 0; i-- {
+		w.WriteByte(byte(n >> uint(8*i)))
+	}
+}
+
+// masterSize writes n as a size of masterSizeLength bytes.
+func (w *ebmlWriter) masterSize(n uint64) {
+	var b [masterSizeLength]byte
+	binary.BigEndian.PutUint64(b[:], n|1<<(7*masterSizeLength))
+	w.Write(b[:])
+}
+
+func (w *ebmlWriter) start(id uint32) {
+	w.id(id)
+	w.open = append(w.open, w.Len())
+	w.masterSize(0)
+}
+
+func (w *ebmlWriter) end() {
+	pos := w.open[len(w.open)-1]
+	w.open = w.open[:len(w.open)-1]
+	n := uint64(w.Len() - pos - masterSizeLength)
+	binary.BigEndian.PutUint64(w.Bytes()[pos:], n|1<<(7*masterSizeLength))
+}
+
+func (w *ebmlWriter) bytes(id uint32, data []byte) {
+	w.id(id)
+	w.size(uint64(len(data)))
+	w.Write(data)
+}
+
+func (w *ebmlWriter) string(id uint32, s string) {
+	w.bytes(id, []byte(s))
+}
+
+func (w *ebmlWriter) uint(id uint32, v uint64) {
+	w.fixedUint(id, v, uintLength(v))
+}
+
+// fixedUint writes v on l bytes, for values patched or computed after the
+// layout is fixed.
+func (w *ebmlWriter) fixedUint(id uint32, v uint64, l int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	w.bytes(id, b[8-l:])
+}
+
+func (w *ebmlWriter) float(id uint32, v float64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+	w.bytes(id, b[:])
+}
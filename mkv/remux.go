@@ -0,0 +1,731 @@
+package mkv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"math"
+)
+
+const (
+	trackTypeVideo    = 1
+	trackTypeAudio    = 2
+	trackTypeSubtitle = 0x11
+
+	// clusters start at video keyframes; without video, or with long
+	// GOPs, they are cut after this many ms
+	maxClusterDuration = 5000
+
+	// track numbers are written as single byte vints
+	maxTracks = 126
+
+	// length of the FLAC STREAMINFO metadata block
+	flacStreamInfoLength = 34
+
+	muxingApp = "flv.go"
+)
+
+// webmCodecs are the codecs a WebM file may hold.
+var webmCodecs = map[string]bool{
+	"V_VP8": true, "V_VP9": true, "V_AV1": true,
+	"A_VORBIS": true, "A_OPUS": true,
+	"S_TEXT/WEBVTT": true,
+}
+
+type track struct {
+	number  uint64
+	typ     byte
+	codecID string
+	private []byte
+	fourcc  string // of V_MS/VFW/FOURCC tracks
+
+	width, height uint16
+	sampleRate    float64
+	channels      uint8
+	bitDepth      uint8
+
+	// skip is the number of bytes of the FLV tag body before the payload
+	// of legacy tags
+	skip int
+}
+
+// payload returns the part of the tag body of fr stored in the blocks of t.
+func (t *track) payload(fr flv.Frame) []byte {
+	switch f := fr.(type) {
+	case flv.ExVideoFrame:
+		return f.Data()
+	case flv.ExAudioFrame:
+		return f.Data()
+	}
+	if body := *fr.GetBody(); len(body) > t.skip {
+		return body[t.skip:]
+	}
+	return nil
+}
+
+// coded reports whether fr carries coded frames rather than a decoder
+// configuration, an end of sequence or a command.
+func coded(fr flv.Frame) bool {
+	switch f := fr.(type) {
+	case flv.AVCVideoFrame:
+		return f.PacketType == flv.VIDEO_AVC_NALU
+	case flv.ExVideoFrame:
+		return f.PacketType == flv.VIDEO_PACKET_TYPE_CODED_FRAMES || f.PacketType == flv.VIDEO_PACKET_TYPE_CODED_FRAMES_X
+	case flv.ExAudioFrame:
+		return f.PacketType == flv.AUDIO_PACKET_TYPE_CODED_FRAMES
+	case flv.AudioFrame:
+		return f.CodecId != flv.AUDIO_CODEC_AAC || len(f.Body) > 1 && flv.AudioAac(f.Body[1]) == flv.AUDIO_AAC_RAW
+	}
+	return true
+}
+
+type block struct {
+	track    *track
+	time     int64 // ms
+	key      bool
+	position int64 // of the FLV tag; unused when data is set
+	trackId  byte  // in a multitrack tag
+	length   int
+	data     []byte
+	duration int64 // ms, subtitles only
+}
+
+func (b *block) size() int {
+	n := 4 + b.length
+	if b.track.typ == trackTypeSubtitle {
+		n = elementLength(idBlock, n) + elementLength(idBlockDuration, uintLength(uint64(b.duration)))
+		return idLength(idBlockGroup) + masterSizeLength + n
+	}
+	return elementLength(idSimpleBlock, n)
+}
+
+type chapter struct {
+	time int64 // ms
+	name string
+}
+
+type cluster struct {
+	time     int64
+	blocks   []block
+	position uint64 // from the start of the segment data
+	size     int    // of the content
+}
+
+// movie is what the first pass learns from the FLV stream.
+type movie struct {
+	video, audio *track
+	text         map[float64]*track // by onTextData trackid
+	textOrder    []*track
+	blocks       []block
+	chapters     []chapter
+
+	// from onMetaData, for codecs without dimensions in the stream
+	width, height uint16
+}
+
+func (m *movie) tracks() (tracks []*track) {
+	for _, t := range []*track{m.video, m.audio} {
+		if t != nil {
+			tracks = append(tracks, t)
+		}
+	}
+	return append(tracks, m.textOrder...)
+}
+
+func (m *movie) end() (end int64) {
+	for _, b := range m.blocks {
+		if b.time > end {
+			end = b.time
+		}
+	}
+	return
+}
+
+func newVideoTrack(fr flv.Frame) (*track, error) {
+	if ef, ok := fr.(flv.ExVideoFrame); ok {
+		return newExVideoTrack(ef)
+	}
+	vf, _ := fr.(flv.VideoFrame)
+	if af, ok := fr.(flv.AVCVideoFrame); ok {
+		vf = *af.VideoFrame
+	}
+	t := &track{typ: trackTypeVideo, codecID: "V_MS/VFW/FOURCC", width: vf.Width, height: vf.Height}
+	switch vf.CodecId {
+	case flv.VIDEO_CODEC_AVC:
+		af := fr.(flv.AVCVideoFrame)
+		if af.PacketType != flv.VIDEO_AVC_SEQUENCE_HEADER {
+			return nil, nil
+		}
+		t.codecID, t.private, t.skip = "V_MPEG4/ISO/AVC", af.Data(), 5
+		if rec, err := flv.ParseAVCConfRecord(t.private); err == nil && len(rec.RawSPSData) > 0 {
+			if sps, err := flv.ParseSPS(rec.RawSPSData[0]); err == nil && sps.Width() > 0 {
+				t.width, t.height = uint16(sps.Width()), uint16(sps.Height())
+			}
+		}
+	case flv.VIDEO_CODEC_SORENSON:
+		t.fourcc, t.skip = "FLV1", 1
+	case flv.VIDEO_CODEC_ON2VP6:
+		// the frame type is followed by the crop adjustment
+		t.fourcc, t.skip = "VP6F", 2
+	default:
+		return nil, fmt.Errorf("mkv: %s video is not supported", vf.CodecId)
+	}
+	return t, nil
+}
+
+// newExVideoTrack creates the track of an Enhanced RTMP sequence start,
+// which carries the CodecPrivate, or of any VP9 frame.
+func newExVideoTrack(ef flv.ExVideoFrame) (*track, error) {
+	t := &track{typ: trackTypeVideo, width: ef.Width, height: ef.Height}
+	switch ef.FourCC {
+	case flv.FOURCC_AVC:
+		t.codecID = "V_MPEG4/ISO/AVC"
+	case flv.FOURCC_HEVC:
+		t.codecID = "V_MPEGH/ISO/HEVC"
+	case flv.FOURCC_AV1:
+		t.codecID = "V_AV1"
+	case flv.FOURCC_VP9:
+		// the vpcC record of the sequence start is no CodecPrivate
+		return &track{typ: trackTypeVideo, codecID: "V_VP9", width: ef.Width, height: ef.Height}, nil
+	default:
+		return nil, fmt.Errorf("mkv: %s video is not supported", ef.FourCC)
+	}
+	if ef.PacketType != flv.VIDEO_PACKET_TYPE_SEQUENCE_START {
+		return nil, nil
+	}
+	t.private = ef.Data()
+	return t, nil
+}
+
+// newExAudioTrack creates the track of an Enhanced RTMP sequence start,
+// which carries the CodecPrivate, or of any frame of codecs without one.
+func newExAudioTrack(ef flv.ExAudioFrame) (*track, error) {
+	t := &track{typ: trackTypeAudio, sampleRate: float64(ef.Rate), channels: ef.ChannelCount}
+	if t.channels == 0 {
+		t.channels = 1
+	}
+	switch ef.FourCC {
+	case flv.FOURCC_AC3:
+		t.codecID = "A_AC3"
+		return t, nil
+	case flv.FOURCC_EAC3:
+		t.codecID = "A_EAC3"
+		return t, nil
+	case flv.FOURCC_MP3:
+		t.codecID = "A_MPEG/L3"
+		return t, nil
+	case flv.FOURCC_AAC:
+		t.codecID = "A_AAC"
+	case flv.FOURCC_OPUS:
+		t.codecID = "A_OPUS"
+	case flv.FOURCC_FLAC:
+		t.codecID = "A_FLAC"
+	default:
+		return nil, fmt.Errorf("mkv: %s audio is not supported", ef.FourCC)
+	}
+	if ef.PacketType != flv.AUDIO_PACKET_TYPE_SEQUENCE_START {
+		return nil, nil
+	}
+	t.private = ef.Data()
+	if t.codecID == "A_FLAC" {
+		// Matroska wants the stream marker and metadata blocks, the
+		// sequence start may hold a bare STREAMINFO
+		if len(t.private) == flacStreamInfoLength {
+			t.private = append([]byte{0x80, 0, 0, flacStreamInfoLength}, t.private...)
+		}
+		if !bytes.HasPrefix(t.private, []byte("fLaC")) {
+			t.private = append([]byte("fLaC"), t.private...)
+		}
+	}
+	return t, nil
+}
+
+func newAudioTrack(af flv.AudioFrame) (*track, error) {
+	body := *af.GetBody()
+	t := &track{typ: trackTypeAudio, sampleRate: float64(af.Rate), channels: 1, skip: 1}
+	if af.Channels == flv.AUDIO_TYPE_STEREO {
+		t.channels = 2
+	}
+	switch af.CodecId {
+	case flv.AUDIO_CODEC_AAC:
+		if len(body) < 2 || flv.AudioAac(body[1]) != flv.AUDIO_AAC_SEQUENCE_HEADER {
+			return nil, nil
+		}
+		conf, err := flv.ParseAudioSpecificConfig(body[2:])
+		if err != nil {
+			return nil, err
+		}
+		t.codecID, t.private, t.skip = "A_AAC", body[2:], 2
+		t.sampleRate = float64(conf.SampleRate)
+		if conf.ChannelConfiguration != 0 {
+			t.channels = uint8(conf.ChannelConfiguration)
+		}
+	case flv.AUDIO_CODEC_MP3, flv.AUDIO_CODEC_MP3_8KHZ:
+		t.codecID = "A_MPEG/L3"
+		if af.CodecId == flv.AUDIO_CODEC_MP3_8KHZ {
+			t.sampleRate = 8000
+		}
+	case flv.AUDIO_CODEC_PCM, flv.AUDIO_CODEC_PCM_LE:
+		// FLV writers use little endian for the platform endian codec too
+		t.codecID, t.bitDepth = "A_PCM/INT/LIT", 8
+		if af.BitSize == flv.AUDIO_SIZE_16BIT {
+			t.bitDepth = 16
+		}
+	default:
+		return nil, fmt.Errorf("mkv: %s audio is not supported", af.CodecId)
+	}
+	switch t.sampleRate {
+	case 5500:
+		t.sampleRate = 5512
+	case 11000:
+		t.sampleRate = 11025
+	case 22000:
+		t.sampleRate = 22050
+	case 44000:
+		t.sampleRate = 44100
+	}
+	return t, nil
+}
+
+// sameTrack reports whether frames of t and u can share a track.
+func sameTrack(t, u *track) bool {
+	return t.codecID == u.codecID && t.fourcc == u.fourcc && bytes.Equal(t.private, u.private)
+}
+
+// scan reads the FLV stream and records the tracks and the blocks. Only
+// the subtitles are kept in memory; the frame payloads are read again when
+// the clusters are written.
+func scan(in *flv.FlvReader) (*movie, error) {
+	if _, err := in.ReadHeader(); err != nil {
+		return nil, err
+	}
+	m := &movie{text: map[float64]*track{}}
+	for {
+		fr, rerr := in.ReadFrame()
+		if rerr != nil {
+			return nil, rerr
+		}
+		if fr == nil {
+			break
+		}
+		body := *fr.GetBody()
+		b := block{time: int64(fr.GetDts()), position: flv.PositionOf(fr), trackId: flv.TrackId(fr), key: true}
+
+		switch fr.GetType() {
+		case flv.TAG_TYPE_META:
+			mf, ok := fr.(flv.MetaFrame)
+			if !ok {
+				continue
+			}
+			props := mf.Properties()
+			switch mf.Name() {
+			case "onMetaData":
+				if w, ok := props["width"].(float64); ok {
+					m.width = uint16(w)
+				}
+				if h, ok := props["height"].(float64); ok {
+					m.height = uint16(h)
+				}
+			case "onCuePoint":
+				c := chapter{time: b.time}
+				c.name, _ = props["name"].(string)
+				if t, ok := props["time"].(float64); ok {
+					// chapters start at an unsigned time
+					switch {
+					case t < 0 || math.IsNaN(t):
+						c.time = 0
+					case t > math.MaxInt64/1000000000:
+						c.time = math.MaxInt64 / 1000000
+					default:
+						c.time = int64(t * 1000)
+					}
+				}
+				m.chapters = append(m.chapters, c)
+			case "onTextData":
+				text, ok := props["text"].(string)
+				if !ok {
+					continue
+				}
+				id, _ := props["trackid"].(float64)
+				if m.text[id] == nil {
+					m.text[id] = &track{typ: trackTypeSubtitle, codecID: "S_TEXT/UTF8"}
+					m.textOrder = append(m.textOrder, m.text[id])
+				}
+				b.track, b.data, b.length = m.text[id], []byte(text), len(text)
+				m.blocks = append(m.blocks, b)
+			}
+			continue
+
+		case flv.TAG_TYPE_VIDEO:
+			if len(body) == 0 {
+				continue
+			}
+			t, err := newVideoTrack(fr)
+			if err != nil {
+				return nil, err
+			}
+			if t != nil {
+				if m.video == nil {
+					m.video = t
+				} else if !sameTrack(m.video, t) {
+					return nil, fmt.Errorf("mkv: video configuration changes mid-stream")
+				}
+			}
+			if m.video == nil || !coded(fr) {
+				// nothing decodes before the sequence header
+				continue
+			}
+			switch f := fr.(type) {
+			case flv.AVCVideoFrame:
+				b.time += int64(f.CompositionTime())
+			case flv.ExVideoFrame:
+				b.time += int64(f.CompositionTime())
+			}
+			if b.time < 0 {
+				b.time = 0
+			}
+			b.track, b.key = m.video, flv.FlavorOf(fr) == flv.KEYFRAME
+
+		case flv.TAG_TYPE_AUDIO:
+			if len(body) == 0 {
+				continue
+			}
+			var t *track
+			var err error
+			switch f := fr.(type) {
+			case flv.ExAudioFrame:
+				t, err = newExAudioTrack(f)
+			case flv.AudioFrame:
+				t, err = newAudioTrack(f)
+			default:
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if t != nil {
+				if m.audio == nil {
+					m.audio = t
+				} else if !sameTrack(m.audio, t) {
+					return nil, fmt.Errorf("mkv: audio configuration changes mid-stream")
+				}
+			}
+			if m.audio == nil || !coded(fr) {
+				// nothing decodes before the sequence header
+				continue
+			}
+			b.track = m.audio
+
+		default:
+			continue
+		}
+		if b.length = len(b.track.payload(fr)); b.length == 0 {
+			continue
+		}
+		m.blocks = append(m.blocks, b)
+	}
+
+	if len(m.tracks()) > maxTracks {
+		return nil, fmt.Errorf("mkv: %d tracks, at most %d are supported", len(m.tracks()), maxTracks)
+	}
+	for i, t := range m.tracks() {
+		t.number = uint64(i + 1)
+		if t.width == 0 {
+			t.width, t.height = m.width, m.height
+		}
+	}
+
+	// subtitles last until the next one of their track
+	end := m.end()
+	last := map[*track]int{}
+	for i := len(m.blocks) - 1; i >= 0; i-- {
+		b := &m.blocks[i]
+		if b.track.typ != trackTypeSubtitle {
+			continue
+		}
+		b.duration = end - b.time
+		if next, ok := last[b.track]; ok {
+			b.duration = m.blocks[next].time - b.time
+		}
+		if b.duration < 0 {
+			b.duration = 0
+		}
+		last[b.track] = i
+	}
+	return m, nil
+}
+
+// clusters splits the blocks into clusters starting at video keyframes.
+func (m *movie) clusters() (clusters []*cluster) {
+	var c *cluster
+	for i, b := range m.blocks {
+		rel := int64(0)
+		if c != nil {
+			rel = b.time - c.time
+		}
+		cut := c == nil || rel > math.MaxInt16 || rel < math.MinInt16
+		if m.video != nil {
+			cut = cut || b.track == m.video && b.key || rel >= maxClusterDuration && b.key
+		} else {
+			cut = cut || rel >= maxClusterDuration
+		}
+		if cut {
+			c = &cluster{time: b.time, blocks: m.blocks[i:i]}
+			c.size = elementLength(idTimecode, uintLength(uint64(c.time)))
+			clusters = append(clusters, c)
+		}
+		c.blocks = c.blocks[:len(c.blocks)+1]
+		c.size += b.size()
+	}
+	return
+}
+
+func bitmapInfoHeader(fourcc string, width, height uint16) []byte {
+	h := make([]byte, 40)
+	le := binary.LittleEndian
+	le.PutUint32(h[0:], 40)
+	le.PutUint32(h[4:], uint32(width))
+	le.PutUint32(h[8:], uint32(height))
+	le.PutUint16(h[12:], 1)  // planes
+	le.PutUint16(h[14:], 24) // bit count
+	copy(h[16:], fourcc)
+	le.PutUint32(h[20:], uint32(width)*uint32(height)*3)
+	return h
+}
+
+func (m *movie) docType() string {
+	for _, t := range m.tracks() {
+		if !webmCodecs[t.codecID] {
+			return "matroska"
+		}
+	}
+	return "webm"
+}
+
+func writeEBMLHeader(w *ebmlWriter, docType string) {
+	w.start(idEBML)
+	w.uint(idEBMLVersion, 1)
+	w.uint(idEBMLReadVersion, 1)
+	w.uint(idEBMLMaxIDLength, 4)
+	w.uint(idEBMLMaxSizeLength, 8)
+	w.string(idDocType, docType)
+	w.uint(idDocTypeVersion, 4)
+	w.uint(idDocTypeReadVersion, 2)
+	w.end()
+}
+
+func (m *movie) writeInfo(w *ebmlWriter) {
+	w.start(idInfo)
+	w.uint(idTimecodeScale, 1000000) // ms
+	w.string(idMuxingApp, muxingApp)
+	w.string(idWritingApp, muxingApp)
+	w.float(idDuration, float64(m.end()))
+	w.end()
+}
+
+func (m *movie) writeTracks(w *ebmlWriter) {
+	w.start(idTracks)
+	for _, t := range m.tracks() {
+		w.start(idTrackEntry)
+		w.uint(idTrackNumber, t.number)
+		w.uint(idTrackUID, t.number)
+		w.uint(idTrackType, uint64(t.typ))
+		w.uint(idFlagLacing, 0)
+		w.string(idLanguage, "und")
+		w.string(idCodecID, t.codecID)
+		private := t.private
+		if t.fourcc != "" {
+			private = bitmapInfoHeader(t.fourcc, t.width, t.height)
+		}
+		if private != nil {
+			w.bytes(idCodecPrivate, private)
+		}
+		switch t.typ {
+		case trackTypeVideo:
+			w.start(idVideo)
+			w.uint(idPixelWidth, uint64(t.width))
+			w.uint(idPixelHeight, uint64(t.height))
+			w.end()
+		case trackTypeAudio:
+			w.start(idAudio)
+			w.float(idSamplingFrequency, t.sampleRate)
+			w.uint(idChannels, uint64(t.channels))
+			if t.bitDepth > 0 {
+				w.uint(idBitDepth, uint64(t.bitDepth))
+			}
+			w.end()
+		}
+		w.end()
+	}
+	w.end()
+}
+
+func (m *movie) writeChapters(w *ebmlWriter) {
+	if len(m.chapters) == 0 {
+		return
+	}
+	w.start(idChapters)
+	w.start(idEditionEntry)
+	for i, c := range m.chapters {
+		w.start(idChapterAtom)
+		w.uint(idChapterUID, uint64(i+1))
+		w.uint(idChapterTimeStart, uint64(c.time)*1000000) // ns
+		w.start(idChapterDisplay)
+		w.string(idChapString, c.name)
+		w.string(idChapLanguage, "und")
+		w.end()
+		w.end()
+	}
+	w.end()
+	w.end()
+}
+
+// writeCues indexes the clusters starting with a video keyframe, or all
+// of them without video.
+func (m *movie) writeCues(w *ebmlWriter, clusters []*cluster) {
+	w.start(idCues)
+	for _, c := range clusters {
+		first := c.blocks[0]
+		if m.video != nil && first.track != m.video {
+			continue
+		}
+		w.start(idCuePoint)
+		w.uint(idCueTime, uint64(c.time))
+		w.start(idCueTrackPositions)
+		w.uint(idCueTrack, first.track.number)
+		w.uint(idCueClusterPosition, c.position)
+		w.end()
+		w.end()
+	}
+	w.end()
+}
+
+type seekEntry struct {
+	id       uint32
+	position uint64
+}
+
+func writeSeekHead(w *ebmlWriter, entries []seekEntry) {
+	w.start(idSeekHead)
+	for _, e := range entries {
+		var id ebmlWriter
+		id.id(e.id)
+		w.start(idSeek)
+		w.bytes(idSeekID, id.Bytes())
+		w.fixedUint(idSeekPosition, e.position, 8)
+		w.end()
+	}
+	w.end()
+}
+
+func (m *movie) writeBlock(w *ebmlWriter, b *block, clusterTime int64, in *flv.FlvReader) error {
+	data := b.data
+	if data == nil {
+		fr, rerr := in.ReadTrackAt(b.position, b.trackId)
+		if rerr != nil {
+			return rerr
+		}
+		if fr == nil || len(b.track.payload(fr)) != b.length {
+			return fmt.Errorf("mkv: frame at %d changed since it was scanned", b.position)
+		}
+		data = b.track.payload(fr)
+	}
+	rel := b.time - clusterTime
+	header := []byte{0x80 | byte(b.track.number), byte(rel >> 8), byte(rel), 0}
+	if b.track.typ == trackTypeSubtitle {
+		w.start(idBlockGroup)
+		w.id(idBlock)
+		w.size(uint64(len(header) + len(data)))
+		w.Write(header)
+		w.Write(data)
+		w.uint(idBlockDuration, uint64(b.duration))
+		w.end()
+		return nil
+	}
+	if b.key {
+		header[3] = 0x80
+	}
+	w.id(idSimpleBlock)
+	w.size(uint64(len(header) + len(data)))
+	w.Write(header)
+	w.Write(data)
+	return nil
+}
+
+// Remux converts an FLV stream into a Matroska file, or a WebM file when
+// all the codecs allow it. AVC, AAC, MP3 and PCM, and the HEVC, AV1, VP9,
+// Opus, FLAC, AC-3 and E-AC-3 of Enhanced RTMP map to their Matroska
+// codecs, Sorenson H.263 and VP6 are stored in VfW compatibility mode.
+// onCuePoint events become chapters and onTextData subtitle tracks. The
+// input is read twice: the layout is computed from a first pass so that
+// the seek head and the cues can be written without seeking the output.
+func Remux(in *flv.FlvReader, w io.Writer) error {
+	m, err := scan(in)
+	if err != nil {
+		return err
+	}
+	if len(m.tracks()) == 0 {
+		return fmt.Errorf("mkv: no audio, video or text to write")
+	}
+	clusters := m.clusters()
+
+	var info, tracks, chapters, cues, seekHead ebmlWriter
+	m.writeInfo(&info)
+	m.writeTracks(&tracks)
+	m.writeChapters(&chapters)
+	entries := []seekEntry{{id: idInfo}, {id: idTracks}, {id: idCues}}
+	if chapters.Len() > 0 {
+		entries = append(entries, seekEntry{id: idChapters})
+	}
+	// the seek head has the same size whatever the positions
+	writeSeekHead(&seekHead, entries)
+
+	pos := uint64(seekHead.Len())
+	entries[0].position = pos
+	pos += uint64(info.Len())
+	entries[1].position = pos
+	pos += uint64(tracks.Len())
+	if chapters.Len() > 0 {
+		entries[3].position = pos
+		pos += uint64(chapters.Len())
+	}
+	for _, c := range clusters {
+		c.position = pos
+		pos += uint64(idLength(idCluster) + masterSizeLength + c.size)
+	}
+	entries[2].position = pos
+	m.writeCues(&cues, clusters)
+	pos += uint64(cues.Len())
+	seekHead.Reset()
+	writeSeekHead(&seekHead, entries)
+
+	var head ebmlWriter
+	writeEBMLHeader(&head, m.docType())
+	head.id(idSegment)
+	head.masterSize(pos)
+	for _, e := range []*ebmlWriter{&seekHead, &info, &tracks, &chapters} {
+		head.Write(e.Bytes())
+	}
+	if _, err = w.Write(head.Bytes()); err != nil {
+		return err
+	}
+
+	for _, c := range clusters {
+		var cw ebmlWriter
+		cw.id(idCluster)
+		cw.masterSize(uint64(c.size))
+		cw.uint(idTimecode, uint64(c.time))
+		for i := range c.blocks {
+			if err = m.writeBlock(&cw, &c.blocks[i], c.time, in); err != nil {
+				return err
+			}
+		}
+		if _, err = w.Write(cw.Bytes()); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(cues.Bytes())
+	return err
+}
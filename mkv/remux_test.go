@@ -0,0 +1,300 @@
+package mkv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/internal/flvtest"
+	"math"
+	"testing"
+)
+
+// testScript builds a script tag whose properties alternate keys and
+// string or number values.
+func testScript(dts uint32, name string, props ...interface{}) flv.Frame {
+	var b bytes.Buffer
+	str := func(s string) {
+		binary.Write(&b, binary.BigEndian, uint16(len(s)))
+		b.WriteString(s)
+	}
+	b.WriteByte(0x02)
+	str(name)
+	b.WriteByte(0x08)
+	binary.Write(&b, binary.BigEndian, uint32(len(props)/2))
+	for i := 0; i < len(props); i += 2 {
+		str(props[i].(string))
+		switch v := props[i+1].(type) {
+		case string:
+			b.WriteByte(0x02)
+			str(v)
+		case float64:
+			b.WriteByte(0x00)
+			binary.Write(&b, binary.BigEndian, math.Float64bits(v))
+		}
+	}
+	b.Write([]byte{0, 0, 0x09})
+	return flv.MetaFrame{CFrame: &flv.CFrame{Type: flv.TAG_TYPE_META, Dts: dts, Flavor: flv.METADATA, Body: b.Bytes()}}
+}
+
+// testFrames is 2 seconds of flvtest.Frames with a cue point and two
+// subtitles.
+func testFrames() []flv.Frame {
+	frames := flvtest.Frames(2000)
+	frames = flvtest.Insert(frames, testScript(500, "onCuePoint", "name", "intro", "time", 0.5, "type", "navigation"))
+	frames = flvtest.Insert(frames, testScript(1000, "onTextData", "text", "hello", "trackid", 0.0))
+	return flvtest.Insert(frames, testScript(1500, "onTextData", "text", "world", "trackid", 0.0))
+}
+
+type element struct {
+	id      uint32
+	offset  int // of the element in the parsed data
+	payload []byte
+}
+
+func readVint(b []byte) (v uint64, n int) {
+	for n = 1; n <= 8 && b[0]&(0x80>>uint(n-1)) == 0; n++ {
+	}
+	for i := 0; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return
+}
+
+func splitElements(t *testing.T, data []byte) (elements []element) {
+	for offset := 0; offset < len(data); {
+		id, n := readVint(data[offset:])
+		size, m := readVint(data[offset+n:])
+		size &^= 1 << uint(7*m)
+		start := offset + n + m
+		if start+int(size) > len(data) {
+			t.Fatalf("element %x of %d bytes overflows its parent", id, size)
+		}
+		elements = append(elements, element{uint32(id), offset, data[start : start+int(size)]})
+		offset = start + int(size)
+	}
+	return
+}
+
+func findElements(t *testing.T, data []byte, id uint32) (found []element) {
+	for _, e := range splitElements(t, data) {
+		if e.id == id {
+			found = append(found, e)
+		}
+	}
+	return
+}
+
+func elementUint(b []byte) (v uint64) {
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return
+}
+
+func TestRemux(t *testing.T) {
+	var out bytes.Buffer
+	if err := Remux(flvtest.WriteFLV(t, testFrames()), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	top := splitElements(t, out.Bytes())
+	if len(top) != 2 || top[0].id != idEBML || top[1].id != idSegment {
+		t.Fatalf("expect the EBML header and a segment")
+	}
+	if docType := findElements(t, top[0].payload, idDocType); string(docType[0].payload) != "matroska" {
+		t.Errorf("expect matroska got %s", docType[0].payload)
+	}
+	segment := top[1].payload
+	children := map[uint32]element{}
+	for _, e := range splitElements(t, segment) {
+		children[e.id] = e
+	}
+
+	for _, seek := range findElements(t, children[idSeekHead].payload, idSeek) {
+		id := elementUint(findElements(t, seek.payload, idSeekID)[0].payload)
+		pos := elementUint(findElements(t, seek.payload, idSeekPosition)[0].payload)
+		if e, ok := children[uint32(id)]; !ok || uint64(e.offset) != pos {
+			t.Errorf("seek head points %x at %d", id, pos)
+		}
+	}
+
+	entries := findElements(t, children[idTracks].payload, idTrackEntry)
+	var codecs []string
+	for _, e := range entries {
+		codecs = append(codecs, string(findElements(t, e.payload, idCodecID)[0].payload))
+	}
+	if len(codecs) != 3 || codecs[0] != "V_MPEG4/ISO/AVC" || codecs[1] != "A_AAC" || codecs[2] != "S_TEXT/UTF8" {
+		t.Fatalf("unexpected tracks %v", codecs)
+	}
+	if private := findElements(t, entries[0].payload, idCodecPrivate); !bytes.Equal(private[0].payload, flvtest.AVCConf) {
+		t.Errorf("unexpected AVC codec private % x", private[0].payload)
+	}
+	audio := findElements(t, entries[1].payload, idAudio)[0].payload
+	if rate := findElements(t, audio, idSamplingFrequency)[0].payload; math.Float64frombits(binary.BigEndian.Uint64(rate)) != 44100 {
+		t.Errorf("unexpected sampling frequency % x", rate)
+	}
+
+	atom := findElements(t, findElements(t, children[idChapters].payload, idEditionEntry)[0].payload, idChapterAtom)
+	if len(atom) != 1 || elementUint(findElements(t, atom[0].payload, idChapterTimeStart)[0].payload) != 500000000 {
+		t.Fatalf("expect a chapter at 500ms")
+	}
+	if name := findElements(t, findElements(t, atom[0].payload, idChapterDisplay)[0].payload, idChapString); string(name[0].payload) != "intro" {
+		t.Errorf("expect the intro chapter got %s", name[0].payload)
+	}
+
+	clusters := findElements(t, segment, idCluster)
+	if len(clusters) != 2 {
+		t.Fatalf("expect a cluster per keyframe got %d", len(clusters))
+	}
+	var video, audioBlocks, subtitles int
+	for i, c := range clusters {
+		time := elementUint(findElements(t, c.payload, idTimecode)[0].payload)
+		if time != uint64(i*1000+40) {
+			t.Errorf("cluster %d starts at %d", i, time)
+		}
+		for _, b := range findElements(t, c.payload, idSimpleBlock) {
+			switch b.payload[0] {
+			case 0x81:
+				video++
+				if key := b.payload[3]&0x80 != 0; key != (video%25 == 1) {
+					t.Errorf("video block %d: unexpected keyframe flag %v", video, key)
+				}
+			case 0x82:
+				audioBlocks++
+			}
+		}
+		for _, g := range findElements(t, c.payload, idBlockGroup) {
+			subtitles++
+			b := findElements(t, g.payload, idBlock)[0].payload
+			if b[0] != 0x83 || string(b[4:]) != []string{"hello", "world"}[subtitles-1] {
+				t.Errorf("unexpected subtitle block % x", b)
+			}
+			if d := elementUint(findElements(t, g.payload, idBlockDuration)[0].payload); d != 500 && d != 480 {
+				t.Errorf("unexpected subtitle duration %d", d)
+			}
+		}
+	}
+	if video != 50 || audioBlocks != 100 || subtitles != 2 {
+		t.Errorf("expect 50 video, 100 audio and 2 subtitle blocks got %d, %d and %d", video, audioBlocks, subtitles)
+	}
+
+	points := findElements(t, children[idCues].payload, idCuePoint)
+	if len(points) != 2 {
+		t.Fatalf("expect 2 cue points got %d", len(points))
+	}
+	for i, p := range points {
+		positions := findElements(t, p.payload, idCueTrackPositions)[0].payload
+		if pos := elementUint(findElements(t, positions, idCueClusterPosition)[0].payload); pos != uint64(clusters[i].offset) {
+			t.Errorf("cue %d points at %d instead of %d", i, pos, clusters[i].offset)
+		}
+	}
+}
+
+func TestRemuxUnsupported(t *testing.T) {
+	screen := flv.VideoFrame{
+		CFrame:  &flv.CFrame{Type: flv.TAG_TYPE_VIDEO, Flavor: flv.KEYFRAME, Body: []byte{0x13, 0x01}},
+		CodecId: flv.VIDEO_CODEC_SCREENVIDEO,
+	}
+	if err := Remux(flvtest.WriteFLV(t, []flv.Frame{screen}), &bytes.Buffer{}); err == nil {
+		t.Errorf("expect an error for screen video")
+	}
+	vvc := flv.NewExVideoFrame(0, flv.VIDEO_FRAME_TYPE_KEYFRAME, flv.VIDEO_PACKET_TYPE_SEQUENCE_START, flv.FourCC("vvc1"), 0, []byte{1})
+	vorbis := flv.NewExAudioFrame(0, flv.AUDIO_PACKET_TYPE_SEQUENCE_START, flv.FourCC("vorb"), []byte{1})
+	for _, fr := range []flv.Frame{vvc, vorbis} {
+		if err := Remux(flvtest.WriteFLV(t, []flv.Frame{fr}), &bytes.Buffer{}); err == nil {
+			t.Errorf("expect an error for %s", fr)
+		}
+	}
+}
+
+func TestRemuxEnhanced(t *testing.T) {
+	av1C := []byte{0x81, 0x00, 0x0C, 0x00}
+	opusHead := []byte("OpusHead\x01\x02\x38\x01\x80\xBB\x00\x00\x00\x00\x00")
+	streamInfo := make([]byte, 34)
+	for _, c := range []struct {
+		video, audio   flv.FourCC
+		vconf, aconf   []byte
+		docType        string
+		vcodec, acodec string
+		aprivate       []byte
+	}{
+		{flv.FOURCC_AV1, flv.FOURCC_OPUS, av1C, opusHead, "webm", "V_AV1", "A_OPUS", opusHead},
+		{flv.FOURCC_HEVC, flv.FOURCC_FLAC, []byte{1, 2, 3}, streamInfo, "matroska", "V_MPEGH/ISO/HEVC", "A_FLAC",
+			append([]byte("fLaC\x80\x00\x00\x22"), streamInfo...)},
+	} {
+		frames := []flv.Frame{
+			flv.NewExVideoFrame(0, flv.VIDEO_FRAME_TYPE_KEYFRAME, flv.VIDEO_PACKET_TYPE_SEQUENCE_START, c.video, 0, c.vconf),
+			flv.NewExAudioFrame(0, flv.AUDIO_PACKET_TYPE_SEQUENCE_START, c.audio, c.aconf),
+		}
+		for ms := uint32(0); ms < 2000; ms += 40 {
+			frameType := flv.VIDEO_FRAME_TYPE_INTER_FRAME
+			if ms%1000 == 0 {
+				frameType = flv.VIDEO_FRAME_TYPE_KEYFRAME
+			}
+			frames = append(frames,
+				flv.NewExVideoFrame(ms, frameType, flv.VIDEO_PACKET_TYPE_CODED_FRAMES, c.video, 0, []byte{0x12, 0, byte(ms / 40)}),
+				flv.NewExAudioFrame(ms, flv.AUDIO_PACKET_TYPE_CODED_FRAMES, c.audio, []byte{0xFC, byte(ms / 40)}))
+		}
+		var out bytes.Buffer
+		if err := Remux(flvtest.WriteFLV(t, frames), &out); err != nil {
+			t.Fatal(err)
+		}
+
+		top := splitElements(t, out.Bytes())
+		if docType := findElements(t, top[0].payload, idDocType); string(docType[0].payload) != c.docType {
+			t.Errorf("expect %s got %s", c.docType, docType[0].payload)
+		}
+		segment := top[1].payload
+		entries := findElements(t, findElements(t, segment, idTracks)[0].payload, idTrackEntry)
+		if len(entries) != 2 {
+			t.Fatalf("expect 2 tracks got %d", len(entries))
+		}
+		if codec := findElements(t, entries[0].payload, idCodecID)[0].payload; string(codec) != c.vcodec {
+			t.Errorf("expect %s got %s", c.vcodec, codec)
+		}
+		if private := findElements(t, entries[0].payload, idCodecPrivate)[0].payload; !bytes.Equal(private, c.vconf) {
+			t.Errorf("unexpected %s codec private % x", c.vcodec, private)
+		}
+		if codec := findElements(t, entries[1].payload, idCodecID)[0].payload; string(codec) != c.acodec {
+			t.Errorf("expect %s got %s", c.acodec, codec)
+		}
+		if private := findElements(t, entries[1].payload, idCodecPrivate)[0].payload; !bytes.Equal(private, c.aprivate) {
+			t.Errorf("unexpected %s codec private % x", c.acodec, private)
+		}
+
+		var blocks [][]byte
+		for _, cl := range findElements(t, segment, idCluster) {
+			for _, b := range findElements(t, cl.payload, idSimpleBlock) {
+				blocks = append(blocks, b.payload)
+			}
+		}
+		if len(blocks) != 100 {
+			t.Fatalf("expect 100 blocks got %d", len(blocks))
+		}
+		if !bytes.Equal(blocks[0], []byte{0x81, 0, 0, 0x80, 0x12, 0, 0}) || !bytes.Equal(blocks[1], []byte{0x82, 0, 0, 0x80, 0xFC, 0}) {
+			t.Errorf("unexpected blocks % x and % x", blocks[0], blocks[1])
+		}
+	}
+}
+
+func TestRemuxBadCuePoints(t *testing.T) {
+	frames := flvtest.Frames(2000)
+	frames = flvtest.Insert(frames, testScript(500, "onCuePoint", "name", "before", "time", -1.5))
+	frames = flvtest.Insert(frames, testScript(600, "onCuePoint", "name", "far", "time", 1e300))
+	var out bytes.Buffer
+	if err := Remux(flvtest.WriteFLV(t, frames), &out); err != nil {
+		t.Fatal(err)
+	}
+	segment := splitElements(t, out.Bytes())[1].payload
+	edition := findElements(t, findElements(t, segment, idChapters)[0].payload, idEditionEntry)[0].payload
+	atoms := findElements(t, edition, idChapterAtom)
+	if len(atoms) != 2 {
+		t.Fatalf("expect 2 chapters got %d", len(atoms))
+	}
+	if start := elementUint(findElements(t, atoms[0].payload, idChapterTimeStart)[0].payload); start != 0 {
+		t.Errorf("expect a negative time to start at 0 got %d", start)
+	}
+	if start := elementUint(findElements(t, atoms[1].payload, idChapterTimeStart)[0].payload); start > math.MaxInt64 {
+		t.Errorf("expect a huge time to be capped got %d", start)
+	}
+}
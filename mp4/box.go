@@ -0,0 +1,75 @@
+// Package mp4 converts between FLV and ISO base media (MP4) files.
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+var (
+	be = binary.BigEndian
+
+	unityMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+)
+
+// boxWriter serializes nested boxes, patching each size on end.
+type boxWriter struct {
+	bytes.Buffer
+	open []int
+}
+
+func (w *boxWriter) start(typ string) {
+	w.open = append(w.open, w.Len())
+	w.u32(0)
+	w.WriteString(typ)
+}
+
+func (w *boxWriter) fullStart(typ string, version byte, flags uint32) {
+	w.start(typ)
+	w.u32(uint32(version)<<24 | flags&0xFFFFFF)
+}
+
+func (w *boxWriter) end() {
+	pos := w.open[len(w.open)-1]
+	w.open = w.open[:len(w.open)-1]
+	be.PutUint32(w.Bytes()[pos:], uint32(w.Len()-pos))
+}
+
+func (w *boxWriter) u8(v byte) {
+	w.WriteByte(v)
+}
+
+func (w *boxWriter) u16(v uint16) {
+	w.Write([]byte{byte(v >> 8), byte(v)})
+}
+
+func (w *boxWriter) u24(v uint32) {
+	w.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+func (w *boxWriter) u32(v uint32) {
+	w.Write([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+func (w *boxWriter) u64(v uint64) {
+	w.u32(uint32(v >> 32))
+	w.u32(uint32(v))
+}
+
+func (w *boxWriter) zeros(n int) {
+	w.Write(make([]byte, n))
+}
+
+func (w *boxWriter) matrix() {
+	for _, v := range unityMatrix {
+		w.u32(v)
+	}
+}
+
+// descriptor writes an MPEG-4 elementary stream descriptor with a 4 byte
+// size field.
+func (w *boxWriter) descriptor(tag byte, payload []byte) {
+	n := len(payload)
+	w.Write([]byte{tag, byte(n>>21) | 0x80, byte(n>>14) | 0x80, byte(n>>7) | 0x80, byte(n) & 0x7F})
+	w.Write(payload)
+}
@@ -0,0 +1,365 @@
+package mp4
+
+import (
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"io"
+)
+
+const (
+	// audio-only streams are fragmented at least this often, ms
+	defaultAudioFragment = 1000
+	// longest wait for the sequence headers of all tracks before the init
+	// segment is written anyway, ms
+	initTimeout = 1000
+)
+
+// Fragment is a moof/mdat pair holding the samples of all tracks for a
+// stretch of time.
+type Fragment struct {
+	Sequence uint32
+	Start    uint32 // DTS of the earliest sample, ms
+	Duration uint32 // ms
+	Keyframe bool   // the video track starts with a keyframe
+	Data     []byte
+}
+
+// InitSegment builds the ftyp and moov boxes announcing fragmented tracks.
+func InitSegment(tracks []*Track) []byte {
+	w := &boxWriter{}
+	w.start("ftyp")
+	w.WriteString("iso5")
+	w.u32(512)
+	w.WriteString("iso5iso6mp41")
+	w.end()
+	writeMoov(w, tracks, true)
+	return w.Bytes()
+}
+
+// buildFragment moves the pending samples of the tracks into a fragment.
+func buildFragment(seq uint32, tracks []*Track) *Fragment {
+	frag := &Fragment{Sequence: seq, Keyframe: true}
+	var end uint32
+	first := true
+	w := &boxWriter{}
+	w.start("moof")
+	w.fullStart("mfhd", 0, 0)
+	w.u32(seq)
+	w.end()
+
+	var offsets []int
+	for _, t := range tracks {
+		if len(t.Samples) == 0 {
+			continue
+		}
+		if last := &t.Samples[len(t.Samples)-1]; last.Duration == 0 {
+			last.Duration = t.defaultDuration()
+		}
+		if first || t.Samples[0].Dts < frag.Start {
+			frag.Start = t.Samples[0].Dts
+			first = false
+		}
+		if t.IsVideo() {
+			frag.Keyframe = t.Samples[0].Key
+		}
+
+		w.start("traf")
+		w.fullStart("tfhd", 0, 0x020000) // default-base-is-moof
+		w.u32(t.ID)
+		w.end()
+		w.fullStart("tfdt", 1, 0)
+		w.u64(uint64(t.Samples[0].Dts))
+		w.end()
+		// data offset, duration, size, flags and composition time offset
+		w.fullStart("trun", 1, 0x000F01)
+		w.u32(uint32(len(t.Samples)))
+		offsets = append(offsets, w.Len())
+		w.u32(0)
+		for _, s := range t.Samples {
+			w.u32(s.Duration)
+			w.u32(s.size())
+			if s.Key {
+				w.u32(sampleFlagsSync)
+			} else {
+				w.u32(sampleFlagsNonSync)
+			}
+			w.u32(uint32(s.Cts))
+			if e := s.Dts + s.Duration; e > end {
+				end = e
+			}
+		}
+		w.end()
+		w.end()
+	}
+	w.end()
+
+	dataOffset := w.Len() + 8
+	i := 0
+	for _, t := range tracks {
+		if len(t.Samples) == 0 {
+			continue
+		}
+		be.PutUint32(w.Bytes()[offsets[i]:], uint32(dataOffset))
+		for _, s := range t.Samples {
+			dataOffset += len(s.Data)
+		}
+		i++
+	}
+
+	w.start("mdat")
+	for _, t := range tracks {
+		for _, s := range t.Samples {
+			w.Write(s.Data)
+		}
+		t.Samples = nil
+	}
+	w.end()
+
+	frag.Duration = end - frag.Start
+	frag.Data = w.Bytes()
+	return frag
+}
+
+// Fragmenter remuxes FLV frames into an fMP4 init segment followed by
+// moof/mdat fragments, each starting at a video keyframe.
+type Fragmenter struct {
+	SkipVideo bool
+	SkipAudio bool
+	// MinDuration is the shortest fragment in ms; 0 cuts at every keyframe.
+	MinDuration uint32
+
+	// WriteInit receives the init segment, again whenever the codec
+	// configuration changes; WriteFragment receives every fragment.
+	WriteInit     func(init []byte, tracks []*Track) error
+	WriteFragment func(frag *Fragment) error
+
+	video       *Track
+	audio       *Track
+	videoHeader flv.Frame
+	audioHeader flv.Frame
+	initDone    bool
+	pending     []flv.Frame
+	keySeen     bool
+	started     bool
+	fragStart   uint32
+	seq         uint32
+}
+
+// Tracks returns the tracks of the current init segment.
+func (f *Fragmenter) Tracks() (tracks []*Track) {
+	for _, t := range []*Track{f.video, f.audio} {
+		if t != nil {
+			tracks = append(tracks, t)
+		}
+	}
+	return
+}
+
+// WriteFrame adds a frame; script data is ignored.
+func (f *Fragmenter) WriteFrame(fr flv.Frame) error {
+	switch fr.GetType() {
+	case flv.TAG_TYPE_VIDEO:
+		if f.SkipVideo {
+			return nil
+		}
+	case flv.TAG_TYPE_AUDIO:
+		if f.SkipAudio {
+			return nil
+		}
+	default:
+		return nil
+	}
+	if !f.initDone {
+		f.pending = append(f.pending, fr)
+		return f.init(false)
+	}
+	return f.add(fr)
+}
+
+// init writes the init segment once the configuration of every track is
+// known, or when forced.
+func (f *Fragmenter) init(force bool) error {
+	if len(f.pending) == 0 {
+		return nil
+	}
+	var videoSrc, audioSrc flv.Frame
+	for _, fr := range f.pending {
+		switch fr.(type) {
+		case flv.AVCVideoFrame:
+			if flv.IsSequenceHeader(fr) {
+				videoSrc = fr
+			}
+		case flv.VideoFrame:
+			return fmt.Errorf("mp4: %s video can not be carried in MP4", fr.(flv.VideoFrame).CodecId)
+		case flv.ExVideoFrame:
+			return fmt.Errorf("mp4: %s video can not be carried in MP4", fr.(flv.ExVideoFrame).FourCC)
+		case flv.ExAudioFrame:
+			return fmt.Errorf("mp4: %s audio can not be carried in MP4", fr.(flv.ExAudioFrame).FourCC)
+		case flv.AudioFrame:
+			if flv.IsSequenceHeader(fr) || audioSrc == nil && fr.(flv.AudioFrame).CodecId != flv.AUDIO_CODEC_AAC {
+				audioSrc = fr
+			}
+		}
+	}
+	first, last := f.pending[0].GetDts(), f.pending[len(f.pending)-1].GetDts()
+	waited := last >= first && last-first >= initTimeout
+	ready := (videoSrc != nil || f.SkipVideo) && (audioSrc != nil || f.SkipAudio)
+	if !ready && !waited && !force {
+		return nil
+	}
+
+	var id uint32
+	var err error
+	f.video, f.audio = nil, nil
+	if videoSrc != nil {
+		id++
+		if f.video, err = NewVideoTrack(id, videoSrc.(flv.AVCVideoFrame)); err != nil {
+			return err
+		}
+		f.videoHeader = videoSrc
+	}
+	if audioSrc != nil {
+		id++
+		if f.audio, err = NewAudioTrack(id, audioSrc.(flv.AudioFrame)); err != nil {
+			return err
+		}
+		if flv.IsSequenceHeader(audioSrc) {
+			f.audioHeader = audioSrc
+		}
+	}
+	if f.video == nil && f.audio == nil {
+		return nil
+	}
+	f.initDone = true
+	f.keySeen = false
+	if err = f.WriteInit(InitSegment(f.Tracks()), f.Tracks()); err != nil {
+		return err
+	}
+
+	pending := f.pending
+	f.pending = nil
+	for _, fr := range pending {
+		if err = f.add(fr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Fragmenter) add(fr flv.Frame) error {
+	isVideo := fr.GetType() == flv.TAG_TYPE_VIDEO
+	t := f.audio
+	if isVideo {
+		t = f.video
+	}
+
+	if flv.IsSequenceHeader(fr) {
+		if t == nil || t.SameConfig(fr) {
+			return nil
+		}
+		// new codec configuration: finish the fragment and start over
+		if err := f.emit(); err != nil {
+			return err
+		}
+		f.initDone = false
+		for _, h := range []flv.Frame{f.videoHeader, f.audioHeader} {
+			if h != nil && h.GetType() != fr.GetType() {
+				f.pending = append(f.pending, h)
+			}
+		}
+		f.pending = append(f.pending, fr)
+		return f.init(false)
+	}
+
+	s, ok := SampleOf(fr)
+	if !ok || t == nil {
+		return nil
+	}
+	if isVideo && !f.keySeen {
+		if !s.Key {
+			return nil
+		}
+		f.keySeen = true
+	}
+
+	cut := false
+	switch {
+	case f.video != nil:
+		cut = isVideo && s.Key && len(f.video.Samples) > 0 && s.Dts >= f.fragStart+f.MinDuration
+	default:
+		limit := f.MinDuration
+		if limit == 0 {
+			limit = defaultAudioFragment
+		}
+		cut = s.Dts >= f.fragStart+limit
+	}
+	if cut && f.started {
+		if n := len(t.Samples); n > 0 && s.Dts >= t.Samples[n-1].Dts {
+			t.Samples[n-1].Duration = s.Dts - t.Samples[n-1].Dts
+		}
+		if err := f.emit(); err != nil {
+			return err
+		}
+	}
+	if !f.started {
+		f.started = true
+		f.fragStart = s.Dts
+	}
+	t.addSample(s)
+	return nil
+}
+
+func (f *Fragmenter) emit() error {
+	if !f.started {
+		return nil
+	}
+	f.seq++
+	frag := buildFragment(f.seq, f.Tracks())
+	f.started = false
+	return f.WriteFragment(frag)
+}
+
+// Flush writes the samples buffered so far as the last fragment.
+func (f *Fragmenter) Flush() error {
+	if !f.initDone {
+		if err := f.init(true); err != nil {
+			return err
+		}
+	}
+	return f.emit()
+}
+
+// RemuxFragmented converts an FLV file into a fragmented MP4 written to w,
+// with a fragment starting at every keyframe.
+func RemuxFragmented(in *flv.FlvReader, w io.Writer) error {
+	if _, err := in.ReadHeader(); err != nil {
+		return err
+	}
+	inits := 0
+	f := &Fragmenter{
+		WriteInit: func(init []byte, tracks []*Track) error {
+			if inits++; inits > 1 {
+				return fmt.Errorf("mp4: codec configuration changes mid-stream")
+			}
+			_, err := w.Write(init)
+			return err
+		},
+		WriteFragment: func(frag *Fragment) error {
+			_, err := w.Write(frag.Data)
+			return err
+		},
+	}
+	for {
+		fr, rerr := in.ReadFrame()
+		if rerr != nil {
+			return rerr
+		}
+		if fr == nil {
+			break
+		}
+		if err := f.WriteFrame(fr); err != nil {
+			return err
+		}
+	}
+	return f.Flush()
+}
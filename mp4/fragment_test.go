@@ -0,0 +1,106 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/internal/flvtest"
+	"strings"
+	"testing"
+)
+
+type testBox struct {
+	typ     string
+	payload []byte
+}
+
+func splitBoxes(data []byte) (boxes []testBox) {
+	for len(data) >= 8 {
+		size := binary.BigEndian.Uint32(data)
+		if size < 8 || int(size) > len(data) {
+			break
+		}
+		boxes = append(boxes, testBox{string(data[4:8]), data[8:size]})
+		data = data[size:]
+	}
+	return
+}
+
+func TestFragmenter(t *testing.T) {
+	var init []byte
+	var frags []*Fragment
+	f := &Fragmenter{
+		WriteInit: func(data []byte, tracks []*Track) error {
+			init = data
+			return nil
+		},
+		WriteFragment: func(frag *Fragment) error {
+			frags = append(frags, frag)
+			return nil
+		},
+	}
+	for _, fr := range flvtest.Frames(2000) {
+		if err := f.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	boxes := splitBoxes(init)
+	if len(boxes) != 2 || boxes[0].typ != "ftyp" || boxes[1].typ != "moov" {
+		t.Fatalf("expect ftyp and moov got %v", boxes)
+	}
+	if !bytes.Contains(boxes[1].payload, append([]byte("avcC"), flvtest.AVCConf...)) {
+		t.Errorf("avcC not found in moov")
+	}
+	if !bytes.Contains(boxes[1].payload, []byte("esds")) || !bytes.Contains(boxes[1].payload, []byte("mvex")) {
+		t.Errorf("esds or mvex not found in moov")
+	}
+
+	if len(frags) != 2 {
+		t.Fatalf("expect 2 fragments got %d", len(frags))
+	}
+	for i, frag := range frags {
+		if frag.Start != uint32(i)*1000 || frag.Duration != 1000 || !frag.Keyframe {
+			t.Errorf("fragment %d: unexpected start %d duration %d", i, frag.Start, frag.Duration)
+		}
+		boxes := splitBoxes(frag.Data)
+		if len(boxes) != 2 || boxes[0].typ != "moof" || boxes[1].typ != "mdat" {
+			t.Fatalf("expect moof and mdat got %v", boxes)
+		}
+		trafs := splitBoxes(boxes[0].payload[16:])
+		video := splitBoxes(trafs[0].payload)
+		trun := video[2].payload
+		if video[2].typ != "trun" || binary.BigEndian.Uint32(trun[4:]) != 25 {
+			t.Fatalf("expect 25 video samples")
+		}
+		offset := binary.BigEndian.Uint32(trun[8:])
+		first := frag.Data[offset : offset+6]
+		if !bytes.Equal(first, []byte{0, 0, 0, 2, 0x65, byte(i * 25)}) {
+			t.Errorf("fragment %d: data offset points to %x", i, first)
+		}
+		if cts := binary.BigEndian.Uint32(trun[12+12:]); cts != 40 {
+			t.Errorf("fragment %d: expect composition offset 40 got %d", i, cts)
+		}
+	}
+}
+
+func TestFragmenterUnsupported(t *testing.T) {
+	hevc := flv.NewExVideoFrame(0, flv.VIDEO_FRAME_TYPE_KEYFRAME, flv.VIDEO_PACKET_TYPE_CODED_FRAMES_X, flv.FOURCC_HEVC, 0, []byte{0, 0, 0, 1, 0x26})
+	opus := flv.NewExAudioFrame(0, flv.AUDIO_PACKET_TYPE_CODED_FRAMES, flv.FOURCC_OPUS, []byte{0xFC})
+	for _, fr := range []flv.Frame{hevc, opus} {
+		f := &Fragmenter{
+			WriteInit:     func([]byte, []*Track) error { return nil },
+			WriteFragment: func(*Fragment) error { return nil },
+		}
+		err := f.WriteFrame(fr)
+		if err == nil {
+			err = f.Flush()
+		}
+		if err == nil || !strings.Contains(err.Error(), "can not be carried in MP4") {
+			t.Errorf("expect unsupported codec error for %s got %v", fr, err)
+		}
+	}
+}
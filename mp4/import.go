@@ -0,0 +1,169 @@
+package mp4
+
+import (
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"strings"
+)
+
+func (m *Movie) track(handler string) *Track {
+	for _, t := range m.Tracks {
+		if t.Handler == handler {
+			return t
+		}
+	}
+	return nil
+}
+
+// MetaData describes the movie as an onMetaData tag.
+func (m *Movie) MetaData() *flv.MetaData {
+	md := &flv.MetaData{Duration: float64(m.Duration) / 1000, Extra: map[string]interface{}{}}
+	if t := m.track("vide"); t != nil {
+		md.HasVideo = true
+		md.VideoCodecId = flv.VIDEO_CODEC_AVC
+		md.Width, md.Height = t.Width, t.Height
+		if d := t.duration(); d > 0 {
+			md.FrameRate = float64(len(t.Samples)) * 1000 / float64(d)
+		}
+	}
+	if t := m.track("soun"); t != nil {
+		md.HasAudio = true
+		md.AudioCodecId = flv.AUDIO_CODEC_MP3
+		if t.AudioConf != nil {
+			md.AudioCodecId = flv.AUDIO_CODEC_AAC
+		}
+		md.AudioSampleRate = t.SampleRate
+		md.AudioSampleSize = flv.AUDIO_SIZE_16BIT
+		md.Stereo = t.Channels > 1
+	}
+	if len(m.Brands) > 0 {
+		md.Extra["major_brand"] = m.Brands[0]
+		md.Extra["compatible_brands"] = strings.Join(m.Brands[1:], "")
+	}
+	for k, v := range m.Tags {
+		md.Extra[k] = v
+	}
+	return md
+}
+
+func videoTag(t *Track, dts uint32, cts int32, key bool, packetType flv.AvcPacketType, data []byte) flv.Frame {
+	frameType, flavor := flv.VIDEO_FRAME_TYPE_INTER_FRAME, flv.FRAME
+	if key {
+		frameType, flavor = flv.VIDEO_FRAME_TYPE_KEYFRAME, flv.KEYFRAME
+	}
+	body := append([]byte{
+		byte(frameType)<<4 | byte(flv.VIDEO_CODEC_AVC), byte(packetType),
+		byte(cts >> 16), byte(cts >> 8), byte(cts),
+	}, data...)
+	vFrame := &flv.VideoFrame{
+		CFrame:  &flv.CFrame{Type: flv.TAG_TYPE_VIDEO, Dts: dts, Flavor: flavor, Body: body},
+		CodecId: flv.VIDEO_CODEC_AVC,
+		Width:   t.Width,
+		Height:  t.Height,
+	}
+	return flv.AVCVideoFrame{VideoFrame: vFrame, PacketType: packetType}
+}
+
+func audioTag(t *Track, dts uint32, header bool, data []byte) flv.Frame {
+	codec, rate, channels := flv.AUDIO_CODEC_AAC, flv.AUDIO_RATE_44, flv.AUDIO_TYPE_STEREO
+	if t.AudioConf == nil {
+		// MP3 decoders take the real rate from the frame headers
+		switch {
+		case t.SampleRate == 8000:
+			codec, rate = flv.AUDIO_CODEC_MP3_8KHZ, flv.AUDIO_RATE_5_5
+		case t.SampleRate <= 5512:
+			codec, rate = flv.AUDIO_CODEC_MP3, flv.AUDIO_RATE_5_5
+		case t.SampleRate <= 11025:
+			codec, rate = flv.AUDIO_CODEC_MP3, flv.AUDIO_RATE_11
+		case t.SampleRate <= 22050:
+			codec, rate = flv.AUDIO_CODEC_MP3, flv.AUDIO_RATE_22
+		default:
+			codec = flv.AUDIO_CODEC_MP3
+		}
+		if t.Channels == 1 {
+			channels = flv.AUDIO_TYPE_MONO
+		}
+	}
+	body := []byte{byte(codec)<<4 | byte(rate)<<2 | byte(flv.AUDIO_SIZE_16BIT)<<1 | byte(channels)}
+	if codec == flv.AUDIO_CODEC_AAC {
+		packetType := flv.AUDIO_AAC_RAW
+		if header {
+			packetType = flv.AUDIO_AAC_SEQUENCE_HEADER
+		}
+		body = append(body, byte(packetType))
+	}
+	return flv.AudioFrame{
+		CFrame:   &flv.CFrame{Type: flv.TAG_TYPE_AUDIO, Dts: dts, Flavor: flv.FRAME, Body: append(body, data...)},
+		CodecId:  codec,
+		Rate:     t.SampleRate,
+		BitSize:  flv.AUDIO_SIZE_16BIT,
+		Channels: channels,
+	}
+}
+
+// WriteFLV writes the movie as an FLV stream: the onMetaData tag, the
+// sequence headers and the samples of both tracks interleaved by DTS.
+func (m *Movie) WriteFLV(out *flv.FlvWriter) error {
+	video, audio := m.track("vide"), m.track("soun")
+	if video == nil && audio == nil {
+		return fmt.Errorf("mp4: no audio or video track")
+	}
+	md := m.MetaData()
+	if err := out.WriteHeader(flv.NewHeader(md.HasAudio, md.HasVideo)); err != nil {
+		return err
+	}
+	if err := out.WriteFrame(md.Frame()); err != nil {
+		return err
+	}
+	if video != nil {
+		if err := out.WriteFrame(videoTag(video, 0, 0, true, flv.VIDEO_AVC_SEQUENCE_HEADER, video.AVCConf)); err != nil {
+			return err
+		}
+	}
+	if audio != nil && audio.AudioConf != nil {
+		if err := out.WriteFrame(audioTag(audio, 0, true, audio.AudioConf.Bytes())); err != nil {
+			return err
+		}
+	}
+
+	var vs, as []Sample
+	if video != nil {
+		vs = video.Samples
+	}
+	if audio != nil {
+		as = audio.Samples
+	}
+	for len(vs) > 0 || len(as) > 0 {
+		var fr flv.Frame
+		if len(as) == 0 || len(vs) > 0 && vs[0].Dts+video.delay <= as[0].Dts+audio.delay {
+			data, err := m.ReadSample(&vs[0])
+			if err != nil {
+				return err
+			}
+			fr = videoTag(video, vs[0].Dts+video.delay, vs[0].Cts, vs[0].Key, flv.VIDEO_AVC_NALU, data)
+			vs = vs[1:]
+		} else {
+			data, err := m.ReadSample(&as[0])
+			if err != nil {
+				return err
+			}
+			fr = audioTag(audio, as[0].Dts+audio.delay, false, data)
+			as = as[1:]
+		}
+		if err := out.WriteFrame(fr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemuxToFLV converts an MP4 or QuickTime file with AVC video and AAC or MP3
+// audio into FLV.
+func RemuxToFLV(r io.ReadSeeker, out *flv.FlvWriter) error {
+	m, err := ReadMovie(r)
+	if err != nil {
+		return err
+	}
+	return m.WriteFLV(out)
+}
@@ -0,0 +1,122 @@
+package mp4
+
+import (
+	"bytes"
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/internal/flvtest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemuxToFLV(t *testing.T) {
+	var movie bytes.Buffer
+	if err := RemuxProgressive(flvtest.WriteFLV(t, flvtest.Frames(2000)), &movie); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.flv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RemuxToFLV(bytes.NewReader(movie.Bytes()), flv.NewWriter(f)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	got := flvtest.ReadFLV(t, path)
+
+	meta, ok := got[0].(flv.MetaFrame)
+	if !ok || meta.Name() != "onMetaData" {
+		t.Fatalf("expect onMetaData first got %s", got[0])
+	}
+	props := meta.Properties()
+	if props["duration"] != 2.0 || props["videocodecid"] != 7.0 || props["major_brand"] != "isom" {
+		t.Errorf("unexpected metadata %v", props)
+	}
+
+	// the progressive MP4 keeps every frame of the source
+	want := flvtest.Frames(2000)
+	got = got[1:]
+	if len(got) != len(want) {
+		t.Fatalf("expect %d frames got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].GetType() != want[i].GetType() || got[i].GetDts() != want[i].GetDts() ||
+			!bytes.Equal(*got[i].GetBody(), *want[i].GetBody()) {
+			t.Errorf("frame %d: expect %s got %s", i, want[i], got[i])
+		}
+	}
+}
+
+func TestReadMovieBadSampleCount(t *testing.T) {
+	var movie bytes.Buffer
+	if err := RemuxProgressive(flvtest.WriteFLV(t, flvtest.Frames(2000)), &movie); err != nil {
+		t.Fatal(err)
+	}
+	// a fixed sample size with billions of samples
+	data := movie.Bytes()
+	i := bytes.Index(data, []byte("stsz"))
+	if i < 0 {
+		t.Fatal("no stsz box")
+	}
+	copy(data[i+8:], []byte{0, 0, 0, 1, 0xFF, 0xFF, 0xFF, 0xF0})
+	if _, err := ReadMovie(bytes.NewReader(data)); err == nil {
+		t.Errorf("expect an error for %d samples", 0xFFFFFFF0)
+	}
+}
+
+func TestReadMovieBadSizes(t *testing.T) {
+	var movie bytes.Buffer
+	if err := RemuxProgressive(flvtest.WriteFLV(t, flvtest.Frames(2000)), &movie); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		box   string
+		at    int
+		value []byte
+	}{
+		{"moov", -8, []byte{0x7F, 0xFF, 0xFF, 0xF0}}, // box size
+		{"stco", 8, []byte{0xFF, 0xFF, 0xFF, 0x00}},  // first chunk offset
+		{"stsz", 12, []byte{0x7F, 0xFF, 0xFF, 0xF0}}, // first sample size
+	} {
+		data := append([]byte{}, movie.Bytes()...)
+		i := bytes.Index(data, []byte(c.box))
+		if i < 0 {
+			t.Fatalf("no %s box", c.box)
+		}
+		copy(data[i+4+c.at:], c.value)
+		if _, err := ReadMovie(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: expect an error for % x", c.box, c.value)
+		}
+	}
+}
+
+func TestReadMovieHighSampleRate(t *testing.T) {
+	// AAC LC at 96kHz stereo
+	frames := flvtest.Frames(1000)
+	frames[1] = flvtest.Audio(0, flv.AUDIO_AAC_SEQUENCE_HEADER, []byte{0x10, 0x10})
+	var movie bytes.Buffer
+	if err := RemuxProgressive(flvtest.WriteFLV(t, frames), &movie); err != nil {
+		t.Fatal(err)
+	}
+	data := movie.Bytes()
+	i := bytes.Index(data, []byte("mp4a"))
+	if i < 0 {
+		t.Fatal("no mp4a box")
+	}
+	if !bytes.Equal(data[i+12:i+14], []byte{0, 1}) || !bytes.Equal(data[i+28:i+32], []byte{0, 0, 0, 0}) ||
+		!bytes.Equal(data[i+32:i+48], []byte{0, 0, 0, 16, 's', 'r', 'a', 't', 0, 0, 0, 0, 0, 1, 0x77, 0}) {
+		t.Errorf("expect a version 1 sample entry with a srat box got % x", data[i:i+48])
+	}
+	m, err := ReadMovie(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tr := range m.Tracks {
+		if !tr.IsVideo() && tr.SampleRate != 96000 {
+			t.Errorf("expect 96000Hz got %d", tr.SampleRate)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package mp4
+
+import (
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"math"
+)
+
+type sampleRef struct {
+	track *Track
+	index int
+}
+
+func writeEdts(w *boxWriter, t *Track) {
+	if len(t.Samples) == 0 {
+		return
+	}
+	// the earliest composition time starts the presentation
+	first := t.Samples[0].Dts
+	mediaTime := int64(math.MaxInt64)
+	for _, s := range t.Samples {
+		if ct := int64(s.Dts-first) + int64(s.Cts); ct < mediaTime {
+			mediaTime = ct
+		}
+	}
+
+	w.start("edts")
+	w.fullStart("elst", 0, 0)
+	if t.delay > 0 {
+		w.u32(2)
+		w.u32(t.delay)
+		w.u32(0xFFFFFFFF) // empty edit
+		w.u32(0x00010000)
+	} else {
+		w.u32(1)
+	}
+	w.u32(t.duration())
+	w.u32(uint32(mediaTime))
+	w.u32(0x00010000)
+	w.end()
+	w.end()
+}
+
+func writeSampleTables(w *boxWriter, t *Track) {
+	type run struct {
+		count uint32
+		value uint32
+	}
+	runs := func(value func(s *Sample) uint32) (rs []run) {
+		for i := range t.Samples {
+			v := value(&t.Samples[i])
+			if n := len(rs); n > 0 && rs[n-1].value == v {
+				rs[n-1].count++
+			} else {
+				rs = append(rs, run{1, v})
+			}
+		}
+		return
+	}
+
+	w.fullStart("stts", 0, 0)
+	stts := runs(func(s *Sample) uint32 { return s.Duration })
+	w.u32(uint32(len(stts)))
+	for _, r := range stts {
+		w.u32(r.count)
+		w.u32(r.value)
+	}
+	w.end()
+
+	hasCts, negativeCts, allKey := false, false, true
+	for _, s := range t.Samples {
+		hasCts = hasCts || s.Cts != 0
+		negativeCts = negativeCts || s.Cts < 0
+		allKey = allKey && s.Key
+	}
+	if hasCts {
+		version := byte(0)
+		if negativeCts {
+			version = 1
+		}
+		w.fullStart("ctts", version, 0)
+		ctts := runs(func(s *Sample) uint32 { return uint32(s.Cts) })
+		w.u32(uint32(len(ctts)))
+		for _, r := range ctts {
+			w.u32(r.count)
+			w.u32(r.value)
+		}
+		w.end()
+	}
+
+	if !allKey {
+		var keys []uint32
+		for i, s := range t.Samples {
+			if s.Key {
+				keys = append(keys, uint32(i+1))
+			}
+		}
+		w.fullStart("stss", 0, 0)
+		w.u32(uint32(len(keys)))
+		for _, k := range keys {
+			w.u32(k)
+		}
+		w.end()
+	}
+
+	type stscEntry struct {
+		firstChunk uint32
+		samples    uint32
+	}
+	var stsc []stscEntry
+	for i, c := range t.chunks {
+		if n := len(stsc); n == 0 || stsc[n-1].samples != uint32(c.samples) {
+			stsc = append(stsc, stscEntry{uint32(i + 1), uint32(c.samples)})
+		}
+	}
+	w.fullStart("stsc", 0, 0)
+	w.u32(uint32(len(stsc)))
+	for _, e := range stsc {
+		w.u32(e.firstChunk)
+		w.u32(e.samples)
+		w.u32(1) // sample_description_index
+	}
+	w.end()
+
+	w.fullStart("stsz", 0, 0)
+	w.u32(0)
+	w.u32(uint32(len(t.Samples)))
+	for i := range t.Samples {
+		w.u32(t.Samples[i].size())
+	}
+	w.end()
+
+	large := false
+	for _, c := range t.chunks {
+		large = large || c.offset > math.MaxUint32
+	}
+	if large {
+		w.fullStart("co64", 0, 0)
+	} else {
+		w.fullStart("stco", 0, 0)
+	}
+	w.u32(uint32(len(t.chunks)))
+	for _, c := range t.chunks {
+		if large {
+			w.u64(c.offset)
+		} else {
+			w.u32(uint32(c.offset))
+		}
+	}
+	w.end()
+}
+
+// readSamples indexes the samples of in without keeping their payload.
+func readSamples(in *flv.FlvReader) (tracks []*Track, refs []sampleRef, err error) {
+	if _, err = in.ReadHeader(); err != nil {
+		return nil, nil, err
+	}
+	var video, audio *Track
+	for {
+		fr, rerr := in.ReadFrame()
+		if rerr != nil {
+			return nil, nil, rerr
+		}
+		if fr == nil {
+			break
+		}
+
+		var t *Track
+		switch f := fr.(type) {
+		case flv.VideoFrame:
+			return nil, nil, fmt.Errorf("mp4: %s video can not be carried in MP4", f.CodecId)
+		case flv.ExVideoFrame:
+			return nil, nil, fmt.Errorf("mp4: %s video can not be carried in MP4", f.FourCC)
+		case flv.ExAudioFrame:
+			return nil, nil, fmt.Errorf("mp4: %s audio can not be carried in MP4", f.FourCC)
+		case flv.AVCVideoFrame:
+			if flv.IsSequenceHeader(f) {
+				if video == nil {
+					if video, err = NewVideoTrack(uint32(len(tracks)+1), f); err != nil {
+						return nil, nil, err
+					}
+					tracks = append(tracks, video)
+				} else if !video.SameConfig(f) {
+					return nil, nil, fmt.Errorf("mp4: AVC configuration changes @%d", f.Position)
+				}
+				continue
+			}
+			t = video
+		case flv.AudioFrame:
+			if audio == nil && (flv.IsSequenceHeader(f) || f.CodecId != flv.AUDIO_CODEC_AAC) {
+				if audio, err = NewAudioTrack(uint32(len(tracks)+1), f); err != nil {
+					return nil, nil, err
+				}
+				tracks = append(tracks, audio)
+			} else if audio != nil && flv.IsSequenceHeader(f) && !audio.SameConfig(f) {
+				return nil, nil, fmt.Errorf("mp4: AAC configuration changes @%d", f.Position)
+			}
+			t = audio
+		}
+
+		s, ok := SampleOf(fr)
+		if !ok || t == nil {
+			continue
+		}
+		if t.IsVideo() && len(t.Samples) == 0 && !s.Key {
+			continue
+		}
+		s.length, s.position, s.trackId, s.Data = uint32(len(s.Data)), flv.PositionOf(fr), flv.TrackId(fr), nil
+		t.addSample(s)
+		refs = append(refs, sampleRef{t, len(t.Samples) - 1})
+	}
+	return tracks, refs, nil
+}
+
+// RemuxProgressive converts an FLV file into a non-fragmented MP4 with the
+// moov box ahead of the media data, so playback can start while the file is
+// downloaded. Only AVC video and AAC or MP3 audio can be carried.
+func RemuxProgressive(in *flv.FlvReader, w io.Writer) error {
+	tracks, refs, err := readSamples(in)
+	if err != nil {
+		return err
+	}
+	if len(tracks) == 0 {
+		return fmt.Errorf("mp4: no audio or video to remux")
+	}
+
+	var movieStart uint32 = math.MaxUint32
+	for _, t := range tracks {
+		if len(t.Samples) > 0 && t.Samples[0].Dts < movieStart {
+			movieStart = t.Samples[0].Dts
+		}
+		if n := len(t.Samples); n > 0 && t.Samples[n-1].Duration == 0 {
+			t.Samples[n-1].Duration = t.defaultDuration()
+		}
+	}
+	for _, t := range tracks {
+		if len(t.Samples) > 0 {
+			t.delay = t.Samples[0].Dts - movieStart
+		}
+	}
+
+	var dataSize uint64
+	var prev *Track
+	for _, ref := range refs {
+		t := ref.track
+		if t != prev {
+			t.chunks = append(t.chunks, chunk{offset: dataSize})
+		}
+		t.chunks[len(t.chunks)-1].samples++
+		dataSize += uint64(t.Samples[ref.index].size())
+		prev = t
+	}
+
+	ftyp := &boxWriter{}
+	ftyp.start("ftyp")
+	ftyp.WriteString("isom")
+	ftyp.u32(512)
+	ftyp.WriteString("isomiso2avc1mp41")
+	ftyp.end()
+
+	mdatHeader := uint64(8)
+	if dataSize+8 > math.MaxUint32 {
+		mdatHeader = 16
+	}
+	// moov grows if chunk offsets need 64 bits once shifted behind it
+	moovSize, shift := 0, uint64(0)
+	var moov *boxWriter
+	for {
+		moov = &boxWriter{}
+		writeMoov(moov, tracks, false)
+		if moov.Len() == moovSize {
+			break
+		}
+		moovSize = moov.Len()
+		delta := uint64(ftyp.Len()+moovSize) + mdatHeader - shift
+		for _, t := range tracks {
+			for i := range t.chunks {
+				t.chunks[i].offset += delta
+			}
+		}
+		shift += delta
+	}
+
+	for _, b := range [][]byte{ftyp.Bytes(), moov.Bytes()} {
+		if _, err = w.Write(b); err != nil {
+			return err
+		}
+	}
+	mdat := &boxWriter{}
+	if mdatHeader == 16 {
+		mdat.u32(1)
+		mdat.WriteString("mdat")
+		mdat.u64(dataSize + 16)
+	} else {
+		mdat.u32(uint32(dataSize + 8))
+		mdat.WriteString("mdat")
+	}
+	if _, err = w.Write(mdat.Bytes()); err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		s := ref.track.Samples[ref.index]
+		fr, rerr := in.ReadTrackAt(s.position, s.trackId)
+		if rerr != nil {
+			return rerr
+		}
+		data, ok := SampleOf(fr)
+		if !ok || uint32(len(data.Data)) != s.length {
+			return fmt.Errorf("mp4: frame @%d changed while remuxing", s.position)
+		}
+		if _, err = w.Write(data.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
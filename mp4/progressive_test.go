@@ -0,0 +1,94 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/internal/flvtest"
+	"strings"
+	"testing"
+)
+
+// findBox returns the payload of the first box along path.
+func findBox(data []byte, path ...string) []byte {
+	for _, typ := range path {
+		found := false
+		for _, b := range splitBoxes(data) {
+			if b.typ == typ {
+				data, found = b.payload, true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return data
+}
+
+func TestRemuxProgressive(t *testing.T) {
+	var out bytes.Buffer
+	if err := RemuxProgressive(flvtest.WriteFLV(t, flvtest.Frames(2000)), &out); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+	boxes := splitBoxes(data)
+	if len(boxes) != 3 || boxes[0].typ != "ftyp" || boxes[1].typ != "moov" || boxes[2].typ != "mdat" {
+		t.Fatalf("expect ftyp, moov and mdat got %v", boxes)
+	}
+	moov := boxes[1].payload
+	if findBox(moov, "mvex") != nil {
+		t.Errorf("unexpected mvex in progressive moov")
+	}
+	if d := binary.BigEndian.Uint32(findBox(moov, "mvhd")[16:]); d != 2000 {
+		t.Errorf("expect movie duration 2000 got %d", d)
+	}
+
+	traks := splitBoxes(moov[108:])
+	if len(traks) != 2 {
+		t.Fatalf("expect 2 traks got %d", len(traks))
+	}
+	stbl := findBox(traks[0].payload, "mdia", "minf", "stbl")
+	stss := findBox(stbl, "stss")
+	if stss == nil || binary.BigEndian.Uint32(stss[4:]) != 2 || binary.BigEndian.Uint32(stss[12:]) != 26 {
+		t.Errorf("expect keyframes 1 and 26 in stss")
+	}
+	ctts := findBox(stbl, "ctts")
+	if ctts == nil || binary.BigEndian.Uint32(ctts[4:]) != 1 || binary.BigEndian.Uint32(ctts[12:]) != 40 {
+		t.Errorf("expect a single ctts run of 40")
+	}
+	if findBox(stbl, "stsz") == nil || binary.BigEndian.Uint32(findBox(stbl, "stsz")[8:]) != 50 {
+		t.Errorf("expect 50 video samples")
+	}
+
+	// the first video chunk starts with the first keyframe
+	stco := findBox(stbl, "stco")
+	offset := binary.BigEndian.Uint32(stco[8:])
+	if !bytes.Equal(data[offset:offset+6], []byte{0, 0, 0, 2, 0x65, 0}) {
+		t.Errorf("stco does not point at the first video sample: % x", data[offset:offset+6])
+	}
+	audio := findBox(traks[1].payload, "mdia", "minf", "stbl", "stco")
+	offset = binary.BigEndian.Uint32(audio[8:])
+	if !bytes.Equal(data[offset:offset+2], []byte{0x21, 0}) {
+		t.Errorf("stco does not point at the first audio sample: % x", data[offset:offset+2])
+	}
+}
+
+func TestRemuxProgressiveUnsupported(t *testing.T) {
+	nelly := flv.AudioFrame{
+		CFrame:  &flv.CFrame{Type: flv.TAG_TYPE_AUDIO, Flavor: flv.FRAME, Body: []byte{0x6E, 0x01, 0x02}},
+		CodecId: flv.AUDIO_CODEC_NELLYMOSER,
+	}
+	screen := flv.VideoFrame{
+		CFrame:  &flv.CFrame{Type: flv.TAG_TYPE_VIDEO, Flavor: flv.KEYFRAME, Body: []byte{0x13, 0x01, 0x02}},
+		CodecId: flv.VIDEO_CODEC_SCREENVIDEO,
+	}
+	hevc := flv.NewExVideoFrame(0, flv.VIDEO_FRAME_TYPE_KEYFRAME, flv.VIDEO_PACKET_TYPE_CODED_FRAMES_X, flv.FOURCC_HEVC, 0, []byte{0, 0, 0, 1, 0x26})
+	opus := flv.NewExAudioFrame(0, flv.AUDIO_PACKET_TYPE_CODED_FRAMES, flv.FOURCC_OPUS, []byte{0xFC})
+	for _, fr := range []flv.Frame{nelly, screen, hevc, opus} {
+		err := RemuxProgressive(flvtest.WriteFLV(t, []flv.Frame{fr}), &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "can not be carried in MP4") {
+			t.Errorf("expect unsupported codec error got %v", err)
+		}
+	}
+}
@@ -0,0 +1,593 @@
+package mp4
+
+import (
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"math"
+	"strings"
+)
+
+// iTunes-style metadata items and their onMetaData names.
+var tagNames = map[string]string{
+	"\xa9nam": "title",
+	"\xa9ART": "artist",
+	"\xa9alb": "album",
+	"\xa9day": "date",
+	"\xa9cmt": "comment",
+	"\xa9gen": "genre",
+	"\xa9too": "encoder",
+	"cprt":    "copyright",
+	"desc":    "description",
+}
+
+type box struct {
+	typ     string
+	payload []byte
+}
+
+// parseBoxes splits data into consecutive boxes; a truncated box ends the
+// list.
+func parseBoxes(data []byte) (boxes []box) {
+	for len(data) >= 8 {
+		size, header := uint64(be.Uint32(data)), uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return
+			}
+			size, header = be.Uint64(data[8:]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return
+		}
+		boxes = append(boxes, box{string(data[4:8]), data[header:size]})
+		data = data[size:]
+	}
+	return
+}
+
+// childBox returns the payload of the first box along path, or nil.
+func childBox(data []byte, path ...string) []byte {
+	for _, typ := range path {
+		var found []byte
+		for _, b := range parseBoxes(data) {
+			if b.typ == typ {
+				found = b.payload
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		data = found
+	}
+	return data
+}
+
+// table returns the entries of a full box holding an entry count followed
+// by n fixed size entries.
+func table(p []byte, name string, entrySize int) ([]byte, int, error) {
+	if len(p) < 8 {
+		return nil, 0, fmt.Errorf("mp4: %s box too short", name)
+	}
+	n := int(be.Uint32(p[4:]))
+	if n < 0 || (len(p)-8)/entrySize < n {
+		return nil, 0, fmt.Errorf("mp4: %s box holds less than %d entries", name, n)
+	}
+	return p[8:], n, nil
+}
+
+// Movie is the index of an MP4 or QuickTime file: its tracks with the
+// position of every sample, while the payloads stay in the file.
+type Movie struct {
+	Duration uint32   // ms
+	Brands   []string // major brand first
+	// Tags holds the iTunes-style metadata, e.g. "title" or "artist".
+	Tags   map[string]string
+	Tracks []*Track
+
+	r io.ReadSeeker
+}
+
+// ReadMovie reads the moov box of r. Only the first video and the first
+// audio track are read; they must be AVC, and AAC or MP3.
+func ReadMovie(r io.ReadSeeker) (*Movie, error) {
+	m := &Movie{Tags: map[string]string{}, r: r}
+	// the file size bounds the sample counts
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	fileSize, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var moov []byte
+	for pos := start; moov == nil; {
+		header := make([]byte, 16)
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("mp4: no moov box")
+			}
+			return nil, err
+		}
+		typ, size, headerSize := string(header[4:8]), uint64(be.Uint32(header)), uint64(8)
+		if size == 1 {
+			if _, err := io.ReadFull(r, header[8:]); err != nil {
+				return nil, err
+			}
+			size, headerSize = be.Uint64(header[8:]), 16
+		}
+		if size == 0 && typ != "moov" {
+			return nil, fmt.Errorf("mp4: no moov box")
+		}
+		if size != 0 && size < headerSize || size > math.MaxInt32 && (typ == "moov" || typ == "ftyp") {
+			return nil, fmt.Errorf("mp4: bad %q box size %d", typ, size)
+		}
+		if size > uint64(fileSize-pos) {
+			return nil, fmt.Errorf("mp4: %q box of %d bytes at %d in a file of %d", typ, size, pos, fileSize)
+		}
+		pos += int64(size)
+
+		switch typ {
+		case "ftyp", "moov":
+			var payload []byte
+			var err error
+			if size == 0 {
+				payload, err = io.ReadAll(r)
+			} else {
+				payload = make([]byte, size-headerSize)
+				_, err = io.ReadFull(r, payload)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if typ == "moov" {
+				moov = payload
+			} else if len(payload) >= 8 {
+				m.Brands = append(m.Brands, string(payload[:4]))
+				for b := payload[8:]; len(b) >= 4; b = b[4:] {
+					m.Brands = append(m.Brands, string(b[:4]))
+				}
+			}
+		default:
+			if _, err := r.Seek(int64(size-headerSize), io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	mvhd := childBox(moov, "mvhd")
+	if len(mvhd) < 32 {
+		return nil, fmt.Errorf("mp4: missing mvhd box")
+	}
+	movieTimescale := be.Uint32(mvhd[12:])
+	duration := uint64(be.Uint32(mvhd[16:]))
+	if mvhd[0] == 1 {
+		movieTimescale, duration = be.Uint32(mvhd[20:]), be.Uint64(mvhd[24:])
+	}
+	if movieTimescale == 0 {
+		return nil, fmt.Errorf("mp4: zero movie timescale")
+	}
+	m.Duration = uint32(duration * 1000 / uint64(movieTimescale))
+
+	var video, audio bool
+	for _, b := range parseBoxes(moov) {
+		switch b.typ {
+		case "trak":
+			handler := childBox(b.payload, "mdia", "hdlr")
+			if len(handler) < 12 {
+				continue
+			}
+			switch string(handler[8:12]) {
+			case "vide":
+				if video {
+					continue
+				}
+				video = true
+			case "soun":
+				if audio {
+					continue
+				}
+				audio = true
+			default:
+				continue
+			}
+			t, err := readTrak(b.payload, movieTimescale, fileSize)
+			if err != nil {
+				return nil, err
+			}
+			m.Tracks = append(m.Tracks, t)
+		case "udta":
+			m.readTags(b.payload)
+		}
+	}
+	return m, nil
+}
+
+// readTags collects the items of udta/meta/ilst; the meta box is a full box
+// in MP4 but not in QuickTime files.
+func (m *Movie) readTags(udta []byte) {
+	meta := childBox(udta, "meta")
+	if len(meta) < 4 {
+		return
+	}
+	ilst := childBox(meta[4:], "ilst")
+	if ilst == nil {
+		ilst = childBox(meta, "ilst")
+	}
+	for _, item := range parseBoxes(ilst) {
+		name, ok := tagNames[item.typ]
+		data := childBox(item.payload, "data")
+		// type indicator 1 is UTF-8 text
+		if ok && len(data) >= 8 && be.Uint32(data) == 1 {
+			m.Tags[name] = string(data[8:])
+		}
+	}
+}
+
+// readTrak builds a track with the timing and position of all samples.
+func readTrak(trak []byte, movieTimescale uint32, fileSize int64) (*Track, error) {
+	t := &Track{}
+	tkhd := childBox(trak, "tkhd")
+	mdhd := childBox(trak, "mdia", "mdhd")
+	hdlr := childBox(trak, "mdia", "hdlr")
+	stbl := childBox(trak, "mdia", "minf", "stbl")
+	if len(tkhd) < 24 || len(mdhd) < 24 || stbl == nil {
+		return nil, fmt.Errorf("mp4: incomplete trak box")
+	}
+	t.Handler = string(hdlr[8:12])
+	t.ID = be.Uint32(tkhd[12:])
+	timescale := be.Uint32(mdhd[12:])
+	if tkhd[0] == 1 {
+		t.ID = be.Uint32(tkhd[20:])
+	}
+	if mdhd[0] == 1 && len(mdhd) >= 32 {
+		timescale = be.Uint32(mdhd[20:])
+	}
+	if timescale == 0 {
+		return nil, fmt.Errorf("mp4: zero timescale in track %d", t.ID)
+	}
+
+	if err := readSampleEntry(t, childBox(stbl, "stsd")); err != nil {
+		return nil, err
+	}
+	if err := readSampleTables(t, stbl, timescale, fileSize); err != nil {
+		return nil, err
+	}
+
+	// leading empty edits delay the track
+	if elst := childBox(trak, "edts", "elst"); len(elst) >= 8 {
+		entrySize := 12
+		if elst[0] == 1 {
+			entrySize = 20
+		}
+		entries, n, err := table(elst, "elst", entrySize)
+		if err != nil {
+			return nil, err
+		}
+		var delay uint64
+		for i := 0; i < n; i++ {
+			e := entries[i*entrySize:]
+			if entrySize == 12 && int32(be.Uint32(e[4:])) == -1 {
+				delay += uint64(be.Uint32(e))
+			} else if entrySize == 20 && int64(be.Uint64(e[8:])) == -1 {
+				delay += be.Uint64(e)
+			} else {
+				break
+			}
+		}
+		t.delay = uint32(delay * 1000 / uint64(movieTimescale))
+	}
+	return t, nil
+}
+
+// readSampleEntry reads the codec configuration from the first sample
+// description.
+func readSampleEntry(t *Track, stsd []byte) error {
+	if len(stsd) < 8 {
+		return fmt.Errorf("mp4: missing stsd box")
+	}
+	entries := parseBoxes(stsd[8:])
+	if len(entries) == 0 {
+		return fmt.Errorf("mp4: empty stsd box")
+	}
+	entry := entries[0]
+
+	if t.IsVideo() {
+		if entry.typ != "avc1" && entry.typ != "avc3" || len(entry.payload) < 78 {
+			return fmt.Errorf("mp4: %q video can not be carried in FLV", entry.typ)
+		}
+		t.Width, t.Height = be.Uint16(entry.payload[24:]), be.Uint16(entry.payload[26:])
+		t.AVCConf = childBox(entry.payload[78:], "avcC")
+		if t.AVCConf == nil {
+			return fmt.Errorf("mp4: missing avcC box")
+		}
+		if rec, err := flv.ParseAVCConfRecord(t.AVCConf); err == nil && len(rec.RawSPSData) > 0 {
+			if sps, err := flv.ParseSPS(rec.RawSPSData[0]); err == nil && sps.Width() > 0 {
+				t.Width, t.Height = uint16(sps.Width()), uint16(sps.Height())
+			}
+		}
+		return nil
+	}
+
+	p := entry.payload
+	if len(p) < 28 {
+		return fmt.Errorf("mp4: %q sample entry too short", entry.typ)
+	}
+	t.Channels = be.Uint16(p[16:])
+	t.SampleRate = be.Uint32(p[24:]) >> 16
+	children := p[28:]
+	// QuickTime sound sample description versions 1 and 2, ISO ones have
+	// version 1 in a version 1 stsd and no extra fields
+	switch be.Uint16(p[8:]) {
+	case 1:
+		if stsd[0] == 1 {
+			if srat := childBox(children, "srat"); len(srat) >= 8 {
+				t.SampleRate = be.Uint32(srat[4:])
+			}
+			break
+		}
+		if len(p) < 44 {
+			return fmt.Errorf("mp4: %q sample entry too short", entry.typ)
+		}
+		children = p[44:]
+	case 2:
+		if len(p) < 64 {
+			return fmt.Errorf("mp4: %q sample entry too short", entry.typ)
+		}
+		t.SampleRate = uint32(math.Float64frombits(be.Uint64(p[32:])))
+		t.Channels = uint16(be.Uint32(p[40:]))
+		children = p[64:]
+	}
+
+	switch entry.typ {
+	case ".mp3":
+		t.ObjectType = objectTypeMP3
+		return nil
+	case "mp4a":
+		esds := childBox(children, "esds")
+		if esds == nil {
+			esds = childBox(children, "wave", "esds")
+		}
+		if len(esds) < 4 {
+			return fmt.Errorf("mp4: missing esds box")
+		}
+		return readEsds(t, esds[4:])
+	}
+	return fmt.Errorf("mp4: %q audio can not be carried in FLV", strings.TrimSpace(entry.typ))
+}
+
+// readDescriptor splits an MPEG-4 descriptor off data.
+func readDescriptor(data []byte) (tag byte, payload, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, fmt.Errorf("mp4: truncated descriptor")
+	}
+	tag = data[0]
+	n, i := 0, 1
+	for {
+		if i >= len(data) || i > 4 {
+			return 0, nil, nil, fmt.Errorf("mp4: truncated descriptor %#x", tag)
+		}
+		b := data[i]
+		i++
+		n = n<<7 | int(b&0x7F)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if n > len(data)-i {
+		return 0, nil, nil, fmt.Errorf("mp4: truncated descriptor %#x", tag)
+	}
+	return tag, data[i : i+n], data[i+n:], nil
+}
+
+func readEsds(t *Track, data []byte) error {
+	tag, es, _, err := readDescriptor(data)
+	if err != nil {
+		return err
+	}
+	if tag != 0x03 || len(es) < 3 {
+		return fmt.Errorf("mp4: bad ES descriptor")
+	}
+	flags := es[2]
+	es = es[3:]
+	skip := 0
+	if flags&0x80 != 0 { // dependsOn_ES_ID
+		skip += 2
+	}
+	if flags&0x40 != 0 && len(es) > skip { // URL
+		skip += 1 + int(es[skip])
+	}
+	if flags&0x20 != 0 { // OCR_ES_Id
+		skip += 2
+	}
+	if skip > len(es) {
+		return fmt.Errorf("mp4: bad ES descriptor")
+	}
+	es = es[skip:]
+	tag, dcd, _, err := readDescriptor(es)
+	if err != nil {
+		return err
+	}
+	if tag != 0x04 || len(dcd) < 13 {
+		return fmt.Errorf("mp4: bad decoder config descriptor")
+	}
+	t.ObjectType = dcd[0]
+	switch t.ObjectType {
+	case objectTypeAAC, 0x66, 0x67, 0x68: // MPEG-4, MPEG-2 AAC profiles
+		tag, dsi, _, err := readDescriptor(dcd[13:])
+		if err != nil || tag != 0x05 {
+			return fmt.Errorf("mp4: missing AAC decoder specific info")
+		}
+		if t.AudioConf, err = flv.ParseAudioSpecificConfig(dsi); err != nil {
+			return err
+		}
+		t.ObjectType = objectTypeAAC
+		t.SampleRate = t.AudioConf.SampleRate
+		if t.AudioConf.ChannelConfiguration != 0 {
+			t.Channels = uint16(t.AudioConf.ChannelConfiguration)
+		}
+	case objectTypeMP3, 0x69: // MPEG-1, MPEG-2 audio
+		t.ObjectType = objectTypeMP3
+	default:
+		return fmt.Errorf("mp4: audio object type %#x can not be carried in FLV", t.ObjectType)
+	}
+	return nil
+}
+
+// readSampleTables fills t.Samples from the sample tables, converting the
+// timestamps from the track timescale to ms. The samples must fit in the
+// fileSize bytes of the file.
+func readSampleTables(t *Track, stbl []byte, timescale uint32, fileSize int64) error {
+	stsz := childBox(stbl, "stsz")
+	if len(stsz) < 12 {
+		return fmt.Errorf("mp4: missing stsz box")
+	}
+	count := int(be.Uint32(stsz[8:]))
+	fixedSize := be.Uint32(stsz[4:])
+	if fixedSize == 0 && (len(stsz)-12)/4 < count {
+		return fmt.Errorf("mp4: stsz box holds less than %d entries", count)
+	}
+	if fixedSize != 0 && int64(count)*int64(fixedSize) > fileSize {
+		return fmt.Errorf("mp4: %d samples of %d bytes in a file of %d", count, fixedSize, fileSize)
+	}
+	samples := make([]Sample, count)
+	for i := range samples {
+		samples[i].length = fixedSize
+		if fixedSize == 0 {
+			samples[i].length = be.Uint32(stsz[12+i*4:])
+		}
+	}
+
+	ms := func(v uint64) uint32 { return uint32(v * 1000 / uint64(timescale)) }
+
+	// decoding times in the track timescale, with the end of the last sample
+	times := make([]uint64, count+1)
+	entries, n, err := table(childBox(stbl, "stts"), "stts", 8)
+	if err != nil {
+		return err
+	}
+	var delta uint64
+	i := 0
+	for e := 0; e < n && i < count; e++ {
+		delta = uint64(be.Uint32(entries[e*8+4:]))
+		for c := be.Uint32(entries[e*8:]); c > 0 && i < count; c-- {
+			times[i+1] = times[i] + delta
+			i++
+		}
+	}
+	for ; i < count; i++ {
+		times[i+1] = times[i] + delta
+	}
+	for i := range samples {
+		samples[i].Dts = ms(times[i])
+		samples[i].Duration = ms(times[i+1]) - samples[i].Dts
+	}
+
+	if ctts := childBox(stbl, "ctts"); ctts != nil {
+		entries, n, err := table(ctts, "ctts", 8)
+		if err != nil {
+			return err
+		}
+		i := 0
+		for e := 0; e < n && i < count; e++ {
+			// version 0 offsets are unsigned but commonly written negative
+			offset := int64(int32(be.Uint32(entries[e*8+4:])))
+			for c := be.Uint32(entries[e*8:]); c > 0 && i < count; c-- {
+				pts := int64(times[i]) + offset
+				samples[i].Cts = int32(pts*1000/int64(timescale) - int64(samples[i].Dts))
+				i++
+			}
+		}
+	}
+
+	if stss := childBox(stbl, "stss"); stss != nil {
+		entries, n, err := table(stss, "stss", 4)
+		if err != nil {
+			return err
+		}
+		for e := 0; e < n; e++ {
+			if k := int(be.Uint32(entries[e*4:])); k >= 1 && k <= count {
+				samples[k-1].Key = true
+			}
+		}
+	} else {
+		for i := range samples {
+			samples[i].Key = true
+		}
+	}
+
+	var offsets []uint64
+	if stco := childBox(stbl, "stco"); stco != nil {
+		entries, n, err := table(stco, "stco", 4)
+		if err != nil {
+			return err
+		}
+		for e := 0; e < n; e++ {
+			offsets = append(offsets, uint64(be.Uint32(entries[e*4:])))
+		}
+	} else if co64 := childBox(stbl, "co64"); co64 != nil {
+		entries, n, err := table(co64, "co64", 8)
+		if err != nil {
+			return err
+		}
+		for e := 0; e < n; e++ {
+			offsets = append(offsets, be.Uint64(entries[e*8:]))
+		}
+	} else {
+		return fmt.Errorf("mp4: missing stco box")
+	}
+
+	stsc, n, err := table(childBox(stbl, "stsc"), "stsc", 12)
+	if err != nil {
+		return err
+	}
+	i = 0
+	for e := 0; e < n && i < count; e++ {
+		first := int(be.Uint32(stsc[e*12:])) - 1
+		last := len(offsets)
+		if e+1 < n {
+			last = int(be.Uint32(stsc[(e+1)*12:])) - 1
+		}
+		perChunk := int(be.Uint32(stsc[e*12+4:]))
+		for c := first; c >= 0 && c < last && c < len(offsets) && i < count; c++ {
+			pos := offsets[c]
+			for k := 0; k < perChunk && i < count; k++ {
+				if pos+uint64(samples[i].length) > uint64(fileSize) {
+					return fmt.Errorf("mp4: sample %d of %d bytes at %d in a file of %d", i, samples[i].length, pos, fileSize)
+				}
+				samples[i].position = int64(pos)
+				pos += uint64(samples[i].length)
+				i++
+			}
+		}
+	}
+	if i < count {
+		return fmt.Errorf("mp4: chunk tables cover %d of %d samples", i, count)
+	}
+
+	t.Samples = samples
+	return nil
+}
+
+// ReadSample reads the payload of a sample of the movie.
+func (m *Movie) ReadSample(s *Sample) ([]byte, error) {
+	if s.Data != nil {
+		return s.Data, nil
+	}
+	if _, err := m.r.Seek(s.position, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, s.length)
+	if _, err := io.ReadFull(m.r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
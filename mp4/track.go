@@ -0,0 +1,425 @@
+package mp4
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+)
+
+const (
+	// FLV timestamps are in milliseconds and are used as they are.
+	timescale = 1000
+
+	objectTypeAAC = 0x40
+	objectTypeMP3 = 0x6B
+
+	sampleFlagsSync    = 0x02000000 // sample_depends_on = 2
+	sampleFlagsNonSync = 0x01010000 // sample_depends_on = 1, sample_is_non_sync_sample
+)
+
+// Sample is a single access unit of a track.
+type Sample struct {
+	Dts      uint32 // ms
+	Duration uint32 // ms
+	Cts      int32  // composition time offset, ms
+	Key      bool
+	Data     []byte
+
+	length   uint32 // payload size when Data is not kept in memory
+	position int64  // file position the payload is read from
+	trackId  byte   // in a multitrack tag
+}
+
+func (s *Sample) size() uint32 {
+	if s.Data != nil {
+		return uint32(len(s.Data))
+	}
+	return s.length
+}
+
+// Track describes an MP4 track built from FLV frames.
+type Track struct {
+	ID      uint32
+	Handler string // "vide" or "soun"
+
+	Width   uint16
+	Height  uint16
+	AVCConf []byte // AVCDecoderConfigurationRecord
+
+	ObjectType byte // esds objectTypeIndication
+	AudioConf  *flv.AudioSpecificConfig
+	SampleRate uint32
+	Channels   uint16
+
+	Samples []Sample
+
+	chunks []chunk
+	// delay of the first sample from the start of the movie, ms
+	delay uint32
+}
+
+// chunk is a run of consecutive samples of a track in the media data.
+type chunk struct {
+	samples int
+	offset  uint64
+}
+
+// IsVideo reports whether the track is a video track.
+func (t *Track) IsVideo() bool {
+	return t.Handler == "vide"
+}
+
+// NewVideoTrack creates a track from an AVC sequence header.
+func NewVideoTrack(id uint32, f flv.AVCVideoFrame) (*Track, error) {
+	if f.PacketType != flv.VIDEO_AVC_SEQUENCE_HEADER {
+		return nil, fmt.Errorf("mp4: AVC track must start with a sequence header")
+	}
+	conf := f.Data()
+	t := &Track{ID: id, Handler: "vide", AVCConf: conf, Width: f.Width, Height: f.Height}
+	if rec, err := flv.ParseAVCConfRecord(conf); err == nil && len(rec.RawSPSData) > 0 {
+		if sps, err := flv.ParseSPS(rec.RawSPSData[0]); err == nil && sps.Width() > 0 {
+			t.Width, t.Height = uint16(sps.Width()), uint16(sps.Height())
+		}
+	}
+	return t, nil
+}
+
+// NewAudioTrack creates a track from an AAC sequence header or the first
+// MP3 frame.
+func NewAudioTrack(id uint32, f flv.AudioFrame) (*Track, error) {
+	t := &Track{ID: id, Handler: "soun", SampleRate: f.Rate, Channels: 1}
+	if f.Channels == flv.AUDIO_TYPE_STEREO {
+		t.Channels = 2
+	}
+	switch f.CodecId {
+	case flv.AUDIO_CODEC_AAC:
+		if !flv.IsSequenceHeader(f) {
+			return nil, fmt.Errorf("mp4: AAC track must start with a sequence header")
+		}
+		conf, err := flv.ParseAudioSpecificConfig(f.Body[2:])
+		if err != nil {
+			return nil, err
+		}
+		t.ObjectType, t.AudioConf = objectTypeAAC, conf
+		t.SampleRate = conf.SampleRate
+		if conf.ChannelConfiguration != 0 {
+			t.Channels = uint16(conf.ChannelConfiguration)
+		}
+	case flv.AUDIO_CODEC_MP3, flv.AUDIO_CODEC_MP3_8KHZ:
+		t.ObjectType = objectTypeMP3
+		if f.CodecId == flv.AUDIO_CODEC_MP3_8KHZ {
+			t.SampleRate = 8000
+		}
+	default:
+		return nil, fmt.Errorf("mp4: %s audio can not be carried in MP4", f.CodecId)
+	}
+	if t.SampleRate == 44000 {
+		t.SampleRate = 44100
+	}
+	return t, nil
+}
+
+// Codec returns the RFC 6381 codecs parameter of the track, as used in
+// HLS and DASH manifests.
+func (t *Track) Codec() string {
+	if t.IsVideo() {
+		if rec, err := flv.ParseAVCConfRecord(t.AVCConf); err == nil {
+			return rec.Codec()
+		}
+		return "avc1"
+	}
+	if t.AudioConf != nil {
+		return t.AudioConf.Codec()
+	}
+	return "mp4a.6B"
+}
+
+// SameConfig reports whether the sequence header fr configures the track the
+// same way it is configured now.
+func (t *Track) SameConfig(fr flv.Frame) bool {
+	switch f := fr.(type) {
+	case flv.AVCVideoFrame:
+		return bytes.Equal(t.AVCConf, f.Data())
+	case flv.AudioFrame:
+		if t.AudioConf == nil {
+			return f.CodecId != flv.AUDIO_CODEC_AAC
+		}
+		return len(f.Body) > 2 && bytes.Equal(t.AudioConf.Bytes(), f.Body[2:])
+	}
+	return false
+}
+
+// SampleOf extracts the sample carried by a media frame; sequence headers
+// and frames without payload are not samples.
+func SampleOf(fr flv.Frame) (s Sample, ok bool) {
+	if flv.IsSequenceHeader(fr) {
+		return s, false
+	}
+	s.Dts = fr.GetDts()
+	switch f := fr.(type) {
+	case flv.AVCVideoFrame:
+		if f.PacketType != flv.VIDEO_AVC_NALU {
+			return s, false
+		}
+		s.Cts = f.CompositionTime()
+		s.Key = flv.IsKeyframe(f)
+		s.Data = f.Data()
+	case flv.AudioFrame:
+		s.Key = true
+		switch f.CodecId {
+		case flv.AUDIO_CODEC_AAC:
+			if len(f.Body) > 2 {
+				s.Data = f.Body[2:]
+			}
+		default:
+			if len(f.Body) > 1 {
+				s.Data = f.Body[1:]
+			}
+		}
+	}
+	return s, len(s.Data) > 0
+}
+
+// defaultDuration estimates the duration of the last sample of a track.
+func (t *Track) defaultDuration() uint32 {
+	if n := len(t.Samples); n > 1 {
+		return t.Samples[n-1].Dts - t.Samples[n-2].Dts
+	}
+	if !t.IsVideo() && t.SampleRate > 0 {
+		samples := uint32(1024)
+		if t.ObjectType == objectTypeMP3 {
+			samples = 1152
+		}
+		return samples * 1000 / t.SampleRate
+	}
+	return 40
+}
+
+// addSample appends s, completing the duration of the previous sample.
+func (t *Track) addSample(s Sample) {
+	if n := len(t.Samples); n > 0 && s.Dts >= t.Samples[n-1].Dts {
+		t.Samples[n-1].Duration = s.Dts - t.Samples[n-1].Dts
+	}
+	t.Samples = append(t.Samples, s)
+}
+
+// duration is the presentation time of the track in the movie, ms.
+func (t *Track) duration() uint32 {
+	n := len(t.Samples)
+	if n == 0 {
+		return 0
+	}
+	last := t.Samples[n-1]
+	return last.Dts + last.Duration - t.Samples[0].Dts
+}
+
+// writeMoov writes the movie box. With fragmented set the sample tables are
+// empty and an mvex box announces the fragments.
+func writeMoov(w *boxWriter, tracks []*Track, fragmented bool) {
+	var duration uint32
+	if !fragmented {
+		for _, t := range tracks {
+			if d := t.delay + t.duration(); d > duration {
+				duration = d
+			}
+		}
+	}
+
+	w.start("moov")
+	w.fullStart("mvhd", 0, 0)
+	w.u32(0) // creation_time
+	w.u32(0) // modification_time
+	w.u32(timescale)
+	w.u32(duration)
+	w.u32(0x00010000) // rate
+	w.u16(0x0100)     // volume
+	w.zeros(10)
+	w.matrix()
+	w.zeros(24) // pre_defined
+	w.u32(uint32(len(tracks) + 1))
+	w.end()
+
+	for _, t := range tracks {
+		writeTrak(w, t, fragmented)
+	}
+
+	if fragmented {
+		w.start("mvex")
+		for _, t := range tracks {
+			w.fullStart("trex", 0, 0)
+			w.u32(t.ID)
+			w.u32(1) // default_sample_description_index
+			w.u32(0) // default_sample_duration
+			w.u32(0) // default_sample_size
+			w.u32(0) // default_sample_flags
+			w.end()
+		}
+		w.end()
+	}
+	w.end()
+}
+
+func writeTrak(w *boxWriter, t *Track, fragmented bool) {
+	var duration uint32
+	if !fragmented {
+		duration = t.duration()
+	}
+
+	w.start("trak")
+	w.fullStart("tkhd", 0, 0x03) // enabled, in movie
+	w.u32(0)                     // creation_time
+	w.u32(0)                     // modification_time
+	w.u32(t.ID)
+	w.u32(0) // reserved
+	w.u32(t.delay + duration)
+	w.zeros(8)
+	w.u16(0) // layer
+	w.u16(0) // alternate_group
+	if t.IsVideo() {
+		w.u16(0)
+	} else {
+		w.u16(0x0100)
+	}
+	w.u16(0)
+	w.matrix()
+	w.u32(uint32(t.Width) << 16)
+	w.u32(uint32(t.Height) << 16)
+	w.end()
+
+	if !fragmented {
+		writeEdts(w, t)
+	}
+
+	w.start("mdia")
+	w.fullStart("mdhd", 0, 0)
+	w.u32(0) // creation_time
+	w.u32(0) // modification_time
+	w.u32(timescale)
+	w.u32(duration)
+	w.u16(0x55C4) // "und"
+	w.u16(0)
+	w.end()
+
+	w.fullStart("hdlr", 0, 0)
+	w.u32(0)
+	w.WriteString(t.Handler)
+	w.zeros(12)
+	if t.IsVideo() {
+		w.WriteString("VideoHandler\x00")
+	} else {
+		w.WriteString("SoundHandler\x00")
+	}
+	w.end()
+
+	w.start("minf")
+	if t.IsVideo() {
+		w.fullStart("vmhd", 0, 1)
+		w.zeros(8)
+		w.end()
+	} else {
+		w.fullStart("smhd", 0, 0)
+		w.zeros(4)
+		w.end()
+	}
+	w.start("dinf")
+	w.fullStart("dref", 0, 0)
+	w.u32(1)
+	w.fullStart("url ", 0, 1) // media in the same file
+	w.end()
+	w.end()
+	w.end()
+
+	w.start("stbl")
+	writeStsd(w, t)
+	if fragmented {
+		for _, typ := range []string{"stts", "stsc", "stco"} {
+			w.fullStart(typ, 0, 0)
+			w.u32(0)
+			w.end()
+		}
+		w.fullStart("stsz", 0, 0)
+		w.u32(0)
+		w.u32(0)
+		w.end()
+	} else {
+		writeSampleTables(w, t)
+	}
+	w.end()
+
+	w.end() // minf
+	w.end() // mdia
+	w.end() // trak
+}
+
+func writeStsd(w *boxWriter, t *Track) {
+	// the 16.16 samplerate field holds up to 65535 Hz, higher rates go to
+	// the srat box of a version 1 AudioSampleEntry
+	var version byte
+	if !t.IsVideo() && t.SampleRate > 0xFFFF {
+		version = 1
+	}
+	w.fullStart("stsd", version, 0)
+	w.u32(1)
+	if t.IsVideo() {
+		w.start("avc1")
+		w.zeros(6)
+		w.u16(1) // data_reference_index
+		w.zeros(16)
+		w.u16(t.Width)
+		w.u16(t.Height)
+		w.u32(0x00480000) // 72 dpi
+		w.u32(0x00480000)
+		w.u32(0)
+		w.u16(1) // frame_count
+		w.zeros(32)
+		w.u16(0x0018) // depth
+		w.u16(0xFFFF) // pre_defined = -1
+		w.start("avcC")
+		w.Write(t.AVCConf)
+		w.end()
+		w.end()
+	} else {
+		w.start("mp4a")
+		w.zeros(6)
+		w.u16(1)               // data_reference_index
+		w.u16(uint16(version)) // entry_version
+		w.zeros(6)
+		w.u16(t.Channels)
+		w.u16(16) // samplesize
+		w.u32(0)
+		if version == 0 {
+			w.u32(t.SampleRate << 16)
+		} else {
+			w.u32(0)
+			w.fullStart("srat", 0, 0)
+			w.u32(t.SampleRate)
+			w.end()
+		}
+		writeEsds(w, t)
+		w.end()
+	}
+	w.end()
+}
+
+func writeEsds(w *boxWriter, t *Track) {
+	dsi := &boxWriter{}
+	if t.AudioConf != nil {
+		dsi.descriptor(0x05, t.AudioConf.Bytes())
+	}
+	dcd := &boxWriter{}
+	dcd.u8(t.ObjectType)
+	dcd.u8(0x05<<2 | 1) // audio stream
+	dcd.u24(0)          // bufferSizeDB
+	dcd.u32(0)          // maxBitrate
+	dcd.u32(0)          // avgBitrate
+	dcd.Write(dsi.Bytes())
+	es := &boxWriter{}
+	es.u16(uint16(t.ID))
+	es.u8(0)
+	es.descriptor(0x04, dcd.Bytes())
+	es.descriptor(0x06, []byte{0x02})
+
+	w.fullStart("esds", 0, 0)
+	w.descriptor(0x03, es.Bytes())
+	w.end()
+}
@@ -0,0 +1,240 @@
+// Package screen decodes Screen Video frames of FLV files into images.
+package screen
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	colorDepthBGR     = 0
+	colorDepthPalette = 2
+)
+
+// Decoder rebuilds the frames of a Screen Video (v1) or Screen Video 2
+// stream: keyframes carry every block, inter frames only the changed ones.
+//
+// Of Screen Video 2 the 24 bit BGR blocks are decoded, with or without
+// diff rows; I-frame images, palette coded blocks and zlib priming are
+// not supported.
+type Decoder struct {
+	img *image.RGBA
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// header is the start of a Screen Video packet.
+type header struct {
+	blockWidth, blockHeight int
+	width, height           int
+}
+
+func parseHeader(data []byte) (h header, err error) {
+	if len(data) < 4 {
+		return h, fmt.Errorf("screen: packet header of %d bytes", len(data))
+	}
+	h.blockWidth = (int(data[0]>>4) + 1) * 16
+	h.width = int(data[0]&0x0F)<<8 | int(data[1])
+	h.blockHeight = (int(data[2]>>4) + 1) * 16
+	h.height = int(data[2]&0x0F)<<8 | int(data[3])
+	if h.width == 0 || h.height == 0 {
+		return h, fmt.Errorf("screen: image of %dx%d", h.width, h.height)
+	}
+	return h, nil
+}
+
+// Decode applies the blocks of a Screen Video tag and returns the frame.
+// The image is owned by the decoder and changes with the next frames.
+func (d *Decoder) Decode(f flv.VideoFrame) (*image.RGBA, error) {
+	if f.CodecId != flv.VIDEO_CODEC_SCREENVIDEO && f.CodecId != flv.VIDEO_CODEC_SCREENVIDEO2 {
+		return nil, fmt.Errorf("screen: %s is not screen video", f.CodecId)
+	}
+	if len(f.Body) < 1 {
+		return nil, fmt.Errorf("screen: empty video tag")
+	}
+	data := f.Body[1:]
+	h, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	data = data[4:]
+	v2 := f.CodecId == flv.VIDEO_CODEC_SCREENVIDEO2
+	if v2 {
+		if len(data) < 1 {
+			return nil, fmt.Errorf("screen: truncated packet header")
+		}
+		if data[0]&0x03 != 0 {
+			return nil, fmt.Errorf("screen: I-frame images and palettes are not supported")
+		}
+		data = data[1:]
+	}
+
+	rect := image.Rect(0, 0, h.width, h.height)
+	switch {
+	case f.Flavor == flv.KEYFRAME:
+		if d.img == nil || d.img.Rect != rect {
+			d.img = image.NewRGBA(rect)
+		}
+	case d.img == nil:
+		return nil, fmt.Errorf("screen: inter frame without keyframe")
+	case d.img.Rect != rect:
+		return nil, fmt.Errorf("screen: inter frame of %dx%d in %dx%d", h.width, h.height, d.img.Rect.Dx(), d.img.Rect.Dy())
+	}
+
+	// blocks go left to right, bottom to top
+	for y := 0; y < h.height; y += h.blockHeight {
+		for x := 0; x < h.width; x += h.blockWidth {
+			if len(data) < 2 {
+				return nil, fmt.Errorf("screen: truncated block at %d,%d", x, y)
+			}
+			size := int(data[0])<<8 | int(data[1])
+			data = data[2:]
+			if size == 0 {
+				continue
+			}
+			if len(data) < size {
+				return nil, fmt.Errorf("screen: block at %d,%d of %d bytes in %d", x, y, size, len(data))
+			}
+			b := block{x: x, y: y, width: min(h.blockWidth, h.width-x), height: min(h.blockHeight, h.height-y)}
+			b.rows = b.height
+			if err := b.decode(d.img, data[:size], v2); err != nil {
+				return nil, err
+			}
+			data = data[size:]
+		}
+	}
+	return d.img, nil
+}
+
+// block is a block of the grid, y counted from the bottom of the image.
+type block struct {
+	x, y          int
+	width, height int
+	start, rows   int // diff rows from the bottom of the block
+}
+
+func (b *block) decode(img *image.RGBA, data []byte, v2 bool) error {
+	if v2 {
+		flags := data[0]
+		data = data[1:]
+		if depth := flags >> 3 & 0x03; depth != colorDepthBGR {
+			return fmt.Errorf("screen: block at %d,%d: color depth %d is not supported", b.x, b.y, depth)
+		}
+		if flags&0x03 != 0 {
+			return fmt.Errorf("screen: block at %d,%d: zlib priming is not supported", b.x, b.y)
+		}
+		if flags&0x04 != 0 {
+			if len(data) < 2 {
+				return fmt.Errorf("screen: block at %d,%d: truncated diff rows", b.x, b.y)
+			}
+			b.start, b.rows = int(data[0]), int(data[1])
+			data = data[2:]
+			if b.start+b.rows > b.height {
+				return fmt.Errorf("screen: block at %d,%d: diff rows %d+%d of %d", b.x, b.y, b.start, b.rows, b.height)
+			}
+		}
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("screen: block at %d,%d: %s", b.x, b.y, err)
+	}
+	pixels, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return fmt.Errorf("screen: block at %d,%d: %s", b.x, b.y, err)
+	}
+	if len(pixels) < b.width*b.rows*3 {
+		return fmt.Errorf("screen: block at %d,%d: %d bytes of pixels for %dx%d", b.x, b.y, len(pixels), b.width, b.rows)
+	}
+	// rows go bottom to top, pixels are BGR
+	bottom := img.Rect.Dy() - 1 - b.y - b.start
+	for row := 0; row < b.rows; row++ {
+		line := img.Pix[img.PixOffset(b.x, bottom-row):]
+		for col := 0; col < b.width; col++ {
+			p := pixels[(row*b.width+col)*3:]
+			line[col*4], line[col*4+1], line[col*4+2], line[col*4+3] = p[2], p[1], p[0], 0xFF
+		}
+	}
+	return nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Snapshots decodes the screen video of in and calls snap with the frame
+// on screen at each of times, ascending ms; the image is only valid during
+// the call. Times before the first frame get the first frame, times past
+// the end the last one.
+func Snapshots(in *flv.FlvReader, times []uint32, snap func(ms uint32, img *image.RGBA) error) error {
+	if _, err := in.ReadHeader(); err != nil {
+		return err
+	}
+	d := NewDecoder()
+	var img *image.RGBA
+	next := 0
+	for next < len(times) {
+		fr, rerr := in.ReadFrame()
+		if rerr != nil {
+			return rerr
+		}
+		if fr == nil {
+			break
+		}
+		f, ok := fr.(flv.VideoFrame)
+		if !ok || (f.CodecId != flv.VIDEO_CODEC_SCREENVIDEO && f.CodecId != flv.VIDEO_CODEC_SCREENVIDEO2) {
+			continue
+		}
+		for ; img != nil && next < len(times) && times[next] < f.Dts; next++ {
+			if err := snap(times[next], img); err != nil {
+				return err
+			}
+		}
+		decoded, err := d.Decode(f)
+		if err != nil {
+			return fmt.Errorf("%s (tag at %d)", err, f.Position)
+		}
+		img = decoded
+	}
+	if img == nil {
+		return fmt.Errorf("screen: no screen video frames")
+	}
+	for ; next < len(times); next++ {
+		if err := snap(times[next], img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SavePNGs writes the snapshots at times as PNG files, named by the format
+// pattern from the time in ms, e.g. "lecture-%08d.png".
+func SavePNGs(in *flv.FlvReader, times []uint32, pattern string) error {
+	return Snapshots(in, times, func(ms uint32, img *image.RGBA) error {
+		out, err := os.Create(fmt.Sprintf(pattern, ms))
+		if err != nil {
+			return err
+		}
+		if err := WritePNG(out, img); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// WritePNG encodes img as PNG.
+func WritePNG(w io.Writer, img image.Image) error {
+	return png.Encode(w, img)
+}
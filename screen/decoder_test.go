@@ -0,0 +1,156 @@
+package screen
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{0xFF, 0, 0, 0xFF}
+	green = color.RGBA{0, 0xFF, 0, 0xFF}
+	blue  = color.RGBA{0, 0, 0xFF, 0xFF}
+	white = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+)
+
+// testBlock compresses n BGR pixels of c, after the v2 block header if any.
+func testBlock(c color.RGBA, n int, header ...byte) []byte {
+	var pixels, buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		pixels.Write([]byte{c.B, c.G, c.R})
+	}
+	zw := zlib.NewWriter(&buf)
+	zw.Write(pixels.Bytes())
+	zw.Close()
+	return append(header, buf.Bytes()...)
+}
+
+// testFrame builds a screen video tag of 16x16 blocks; nil blocks are
+// unchanged.
+func testFrame(dts uint32, codec flv.VideoCodec, key bool, width, height int, blocks ...[]byte) flv.VideoFrame {
+	frameType, flavor := flv.VIDEO_FRAME_TYPE_INTER_FRAME, flv.FRAME
+	if key {
+		frameType, flavor = flv.VIDEO_FRAME_TYPE_KEYFRAME, flv.KEYFRAME
+	}
+	body := []byte{byte(frameType)<<4 | byte(codec), byte(width >> 8), byte(width), byte(height >> 8), byte(height)}
+	if codec == flv.VIDEO_CODEC_SCREENVIDEO2 {
+		body = append(body, 0)
+	}
+	for _, b := range blocks {
+		body = append(body, byte(len(b)>>8), byte(len(b)))
+		body = append(body, b...)
+	}
+	return flv.VideoFrame{
+		CFrame:  &flv.CFrame{Type: flv.TAG_TYPE_VIDEO, Dts: dts, Flavor: flavor, Body: body},
+		CodecId: codec,
+	}
+}
+
+func expectPixel(t *testing.T, img image.Image, x, y int, c color.RGBA) {
+	t.Helper()
+	if got := img.At(x, y); got != c {
+		t.Errorf("expect %v at %d,%d got %v", c, x, y, got)
+	}
+}
+
+func TestDecodeScreenVideo(t *testing.T) {
+	d := NewDecoder()
+	// 20x20 in blocks of 16x16, 4x16, 16x4 and 4x4 from the bottom left
+	img, err := d.Decode(testFrame(0, flv.VIDEO_CODEC_SCREENVIDEO, true, 20, 20,
+		testBlock(red, 256), testBlock(green, 64), testBlock(blue, 64), testBlock(white, 16)))
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	if img.Rect.Dx() != 20 || img.Rect.Dy() != 20 {
+		t.Fatalf("expect 20x20 got %v", img.Rect)
+	}
+	expectPixel(t, img, 0, 19, red)
+	expectPixel(t, img, 15, 4, red)
+	expectPixel(t, img, 16, 19, green)
+	expectPixel(t, img, 0, 0, blue)
+	expectPixel(t, img, 19, 0, white)
+
+	img, err = d.Decode(testFrame(40, flv.VIDEO_CODEC_SCREENVIDEO, false, 20, 20, nil, nil, nil, testBlock(red, 16)))
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	expectPixel(t, img, 19, 0, red)
+	expectPixel(t, img, 0, 0, blue)
+	expectPixel(t, img, 16, 19, green)
+}
+
+func TestDecodeScreenVideo2(t *testing.T) {
+	d := NewDecoder()
+	if _, err := d.Decode(testFrame(0, flv.VIDEO_CODEC_SCREENVIDEO2, true, 16, 16, testBlock(blue, 256, 0))); err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	// rows 2 to 4 from the bottom
+	img, err := d.Decode(testFrame(40, flv.VIDEO_CODEC_SCREENVIDEO2, false, 16, 16, testBlock(green, 48, 0x04, 2, 3)))
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	expectPixel(t, img, 0, 14, blue)
+	expectPixel(t, img, 0, 13, green)
+	expectPixel(t, img, 15, 11, green)
+	expectPixel(t, img, 0, 10, blue)
+
+	if _, err := d.Decode(testFrame(80, flv.VIDEO_CODEC_SCREENVIDEO2, false, 16, 16, testBlock(green, 256, 0x10))); err == nil {
+		t.Errorf("expect palette blocks to be rejected")
+	}
+	if _, err := NewDecoder().Decode(testFrame(0, flv.VIDEO_CODEC_SCREENVIDEO, false, 16, 16, testBlock(red, 256))); err == nil {
+		t.Errorf("expect inter frame without keyframe to be rejected")
+	}
+}
+
+func TestSavePNGs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "in.flv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := flv.NewWriter(f)
+	if err := w.WriteHeader(flv.NewHeader(false, true)); err != nil {
+		t.Fatal(err)
+	}
+	for _, fr := range []flv.VideoFrame{
+		testFrame(100, flv.VIDEO_CODEC_SCREENVIDEO, true, 16, 16, testBlock(red, 256)),
+		testFrame(200, flv.VIDEO_CODEC_SCREENVIDEO, false, 16, 16, testBlock(green, 256)),
+	} {
+		if err := w.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	in, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	pattern := filepath.Join(dir, "snap-%d.png")
+	if err := SavePNGs(flv.NewReader(in), []uint32{0, 150, 200, 500}, pattern); err != nil {
+		t.Fatalf("snapshot error: %s", err)
+	}
+	for ms, c := range map[uint32]color.RGBA{0: red, 150: red, 200: green, 500: green} {
+		out, err := os.Open(fmt.Sprintf(pattern, ms))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(out)
+		out.Close()
+		if err != nil {
+			t.Fatalf("png error: %s", err)
+		}
+		if got := color.RGBAModel.Convert(img.At(8, 8)); got != c {
+			t.Errorf("expect %v at %d ms got %v", c, ms, got)
+		}
+	}
+}
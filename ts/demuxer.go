@@ -0,0 +1,504 @@
+package ts
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"io"
+	"os"
+)
+
+const (
+	wrap = 1 << 33
+
+	// frames buffered per stream while waiting for the other stream to
+	// interleave by DTS
+	maxPending = 500
+)
+
+type pesStream struct {
+	pid        uint16
+	streamType byte
+	buf        []byte
+	length     int // PES_packet_length, 0 if unbounded
+	pending    []pendingFrame
+}
+
+// pendingFrame is a frame with its unwrapped 90kHz DTS, waiting to be
+// interleaved.
+type pendingFrame struct {
+	dts   int64
+	frame flv.Frame
+}
+
+// Demuxer reads a transport stream and produces FLV frames: H.264 as AVC
+// with sequence headers built from the in-band SPS/PPS, AAC from ADTS and
+// MP3. Frames of both streams come out interleaved by DTS.
+type Demuxer struct {
+	r       io.Reader
+	pmtPID  int
+	streams map[uint16]*pesStream
+	video   *pesStream
+	audio   *pesStream
+	eof     bool
+
+	haveRef  bool
+	ref      int64 // last unwrapped DTS
+	haveBase bool
+	base     int64 // unwrapped DTS of FLV time 0
+
+	sps, pps [][]byte
+	width    uint16
+	height   uint16
+	aacConf  *flv.AudioSpecificConfig
+}
+
+func NewDemuxer(r io.Reader) *Demuxer {
+	return &Demuxer{r: r, pmtPID: -1, streams: map[uint16]*pesStream{}}
+}
+
+// HasVideo and HasAudio report the streams announced by the PMT.
+func (d *Demuxer) HasVideo() bool {
+	return d.video != nil
+}
+
+func (d *Demuxer) HasAudio() bool {
+	return d.audio != nil
+}
+
+// ReadFrame returns the next frame, or nil at the end of the stream.
+func (d *Demuxer) ReadFrame() (flv.Frame, error) {
+	for {
+		if fr := d.next(); fr != nil {
+			return fr, nil
+		}
+		if d.eof {
+			return nil, nil
+		}
+		if err := d.readPacket(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// next pops the frame with the lowest DTS once every active stream has a
+// frame pending, or at the end of the stream.
+func (d *Demuxer) next() flv.Frame {
+	var first *pesStream
+	for _, s := range []*pesStream{d.video, d.audio} {
+		if s == nil {
+			continue
+		}
+		if len(s.pending) == 0 {
+			if !d.eof && !d.overflow() {
+				return nil
+			}
+			continue
+		}
+		if first == nil || s.pending[0].dts < first.pending[0].dts {
+			first = s
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	p := first.pending[0]
+	first.pending = first.pending[1:]
+	if !d.haveBase {
+		d.haveBase, d.base = true, p.dts
+	}
+	ms := (p.dts - d.base) / 90
+	if ms < 0 {
+		ms = 0
+	}
+	p.frame.SetDts(uint32(ms))
+	return p.frame
+}
+
+func (d *Demuxer) overflow() bool {
+	for _, s := range []*pesStream{d.video, d.audio} {
+		if s != nil && len(s.pending) > maxPending {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Demuxer) readPacket() error {
+	p := make([]byte, packetSize)
+	if _, err := io.ReadFull(d.r, p); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			d.eof = true
+			for _, s := range []*pesStream{d.video, d.audio} {
+				if s != nil {
+					if err := d.flushPES(s); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+		return err
+	}
+	if p[0] != 0x47 {
+		return fmt.Errorf("ts: lost sync, %#x instead of 0x47", p[0])
+	}
+	if p[1]&0x80 != 0 { // transport_error_indicator
+		return nil
+	}
+	pid := uint16(p[1]&0x1F)<<8 | uint16(p[2])
+	pusi := p[1]&0x40 != 0
+	payload := p[4:]
+	if p[3]&0x20 != 0 {
+		if int(payload[0]) >= len(payload) {
+			return nil
+		}
+		payload = payload[1+int(payload[0]):]
+	}
+	if p[3]&0x10 == 0 {
+		return nil
+	}
+
+	switch {
+	case pid == patPID:
+		if pusi {
+			d.readPAT(payload)
+		}
+	case int(pid) == d.pmtPID:
+		if pusi {
+			d.readPMT(payload)
+		}
+	default:
+		s := d.streams[pid]
+		if s == nil {
+			return nil
+		}
+		if pusi {
+			if err := d.flushPES(s); err != nil {
+				return err
+			}
+			if len(payload) >= 6 {
+				s.length = int(payload[4])<<8 | int(payload[5])
+			}
+			s.buf = append(s.buf[:0], payload...)
+		} else if len(s.buf) > 0 {
+			s.buf = append(s.buf, payload...)
+		}
+		if s.length > 0 && len(s.buf) >= s.length+6 {
+			return d.flushPES(s)
+		}
+	}
+	return nil
+}
+
+// psi returns the section following the pointer field, without CRC.
+func psi(payload []byte, tableId byte) []byte {
+	if len(payload) < 1 || int(payload[0])+1 > len(payload) {
+		return nil
+	}
+	section := payload[1+int(payload[0]):]
+	if len(section) < 12 || section[0] != tableId {
+		return nil
+	}
+	n := int(section[1]&0x0F)<<8 | int(section[2])
+	if n < 9 || 3+n > len(section) {
+		return nil
+	}
+	return section[:3+n-4]
+}
+
+func (d *Demuxer) readPAT(payload []byte) {
+	section := psi(payload, 0x00)
+	if section == nil {
+		return
+	}
+	for entries := section[8:]; len(entries) >= 4; entries = entries[4:] {
+		program := uint16(entries[0])<<8 | uint16(entries[1])
+		if program != 0 {
+			d.pmtPID = int(entries[2]&0x1F)<<8 | int(entries[3])
+			return
+		}
+	}
+}
+
+func (d *Demuxer) readPMT(payload []byte) {
+	section := psi(payload, 0x02)
+	if section == nil {
+		return
+	}
+	infoLength := int(section[10]&0x0F)<<8 | int(section[11])
+	if 12+infoLength > len(section) {
+		return
+	}
+	for es := section[12+infoLength:]; len(es) >= 5; {
+		streamType := es[0]
+		pid := uint16(es[1]&0x1F)<<8 | uint16(es[2])
+		n := int(es[3]&0x0F)<<8 | int(es[4])
+		if 5+n > len(es) {
+			return
+		}
+		es = es[5+n:]
+		if d.streams[pid] != nil {
+			continue
+		}
+		s := &pesStream{pid: pid, streamType: streamType}
+		switch streamType {
+		case streamTypeAVC:
+			if d.video != nil {
+				continue
+			}
+			d.video = s
+		case streamTypeAAC, streamTypeMP3, 0x04:
+			if d.audio != nil {
+				continue
+			}
+			d.audio = s
+		default:
+			continue
+		}
+		d.streams[pid] = s
+	}
+}
+
+// unwrap extends a 33-bit timestamp to the one closest to the last DTS.
+func (d *Demuxer) unwrap(ts int64) int64 {
+	if !d.haveRef {
+		d.haveRef, d.ref = true, ts
+		return ts
+	}
+	diff := (ts - d.ref) % wrap
+	if diff >= wrap/2 {
+		diff -= wrap
+	} else if diff < -wrap/2 {
+		diff += wrap
+	}
+	d.ref += diff
+	return d.ref
+}
+
+func readTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
+
+func (d *Demuxer) flushPES(s *pesStream) error {
+	pes, length := s.buf, s.length
+	s.buf, s.length = nil, 0
+	if len(pes) < 9 || !bytes.Equal(pes[:3], []byte{0, 0, 1}) {
+		return nil
+	}
+	headerEnd := 9 + int(pes[8])
+	if headerEnd > len(pes) || pes[7]&0x80 == 0 || len(pes) < 14 {
+		return nil
+	}
+	pts := readTimestamp(pes[9:])
+	dts := pts
+	if pes[7]&0x40 != 0 && len(pes) >= 19 {
+		dts = readTimestamp(pes[14:])
+	}
+	diff := (pts - dts) % wrap
+	if diff >= wrap/2 {
+		diff -= wrap
+	} else if diff < -wrap/2 {
+		diff += wrap
+	}
+	unwrapped := d.unwrap(dts)
+	data := pes[headerEnd:]
+	if length > 0 && 6+length < len(pes) && 6+length >= headerEnd {
+		data = pes[headerEnd : 6+length]
+	}
+
+	if s == d.video {
+		return d.videoFrames(s, unwrapped, int32(diff/90), data)
+	}
+	return d.audioFrames(s, unwrapped, data)
+}
+
+func (d *Demuxer) push(s *pesStream, dts int64, fr flv.Frame) {
+	s.pending = append(s.pending, pendingFrame{dts, fr})
+}
+
+func videoTag(cts int32, key bool, packetType flv.AvcPacketType, data []byte, width, height uint16) flv.Frame {
+	frameType, flavor := flv.VIDEO_FRAME_TYPE_INTER_FRAME, flv.FRAME
+	if key {
+		frameType, flavor = flv.VIDEO_FRAME_TYPE_KEYFRAME, flv.KEYFRAME
+	}
+	body := append([]byte{
+		byte(frameType)<<4 | byte(flv.VIDEO_CODEC_AVC), byte(packetType),
+		byte(cts >> 16), byte(cts >> 8), byte(cts),
+	}, data...)
+	vFrame := &flv.VideoFrame{
+		CFrame:  &flv.CFrame{Type: flv.TAG_TYPE_VIDEO, Flavor: flavor, Body: body},
+		CodecId: flv.VIDEO_CODEC_AVC,
+		Width:   width,
+		Height:  height,
+	}
+	return flv.AVCVideoFrame{VideoFrame: vFrame, PacketType: packetType}
+}
+
+func equalNALUs(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Demuxer) videoFrames(s *pesStream, dts int64, cts int32, data []byte) error {
+	var sps, pps, nalus [][]byte
+	key := false
+	for _, nalu := range flv.SplitAnnexB(data) {
+		switch flv.NALUTypeOf(nalu) {
+		case flv.NALU_TYPE_AUD:
+			continue
+		case flv.NALU_TYPE_SPS:
+			sps = append(sps, nalu)
+		case flv.NALU_TYPE_PPS:
+			pps = append(pps, nalu)
+		case flv.NALU_TYPE_IDR:
+			key = true
+		}
+		nalus = append(nalus, nalu)
+	}
+
+	if len(sps) > 0 && len(pps) > 0 && (!equalNALUs(sps, d.sps) || !equalNALUs(pps, d.pps)) {
+		d.sps, d.pps = sps, pps
+		if parsed, err := flv.ParseSPS(sps[0]); err == nil {
+			d.width, d.height = uint16(parsed.Width()), uint16(parsed.Height())
+		}
+		conf := flv.NewAVCConfRecord(sps, pps).Bytes()
+		d.push(s, dts, videoTag(0, true, flv.VIDEO_AVC_SEQUENCE_HEADER, conf, d.width, d.height))
+	}
+	// nothing decodes before the first SPS/PPS
+	if d.sps == nil || len(nalus) == 0 {
+		return nil
+	}
+
+	var avcc bytes.Buffer
+	for _, nalu := range nalus {
+		n := len(nalu)
+		avcc.Write([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+		avcc.Write(nalu)
+	}
+	d.push(s, dts, videoTag(cts, key, flv.VIDEO_AVC_NALU, avcc.Bytes(), d.width, d.height))
+	return nil
+}
+
+func audioTag(flags byte, data []byte) flv.AudioFrame {
+	return flv.AudioFrame{
+		CFrame:   &flv.CFrame{Type: flv.TAG_TYPE_AUDIO, Flavor: flv.FRAME, Body: append([]byte{flags}, data...)},
+		CodecId:  flv.AudioCodec(flags >> 4),
+		Rate:     44000,
+		BitSize:  flv.AUDIO_SIZE_16BIT,
+		Channels: flv.AudioType(flags & 0x01),
+	}
+}
+
+func (d *Demuxer) audioFrames(s *pesStream, dts int64, data []byte) error {
+	if s.streamType != streamTypeAAC {
+		// MP3: the real rate is in the frame headers
+		flags := byte(flv.AUDIO_CODEC_MP3)<<4 | byte(flv.AUDIO_RATE_44)<<2 | byte(flv.AUDIO_SIZE_16BIT)<<1 | byte(flv.AUDIO_TYPE_STEREO)
+		d.push(s, dts, audioTag(flags, data))
+		return nil
+	}
+
+	flags := byte(flv.AUDIO_CODEC_AAC)<<4 | byte(flv.AUDIO_RATE_44)<<2 | byte(flv.AUDIO_SIZE_16BIT)<<1 | byte(flv.AUDIO_TYPE_STEREO)
+	for frames := 0; len(data) > 0; frames++ {
+		conf, headerLength, frameLength, err := flv.ParseADTSHeader(data)
+		if err != nil || frameLength > len(data) {
+			// like lost packets, frames damaged by transport errors are
+			// dropped: go on from the next syncword
+			data = adtsSync(data[1:])
+			frames--
+			continue
+		}
+		frameDts := dts + int64(frames)*1024*90000/int64(conf.SampleRate)
+		if d.aacConf == nil || !bytes.Equal(d.aacConf.Bytes(), conf.Bytes()) {
+			d.aacConf = conf
+			d.push(s, frameDts, audioTag(flags, append([]byte{byte(flv.AUDIO_AAC_SEQUENCE_HEADER)}, conf.Bytes()...)))
+		}
+		d.push(s, frameDts, audioTag(flags, append([]byte{byte(flv.AUDIO_AAC_RAW)}, data[headerLength:frameLength]...)))
+		data = data[frameLength:]
+	}
+	return nil
+}
+
+// adtsSync returns data from its first ADTS syncword on, or nil.
+func adtsSync(data []byte) []byte {
+	for i := 0; i+1 < len(data); i++ {
+		if data[i] == 0xFF && data[i+1]&0xF0 == 0xF0 {
+			return data[i:]
+		}
+	}
+	return nil
+}
+
+// Import converts a transport stream into FLV. The onMetaData tag is
+// rewritten with the final duration once all frames are written.
+func Import(r io.Reader, out *flv.FlvWriter) error {
+	d := NewDemuxer(r)
+	fr, err := d.ReadFrame()
+	if err != nil {
+		return err
+	}
+	if fr == nil {
+		return fmt.Errorf("ts: no H.264, AAC or MP3 stream found")
+	}
+
+	md := &flv.MetaData{HasVideo: d.HasVideo(), HasAudio: d.HasAudio()}
+	if md.HasVideo {
+		md.VideoCodecId = flv.VIDEO_CODEC_AVC
+	}
+	if md.HasAudio {
+		md.AudioCodecId = flv.AUDIO_CODEC_MP3
+		if d.audio.streamType == streamTypeAAC {
+			md.AudioCodecId = flv.AUDIO_CODEC_AAC
+		}
+		md.AudioSampleSize = flv.AUDIO_SIZE_16BIT
+	}
+	if err = out.WriteHeader(flv.NewHeader(md.HasAudio, md.HasVideo)); err != nil {
+		return err
+	}
+	metaPos, err := out.OutFile.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return err
+	}
+	if err = out.WriteFrame(md.Frame()); err != nil {
+		return err
+	}
+
+	var end uint32
+	for fr != nil {
+		if err = out.WriteFrame(fr); err != nil {
+			return err
+		}
+		if fr.GetDts() > end {
+			end = fr.GetDts()
+		}
+		if fr, err = d.ReadFrame(); err != nil {
+			return err
+		}
+	}
+
+	md.Duration = float64(end) / 1000
+	md.Width, md.Height = d.width, d.height
+	if d.aacConf != nil {
+		md.AudioSampleRate = d.aacConf.SampleRate
+		md.Stereo = d.aacConf.ChannelConfiguration != 1
+	}
+	endPos, err := out.OutFile.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return err
+	}
+	if _, err = out.OutFile.Seek(metaPos, os.SEEK_SET); err != nil {
+		return err
+	}
+	if err = out.WriteFrame(md.Frame()); err != nil {
+		return err
+	}
+	_, err = out.OutFile.Seek(endPos, os.SEEK_SET)
+	return err
+}
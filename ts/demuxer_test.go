@@ -0,0 +1,167 @@
+package ts
+
+import (
+	"bytes"
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/internal/flvtest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func muxTestFrames(t *testing.T) []byte {
+	var out bytes.Buffer
+	m := NewMuxer(&out)
+	for _, fr := range flvtest.Frames(2000) {
+		if err := m.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out.Bytes()
+}
+
+func TestDemuxer(t *testing.T) {
+	d := NewDemuxer(bytes.NewReader(muxTestFrames(t)))
+	var video, audio []flv.Frame
+	var last uint32
+	for {
+		fr, err := d.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fr == nil {
+			break
+		}
+		if fr.GetDts() < last {
+			t.Errorf("DTS goes back from %d to %d", last, fr.GetDts())
+		}
+		last = fr.GetDts()
+		if fr.GetType() == flv.TAG_TYPE_VIDEO {
+			video = append(video, fr)
+		} else {
+			audio = append(audio, fr)
+		}
+	}
+	if !d.HasVideo() || !d.HasAudio() {
+		t.Errorf("expect video and audio streams")
+	}
+	if len(video) != 51 || len(audio) != 101 {
+		t.Fatalf("expect 51 video and 101 audio frames got %d and %d", len(video), len(audio))
+	}
+
+	sps, pps := []byte{0x67, 0x42}, []byte{0x68, 0xCE}
+	conf := flv.NewAVCConfRecord([][]byte{sps}, [][]byte{pps}).Bytes()
+	if !bytes.Equal(*video[0].GetBody(), append([]byte{0x17, 0, 0, 0, 0}, conf...)) {
+		t.Errorf("unexpected sequence header % x", *video[0].GetBody())
+	}
+	// the trailing zero of the IDR is indistinguishable from Annex B padding
+	idr := []byte{0x17, 1, 0, 0, 40, 0, 0, 0, 2, 0x67, 0x42, 0, 0, 0, 2, 0x68, 0xCE, 0, 0, 0, 1, 0x65}
+	if !bytes.Equal(*video[1].GetBody(), idr) {
+		t.Errorf("expect SPS, PPS and IDR in AVCC got % x", *video[1].GetBody())
+	}
+	if !bytes.Equal(*video[2].GetBody(), []byte{0x27, 1, 0, 0, 40, 0, 0, 0, 2, 0x41, 1}) || video[2].GetDts() != 40 {
+		t.Errorf("unexpected frame at %d: % x", video[2].GetDts(), *video[2].GetBody())
+	}
+	if flv.FlavorOf(video[26]) != flv.KEYFRAME || video[26].GetDts() != 1000 {
+		t.Errorf("expect keyframe at 1000 got %s", video[26])
+	}
+
+	if !bytes.Equal(*audio[0].GetBody(), []byte{0xAF, 0, 0x12, 0x10}) {
+		t.Errorf("unexpected AAC sequence header % x", *audio[0].GetBody())
+	}
+	for i, fr := range audio[1:] {
+		if fr.GetDts() != uint32(i*20) || !bytes.Equal(*fr.GetBody(), []byte{0xAF, 1, 0x21, byte(i)}) {
+			t.Errorf("unexpected audio frame at %d: % x", fr.GetDts(), *fr.GetBody())
+		}
+	}
+}
+
+func TestDemuxerUnwrap(t *testing.T) {
+	d := NewDemuxer(nil)
+	for _, c := range []struct{ ts, want int64 }{
+		{wrap - 90, wrap - 90},
+		{45, wrap + 45},
+		{wrap - 10, wrap - 10},
+		{900, wrap + 900},
+	} {
+		if got := d.unwrap(c.ts); got != c.want {
+			t.Errorf("unwrap(%d): expect %d got %d", c.ts, c.want, got)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.flv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Import(bytes.NewReader(muxTestFrames(t)), flv.NewWriter(f)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	in, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	r := flv.NewReader(in)
+	if _, err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	fr, err := r.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, ok := fr.(flv.MetaFrame)
+	if !ok || meta.Name() != "onMetaData" {
+		t.Fatalf("expect onMetaData first got %s", fr)
+	}
+	props := meta.Properties()
+	if props["duration"] != 1.98 || props["videocodecid"] != 7.0 || props["audiocodecid"] != 10.0 ||
+		props["audiosamplerate"] != 44100.0 || props["stereo"] != true {
+		t.Errorf("unexpected metadata %v", props)
+	}
+	frames := 0
+	for {
+		fr, err := r.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fr == nil {
+			break
+		}
+		frames++
+	}
+	if frames != 152 {
+		t.Errorf("expect 152 frames got %d", frames)
+	}
+}
+
+func TestDemuxerDamagedADTS(t *testing.T) {
+	conf, err := flv.ParseAudioSpecificConfig([]byte{0x12, 0x10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	data = append(data, 0x00, 0x01) // lost start of a frame
+	data = append(append(data, conf.ADTSHeader(2)...), 0x21, 0x00)
+	data = append(data, 0xFF, 0xF1, 0x3C, 0x80, 0x02, 0x1F, 0xFC) // bad sampling frequency index
+	data = append(append(data, conf.ADTSHeader(2)...), 0x21, 0x01)
+	data = append(data, conf.ADTSHeader(100)...) // truncated
+
+	d := NewDemuxer(nil)
+	s := &pesStream{streamType: streamTypeAAC}
+	if err := d.audioFrames(s, 0, data); err != nil {
+		t.Fatalf("demux error: %s", err)
+	}
+	if len(s.pending) != 3 {
+		t.Fatalf("expect sequence header and 2 frames got %d", len(s.pending))
+	}
+	for i, p := range s.pending[1:] {
+		if !bytes.Equal(*p.frame.GetBody(), []byte{0xAF, 1, 0x21, byte(i)}) || p.dts != int64(i)*1024*90000/44100 {
+			t.Errorf("unexpected frame at %d: % x", p.dts, *p.frame.GetBody())
+		}
+	}
+}
@@ -0,0 +1,353 @@
+// Package ts remuxes FLV into MPEG-2 transport streams (ISO/IEC 13818-1).
+package ts
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/metachord/flv.go/flv"
+	"io"
+)
+
+const (
+	packetSize    = 188
+	programNumber = 1
+
+	patPID   = 0x0000
+	pmtPID   = 0x1000
+	videoPID = 0x0100
+	audioPID = 0x0101
+
+	streamTypeMP3 = 0x03
+	streamTypeAAC = 0x0F
+	streamTypeAVC = 0x1B
+
+	// PTS and DTS run ahead of the PCR by pcrDelay so decoders can fill
+	// their buffers, 90kHz
+	timestampOffset = 90 * 1400
+	pcrDelay        = 90 * 700
+
+	// longest time between PCRs and between PAT/PMT repetitions, ms
+	pcrInterval   = 40
+	tableInterval = 500
+)
+
+type stream struct {
+	pid        uint16
+	streamId   byte
+	streamType byte
+	cc         byte
+}
+
+// Muxer writes FLV frames as transport stream packets: AVC as Annex B with
+// an AUD and the SPS/PPS on every IDR, AAC as ADTS and MP3 as is.
+type Muxer struct {
+	w       io.Writer
+	video   *stream
+	audio   *stream
+	avcConf *flv.AVCConfRecord
+	aacConf *flv.AudioSpecificConfig
+
+	patCC         byte
+	pmtCC         byte
+	version       byte
+	tablesWritten bool
+	tablesDts     uint32
+	pcrWritten    bool // to the current writer
+	pcrStarted    bool // to any writer
+	pcrDts        uint32
+}
+
+func NewMuxer(w io.Writer) *Muxer {
+	return &Muxer{w: w}
+}
+
+// SetWriter directs the following packets to w, starting with PAT, PMT and
+// a PCR. Continuity counters and the PCR carry on.
+func (m *Muxer) SetWriter(w io.Writer) {
+	m.w = w
+	m.tablesWritten = false
+	m.pcrWritten = false
+}
+
+func (m *Muxer) streams() (streams []*stream) {
+	for _, s := range []*stream{m.video, m.audio} {
+		if s != nil {
+			streams = append(streams, s)
+		}
+	}
+	return
+}
+
+func (m *Muxer) pcrStream() *stream {
+	if m.video != nil {
+		return m.video
+	}
+	return m.audio
+}
+
+func (m *Muxer) pcrPID() uint16 {
+	if s := m.pcrStream(); s != nil {
+		return s.pid
+	}
+	return 0x1FFF
+}
+
+// useStream announces the stream in a new PMT version when it is new or
+// changes its type.
+func (m *Muxer) useStream(s *stream, pid uint16, streamId, streamType byte) *stream {
+	if s == nil {
+		s = &stream{pid: pid, streamId: streamId}
+	}
+	if s.streamType != streamType {
+		s.streamType = streamType
+		m.version++
+		m.tablesWritten = false
+	}
+	return s
+}
+
+// WriteFrame writes the packets of a frame; script data is ignored.
+func (m *Muxer) WriteFrame(fr flv.Frame) error {
+	if len(*fr.GetBody()) == 0 {
+		return nil
+	}
+	switch f := fr.(type) {
+	case flv.AVCVideoFrame:
+		return m.writeVideo(f)
+	case flv.VideoFrame:
+		return fmt.Errorf("ts: %s video can not be carried in MPEG-TS", f.CodecId)
+	case flv.ExVideoFrame:
+		return fmt.Errorf("ts: %s video can not be carried in MPEG-TS", f.FourCC)
+	case flv.AudioFrame:
+		return m.writeAudio(f)
+	case flv.ExAudioFrame:
+		return fmt.Errorf("ts: %s audio can not be carried in MPEG-TS", f.FourCC)
+	}
+	return nil
+}
+
+func (m *Muxer) writeVideo(f flv.AVCVideoFrame) error {
+	switch f.PacketType {
+	case flv.VIDEO_AVC_SEQUENCE_HEADER:
+		conf, err := flv.ParseAVCConfRecord(f.Data())
+		if err != nil {
+			return err
+		}
+		m.avcConf = conf
+		m.video = m.useStream(m.video, videoPID, 0xE0, streamTypeAVC)
+		return nil
+	case flv.VIDEO_AVC_NALU:
+		if m.avcConf == nil {
+			return fmt.Errorf("ts: AVC frame @%d before sequence header", f.Position)
+		}
+		nalus, err := flv.SplitAVCC(f.Data(), m.avcConf.NALULengthSize())
+		if err != nil {
+			return err
+		}
+		hasIDR, hasSPS := false, false
+		units := [][]byte{{byte(flv.NALU_TYPE_AUD), 0xF0}}
+		for _, nalu := range nalus {
+			switch flv.NALUTypeOf(nalu) {
+			case flv.NALU_TYPE_AUD:
+				continue
+			case flv.NALU_TYPE_IDR:
+				hasIDR = true
+			case flv.NALU_TYPE_SPS:
+				hasSPS = true
+			}
+			units = append(units, nalu)
+		}
+		if hasIDR && !hasSPS {
+			params := append(append([][]byte{}, m.avcConf.RawSPSData...), m.avcConf.RawPPSData...)
+			units = append(units[:1], append(params, units[1:]...)...)
+		}
+		var es bytes.Buffer
+		if err = flv.WriteAnnexB(&es, units); err != nil {
+			return err
+		}
+		return m.writePES(m.video, f.Dts, f.CompositionTime(), flv.IsKeyframe(f), es.Bytes())
+	}
+	return nil
+}
+
+func (m *Muxer) writeAudio(f flv.AudioFrame) error {
+	var es []byte
+	switch f.CodecId {
+	case flv.AUDIO_CODEC_AAC:
+		if len(f.Body) < 2 {
+			return nil
+		}
+		if flv.IsSequenceHeader(f) {
+			conf, err := flv.ParseAudioSpecificConfig(f.Body[2:])
+			if err != nil {
+				return err
+			}
+			m.aacConf = conf
+			m.audio = m.useStream(m.audio, audioPID, 0xC0, streamTypeAAC)
+			return nil
+		}
+		if m.aacConf == nil {
+			return fmt.Errorf("ts: AAC frame @%d before sequence header", f.Position)
+		}
+		es = append(m.aacConf.ADTSHeader(len(f.Body)-2), f.Body[2:]...)
+	case flv.AUDIO_CODEC_MP3, flv.AUDIO_CODEC_MP3_8KHZ:
+		m.audio = m.useStream(m.audio, audioPID, 0xC0, streamTypeMP3)
+		es = f.Body[1:]
+	default:
+		return fmt.Errorf("ts: %s audio can not be carried in MPEG-TS", f.CodecId)
+	}
+	return m.writePES(m.audio, f.Dts, 0, false, es)
+}
+
+func putTimestamp(b []byte, prefix byte, ts uint64) {
+	b[0] = prefix<<4 | byte(ts>>29)&0x0E | 1
+	b[1] = byte(ts >> 22)
+	b[2] = byte(ts>>14) | 1
+	b[3] = byte(ts >> 7)
+	b[4] = byte(ts<<1) | 1
+}
+
+// writePES writes es as a PES packet of stream s, preceded by PAT/PMT and
+// a PCR when they are due.
+func (m *Muxer) writePES(s *stream, dts uint32, cts int32, key bool, es []byte) error {
+	var buf bytes.Buffer
+	if !m.tablesWritten || s == m.video && key || dts >= m.tablesDts+tableInterval {
+		m.writeTables(&buf, dts)
+	}
+
+	pcr := int64(-1)
+	pcrStream := m.pcrStream()
+	if !m.pcrWritten || dts >= m.pcrDts+pcrInterval || s == pcrStream && key {
+		// a keyframe may come after audio with later timestamps, the PCR
+		// must not go back, even in the next writer
+		if !m.pcrStarted || dts > m.pcrDts {
+			m.pcrDts = dts
+		}
+		m.pcrWritten, m.pcrStarted = true, true
+		pcr = int64(m.pcrDts)*90 + timestampOffset - pcrDelay
+		if s != pcrStream {
+			m.packetize(&buf, pcrStream, nil, pcr, false)
+			pcr = -1
+		}
+	}
+
+	dts90 := (uint64(dts)*90 + timestampOffset) & (1<<33 - 1)
+	pts90 := uint64(int64(dts)*90+int64(cts)*90+timestampOffset) & (1<<33 - 1)
+	header := []byte{0, 0, 1, s.streamId, 0, 0, 0x84, 0x80, 5} // data_alignment_indicator
+	if pts90 != dts90 {
+		header[7], header[8] = 0xC0, 10
+		header = append(header, make([]byte, 10)...)
+		putTimestamp(header[9:], 0x3, pts90)
+		putTimestamp(header[14:], 0x1, dts90)
+	} else {
+		header = append(header, make([]byte, 5)...)
+		putTimestamp(header[9:], 0x2, pts90)
+	}
+	// the length may be left 0 only for video
+	if n := len(header) - 6 + len(es); n <= 0xFFFF {
+		header[4], header[5] = byte(n>>8), byte(n)
+	}
+
+	m.packetize(&buf, s, append(header, es...), pcr, key)
+	_, err := m.w.Write(buf.Bytes())
+	return err
+}
+
+func (m *Muxer) writeTables(buf *bytes.Buffer, dts uint32) {
+	m.tablesWritten, m.tablesDts = true, dts
+	for _, t := range []struct {
+		pid uint16
+		cc  *byte
+		psi []byte
+	}{{patPID, &m.patCC, m.pat()}, {pmtPID, &m.pmtCC, m.pmt()}} {
+		buf.Write([]byte{0x47, 0x40 | byte(t.pid>>8), byte(t.pid), 0x10 | *t.cc})
+		*t.cc = (*t.cc + 1) & 0x0F
+		buf.Write(t.psi)
+		buf.Write(bytes.Repeat([]byte{0xFF}, packetSize-4-len(t.psi)))
+	}
+}
+
+// packetize splits a PES packet into transport packets. The first one
+// carries the PCR unless pcr is negative; without data a single packet
+// with only the PCR is written.
+func (m *Muxer) packetize(buf *bytes.Buffer, s *stream, data []byte, pcr int64, randomAccess bool) {
+	first := true
+	for first || len(data) > 0 {
+		var af []byte
+		hasAF := false
+		if first && (pcr >= 0 || randomAccess) {
+			hasAF = true
+			flags := byte(0)
+			if randomAccess {
+				flags |= 0x40
+			}
+			af = append(af, flags)
+			if pcr >= 0 {
+				base := uint64(pcr) & (1<<33 - 1)
+				af[0] |= 0x10
+				af = append(af, byte(base>>25), byte(base>>17), byte(base>>9), byte(base>>1), byte(base<<7)|0x7E, 0)
+			}
+		}
+
+		space := packetSize - 4
+		if hasAF {
+			space -= 1 + len(af)
+		}
+		if len(data) < space {
+			stuff := space - len(data)
+			if !hasAF {
+				hasAF = true
+				stuff--
+				if stuff > 0 {
+					af = append(af, 0)
+					stuff--
+				}
+			}
+			af = append(af, bytes.Repeat([]byte{0xFF}, stuff)...)
+			space = len(data)
+		}
+
+		control := byte(0x10)
+		pusi := byte(0)
+		if first && data != nil {
+			pusi = 0x40
+		}
+		switch {
+		case hasAF && len(data) == 0:
+			control = 0x20
+		case hasAF:
+			control = 0x30
+		}
+		buf.Write([]byte{0x47, pusi | byte(s.pid>>8), byte(s.pid), control | s.cc})
+		if hasAF {
+			buf.WriteByte(byte(len(af)))
+			buf.Write(af)
+		}
+		if len(data) > 0 {
+			buf.Write(data[:space])
+			data = data[space:]
+			s.cc = (s.cc + 1) & 0x0F
+		}
+		first = false
+	}
+}
+
+// Remux converts an FLV file into a transport stream written to w.
+func Remux(in *flv.FlvReader, w io.Writer) error {
+	if _, err := in.ReadHeader(); err != nil {
+		return err
+	}
+	m := NewMuxer(w)
+	for {
+		fr, rerr := in.ReadFrame()
+		if rerr != nil {
+			return rerr
+		}
+		if fr == nil {
+			return nil
+		}
+		if err := m.WriteFrame(fr); err != nil {
+			return err
+		}
+	}
+}
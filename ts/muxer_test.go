@@ -0,0 +1,185 @@
+package ts
+
+import (
+	"bytes"
+	"github.com/metachord/flv.go/flv"
+	"github.com/metachord/flv.go/internal/flvtest"
+	"testing"
+)
+
+type testPES struct {
+	pid      uint16
+	pts, dts uint64
+	data     []byte
+}
+
+// parsePackets checks the packet structure and reassembles the PES packets
+// and PSI sections.
+func parsePackets(t *testing.T, data []byte) (pes []testPES, sections map[uint16][]byte, pcrs int) {
+	if len(data)%packetSize != 0 {
+		t.Fatalf("output of %d bytes is not made of packets", len(data))
+	}
+	sections = map[uint16][]byte{}
+	cc := map[uint16]byte{}
+	current := map[uint16]*testPES{}
+	for ; len(data) > 0; data = data[packetSize:] {
+		p := data[:packetSize]
+		if p[0] != 0x47 {
+			t.Fatalf("bad sync byte %#x", p[0])
+		}
+		pid := uint16(p[1]&0x1F)<<8 | uint16(p[2])
+		pusi := p[1]&0x40 != 0
+		payload := p[4:]
+		if p[3]&0x20 != 0 {
+			if payload[0] > 0 && payload[1]&0x10 != 0 {
+				pcrs++
+			}
+			payload = payload[1+int(payload[0]):]
+		}
+		if p[3]&0x10 == 0 {
+			continue
+		}
+		if last, ok := cc[pid]; ok && p[3]&0x0F != (last+1)&0x0F {
+			t.Errorf("continuity counter of pid %#x jumps from %d to %d", pid, last, p[3]&0x0F)
+		}
+		cc[pid] = p[3] & 0x0F
+
+		if pid == patPID || pid == pmtPID {
+			n := int(payload[2]&0x0F)<<8 | int(payload[3])
+			sections[pid] = payload[1 : 4+n]
+			continue
+		}
+		if pusi {
+			if !bytes.Equal(payload[:3], []byte{0, 0, 1}) {
+				t.Fatalf("PES start code missing")
+			}
+			pes = append(pes, testPES{pid: pid})
+			cur := &pes[len(pes)-1]
+			current[pid] = cur
+			cur.pts = uint64(readTimestamp(payload[9:]))
+			cur.dts = cur.pts
+			if payload[7]&0x40 != 0 {
+				cur.dts = uint64(readTimestamp(payload[14:]))
+			}
+			payload = payload[9+int(payload[8]):]
+		}
+		if cur := current[pid]; cur != nil {
+			cur.data = append(cur.data, payload...)
+		}
+	}
+	return
+}
+
+func TestMuxer(t *testing.T) {
+	var out bytes.Buffer
+	m := NewMuxer(&out)
+	for _, fr := range flvtest.Frames(2000) {
+		if err := m.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pes, sections, pcrs := parsePackets(t, out.Bytes())
+
+	pmt := sections[pmtPID]
+	if sections[patPID] == nil || pmt == nil {
+		t.Fatalf("expect PAT and PMT")
+	}
+	for pid, s := range sections {
+		if crc32(s) != 0 {
+			t.Errorf("bad CRC of section on pid %#x", pid)
+		}
+	}
+	if pcrPID := uint16(pmt[8]&0x1F)<<8 | uint16(pmt[9]); pcrPID != videoPID {
+		t.Errorf("expect PCR on video pid got %#x", pcrPID)
+	}
+	if !bytes.Equal(pmt[12:22], []byte{streamTypeAVC, 0xE1, 0x00, 0xF0, 0x00, streamTypeAAC, 0xE1, 0x01, 0xF0, 0x00}) {
+		t.Errorf("unexpected PMT streams % x", pmt[12:22])
+	}
+	if pcrs < 2000/pcrInterval {
+		t.Errorf("expect a PCR every %dms, got %d", pcrInterval, pcrs)
+	}
+
+	var video, audio []testPES
+	for _, p := range pes {
+		if p.pid == videoPID {
+			video = append(video, p)
+		} else {
+			audio = append(audio, p)
+		}
+	}
+	if len(video) != 50 || len(audio) != 100 {
+		t.Fatalf("expect 50 video and 100 audio PES got %d and %d", len(video), len(audio))
+	}
+	idr := []byte{0, 0, 0, 1, 9, 0xF0, 0, 0, 0, 1, 0x67, 0x42, 0, 0, 0, 1, 0x68, 0xCE, 0, 0, 0, 1, 0x65, 0}
+	if !bytes.Equal(video[0].data, idr) {
+		t.Errorf("expect AUD, SPS, PPS and IDR got % x", video[0].data)
+	}
+	if !bytes.Equal(video[1].data, []byte{0, 0, 0, 1, 9, 0xF0, 0, 0, 0, 1, 0x41, 1}) {
+		t.Errorf("expect AUD and slice got % x", video[1].data)
+	}
+	if video[1].dts != timestampOffset+40*90 || video[1].pts != timestampOffset+80*90 {
+		t.Errorf("unexpected PTS %d DTS %d", video[1].pts, video[1].dts)
+	}
+	if !bytes.Equal(audio[1].data, append((&flv.AudioSpecificConfig{ObjectType: 2, SamplingFrequencyIndex: 4, ChannelConfiguration: 2}).ADTSHeader(2), 0x21, 1)) {
+		t.Errorf("unexpected ADTS frame % x", audio[1].data)
+	}
+}
+
+func TestMuxerPCRMonotonic(t *testing.T) {
+	frames := []flv.Frame{
+		flvtest.Video(0, true, flv.VIDEO_AVC_SEQUENCE_HEADER, 0, flvtest.AVCConf),
+		flvtest.Audio(0, flv.AUDIO_AAC_SEQUENCE_HEADER, []byte{0x12, 0x10}),
+		flvtest.Video(0, true, flv.VIDEO_AVC_NALU, 0, []byte{0, 0, 0, 2, 0x65, 0}),
+	}
+	// audio interleaved ahead of the next keyframe
+	for ms := uint32(0); ms <= 1100; ms += 20 {
+		frames = append(frames, flvtest.Audio(ms, flv.AUDIO_AAC_RAW, []byte{0x21, byte(ms / 20)}))
+	}
+	key := flvtest.Video(1000, true, flv.VIDEO_AVC_NALU, 0, []byte{0, 0, 0, 2, 0x65, 1})
+
+	// the keyframe may also start the output of a new writer
+	for _, newWriter := range []bool{false, true} {
+		var out bytes.Buffer
+		m := NewMuxer(&out)
+		for _, fr := range frames {
+			if err := m.WriteFrame(fr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if newWriter {
+			m.SetWriter(&out)
+		}
+		if err := m.WriteFrame(key); err != nil {
+			t.Fatal(err)
+		}
+		last := uint64(0)
+		for data := out.Bytes(); len(data) >= packetSize; data = data[packetSize:] {
+			p := data[:packetSize]
+			if p[3]&0x20 == 0 || p[4] == 0 || p[5]&0x10 == 0 {
+				continue
+			}
+			pcr := uint64(p[6])<<25 | uint64(p[7])<<17 | uint64(p[8])<<9 | uint64(p[9])<<1 | uint64(p[10]>>7)
+			if pcr < last {
+				t.Errorf("PCR goes back from %d to %d, new writer %v", last, pcr, newWriter)
+			}
+			last = pcr
+		}
+	}
+}
+
+func TestMuxerUnsupported(t *testing.T) {
+	screen := flv.VideoFrame{
+		CFrame:  &flv.CFrame{Type: flv.TAG_TYPE_VIDEO, Flavor: flv.KEYFRAME, Body: []byte{0x13, 0x01}},
+		CodecId: flv.VIDEO_CODEC_SCREENVIDEO,
+	}
+	if err := NewMuxer(&bytes.Buffer{}).WriteFrame(screen); err == nil {
+		t.Errorf("expect an error for screen video")
+	}
+	hevc := flv.NewExVideoFrame(0, flv.VIDEO_FRAME_TYPE_KEYFRAME, flv.VIDEO_PACKET_TYPE_CODED_FRAMES_X, flv.FOURCC_HEVC, 0, []byte{0, 0, 0, 1, 0x26})
+	opus := flv.NewExAudioFrame(0, flv.AUDIO_PACKET_TYPE_CODED_FRAMES, flv.FOURCC_OPUS, []byte{0xFC})
+	for _, fr := range []flv.Frame{hevc, opus} {
+		if err := NewMuxer(&bytes.Buffer{}).WriteFrame(fr); err == nil {
+			t.Errorf("expect an error for %s", fr)
+		}
+	}
+}
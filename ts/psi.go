@@ -0,0 +1,64 @@
+package ts
+
+var crcTable = func() (table [256]uint32) {
+	for i := range table {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04C11DB7
+			} else {
+				c <<= 1
+			}
+		}
+		table[i] = c
+	}
+	return
+}()
+
+// crc32 is the CRC of MPEG-2 PSI sections (ISO/IEC 13818-1 Annex B).
+func crc32(data []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range data {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// section completes a PSI section: section_length is patched in and the
+// CRC appended. The pointer_field precedes the section.
+func section(body []byte) []byte {
+	n := len(body) - 3 + 4
+	body[1] = body[1]&0xF0 | byte(n>>8)&0x0F
+	body[2] = byte(n)
+	crc := crc32(body)
+	return append(append([]byte{0}, body...), byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+func (m *Muxer) pat() []byte {
+	return section([]byte{
+		0x00,       // table_id
+		0xB0, 0x00, // section_syntax_indicator, section_length
+		0x00, 0x01, // transport_stream_id
+		0xC1,       // version 0, current_next_indicator
+		0x00, 0x00, // section_number, last_section_number
+		0x00, programNumber,
+		0xE0 | pmtPID>>8, pmtPID & 0xFF,
+	})
+}
+
+func (m *Muxer) pmt() []byte {
+	pcr := m.pcrPID()
+	body := []byte{
+		0x02, // table_id
+		0xB0, 0x00,
+		0x00, programNumber,
+		0xC1 | (m.version&0x1F)<<1,
+		0x00, 0x00,
+		0xE0 | byte(pcr>>8), byte(pcr),
+		0xF0, 0x00, // program_info_length
+	}
+	for _, s := range m.streams() {
+		body = append(body, s.streamType, 0xE0|byte(s.pid>>8), byte(s.pid), 0xF0, 0x00)
+	}
+	return section(body)
+}